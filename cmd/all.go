@@ -1,14 +1,15 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/containerd"
 	"github.com/wapsol/m2deploy/pkg/payload"
-	"github.com/wapsol/m2deploy/pkg/prereq"
 )
 
 var (
@@ -75,7 +76,7 @@ func runAll(cmd *cobra.Command, args []string) error {
 	logger.Info("Using workspace: %s", workDir)
 
 	// Always check prerequisites first (fail-fast)
-	checker := prereq.NewChecker(logger)
+	checker := newChecker(logger)
 	checker.CheckAllPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
 
 	// If --check flag is set, print results and exit
@@ -189,13 +190,14 @@ func runAll(cmd *cobra.Command, args []string) error {
 	logger.Info("Verifying images in k0s containerd...")
 	for _, component := range components {
 		imageName := cfg.GetLocalImageName(component)
-		exists, err := dockerClient.VerifyImageInK0s(component)
-		if err != nil {
+		err := dockerClient.VerifyImageInK0s(component)
+		var verifyErr *containerd.VerifyError
+		if errors.As(err, &verifyErr) {
+			return fmt.Errorf("%v in k0s containerd", verifyErr)
+		} else if err != nil {
 			logger.Warning("Failed to verify %s: %v", imageName, err)
-		} else if exists {
-			logger.Success("✓ %s available in k0s containerd", imageName)
 		} else {
-			return fmt.Errorf("%s not found in k0s containerd", imageName)
+			logger.Success("✓ %s available in k0s containerd", imageName)
 		}
 	}
 
@@ -229,8 +231,8 @@ func runAll(cmd *cobra.Command, args []string) error {
 	logger.Info("")
 	logger.Info("Useful commands:")
 	logger.Info("  - List images: sudo k0s ctr images list | grep magnetiq")
-	logger.Info("  - Check pods: sudo k0s kubectl -n %s get pods", viper.GetString("namespace"))
-	logger.Info("  - Check services: sudo k0s kubectl -n %s get svc", viper.GetString("namespace"))
+	logger.Info("  - Check pods: %s -n %s get pods", k8sClient.Kubectl, viper.GetString("namespace"))
+	logger.Info("  - Check services: %s -n %s get svc", k8sClient.Kubectl, viper.GetString("namespace"))
 	logger.Info("")
 	logger.Info("Run 'm2deploy verify' for detailed deployment health status")
 
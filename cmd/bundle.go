@@ -0,0 +1,381 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wapsol/m2deploy/pkg/bundle"
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/distribution"
+	"github.com/wapsol/m2deploy/pkg/payload"
+	"github.com/wapsol/m2deploy/pkg/prereq"
+	"github.com/wapsol/m2deploy/pkg/registry"
+)
+
+var (
+	bundleOutput      string
+	bundleSigningKey  string
+	bundleVerifyKey   string
+	bundleImportLocal bool
+	bundleValidate    bool
+	bundleWait        bool
+	bundleKeyOutput   string
+)
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Offline deployment bundles",
+	Long: `Create and install signed deployment bundles for sites without network access.
+
+A bundle is a single archive holding both component images, the Kubernetes
+manifests, a descriptor of the payload and a SHA-256 checksum manifest signed
+with an ed25519 key. Installing a bundle needs neither a Docker daemon nor a
+git checkout on the controller.`,
+}
+
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a signed bundle from the built images and manifests",
+	Long: `Export the built backend and frontend images from the Docker daemon and package
+them with the workspace's k8s manifests into a signed bundle.`,
+	Example: `  m2deploy bundle create --workspace-path /tmp/wapsol/magnetiq2 --signing-key bundle.key
+  m2deploy bundle create --repo-url https://github.com/wapsol/magnetiq2 --signing-key bundle.key --output site-a.tar.gz`,
+	RunE: runBundleCreate,
+}
+
+var bundleInstallCmd = &cobra.Command{
+	Use:   "install <file>",
+	Short: "Verify a bundle, distribute its images and deploy",
+	Long: `Verify the bundle's signature and checksums, distribute its images to the worker
+nodes and apply its manifests. The namespace recorded in the bundle is used
+unless --namespace is given.
+
+Images are distributed from the bundle's tarballs with --distribution ssh or
+daemonset; registry distribution needs a Docker daemon and is not supported.`,
+	Example: `  m2deploy bundle install m2deploy-bundle-latest.tar.gz --verify-key bundle.pub
+  m2deploy bundle install site-a.tar.gz --verify-key bundle.pub --import-local --wait`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBundleInstall,
+}
+
+var bundleKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a bundle signing key pair",
+	Long: `Generate an ed25519 key pair for signing bundles. The private key is written to
+--output and the public key to --output with a .pub suffix.`,
+	Example: `  m2deploy bundle keygen --output bundle.key`,
+	RunE:    runBundleKeygen,
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+
+	// Create command
+	bundleCmd.AddCommand(bundleCreateCmd)
+	bundleCreateCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "Bundle file (default: m2deploy-bundle-<tag>.tar.gz)")
+	bundleCreateCmd.Flags().StringVar(&bundleSigningKey, "signing-key", "", "ed25519 private key (PEM) to sign the bundle with")
+	bundleCreateCmd.MarkFlagRequired("signing-key")
+
+	// Install command
+	bundleCmd.AddCommand(bundleInstallCmd)
+	bundleInstallCmd.Flags().StringVar(&bundleVerifyKey, "verify-key", "", "ed25519 public key (PEM) the bundle must be signed with")
+	bundleInstallCmd.Flags().BoolVar(&bundleImportLocal, "import-local", false, "Also import the images into the controller's k0s containerd")
+	bundleInstallCmd.Flags().BoolVar(&bundleValidate, "validate", false, "Validate manifests before applying")
+	bundleInstallCmd.Flags().BoolVar(&bundleWait, "wait", false, "Wait for deployments to be ready")
+	bundleInstallCmd.MarkFlagRequired("verify-key")
+
+	// Keygen command
+	bundleCmd.AddCommand(bundleKeygenCmd)
+	bundleKeygenCmd.Flags().StringVarP(&bundleKeyOutput, "output", "o", "m2deploy-bundle.key", "Private key file (public key gets a .pub suffix)")
+}
+
+func runBundleCreate(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	// Get workspace path (either from --workspace-path or derive from --repo-url)
+	var workDir string
+	if workspacePath := viper.GetString("workspace-path"); workspacePath != "" {
+		workDir = workspacePath
+	} else if repoURL := viper.GetString("repo-url"); repoURL != "" {
+		workDir = deriveWorkspaceFromRepoURL(repoURL)
+	} else {
+		return fmt.Errorf("either --repo-url or --workspace-path is required")
+	}
+	logger.Info("Using workspace: %s", workDir)
+
+	// Check prerequisites (fail-fast)
+	checker := prereq.NewChecker(logger)
+	checker.CheckDocker(viper.GetBool("use-sudo"))
+	checker.CheckDiskSpace(os.TempDir(), 5)
+
+	if viper.GetBool("check") {
+		checker.PrintResults()
+		if checker.HasFailures() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if checker.HasFailures() {
+		checker.PrintResults()
+		return formatPrereqError("bundle create")
+	}
+
+	validator := payload.NewValidator(logger)
+	if err := validator.ValidateStructure(workDir); err != nil {
+		return fmt.Errorf("payload validation failed: %w", err)
+	}
+
+	signingKey, err := bundle.LoadPrivateKey(bundleSigningKey)
+	if err != nil {
+		return formatError("bundle create", err)
+	}
+
+	cfg := getConfig()
+	tag := cfg.LocalImageTag
+	if tag == "" {
+		tag = constants.DefaultTag
+	}
+	output := bundleOutput
+	if output == "" {
+		output = fmt.Sprintf("m2deploy-bundle-%s.tar.gz", tag)
+	}
+
+	desc := &bundle.Descriptor{
+		FormatVersion: bundle.FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Tag:           tag,
+		Namespace:     viper.GetString("namespace"),
+	}
+	if commit, err := newGitClient(logger).GetCurrentCommit(workDir); err == nil {
+		desc.Commit = commit
+	} else {
+		logger.Debug("Workspace commit unknown: %v", err)
+	}
+
+	tempDir, err := os.MkdirTemp("", "m2deploy-bundle-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Manifests are rendered for the bundle's namespace and images
+	images := make(map[string]string)
+	for _, component := range []string{constants.ComponentBackend, constants.ComponentFrontend} {
+		name := cfg.GetLocalImageName(component)
+		repository, _, _ := registry.SplitReference(name)
+		images[repository] = name
+	}
+	entries, err := bundle.RenderManifests(filepath.Join(workDir, "k8s"), filepath.Join(tempDir, bundle.ManifestDir), desc.Namespace, images)
+	if err != nil {
+		return err
+	}
+	logger.Info("Packaging %d manifests rendered for namespace %s", len(entries), desc.Namespace)
+
+	// Export each component image with its digest for verification on the workers
+	dockerClient := newDockerClient(logger)
+	for _, component := range []string{constants.ComponentBackend, constants.ComponentFrontend} {
+		imageName := cfg.GetLocalImageName(component)
+
+		digest, err := dockerClient.GetImageDigest(component)
+		if err != nil && !viper.GetBool("dry-run") {
+			return fmt.Errorf("failed to read %s image digest: %w\nMake sure you have built the images with 'build' command", component, err)
+		}
+
+		tarballPath := filepath.Join(tempDir, component+".tar")
+		logger.Info("Exporting %s from Docker daemon...", imageName)
+		if err := dockerClient.SaveImage(component, tarballPath); err != nil {
+			return fmt.Errorf("failed to save %s image: %w", component, err)
+		}
+
+		img := bundle.ImageInfo{
+			Component: component,
+			Name:      imageName,
+			Digest:    digest,
+			File:      fmt.Sprintf("%s/%s.tar", bundle.ImageDir, component),
+		}
+		if info, err := os.Stat(tarballPath); err == nil {
+			img.Size = info.Size()
+		}
+		desc.Images = append(desc.Images, img)
+		entries = append(entries, bundle.Entry{Name: img.File, Path: tarballPath})
+	}
+
+	if viper.GetBool("dry-run") {
+		logger.DryRun("Would write signed bundle %s (%d files)", output, len(entries)+1)
+		return nil
+	}
+
+	logger.Info("Writing bundle %s...", output)
+	if err := bundle.Create(output, desc, entries, signingKey); err != nil {
+		return formatError("bundle create", err)
+	}
+
+	info, err := os.Stat(output)
+	if err != nil {
+		return err
+	}
+	logger.Success("Created bundle %s (%.1f MB, tag %s)", output, float64(info.Size())/1024/1024, tag)
+	logger.Info("Install with: m2deploy bundle install %s --verify-key <public key>", filepath.Base(output))
+	return nil
+}
+
+func runBundleInstall(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	bundlePath := args[0]
+
+	if viper.GetString("distribution") == distribution.ModeRegistry {
+		return fmt.Errorf("bundle install does not support --distribution registry (it needs a Docker daemon); use ssh or daemonset")
+	}
+
+	verifyKey, err := bundle.LoadPublicKey(bundleVerifyKey)
+	if err != nil {
+		return formatError("bundle install", err)
+	}
+
+	// Verify and unpack before touching the cluster
+	extractDir, err := os.MkdirTemp("", "m2deploy-bundle-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(extractDir)
+
+	logger.Info("Verifying bundle %s...", bundlePath)
+	desc, err := bundle.Extract(bundlePath, extractDir, verifyKey)
+	if err != nil {
+		return formatError("bundle install", err)
+	}
+	logger.Success("Bundle signature and checksums verified")
+	logger.Info("  Tag: %s, created %s", desc.Tag, desc.CreatedAt.Format(time.RFC3339))
+	if desc.Commit != "" {
+		logger.Info("  Commit: %s", desc.Commit)
+	}
+	logger.Info("")
+
+	// The namespace recorded at bundle creation applies unless overridden;
+	// an override re-renders the manifests for it
+	manifestDir := extractDir
+	if !viper.IsSet("namespace") && desc.Namespace != "" {
+		viper.Set("namespace", desc.Namespace)
+	} else if namespace := viper.GetString("namespace"); namespace != desc.Namespace {
+		logger.Info("Rendering manifests for namespace %s (bundled for %s)", namespace, desc.Namespace)
+		manifestDir = filepath.Join(extractDir, "rendered")
+		_, err := bundle.RenderManifests(filepath.Join(extractDir, bundle.ManifestDir), filepath.Join(manifestDir, bundle.ManifestDir), namespace, nil)
+		if err != nil {
+			return formatError("bundle install", err)
+		}
+	}
+
+	checker := newChecker(logger)
+	checker.CheckDeployPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
+
+	var imageSize int64
+	for _, img := range desc.Images {
+		imageSize += img.Size
+	}
+	checkWorkers(logger, checker, imageSize)
+
+	if viper.GetBool("check") {
+		checker.PrintResults()
+		if checker.HasFailures() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if checker.HasFailures() {
+		checker.PrintResults()
+		return formatPrereqError("bundle install")
+	}
+
+	workloads := readWorkloads(logger, manifestDir)
+	images := make([]distribution.Image, 0, len(desc.Images))
+	for _, img := range desc.Images {
+		images = append(images, distribution.Image{
+			Component:   img.Component,
+			Name:        img.Name,
+			TarballPath: filepath.Join(extractDir, filepath.FromSlash(img.File)),
+			Digest:      img.Digest,
+			Placements:  distribution.PlacementsFor(workloads, img.Name),
+		})
+	}
+
+	// Controllers that also run workloads need the images in their own containerd
+	if bundleImportLocal {
+		dockerClient := newDockerClient(logger)
+		for _, img := range images {
+			logger.Info("Importing %s to k0s containerd...", img.Name)
+			if err := dockerClient.ImportToK0s(img.TarballPath); err != nil {
+				return err
+			}
+		}
+		logger.Info("")
+	}
+
+	k8sClient := newK8sClient(logger)
+	backend, err := newDistributionBackend(logger, k8sClient)
+	if err != nil {
+		return formatError("bundle install", err)
+	}
+
+	logger.Info("Step 1: Distributing images to worker nodes (%s)", backend.Name())
+	logger.Info("")
+
+	if err := backend.Prepare(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := backend.Cleanup(); err != nil {
+			logger.Warning("Failed to clean up %s distribution: %v", backend.Name(), err)
+		}
+	}()
+
+	if err := distributeImages(logger, backend, images, nil); err != nil {
+		return err
+	}
+	logger.Info("")
+
+	logger.Info("Step 2: Deploying to Kubernetes cluster")
+	if err := k8sClient.DeployWithOptions(manifestDir, bundleValidate, bundleWait); err != nil {
+		return err
+	}
+
+	logger.Success("Bundle %s installed", desc.Tag)
+	logger.Info("Deployment location: Kubernetes namespace '%s'", viper.GetString("namespace"))
+	return nil
+}
+
+func runBundleKeygen(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	publicPath := bundleKeyOutput + ".pub"
+	for _, path := range []string{bundleKeyOutput, publicPath} {
+		if _, err := os.Stat(path); err == nil && !viper.GetBool("force") {
+			return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+		}
+	}
+
+	privatePEM, publicPEM, err := bundle.GenerateKey()
+	if err != nil {
+		return formatError("bundle keygen", err)
+	}
+
+	if err := os.WriteFile(bundleKeyOutput, privatePEM, 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := os.WriteFile(publicPath, publicPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	logger.Success("Wrote signing key %s and public key %s", bundleKeyOutput, publicPath)
+	logger.Info("Keep the private key on the build host; ship the public key to the sites")
+	return nil
+}
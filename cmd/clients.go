@@ -1,14 +1,26 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/viper"
 	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/containerd"
 	"github.com/wapsol/m2deploy/pkg/database"
+	"github.com/wapsol/m2deploy/pkg/distribution"
 	"github.com/wapsol/m2deploy/pkg/docker"
 	"github.com/wapsol/m2deploy/pkg/git"
+	"github.com/wapsol/m2deploy/pkg/health"
+	"github.com/wapsol/m2deploy/pkg/inventory"
 	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/kubectl"
+	"github.com/wapsol/m2deploy/pkg/prereq"
+	"github.com/wapsol/m2deploy/pkg/registry"
+	"github.com/wapsol/m2deploy/pkg/ssh"
 )
 
 // Clients holds all service clients for the application
@@ -98,6 +110,9 @@ func newDockerClient(logger *config.Logger) *docker.Client {
 		useSudo,
 	)
 
+	client.Runtime = viper.GetString("runtime")
+	client.RuntimeSocket = viper.GetString("containerd-socket")
+
 	// External builder is ALWAYS enabled (required to prevent resource exhaustion)
 	client.EnableExternalBuilder()
 	logger.Debug("External builder mode enabled")
@@ -107,16 +122,31 @@ func newDockerClient(logger *config.Logger) *docker.Client {
 
 // newK8sClient creates a new Kubernetes client with configuration from viper
 func newK8sClient(logger *config.Logger) *k8s.Client {
-	useSudo := getUseSudoWithAutoDetect(logger)
 	return k8s.NewClient(
 		logger,
 		viper.GetBool("dry-run"),
 		viper.GetString("namespace"),
-		viper.GetString("kubeconfig"),
-		useSudo,
+		newKubectl(logger),
 	)
 }
 
+// newKubectl creates the kubectl executor for --kube-distribution, detecting
+// the distribution when it is auto (or invalid, with a warning)
+func newKubectl(logger *config.Logger) *kubectl.Executor {
+	useSudo := getUseSudoWithAutoDetect(logger)
+	distribution := viper.GetString("kube-distribution")
+	kubeconfig := viper.GetString("kubeconfig")
+	context := viper.GetString("kube-context")
+
+	executor, err := kubectl.New(distribution, kubeconfig, context, useSudo)
+	if err != nil {
+		logger.Warning("%v, detecting the distribution instead", err)
+		executor, _ = kubectl.New(kubectl.DistributionAuto, kubeconfig, context, useSudo)
+	}
+	logger.Debug("Using %s", executor)
+	return executor
+}
+
 // newGitClient creates a new Git client with configuration from viper
 func newGitClient(logger *config.Logger) *git.Client {
 	return git.NewClient(logger, viper.GetBool("dry-run"))
@@ -124,16 +154,217 @@ func newGitClient(logger *config.Logger) *git.Client {
 
 // newDBClient creates a new database client with configuration from viper
 func newDBClient(logger *config.Logger) *database.Client {
-	useSudo := getUseSudoWithAutoDetect(logger)
 	return database.NewClient(
 		logger,
 		viper.GetBool("dry-run"),
 		viper.GetString("namespace"),
-		viper.GetString("kubeconfig"),
-		useSudo,
+		newK8sClient(logger),
 	)
 }
 
+// newChecker creates a prerequisite checker for the selected Kubernetes distribution
+func newChecker(logger *config.Logger) *prereq.Checker {
+	checker := prereq.NewChecker(logger)
+	checker.K8s = newK8sClient(logger)
+	checker.Kubectl = checker.K8s.Kubectl
+	return checker
+}
+
+// newSSHDistributor creates an SSH image distributor with configuration from viper
+func newSSHDistributor(logger *config.Logger) (*ssh.Distributor, error) {
+	// Expand SSH key path (handle ~)
+	sshKeyPath, err := expandHome(viper.GetString("ssh-key"))
+	if err != nil {
+		return nil, err
+	}
+
+	sshConfig := &ssh.Config{
+		User:          viper.GetString("ssh-user"),
+		KeyPath:       sshKeyPath,
+		Port:          viper.GetInt("ssh-port"),
+		Timeout:       viper.GetInt("ssh-timeout"),
+		WorkerTempDir: viper.GetString("worker-temp-dir"),
+	}
+
+	distributor := ssh.NewDistributor(logger, sshConfig)
+	distributor.Parallel = viper.GetInt("parallel-workers")
+	distributor.WorkerParallel = viper.GetInt("parallel-per-worker")
+	distributor.RetryCount = viper.GetInt("retry-count")
+	distributor.MinWorkers = viper.GetInt("min-workers")
+	distributor.KeepTarballs = viper.GetBool("skip-worker-cleanup")
+	distributor.Compression = viper.GetString("transfer-compression")
+	distributor.DeltaLayers = viper.GetBool("delta-transfer")
+	distributor.ResumeTransfers = viper.GetBool("transfer-resume")
+	distributor.ChunkSize = int64(viper.GetInt("transfer-chunk-size")) * 1024 * 1024
+	distributor.ChunkParallel = viper.GetInt("transfer-streams")
+	distributor.FanOut = viper.GetBool("fan-out")
+	distributor.FanOutSeeds = viper.GetInt("fan-out-seeds")
+	distributor.SkipPresent = !viper.GetBool("force-distribute")
+	distributor.Runtime = viper.GetString("runtime")
+	distributor.Socket = viper.GetString("containerd-socket")
+	if err := ssh.ValidateCompression(distributor.Compression); err != nil {
+		return nil, err
+	}
+	if err := containerd.ValidateRuntime(distributor.Runtime); err != nil {
+		return nil, err
+	}
+
+	// Bandwidth limits for worker transfers
+	rateLimit, err := ssh.ParseRate(viper.GetString("transfer-rate-limit"))
+	if err != nil {
+		return nil, err
+	}
+	workerRateLimit, err := ssh.ParseRate(viper.GetString("transfer-rate-limit-per-worker"))
+	if err != nil {
+		return nil, err
+	}
+	distributor.RateLimit = rateLimit
+	distributor.WorkerRateLimit = workerRateLimit
+
+	// Parse manual worker IPs if provided
+	workersFlag := viper.GetString("workers")
+	if workersFlag != "" {
+		distributor.WorkerIPs = strings.Split(workersFlag, ",")
+		for i := range distributor.WorkerIPs {
+			distributor.WorkerIPs[i] = strings.TrimSpace(distributor.WorkerIPs[i])
+		}
+	}
+
+	// Restrict discovered workers by label
+	selector, err := k8s.ParseSelector(viper.GetString("node-selector"))
+	if err != nil {
+		return nil, err
+	}
+	distributor.NodeSelector = selector
+
+	// Per-host settings from the worker inventory
+	if path := viper.GetString("inventory"); path != "" {
+		inv, err := inventory.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		distributor.Inventory = inv
+	}
+
+	return distributor, nil
+}
+
+// newDistributionBackend creates the image distribution backend selected with --distribution
+func newDistributionBackend(logger *config.Logger, k8sClient *k8s.Client) (distribution.Backend, error) {
+	mode := viper.GetString("distribution")
+	if err := distribution.ValidateMode(mode); err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case distribution.ModeRegistry:
+		registryClient, err := newRegistryClient(logger)
+		if err != nil {
+			return nil, err
+		}
+		backend := distribution.NewRegistryBackend(logger, newDockerClient(logger), k8sClient, registryClient, viper.GetBool("dry-run"))
+		backend.RunLocal = viper.GetBool("registry-local")
+		return backend, nil
+	case distribution.ModeDaemonSet:
+		selector, err := k8s.ParseSelector(viper.GetString("node-selector"))
+		if err != nil {
+			return nil, err
+		}
+		backend := distribution.NewDaemonSetBackend(logger, k8sClient, viper.GetBool("dry-run"))
+		backend.NodeSelector = selector
+		backend.LoaderImage = viper.GetString("loader-image")
+		backend.Socket = viper.GetString("containerd-socket")
+		backend.Parallel = viper.GetInt("parallel-workers")
+		backend.MinNodes = viper.GetInt("min-workers")
+		backend.SkipPresent = !viper.GetBool("force-distribute")
+		return backend, nil
+	default:
+		distributor, err := newSSHDistributor(logger)
+		if err != nil {
+			return nil, err
+		}
+		backend := distribution.NewSSHBackend(logger, k8sClient, distributor)
+		backend.Cordon = viper.GetBool("quarantine-cordon")
+		if !viper.GetBool("dry-run") {
+			if backend.Health, err = newHealthStore(); err != nil {
+				return nil, err
+			}
+		}
+		return backend, nil
+	}
+}
+
+// newHealthStore loads the worker health file, or returns nil if tracking is disabled
+func newHealthStore() (*health.Store, error) {
+	path, err := expandHome(viper.GetString("worker-health-file"))
+	if err != nil || path == "" {
+		return nil, err
+	}
+	return health.Load(path, viper.GetInt("quarantine-after"))
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, path[1:]), nil
+}
+
+// newRegistryClient creates a registry API client with configuration from viper
+func newRegistryClient(logger *config.Logger) (*registry.Client, error) {
+	address := viper.GetString("registry")
+	if address == "" {
+		return nil, fmt.Errorf("--registry is required (host:port reachable from the cluster nodes)")
+	}
+
+	password, err := getRegistryPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	return registry.NewClient(
+		logger,
+		address,
+		viper.GetString("registry-username"),
+		password,
+		viper.GetBool("registry-insecure"),
+	), nil
+}
+
+// Registry password read from stdin, cached as stdin can be read only once
+var cachedRegistryPassword *string
+
+// getRegistryPassword returns the registry password from stdin with
+// --registry-password-stdin, otherwise from --registry-password or the
+// M2DEPLOY_REGISTRY_PASSWORD environment variable
+func getRegistryPassword() (string, error) {
+	if !viper.GetBool("registry-password-stdin") {
+		return viper.GetString("registry-password"), nil
+	}
+	if cachedRegistryPassword != nil {
+		return *cachedRegistryPassword, nil
+	}
+	if rootCmd.PersistentFlags().Changed("registry-password") {
+		return "", fmt.Errorf("--registry-password and --registry-password-stdin are mutually exclusive")
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read registry password from stdin: %w", err)
+	}
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("--registry-password-stdin: no password on stdin")
+	}
+	cachedRegistryPassword = &password
+	return password, nil
+}
+
 // Cached useSudo value to avoid recalculating
 var cachedUseSudo *bool
 var cachedUseSudoLogged bool
@@ -5,7 +5,6 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"github.com/wapsol/m2deploy/pkg/prereq"
 )
 
 var (
@@ -82,7 +81,7 @@ func runDBBackup(cmd *cobra.Command, args []string) error {
 	defer logger.Close()
 
 	// Always check prerequisites first (fail-fast)
-	checker := prereq.NewChecker(logger)
+	checker := newChecker(logger)
 	checker.CheckDBPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
 
 	// If --check flag is set, print results and exit
@@ -120,7 +119,7 @@ func runDBRestore(cmd *cobra.Command, args []string) error {
 
 	// Check prerequisites if --check flag is set
 	if viper.GetBool("check") {
-		checker := prereq.NewChecker(logger)
+		checker := newChecker(logger)
 		checker.CheckDBPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
 		checker.PrintResults()
 		if checker.HasFailures() {
@@ -143,7 +142,7 @@ func runDBMigrate(cmd *cobra.Command, args []string) error {
 
 	// Check prerequisites if --check flag is set
 	if viper.GetBool("check") {
-		checker := prereq.NewChecker(logger)
+		checker := newChecker(logger)
 		checker.CheckDBPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
 		checker.PrintResults()
 		if checker.HasFailures() {
@@ -163,7 +162,7 @@ func runDBStatus(cmd *cobra.Command, args []string) error {
 
 	// Check prerequisites if --check flag is set
 	if viper.GetBool("check") {
-		checker := prereq.NewChecker(logger)
+		checker := newChecker(logger)
 		checker.CheckDBPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
 		checker.PrintResults()
 		if checker.HasFailures() {
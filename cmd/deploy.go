@@ -4,28 +4,35 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/wapsol/m2deploy/pkg/config"
 	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/distribution"
+	"github.com/wapsol/m2deploy/pkg/k8s"
 	"github.com/wapsol/m2deploy/pkg/payload"
 	"github.com/wapsol/m2deploy/pkg/prereq"
-	"github.com/wapsol/m2deploy/pkg/ssh"
+	"github.com/wapsol/m2deploy/pkg/target"
 )
 
 var (
-	deployValidate  bool
-	deployWait      bool
+	deployValidate   bool
+	deployWait       bool
 	deploySkipImport bool
+	deployWorkersGC  bool
+	deployGCKeep     int
 )
 
 var deployCmd = &cobra.Command{
 	Use:   "deploy",
 	Short: "Deploy Magnetiq2 to Kubernetes",
 	Long: `Deploy the Magnetiq2 application to the Kubernetes cluster.
-Automatically imports Docker images to k0s containerd before deploying.
-Applies manifests in the correct order.
+Automatically distributes Docker images to the worker nodes before deploying.
+Workers that already hold the exact image digest are skipped, and when every
+worker has an image it is not exported at all (use --force-distribute to send
+anyway). Applies manifests in the correct order.
 
 Workspace can be specified in two ways:
 1. --repo-url: Auto-derive workspace from repository URL (e.g., /tmp/wapsol/magnetiq2)
@@ -37,8 +44,7 @@ Workspace can be specified in two ways:
   m2deploy deploy --workspace-path /tmp/wapsol/magnetiq2
 
   # With additional options
-  m2deploy deploy --workspace-path /tmp/wapsol/magnetiq2 --validate --wait
-  m2deploy deploy --workspace-path /tmp/wapsol/magnetiq2 --skip-import`,
+  m2deploy deploy --workspace-path /tmp/wapsol/magnetiq2 --validate --wait`,
 	RunE: runDeploy,
 }
 
@@ -47,7 +53,10 @@ func init() {
 
 	deployCmd.Flags().BoolVar(&deployValidate, "validate", false, "Validate manifests before applying")
 	deployCmd.Flags().BoolVar(&deployWait, "wait", false, "Wait for deployments to be ready")
-	deployCmd.Flags().BoolVar(&deploySkipImport, "skip-import", false, "Skip importing Docker images to k0s (images must already be in k0s)")
+	deployCmd.Flags().BoolVar(&deploySkipImport, "skip-import", false, "Skip image distribution and verification entirely")
+	deployCmd.Flags().BoolVar(&deployWorkersGC, "workers-gc", false, "Remove old application images from the workers after a successful deploy (ssh distribution)")
+	deployCmd.Flags().IntVar(&deployGCKeep, "workers-gc-keep", constants.DefaultWorkerGCKeep, "Newest images per component kept by --workers-gc in addition to those in use")
+	deployCmd.Flags().MarkDeprecated("skip-import", "workers that already hold the image are now skipped automatically")
 }
 
 func runDeploy(cmd *cobra.Command, args []string) error {
@@ -72,9 +81,21 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("either --repo-url or --workspace-path is required\nUse --workspace-path to specify workspace directly, or --repo-url to auto-derive it")
 	}
 
+	// Several clusters from the targets file
+	targets, err := selectTargets()
+	if err != nil {
+		return formatError("deploy", err)
+	}
+	if targets != nil {
+		return runDeployTargets(logger, workDir, targets)
+	}
+
 	// Always check prerequisites first (fail-fast)
-	checker := prereq.NewChecker(logger)
+	checker := newChecker(logger)
 	checker.CheckDeployPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
+	if !deploySkipImport {
+		checkWorkers(logger, checker, localImageSize(logger))
+	}
 
 	// If --check flag is set, print results and exit
 	if viper.GetBool("check") {
@@ -98,129 +119,139 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("payload validation failed: %w", err)
 	}
 
-	// Distribute Docker images to worker nodes via SSH (unless skipped)
+	// Manifests are applied through the same client the backend may redirect images on
+	k8sClient := newK8sClient(logger)
+	var backend distribution.Backend
+	var images []distribution.Image
 	if !deploySkipImport {
-		logger.Info("Step 1: Distributing images to worker nodes via SSH")
-		logger.Info("")
-
-		// Expand SSH key path (handle ~)
-		sshKeyPath := viper.GetString("ssh-key")
-		if strings.HasPrefix(sshKeyPath, "~") {
-			homeDir, err := os.UserHomeDir()
-			if err != nil {
-				return fmt.Errorf("failed to get home directory: %w", err)
-			}
-			sshKeyPath = filepath.Join(homeDir, sshKeyPath[1:])
+		if backend, err = newDistributionBackend(logger, k8sClient); err != nil {
+			return formatError("deploy", err)
 		}
-
-		// Create SSH configuration
-		sshConfig := &ssh.Config{
-			User:          viper.GetString("ssh-user"),
-			KeyPath:       sshKeyPath,
-			Port:          viper.GetInt("ssh-port"),
-			Timeout:       viper.GetInt("ssh-timeout"),
-			WorkerTempDir: viper.GetString("worker-temp-dir"),
+		if images, err = componentImages(logger, workDir); err != nil {
+			return err
 		}
+	}
 
-		// Create distributor
-		distributor := ssh.NewDistributor(logger, sshConfig)
-		distributor.Parallel = viper.GetInt("parallel-workers")
-		distributor.RetryCount = viper.GetInt("retry-count")
-		distributor.MinWorkers = viper.GetInt("min-workers")
-		distributor.KeepTarballs = viper.GetBool("skip-worker-cleanup")
-
-		// Parse manual worker IPs if provided
-		workersFlag := viper.GetString("workers")
-		if workersFlag != "" {
-			distributor.WorkerIPs = strings.Split(workersFlag, ",")
-			for i := range distributor.WorkerIPs {
-				distributor.WorkerIPs[i] = strings.TrimSpace(distributor.WorkerIPs[i])
-			}
-		}
+	exports := newImageExports(logger, deploySave(logger))
+	defer exports.Remove()
+	if err := deployCluster(logger, workDir, k8sClient, backend, images, exports); err != nil {
+		return err
+	}
 
-		// Get worker nodes (either from k8s API or manual list)
-		k8sClient := newK8sClient(logger)
-		workers, err := distributor.GetWorkerNodes(k8sClient)
-		if err != nil {
-			return fmt.Errorf("failed to get worker nodes: %w", err)
-		}
+	logger.Info("")
+	logger.Info("Deployment location: Kubernetes namespace '%s'", viper.GetString("namespace"))
+	logger.Info("Check pods: %s -n %s get pods", k8sClient.Kubectl, viper.GetString("namespace"))
+	logger.Info("Check services: %s -n %s get svc", k8sClient.Kubectl, viper.GetString("namespace"))
+	logger.Info("")
+	if !deployWait {
+		logger.Info("Run 'm2deploy verify' for detailed deployment health status")
+	}
 
-		logger.Info("Found %d worker nodes", len(workers))
-		for _, w := range workers {
-			logger.Info("  - %s (%s)", w.Name, w.IP)
-		}
-		logger.Info("")
+	return nil
+}
 
-		// Test SSH connectivity
-		logger.Info("Testing SSH connectivity to all workers...")
-		if err := distributor.TestConnectivity(workers); err != nil {
-			return fmt.Errorf("SSH connectivity test failed: %w", err)
+// runDeployTargets deploys the workspace to every selected cluster. The
+// prerequisites of all clusters are checked first, so a missing tool fails
+// the deploy before any cluster changes.
+func runDeployTargets(logger *config.Logger, workDir string, targets []target.Target) error {
+	var imageSize int64
+	if !deploySkipImport {
+		imageSize = localImageSize(logger)
+	}
+	err := checkTargets(logger, "deploy", targets, func(checker *prereq.Checker) {
+		checker.CheckDeployPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
+		if !deploySkipImport {
+			checkWorkers(checker.Logger, checker, imageSize)
 		}
-		logger.Success("All workers reachable via SSH")
-		logger.Info("")
+	})
+	if err != nil {
+		return err
+	}
 
-		// Distribute each component
-		dockerClient := newDockerClient(logger)
-		cfg := getConfig()
-		components := []string{constants.ComponentBackend, constants.ComponentFrontend}
+	validator := payload.NewValidator(logger)
+	if err := validator.ValidateStructure(workDir); err != nil {
+		return fmt.Errorf("payload validation failed: %w", err)
+	}
 
-		for _, component := range components {
-			imageName := cfg.GetLocalImageName(component)
-			tarballPath := fmt.Sprintf(constants.TarballPathTemplate, component)
+	clusters, err := newClusters(logger, targets, !deploySkipImport)
+	if err != nil {
+		return formatError("deploy", err)
+	}
+	var images []distribution.Image
+	if !deploySkipImport {
+		if images, err = componentImages(logger, workDir); err != nil {
+			return err
+		}
+	}
 
-			// Save image to tarball
-			logger.Info("Exporting %s from Docker daemon...", imageName)
-			if err := dockerClient.SaveImage(component, tarballPath); err != nil {
-				return fmt.Errorf("failed to save %s image: %w\nMake sure you have built the images with 'build' command", component, err)
-			}
+	// Each image is exported once and its tarball shared by all clusters
+	exports := newImageExports(logger, deploySave(logger))
+	defer exports.Remove()
+	return runClusters(logger, clusters, func(cl *cluster) error {
+		return deployCluster(cl.logger, workDir, cl.k8s, cl.backend, exports.ForTarget(images, cl.target.Name), exports)
+	})
+}
 
-			// Distribute to all workers
-			results, err := distributor.DistributeToAllWorkers(workers, tarballPath, component, imageName)
-			if err != nil {
-				return fmt.Errorf("failed to distribute %s: %w", component, err)
-			}
+// deploySave returns the export of a component image from the Docker daemon
+func deploySave(logger *config.Logger) func(img distribution.Image) error {
+	dockerClient := newDockerClient(logger)
+	return func(img distribution.Image) error {
+		logger.Info("Exporting %s from Docker daemon...", img.Name)
+		if err := dockerClient.SaveImage(img.Component, img.TarballPath); err != nil {
+			return fmt.Errorf("failed to save %s image: %w\nMake sure you have built the images with 'build' command", img.Component, err)
+		}
+		return nil
+	}
+}
 
-			// Clean up local tarball
-			if !viper.GetBool("dry-run") {
-				os.Remove(tarballPath)
-				logger.Debug("Removed local tarball: %s", tarballPath)
-			}
+// componentImages describes the local component images to distribute, with
+// the digests workers are verified against
+func componentImages(logger *config.Logger, workDir string) ([]distribution.Image, error) {
+	dockerClient := newDockerClient(logger)
+	cfg := getConfig()
+	workloads := readWorkloads(logger, workDir)
+
+	var images []distribution.Image
+	for _, component := range []string{constants.ComponentBackend, constants.ComponentFrontend} {
+		img := distribution.Image{
+			Component:   component,
+			Name:        cfg.GetLocalImageName(component),
+			TarballPath: fmt.Sprintf(constants.TarballPathTemplate, component),
+		}
+		img.Placements = distribution.PlacementsFor(workloads, img.Name)
 
-			// Log distribution summary
-			successCount := 0
-			for _, result := range results {
-				if result.Success {
-					successCount++
-				}
-			}
-			logger.Info("  Distributed %s to %d/%d workers", component, successCount, len(workers))
+		// Record the local image digest so workers are verified against it
+		digest, err := dockerClient.GetImageDigest(component)
+		if err != nil && !viper.GetBool("dry-run") {
+			return nil, fmt.Errorf("failed to read %s image digest: %w\nMake sure you have built the images with 'build' command", component, err)
 		}
+		img.Digest = digest
+		images = append(images, img)
+		logger.Debug("Local %s digest: %s", img.Name, digest)
+	}
+	return images, nil
+}
 
-		// Verify images on all workers
+// deployCluster distributes images with backend (nil = skip distribution),
+// exported through exports, and applies the manifests under workDir to the
+// cluster of k8sClient
+func deployCluster(logger *config.Logger, workDir string, k8sClient *k8s.Client, backend distribution.Backend, images []distribution.Image, exports *imageExports) error {
+	if backend != nil {
+		logger.Info("Step 1: Distributing images to worker nodes (%s)", backend.Name())
 		logger.Info("")
-		logger.Info("Verifying images on worker nodes...")
-		for _, component := range components {
-			imageName := cfg.GetLocalImageName(component)
-
-			successCount := 0
-			for _, worker := range workers {
-				if err := distributor.VerifyImportOnWorker(worker, imageName); err != nil {
-					logger.Warning("Verification failed on %s: %v", worker.Name, err)
-				} else {
-					logger.Success("✓ %s has %s", worker.Name, imageName)
-					successCount++
-				}
-			}
 
-			minRequired := distributor.MinWorkers
-			if minRequired == 0 {
-				minRequired = len(workers)
+		if err := backend.Prepare(); err != nil {
+			return err
+		}
+		defer func() {
+			if err := backend.Cleanup(); err != nil {
+				logger.Warning("Failed to clean up %s distribution: %v", backend.Name(), err)
 			}
+		}()
 
-			if successCount < minRequired {
-				return fmt.Errorf("image %s not available on enough workers (%d/%d, minimum: %d)",
-					imageName, successCount, len(workers), minRequired)
-			}
+		// Distribute all components concurrently
+		if err := distributeImages(logger, backend, images, exports); err != nil {
+			return err
 		}
 
 		logger.Info("")
@@ -232,8 +263,6 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 		logger.Info("")
 	}
 
-	k8sClient := newK8sClient(logger)
-
 	logger.Info("Step 2: Deploying to Kubernetes cluster")
 
 	if deployValidate {
@@ -248,15 +277,277 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Backends whose nodes pull on rollout verify the pulls now
+	if verifier, ok := backend.(distribution.RolloutVerifier); ok {
+		logger.Info("")
+		logger.Info("Verifying image pulls on worker nodes...")
+		for _, img := range images {
+			if err := verifier.VerifyRollout(img); err != nil {
+				return err
+			}
+		}
+	}
+
 	logger.Success("Deployment completed successfully")
-	logger.Info("")
-	logger.Info("Deployment location: Kubernetes namespace '%s'", viper.GetString("namespace"))
-	logger.Info("Check pods: sudo k0s kubectl -n %s get pods", viper.GetString("namespace"))
-	logger.Info("Check services: sudo k0s kubectl -n %s get svc", viper.GetString("namespace"))
-	logger.Info("")
-	if !deployWait {
-		logger.Info("Run 'm2deploy verify' for detailed deployment health status")
+
+	// Old images are only removed once the new release is in place
+	if deployWorkersGC {
+		if sshBackend, ok := backend.(*distribution.SSHBackend); ok {
+			logger.Info("")
+			if err := gcWorkers(logger, sshBackend.Distributor, k8sClient, sshBackend.Workers(), deployGCKeep); err != nil {
+				logger.Warning("Worker image cleanup failed: %v", err)
+			}
+		} else {
+			logger.Warning("--workers-gc needs --distribution ssh, skipping worker image cleanup")
+		}
+	}
+	return nil
+}
+
+// checkWorkers adds the SSH preflight of every worker to checker when images
+// are distributed over SSH, so deploys fail before any transfer starts.
+// requiredBytes is the size of the images to be sent.
+func checkWorkers(logger *config.Logger, checker *prereq.Checker, requiredBytes int64) {
+	if viper.GetString("distribution") != distribution.ModeSSH {
+		return
+	}
+
+	distributor, err := newSSHDistributor(logger)
+	if err != nil {
+		checker.AddResult(workersFailure(err))
+		return
+	}
+	workers, err := distributor.GetWorkerNodes(newK8sClient(logger))
+	if err != nil {
+		checker.AddResult(workersFailure(err))
+		return
 	}
 
+	checker.CheckWorkers(distributor, workers, requiredBytes)
+}
+
+// workersFailure reports that the worker nodes could not be checked
+func workersFailure(err error) prereq.CheckResult {
+	return prereq.CheckResult{
+		Name:     "Workers",
+		Status:   "fail",
+		Message:  fmt.Sprintf("Cannot check worker nodes: %v", err),
+		Required: true,
+	}
+}
+
+// localImageSize returns the combined size of the local component images
+func localImageSize(logger *config.Logger) int64 {
+	dockerClient := newDockerClient(logger)
+	var total int64
+	for _, component := range []string{constants.ComponentBackend, constants.ComponentFrontend} {
+		size, err := dockerClient.GetImageSize(component)
+		if err != nil {
+			logger.Debug("Cannot read %s image size: %v", component, err)
+			continue
+		}
+		total += size
+	}
+	return total
+}
+
+// readWorkloads returns the placements of the workloads in the manifests under
+// workDir, or nil when manifest targeting is disabled or the manifests cannot
+// be read (every node is then targeted)
+func readWorkloads(logger *config.Logger, workDir string) []k8s.Placement {
+	if !viper.GetBool("manifest-targeting") {
+		return nil
+	}
+
+	workloads, err := k8s.ReadWorkloads(filepath.Join(workDir, "k8s"))
+	if err != nil {
+		logger.Warning("Cannot read workload placement, distributing to all nodes: %v", err)
+		return nil
+	}
+	return workloads
+}
+
+// distributeImages makes every image available on the nodes, all images
+// concurrently within the backend's shared budget. Each image is checked for
+// presence, exported through exports if the backend needs a tarball (nil =
+// the tarball exists), distributed and verified in one pass; backends that
+// verify during Distribute are not verified again.
+func distributeImages(logger *config.Logger, backend distribution.Backend, images []distribution.Image, exports *imageExports) error {
+	_, inline := backend.(distribution.InlineVerifier)
+	errs := make([]error, len(images))
+	var wg sync.WaitGroup
+
+	for i, img := range images {
+		wg.Add(1)
+		go func(idx int, img distribution.Image) {
+			defer wg.Done()
+
+			// Nothing to export or send when every node already holds the image
+			if imagePresent(logger, backend, img) {
+				return
+			}
+
+			if backend.NeedsTarball() && exports != nil {
+				if errs[idx] = exports.Save(img); errs[idx] != nil {
+					return
+				}
+			}
+
+			if errs[idx] = distributeImage(logger, backend, img); errs[idx] != nil {
+				return
+			}
+			if !inline {
+				errs[idx] = backend.Verify(img)
+			}
+		}(i, img)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// imageExports exports each image tarball once, however many clusters
+// distribute it: the first to need an image saves it, the others wait for
+// and reuse that tarball. Remove deletes the tarballs when all are done.
+type imageExports struct {
+	logger  *config.Logger
+	save    func(img distribution.Image) error
+	mu      sync.Mutex
+	exports map[string]*imageExport // Keyed by the tarball path save writes
+	links   map[string]string       // Tarball paths of clusters to the exported ones
+}
+
+// imageExport is the export of one tarball
+type imageExport struct {
+	once sync.Once
+	err  error
+}
+
+// newImageExports creates the exports of tarballs written by save
+func newImageExports(logger *config.Logger, save func(img distribution.Image) error) *imageExports {
+	return &imageExports{
+		logger:  logger,
+		save:    save,
+		exports: make(map[string]*imageExport),
+		links:   make(map[string]string),
+	}
+}
+
+// ForTarget returns images with tarball paths of their own for the target,
+// hard links to the exported tarballs: distributors write compressed copies
+// and delta archives next to a tarball, which clusters distributed in
+// parallel must not share
+func (e *imageExports) ForTarget(images []distribution.Image, name string) []distribution.Image {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	own := make([]distribution.Image, len(images))
+	for i, img := range images {
+		path := target.Suffixed(img.TarballPath, name)
+		e.links[path] = img.TarballPath
+		img.TarballPath = path
+		own[i] = img
+	}
+	return own
+}
+
+// Save exports the tarball of img unless it was exported already, and
+// links it to img's own path if that is a cluster's
+func (e *imageExports) Save(img distribution.Image) error {
+	e.mu.Lock()
+	exported := img.TarballPath
+	if source, ok := e.links[img.TarballPath]; ok {
+		exported = source
+	}
+	export, ok := e.exports[exported]
+	if !ok {
+		export = &imageExport{}
+		e.exports[exported] = export
+	}
+	e.mu.Unlock()
+
+	export.once.Do(func() {
+		saved := img
+		saved.TarballPath = exported
+		export.err = e.save(saved)
+	})
+	if export.err != nil || exported == img.TarballPath || viper.GetBool("dry-run") {
+		return export.err
+	}
+
+	os.Remove(img.TarballPath)
+	if err := os.Link(exported, img.TarballPath); err != nil {
+		return fmt.Errorf("failed to link %s tarball: %w", img.Component, err)
+	}
+	return nil
+}
+
+// Remove deletes the exported tarballs and their links
+func (e *imageExports) Remove() {
+	if viper.GetBool("dry-run") {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var paths []string
+	for path := range e.links {
+		paths = append(paths, path)
+	}
+	for path := range e.exports {
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err == nil {
+			e.logger.Debug("Removed local tarball: %s", path)
+		}
+	}
+}
+
+// distributeImage distributes one component image with the backend and logs a summary
+func distributeImage(logger *config.Logger, backend distribution.Backend, img distribution.Image) error {
+	results, err := backend.Distribute(img)
+	if err != nil {
+		return fmt.Errorf("failed to distribute %s: %w", img.Component, err)
+	}
+
+	successCount, presentCount := 0, 0
+	for _, result := range results {
+		if result.AlreadyPresent {
+			presentCount++
+		} else if result.Success {
+			successCount++
+		}
+	}
+	if presentCount > 0 {
+		logger.Info("  Distributed %s to %d/%d workers, already present on %d", img.Component, successCount, len(results)-presentCount, presentCount)
+	} else if len(results) > 0 {
+		logger.Info("  Distributed %s to %d/%d workers", img.Component, successCount, len(results))
+	}
+	return nil
+}
+
+// imagePresent reports whether every node already holds exactly img, in which
+// case it need not be exported or distributed
+func imagePresent(logger *config.Logger, backend distribution.Backend, img distribution.Image) bool {
+	checker, ok := backend.(distribution.PresenceChecker)
+	if !ok || viper.GetBool("force-distribute") || img.Digest == "" {
+		return false
+	}
+
+	present, total := checker.CheckPresence(img)
+	if total == 0 || present < total {
+		if present > 0 {
+			logger.Info("%s already present on %d/%d workers", img.Component, present, total)
+		}
+		return false
+	}
+
+	logger.Success("%s already present on all %d workers, skipping distribution", img.Component, total)
+	return true
+}
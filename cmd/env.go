@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/database"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/manifest"
+	"github.com/wapsol/m2deploy/pkg/payload"
+	"github.com/wapsol/m2deploy/pkg/preview"
+	"github.com/wapsol/m2deploy/pkg/registry"
+)
+
+// cloneKind is the k8s.EphemeralLabel value of cloned namespaces
+const cloneKind = "clone"
+
+// clonedFromAnnotation records the namespace a clone was copied from
+const clonedFromAnnotation = k8s.ProvenancePrefix + "cloned-from"
+
+var (
+	envCloneFrom       string
+	envCloneTo         string
+	envCloneTTL        time.Duration
+	envCloneRestoreDB  bool
+	envCloneBackupFile string
+	envCloneBackupDir  string
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage copies of environments",
+}
+
+var envCloneCmd = &cobra.Command{
+	Use:   "clone",
+	Short: "Copy an environment into a new namespace, e.g. to debug it",
+	Long: `Copy the environment of namespace --from into namespace --to on the same
+cluster:
+
+1. The ConfigMaps and Secrets of --from are copied (without their uid,
+   resourceVersion and owners), so the clone gets the real values.
+2. The manifests of the workspace are rendered for --to and deployed with the
+   images --from runs. The running digests are verified after the rollout.
+3. The latest database backup (or --backup-file) is restored into the
+   clone's backend pod.
+
+Ingress hosts get the clone's name as a subdomain. The namespace expires after
+--ttl; 'm2deploy preview gc' removes expired clones.`,
+	Example: `  m2deploy env clone --from magnetiq-v2 --to debug-123 --workspace-path /tmp/wapsol/magnetiq2
+  m2deploy env clone --from magnetiq-v2 --to debug-123 --repo-url https://github.com/wapsol/magnetiq2 --ttl 4h
+  m2deploy env clone --from magnetiq-v2 --to debug-123 --workspace-path /tmp/wapsol/magnetiq2 --backup-file ./backups/magnetiq-db-20240101-120000.db.gz`,
+	RunE: runEnvClone,
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+
+	envCmd.AddCommand(envCloneCmd)
+	envCloneCmd.Flags().StringVar(&envCloneFrom, "from", "", "Namespace to clone")
+	envCloneCmd.Flags().StringVar(&envCloneTo, "to", "", "Namespace of the clone")
+	envCloneCmd.Flags().DurationVar(&envCloneTTL, "ttl", constants.DefaultCloneTTL, "Time after which 'preview gc' removes the clone")
+	envCloneCmd.Flags().BoolVar(&envCloneRestoreDB, "restore-db", true, "Restore a database backup into the clone")
+	envCloneCmd.Flags().StringVar(&envCloneBackupFile, "backup-file", "", "Database backup to restore (default: the latest in --backup-dir)")
+	envCloneCmd.Flags().StringVar(&envCloneBackupDir, "backup-dir", constants.DefaultBackupPath, "Directory to take the latest backup from")
+	envCloneCmd.MarkFlagRequired("from")
+	envCloneCmd.MarkFlagRequired("to")
+}
+
+func runEnvClone(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	if envCloneFrom == envCloneTo {
+		return formatError("env clone", fmt.Errorf("--from and --to are both %s", envCloneFrom))
+	}
+	if envCloneTTL <= 0 {
+		return formatError("env clone", fmt.Errorf("--ttl must be positive"))
+	}
+
+	// The manifests come from the workspace, like for deploy
+	workDir := viper.GetString("workspace-path")
+	if workDir == "" {
+		repoURL := viper.GetString("repo-url")
+		if repoURL == "" {
+			return formatError("env clone", fmt.Errorf("either --repo-url or --workspace-path is required"))
+		}
+		workDir = deriveWorkspaceFromRepoURL(repoURL)
+	}
+
+	backupFile := envCloneBackupFile
+	if envCloneRestoreDB && backupFile == "" {
+		latest, err := database.LatestBackup(envCloneBackupDir)
+		if err != nil {
+			return formatError("env clone", fmt.Errorf("%w (pass --backup-file or --restore-db=false)", err))
+		}
+		backupFile = latest
+	}
+
+	// Always check prerequisites first (fail-fast)
+	checker := newChecker(logger)
+	checker.CheckDeployPrereqs(envCloneFrom, viper.GetBool("use-sudo"))
+
+	if viper.GetBool("check") {
+		checker.PrintResults()
+		if checker.HasFailures() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if checker.HasFailures() {
+		checker.PrintResults()
+		return formatPrereqError("env clone")
+	}
+
+	validator := payload.NewValidator(logger)
+	if err := validator.ValidateStructure(workDir); err != nil {
+		return fmt.Errorf("payload validation failed: %w", err)
+	}
+
+	viper.Set("namespace", envCloneFrom)
+	source := newK8sClient(logger)
+	viper.Set("namespace", envCloneTo)
+	clone := newK8sClient(logger)
+
+	exists, err := clone.NamespaceExists(envCloneTo)
+	if err != nil {
+		return formatError("env clone", err)
+	}
+	if exists && !viper.GetBool("force") {
+		return formatError("env clone", fmt.Errorf("namespace %s already exists; use --force to clone into it", envCloneTo))
+	}
+
+	// What the source runs; the clone runs the same images
+	cfg := getConfig()
+	components := []string{constants.ComponentBackend, constants.ComponentFrontend}
+	var releases []*k8s.Release
+	images := make(map[string]string)
+	for _, component := range components {
+		release, err := source.ReadRelease(getDeploymentName(component))
+		if err != nil {
+			return fmt.Errorf("cannot read the release of %s: %w", envCloneFrom, err)
+		}
+		releases = append(releases, release)
+
+		// Manifests name the local image; the source may run it under
+		// another repository, e.g. that of a registry
+		local, _, _ := registry.SplitReference(cfg.GetLocalImageName(component))
+		for _, container := range release.Containers() {
+			image := release.Images[container]
+			repository, _, _ := registry.SplitReference(image)
+			images[repository] = image
+			if strings.HasSuffix(repository, "/"+component) {
+				images[local] = image
+			}
+		}
+	}
+
+	logger.Info("Cloning %s into %s", envCloneFrom, envCloneTo)
+	for _, release := range releases {
+		for _, container := range release.Containers() {
+			logger.Info("  %s/%s: %s (%s)", release.Deployment, container, release.Images[container], shortDigest(release.Digests[container]))
+		}
+	}
+	if envCloneRestoreDB {
+		logger.Info("  database: %s", backupFile)
+	}
+	logger.Info("")
+
+	// 1. Namespace with its expiry, and the configuration of the source
+	logger.Info("Step 1/4: Copying configuration from %s", envCloneFrom)
+	expires := time.Now().Add(envCloneTTL).UTC()
+	err = clone.EnsureNamespace(envCloneTo,
+		map[string]string{k8s.EphemeralLabel: cloneKind},
+		map[string]string{
+			k8s.ExpiresAtAnnotation: expires.Format(time.RFC3339),
+			clonedFromAnnotation:    envCloneFrom,
+		})
+	if err != nil {
+		return err
+	}
+
+	configMaps, secrets, err := source.NamespaceConfig(envCloneFrom)
+	if err != nil {
+		return err
+	}
+	for _, name := range configMaps {
+		if err := clone.CopyConfigMapToNamespace(name, envCloneFrom, envCloneTo); err != nil {
+			return fmt.Errorf("failed to copy configmap %s from %s: %w", name, envCloneFrom, err)
+		}
+	}
+	for _, name := range secrets {
+		if err := clone.CopySecretToNamespace(name, envCloneFrom, envCloneTo); err != nil {
+			return fmt.Errorf("failed to copy secret %s from %s: %w", name, envCloneFrom, err)
+		}
+	}
+
+	// 2. Manifests for the clone, with the source's images and without the
+	// configuration copied above
+	logger.Info("Step 2/4: Rendering manifests for %s", envCloneTo)
+	renderDir, err := os.MkdirTemp("", "m2deploy-clone-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(renderDir)
+
+	rendering := &manifest.Rendering{
+		Namespace: envCloneTo,
+		Hosts:     manifest.HostPrefixer(preview.Subdomain(envCloneFrom, envCloneTo)),
+		Images:    images,
+		OmitKinds: []string{"ConfigMap", "Secret"},
+	}
+	omitted, err := rendering.RenderDir(filepath.Join(workDir, "k8s"), filepath.Join(renderDir, "k8s"))
+	if err != nil {
+		return err
+	}
+	for _, object := range omitted {
+		logger.Debug("%s/%s not applied to %s", object.Kind, object.Name, envCloneTo)
+	}
+
+	// 3. The images are on the cluster already: no distribution
+	logger.Info("Step 3/4: Deploying clone")
+	if err := clone.DeployWithOptions(renderDir, false, false); err != nil {
+		return err
+	}
+	if !viper.GetBool("dry-run") {
+		for _, release := range releases {
+			if err := clone.WaitForRollout(release.Deployment, 5*time.Minute); err != nil {
+				return err
+			}
+			if err := verifyRelease(clone, release); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 4. Data of the source, as of its latest backup
+	if envCloneRestoreDB {
+		logger.Info("Step 4/4: Restoring database")
+		dbClient := database.NewClient(logger, viper.GetBool("dry-run"), envCloneTo, clone)
+		if err := dbClient.Restore(backupFile); err != nil {
+			return err
+		}
+	} else {
+		logger.Info("Step 4/4: Skipping database restore (--restore-db=false)")
+	}
+
+	logger.Info("")
+	logger.Success("Cloned %s into namespace %s (%d configmaps, %d secrets)", envCloneFrom, envCloneTo, len(configMaps), len(secrets))
+	logger.Info("Ingress hosts carry the subdomain %s", preview.Subdomain(envCloneFrom, envCloneTo))
+	logger.Info("Expires %s; 'm2deploy preview gc' removes it after that", expires.Local().Format(time.RFC1123))
+	return nil
+}
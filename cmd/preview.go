@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/manifest"
+	"github.com/wapsol/m2deploy/pkg/payload"
+	"github.com/wapsol/m2deploy/pkg/preview"
+	"github.com/wapsol/m2deploy/pkg/registry"
+)
+
+var (
+	previewBranch      string
+	previewTTL         time.Duration
+	previewCopySecrets []string
+	previewWait        bool
+)
+
+var previewCmd = &cobra.Command{
+	Use:   "preview",
+	Short: "Ephemeral preview environments per branch",
+	Long: `Deploy a branch into a namespace of its own for review, and remove the
+environments whose time is up.
+
+A preview runs next to the environment of --namespace (the base) in the
+namespace <base>-<branch>. Ingress hosts get the branch as a subdomain, e.g.
+feature-x.magnetiq.example.com.`,
+}
+
+var previewUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Build a branch and deploy it into its preview namespace",
+	Long: `Clone or update the branch in a workspace of its own, build the images with
+a tag naming the branch and commit, and deploy them into the branch's
+preview namespace.
+
+The manifests are rendered for the preview: every object moves into the
+preview namespace, ingress hosts get the branch subdomain and the images
+the preview tag. Cluster-scoped objects (storage classes, volumes, cluster
+roles) stay with the base environment. The Secrets of the manifests and
+those of --copy-secret are copied from the base namespace instead of being
+applied, so the preview gets the real values.
+
+The namespace expires after --ttl; running 'preview up' again redeploys the
+branch and renews it. 'preview gc' removes expired previews.`,
+	Example: `  m2deploy preview up --repo-url https://github.com/wapsol/magnetiq2 --branch feature-x
+  m2deploy preview up --repo-url https://github.com/wapsol/magnetiq2 --branch fix/login --ttl 24h --copy-secret registry-credentials`,
+	RunE: runPreviewUp,
+}
+
+var previewListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List preview and other ephemeral environments",
+	RunE:  runPreviewList,
+}
+
+var previewGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete expired preview and other ephemeral environments",
+	Long: `Delete the namespaces of previews and clones whose expiry has passed, with
+everything in them. Namespaces without a valid expiry are kept.`,
+	Example: `  m2deploy preview gc --dry-run
+  m2deploy preview gc --force`,
+	RunE: runPreviewGC,
+}
+
+func init() {
+	rootCmd.AddCommand(previewCmd)
+
+	previewCmd.AddCommand(previewUpCmd)
+	previewUpCmd.Flags().StringVarP(&previewBranch, "branch", "b", "", "Git branch to preview")
+	previewUpCmd.Flags().DurationVar(&previewTTL, "ttl", constants.DefaultPreviewTTL, "Time after which 'preview gc' removes the preview")
+	previewUpCmd.Flags().StringSliceVar(&previewCopySecrets, "copy-secret", nil, "Additional secrets to copy from the base namespace (e.g. registry or TLS credentials)")
+	previewUpCmd.Flags().BoolVar(&previewWait, "wait", true, "Wait for the preview deployments to be ready")
+	previewUpCmd.MarkFlagRequired("branch")
+
+	previewCmd.AddCommand(previewListCmd)
+	previewCmd.AddCommand(previewGCCmd)
+}
+
+func runPreviewUp(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	repoURL := viper.GetString("repo-url")
+	if repoURL == "" {
+		return formatError("preview up", fmt.Errorf("--repo-url is required"))
+	}
+	if previewTTL <= 0 {
+		return formatError("preview up", fmt.Errorf("--ttl must be positive"))
+	}
+
+	base := viper.GetString("namespace")
+	namespace := preview.Namespace(base, previewBranch)
+	workDir := deriveWorkspaceFromRepoURL(repoURL) + "-" + preview.Slug(previewBranch)
+	logger.Info("Preview of %s: namespace %s, workspace %s", previewBranch, namespace, workDir)
+
+	// Always check prerequisites first (fail-fast)
+	checker := newChecker(logger)
+	checker.CheckBuildPrereqs(viper.GetBool("use-sudo"))
+	checker.CheckDeployPrereqs(base, viper.GetBool("use-sudo"))
+	checkWorkers(logger, checker, 0)
+
+	if viper.GetBool("check") {
+		checker.PrintResults()
+		if checker.HasFailures() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if checker.HasFailures() {
+		checker.PrintResults()
+		return formatPrereqError("preview up")
+	}
+
+	// 1. Source of the branch, in a workspace of its own
+	logger.Info("Step 1/4: Preparing source code")
+	gitClient := newGitClient(logger)
+	if err := gitClient.Clone(repoURL, workDir, previewBranch, 1); err != nil {
+		return err
+	}
+	commit, err := gitClient.GetCurrentCommit(workDir)
+	if err != nil && !viper.GetBool("dry-run") {
+		return err
+	}
+
+	validator := payload.NewValidator(logger)
+	if err := validator.ValidateStructure(workDir); err != nil {
+		return fmt.Errorf("payload validation failed: %w", err)
+	}
+
+	// 2. Images tagged for the branch; every client below uses the tag
+	viper.Set("local-image-tag", preview.Tag(previewBranch, commit))
+	cfg := getConfig()
+	logger.Info("Step 2/4: Building images (tag %s)", cfg.LocalImageTag)
+	dockerClient := newDockerClient(logger)
+	components := []string{constants.ComponentBackend, constants.ComponentFrontend}
+	images := make(map[string]string)
+	for _, component := range components {
+		if err := dockerClient.Build(workDir, component); err != nil {
+			return err
+		}
+		name := cfg.GetLocalImageName(component)
+		repository, _, _ := registry.SplitReference(name)
+		images[repository] = name
+	}
+
+	// 3. Manifests for the preview namespace
+	logger.Info("Step 3/4: Rendering manifests for %s", namespace)
+	renderDir, err := os.MkdirTemp("", "m2deploy-preview-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(renderDir)
+
+	rendering := &manifest.Rendering{
+		Namespace: namespace,
+		Hosts:     manifest.HostPrefixer(preview.Subdomain(base, namespace)),
+		Images:    images,
+		OmitKinds: []string{"Secret"},
+	}
+	omitted, err := rendering.RenderDir(filepath.Join(workDir, "k8s"), filepath.Join(renderDir, "k8s"))
+	if err != nil {
+		return err
+	}
+	secrets := append([]string(nil), previewCopySecrets...)
+	for _, object := range omitted {
+		if object.Kind == "Secret" {
+			secrets = append(secrets, object.Name)
+		} else {
+			logger.Debug("%s/%s stays with %s", object.Kind, object.Name, base)
+		}
+	}
+
+	// 4. Namespace with its expiry, secrets, images and manifests
+	logger.Info("Step 4/4: Deploying preview")
+	viper.Set("namespace", namespace)
+	k8sClient := newK8sClient(logger)
+	expires := time.Now().Add(previewTTL).UTC()
+	err = k8sClient.EnsureNamespace(namespace,
+		map[string]string{k8s.EphemeralLabel: preview.Kind},
+		map[string]string{
+			k8s.ExpiresAtAnnotation:  expires.Format(time.RFC3339),
+			preview.BranchAnnotation: previewBranch,
+			preview.CommitAnnotation: commit,
+			preview.BaseAnnotation:   base,
+		})
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		if err := k8sClient.CopySecretToNamespace(secret, base, namespace); err != nil {
+			return fmt.Errorf("failed to copy secret %s from %s: %w", secret, base, err)
+		}
+	}
+
+	backend, err := newDistributionBackend(logger, k8sClient)
+	if err != nil {
+		return formatError("preview up", err)
+	}
+	distImages, err := componentImages(logger, renderDir)
+	if err != nil {
+		return err
+	}
+	exports := newImageExports(logger, deploySave(logger))
+	defer exports.Remove()
+	if err := deployCluster(logger, renderDir, k8sClient, backend, distImages, exports); err != nil {
+		return err
+	}
+
+	if previewWait {
+		for _, component := range components {
+			if err := k8sClient.WaitForRollout(getDeploymentName(component), 5*time.Minute); err != nil {
+				return err
+			}
+		}
+	}
+
+	logger.Info("")
+	logger.Success("Preview of %s (%s) is up in namespace %s", previewBranch, cfg.LocalImageTag, namespace)
+	logger.Info("Ingress hosts carry the subdomain %s", preview.Subdomain(base, namespace))
+	logger.Info("Expires %s; run 'm2deploy preview up' again to redeploy and renew it", expires.Local().Format(time.RFC1123))
+	return nil
+}
+
+func runPreviewList(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	namespaces, err := newK8sClient(logger).EphemeralNamespaces()
+	if err != nil {
+		return formatError("preview list", err)
+	}
+	if len(namespaces) == 0 {
+		logger.Info("No preview or ephemeral environments")
+		return nil
+	}
+
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Name < namespaces[j].Name })
+	now := time.Now()
+	for _, ns := range namespaces {
+		describeEphemeral(logger, ns, now)
+	}
+	return nil
+}
+
+// describeEphemeral logs one ephemeral namespace with its state
+func describeEphemeral(logger *config.Logger, ns k8s.NamespaceInfo, now time.Time) {
+	what := ns.Labels[k8s.EphemeralLabel]
+	if branch := ns.Annotations[preview.BranchAnnotation]; branch != "" {
+		what = fmt.Sprintf("%s of %s", what, branch)
+		if commit := ns.Annotations[preview.CommitAnnotation]; commit != "" {
+			what += "@" + commit
+		}
+	}
+	if from := ns.Annotations[clonedFromAnnotation]; from != "" {
+		what = fmt.Sprintf("%s of %s", what, from)
+	}
+
+	expires, ok := ns.ExpiresAt()
+	switch {
+	case ns.Terminating:
+		logger.Info("  %s: %s, being deleted", ns.Name, what)
+	case !ok:
+		logger.Warning("  %s: %s, no valid expiry (kept by gc)", ns.Name, what)
+	case expires.Before(now):
+		logger.Warning("  %s: %s, expired %s ago", ns.Name, what, now.Sub(expires).Round(time.Minute))
+	default:
+		logger.Success("  %s: %s, expires in %s", ns.Name, what, expires.Sub(now).Round(time.Minute))
+	}
+}
+
+func runPreviewGC(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	k8sClient := newK8sClient(logger)
+	namespaces, err := k8sClient.EphemeralNamespaces()
+	if err != nil {
+		return formatError("preview gc", err)
+	}
+
+	now := time.Now()
+	var expired []k8s.NamespaceInfo
+	for _, ns := range namespaces {
+		if expires, ok := ns.ExpiresAt(); ok && expires.Before(now) && !ns.Terminating {
+			expired = append(expired, ns)
+		}
+	}
+	if len(expired) == 0 {
+		logger.Success("No expired environments")
+		return nil
+	}
+
+	logger.Info("Expired environments:")
+	for _, ns := range expired {
+		describeEphemeral(logger, ns, now)
+	}
+
+	if !viper.GetBool("force") && !viper.GetBool("dry-run") {
+		if !promptForConfirmation(fmt.Sprintf("Delete %d namespaces with everything in them?", len(expired))) {
+			logger.Info("Cleanup cancelled")
+			return nil
+		}
+	}
+
+	failed := 0
+	for _, ns := range expired {
+		if err := k8sClient.DeleteNamespace(ns.Name); err != nil {
+			logger.Warning("%v", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d of %d namespaces", failed, len(expired))
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wapsol/m2deploy/pkg/bundle"
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/distribution"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/prereq"
+	"github.com/wapsol/m2deploy/pkg/target"
+)
+
+var (
+	promoteFrom      string
+	promoteTo        string
+	promoteComponent string
+	promoteBundle    string
+	promoteVerifyKey string
+	promoteWait      bool
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Promote the running release of one environment to another",
+	Long: `Promote the exact images running in one environment to another, without rebuilding.
+
+An environment is a target of the targets file (see --targets-file) or, when
+no target has that name, a namespace on the cluster given by the flags.
+
+The image digests running in the source Deployments and their provenance
+annotations (m2deploy.io/*) are read first and compared with the target.
+The images must exist with those digests in the local Docker daemon or in
+the bundle given with --bundle. They are distributed to the target's workers
+and verified against the digests, then the target Deployments are updated
+to the same images and annotated with where they came from. After the
+rollout the target pods must run the source digests.`,
+	Example: `  # Promote between namespaces of one cluster
+  m2deploy promote --from magnetiq-staging --to magnetiq-v2
+
+  # Promote between clusters of the targets file, images from a bundle
+  m2deploy promote --from staging --to prod --bundle m2deploy-bundle-abc123.tar.gz --verify-key bundle.pub`,
+	RunE: runPromote,
+}
+
+func init() {
+	rootCmd.AddCommand(promoteCmd)
+
+	promoteCmd.Flags().StringVar(&promoteFrom, "from", "", "Environment to promote from (target or namespace)")
+	promoteCmd.Flags().StringVar(&promoteTo, "to", "", "Environment to promote to (target or namespace)")
+	promoteCmd.Flags().StringVarP(&promoteComponent, "component", "c", constants.ComponentBoth, "Component to promote: backend, frontend, or both")
+	promoteCmd.Flags().StringVar(&promoteBundle, "bundle", "", "Take the images from this bundle instead of the local Docker daemon")
+	promoteCmd.Flags().StringVar(&promoteVerifyKey, "verify-key", "", "ed25519 public key (PEM) the bundle must be signed with")
+	promoteCmd.Flags().BoolVar(&promoteWait, "wait", true, "Wait for the rollout and verify the running digests")
+	promoteCmd.MarkFlagRequired("from")
+	promoteCmd.MarkFlagRequired("to")
+}
+
+func runPromote(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	if promoteFrom == promoteTo {
+		return formatError("promote", fmt.Errorf("--from and --to are both %s", promoteFrom))
+	}
+	if promoteBundle != "" && promoteVerifyKey == "" {
+		return formatError("promote", fmt.Errorf("--bundle needs --verify-key"))
+	}
+	if promoteBundle != "" && viper.GetString("distribution") == distribution.ModeRegistry {
+		return fmt.Errorf("promote --bundle does not support --distribution registry (it needs a Docker daemon); use ssh or daemonset")
+	}
+
+	from, err := resolveEnvironment(promoteFrom)
+	if err != nil {
+		return formatError("promote", err)
+	}
+	to, err := resolveEnvironment(promoteTo)
+	if err != nil {
+		return formatError("promote", err)
+	}
+
+	err = checkTargets(logger, "promote", []target.Target{to}, func(checker *prereq.Checker) {
+		checker.CheckDeployPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
+	})
+	if err != nil {
+		return err
+	}
+
+	sources, err := newClusters(logger, []target.Target{from}, false)
+	if err != nil {
+		return formatError("promote", err)
+	}
+	targets, err := newClusters(logger, []target.Target{to}, true)
+	if err != nil {
+		return formatError("promote", err)
+	}
+	source, dest := sources[0], targets[0]
+
+	// What runs on both sides
+	components := getComponents(promoteComponent)
+	var releases, current []*k8s.Release
+	for _, component := range components {
+		deployment := getDeploymentName(component)
+		release, err := source.k8s.ReadRelease(deployment)
+		if err != nil {
+			return fmt.Errorf("cannot read the release of %s: %w", promoteFrom, err)
+		}
+		running, err := dest.k8s.ReadRelease(deployment)
+		if err != nil {
+			return fmt.Errorf("cannot read the release of %s (deploy it first): %w", promoteTo, err)
+		}
+		releases = append(releases, release)
+		current = append(current, running)
+	}
+
+	logger.Info("Promoting %s (namespace %s) to %s (namespace %s)", promoteFrom, source.namespace, promoteTo, dest.namespace)
+	logger.Info("")
+	if !printReleaseDiff(logger, current, releases) {
+		logger.Success("%s already runs the release of %s", promoteTo, promoteFrom)
+		return nil
+	}
+	logger.Info("")
+
+	// The images must exist with the exact digests: promote never rebuilds
+	images, cleanup, err := promotionImages(logger, releases)
+	if err != nil {
+		return formatError("promote", err)
+	}
+	defer cleanup()
+
+	if viper.GetBool("dry-run") {
+		logger.DryRun("Would distribute %d images to %s and update its deployments", len(images), promoteTo)
+		return nil
+	}
+	if !viper.GetBool("force") && !promptForConfirmation(fmt.Sprintf("Promote %s to %s?", promoteFrom, promoteTo)) {
+		logger.Info("Promotion cancelled")
+		return nil
+	}
+
+	return promote(dest, releases, images)
+}
+
+// printReleaseDiff logs what changes in every Deployment from the current to
+// the promoted release and reports whether anything changes
+func printReleaseDiff(logger *config.Logger, current, releases []*k8s.Release) bool {
+	changed := false
+	for i, release := range releases {
+		logger.Info("%s:", release.Deployment)
+		for _, container := range release.Containers() {
+			before := fmt.Sprintf("%s (%s)", current[i].Images[container], shortDigest(current[i].Digests[container]))
+			after := fmt.Sprintf("%s (%s)", release.Images[container], shortDigest(release.Digests[container]))
+			if before == after {
+				logger.Info("    %s: %s unchanged", container, after)
+				continue
+			}
+			changed = true
+			logger.Info("  - %s: %s", container, before)
+			logger.Info("  + %s: %s", container, after)
+		}
+		for key, value := range release.Provenance {
+			if current[i].Provenance[key] != value {
+				logger.Info("  + %s=%s", key, value)
+			}
+		}
+	}
+	return changed
+}
+
+// shortDigest shortens a digest for display (sha256:0123456789ab)
+func shortDigest(digest string) string {
+	if len(digest) > 19 {
+		return digest[:19]
+	}
+	return digest
+}
+
+// promotionImages finds the image of every container of releases with its
+// running digest, in the bundle of --bundle or else in the local Docker
+// daemon. cleanup removes the extracted bundle.
+func promotionImages(logger *config.Logger, releases []*k8s.Release) ([]distribution.Image, func(), error) {
+	var images []distribution.Image
+	cleanup := func() {}
+
+	if promoteBundle != "" {
+		verifyKey, err := bundle.LoadPublicKey(promoteVerifyKey)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		extractDir, err := os.MkdirTemp("", "m2deploy-bundle-")
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("failed to create temp directory: %w", err)
+		}
+		cleanup = func() { os.RemoveAll(extractDir) }
+
+		logger.Info("Verifying bundle %s...", promoteBundle)
+		desc, err := bundle.Extract(promoteBundle, extractDir, verifyKey)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		workloads := readWorkloads(logger, extractDir)
+
+		for _, release := range releases {
+			for _, container := range release.Containers() {
+				name, digest := release.Images[container], release.Digests[container]
+				info, err := bundleImage(desc, name, digest)
+				if err != nil {
+					return nil, cleanup, err
+				}
+				images = append(images, distribution.Image{
+					Component:   container,
+					Name:        name,
+					TarballPath: filepath.Join(extractDir, filepath.FromSlash(info.File)),
+					Digest:      digest,
+					Placements:  distribution.PlacementsFor(workloads, name),
+				})
+				logger.Success("%s %s found in the bundle", name, shortDigest(digest))
+			}
+		}
+		return images, cleanup, nil
+	}
+
+	dockerClient := newDockerClient(logger)
+	for _, release := range releases {
+		for _, container := range release.Containers() {
+			name, digest := release.Images[container], release.Digests[container]
+			id, repoDigests, err := dockerClient.InspectImage(name)
+			if err != nil {
+				return nil, cleanup, fmt.Errorf("%s is not in the local Docker daemon (use --bundle to take it from a bundle): %w", name, err)
+			}
+			if !digestMatches(digest, id, repoDigests) {
+				return nil, cleanup, fmt.Errorf("local %s is %s, not the promoted %s; promote does not rebuild", name, shortDigest(id), shortDigest(digest))
+			}
+			images = append(images, distribution.Image{
+				Component:   container,
+				Name:        name,
+				TarballPath: fmt.Sprintf(constants.TarballPathTemplate, container+"-promote"),
+				Digest:      digest,
+			})
+			logger.Success("%s %s found locally", name, shortDigest(digest))
+		}
+	}
+	return images, cleanup, nil
+}
+
+// bundleImage returns the bundle image saved from name with digest
+func bundleImage(desc *bundle.Descriptor, name, digest string) (bundle.ImageInfo, error) {
+	for _, img := range desc.Images {
+		if img.Name == name && img.Digest == digest {
+			return img, nil
+		}
+	}
+	return bundle.ImageInfo{}, fmt.Errorf("bundle %s has no %s with digest %s", desc.Tag, name, shortDigest(digest))
+}
+
+// digestMatches reports whether a local image with the given ID and
+// repository digests is the image of digest
+func digestMatches(digest, id string, repoDigests []string) bool {
+	if id == digest {
+		return true
+	}
+	for _, repoDigest := range repoDigests {
+		if strings.HasSuffix(repoDigest, "@"+digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// promote distributes images to the cluster of dest, updates its Deployments
+// to releases and checks that the new pods run the promoted digests
+func promote(dest *cluster, releases []*k8s.Release, images []distribution.Image) error {
+	logger := dest.logger
+
+	logger.Info("Step 1: Distributing images to worker nodes (%s)", dest.backend.Name())
+	if err := dest.backend.Prepare(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := dest.backend.Cleanup(); err != nil {
+			logger.Warning("Failed to clean up %s distribution: %v", dest.backend.Name(), err)
+		}
+	}()
+
+	var exports *imageExports
+	if promoteBundle == "" {
+		dockerClient := newDockerClient(logger)
+		exports = newImageExports(logger, func(img distribution.Image) error {
+			return dockerClient.SaveImageByName(img.Name, img.TarballPath)
+		})
+		defer exports.Remove()
+	}
+	if err := distributeImages(logger, dest.backend, images, exports); err != nil {
+		return err
+	}
+	logger.Info("")
+
+	logger.Info("Step 2: Updating deployments")
+	promotedAt := time.Now().UTC().Format(time.RFC3339)
+	for _, release := range releases {
+		annotations := map[string]string{
+			k8s.PromotedFromAnnotation: promoteFrom,
+			k8s.PromotedAtAnnotation:   promotedAt,
+		}
+		for key, value := range release.Provenance {
+			if key != k8s.PromotedFromAnnotation && key != k8s.PromotedAtAnnotation {
+				annotations[key] = value
+			}
+		}
+		for container, digest := range release.Digests {
+			annotations[k8s.DigestAnnotationPrefix+container] = digest
+		}
+		if err := dest.k8s.SetRelease(release.Deployment, release.Images, annotations); err != nil {
+			return err
+		}
+	}
+
+	if !promoteWait {
+		logger.Success("Promoted %s to %s (rollout not awaited)", promoteFrom, promoteTo)
+		return nil
+	}
+
+	logger.Info("Step 3: Waiting for rollout and verifying digests")
+	for _, release := range releases {
+		if err := dest.k8s.WaitForRollout(release.Deployment, 5*time.Minute); err != nil {
+			logger.Info("Consider rolling back with 'm2deploy rollback --namespace %s'", dest.namespace)
+			return err
+		}
+		if err := verifyRelease(dest.k8s, release); err != nil {
+			return err
+		}
+	}
+
+	logger.Success("Promoted %s to %s", promoteFrom, promoteTo)
+	return nil
+}
+
+// verifyRelease checks that the deployment of release runs its digests
+func verifyRelease(k8sClient *k8s.Client, release *k8s.Release) error {
+	running, err := k8sClient.ReadRelease(release.Deployment)
+	if err != nil {
+		return err
+	}
+	for container, digest := range release.Digests {
+		if running.Digests[container] != digest {
+			return fmt.Errorf("%s/%s runs %s after the rollout, not %s", release.Deployment, container, shortDigest(running.Digests[container]), shortDigest(digest))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/registry"
+)
+
+var (
+	registryGCKeep int
+)
+
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Distribution registry operations",
+	Long:  `Manage the registry used by --distribution registry.`,
+}
+
+var registryGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Prune old images from the registry",
+	Long: `Delete image tags from the registry that are not referenced by recent releases.
+
+Images used by any ReplicaSet in the namespace (the current release and the
+revision history kept for rollback) are always kept, as are the --keep newest
+images of each component. With --registry-local, the registry's garbage
+collector is run afterwards to free disk space.`,
+	Example: `  m2deploy registry gc --registry 10.0.0.5:5000 --dry-run
+  m2deploy registry gc --registry 10.0.0.5:5000 --registry-local --keep 5`,
+	RunE: runRegistryGC,
+}
+
+func init() {
+	rootCmd.AddCommand(registryCmd)
+
+	// GC command
+	registryCmd.AddCommand(registryGCCmd)
+	registryGCCmd.Flags().IntVar(&registryGCKeep, "keep", constants.DefaultRegistryGCKeep, "Newest images to keep per component in addition to those in use")
+}
+
+func runRegistryGC(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	registryClient, err := newRegistryClient(logger)
+	if err != nil {
+		return formatError("registry gc", err)
+	}
+	if err := registryClient.Ping(); err != nil {
+		return err
+	}
+
+	// Repositories of the application's components
+	cfg := getConfig()
+	var repositories []string
+	for _, component := range []string{constants.ComponentBackend, constants.ComponentFrontend} {
+		repository, _, _ := registry.SplitReference(cfg.GetLocalImageName(component))
+		repositories = append(repositories, registry.RepositoryPath(repository))
+	}
+
+	tags, err := registryClient.ListTags(repositories)
+	if err != nil {
+		return fmt.Errorf("failed to list registry tags: %w", err)
+	}
+
+	// Images of the current and previous releases must survive
+	k8sClient := newK8sClient(logger)
+	releaseImages, err := k8sClient.ReplicaSetImages(viper.GetString("namespace"))
+	if err != nil {
+		return fmt.Errorf("failed to read release history: %w", err)
+	}
+	protected := registryClient.ProtectedDigests(releaseImages)
+	logger.Debug("%d digests referenced by releases", len(protected))
+
+	deletions := registry.PlanGC(tags, protected, registryGCKeep)
+	logger.Info("Registry %s: %d tags, %d images to delete (keeping %d newest per component and all in use)",
+		registryClient.Address, len(tags), len(deletions), registryGCKeep)
+
+	if len(deletions) == 0 {
+		logger.Success("Nothing to prune")
+		return nil
+	}
+
+	for _, tag := range deletions {
+		if viper.GetBool("dry-run") {
+			logger.DryRun("Would delete %s:%s (%s)", tag.Repository, tag.Tag, tag.Digest)
+			continue
+		}
+		if err := registryClient.DeleteManifest(tag.Repository, tag.Digest); err != nil {
+			return err
+		}
+		logger.Info("Deleted %s:%s (%s)", tag.Repository, tag.Tag, tag.Digest)
+	}
+
+	// Deleting manifests only unlinks them; the registry's GC frees the blobs
+	if viper.GetBool("registry-local") {
+		dockerClient := newDockerClient(logger)
+		if _, err := dockerClient.ExecInContainer(constants.RegistryContainerName,
+			"registry", "garbage-collect", "--delete-untagged", "/etc/docker/registry/config.yml"); err != nil {
+			return fmt.Errorf("registry garbage collection failed: %w", err)
+		}
+		logger.Success("Registry storage garbage-collected")
+	} else if !viper.GetBool("dry-run") {
+		logger.Info("Run the registry's garbage collector to reclaim disk space")
+	}
+
+	return nil
+}
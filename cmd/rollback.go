@@ -8,7 +8,6 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/wapsol/m2deploy/pkg/constants"
-	"github.com/wapsol/m2deploy/pkg/prereq"
 )
 
 var (
@@ -43,7 +42,7 @@ func runRollback(cmd *cobra.Command, args []string) error {
 	defer logger.Close()
 
 	// Always check prerequisites first (fail-fast)
-	checker := prereq.NewChecker(logger)
+	checker := newChecker(logger)
 	checker.CheckRollbackPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
 
 	// If --check flag is set, print results and exit
@@ -5,24 +5,34 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/containerd"
+	"github.com/wapsol/m2deploy/pkg/distribution"
+	"github.com/wapsol/m2deploy/pkg/kubectl"
+	"github.com/wapsol/m2deploy/pkg/target"
 )
 
 var (
-	repoURL       string
-	workspacePath string
-	namespace     string
-	kubeconfig    string
-	dryRun        bool
-	verbose       bool
-	useSudo       bool
-	force         bool
-	appName       string
-	imagePrefix   string
-	k8sDir        string
-	localImageTag string
-	checkOnly     bool
-	logFile       string
-	noLogFile     bool
+	repoURL          string
+	workspacePath    string
+	namespace        string
+	kubeconfig       string
+	kubeContext      string
+	kubeDistribution string
+	targetNames      []string
+	targetsFile      string
+	targetStrategy   string
+	dryRun           bool
+	verbose          bool
+	useSudo          bool
+	force            bool
+	appName          string
+	imagePrefix      string
+	k8sDir           string
+	localImageTag    string
+	checkOnly        bool
+	logFile          string
+	noLogFile        bool
 
 	// SSH configuration
 	sshUser    string
@@ -31,14 +41,46 @@ var (
 	sshTimeout int
 
 	// Distribution behavior
-	workerTempDir     string
-	parallelWorkers   int
-	retryCount        int
-	minWorkers        int
-	skipWorkerCleanup bool
-	workers           string
+	workerTempDir       string
+	parallelWorkers     int
+	parallelPerWorker   int
+	containerRuntime    string
+	containerdSocket    string
+	retryCount          int
+	minWorkers          int
+	skipWorkerCleanup   bool
+	workers             string
+	inventoryFile       string
+	nodeSelector        string
+	manifestTargeting   bool
+	workerHealthFile    string
+	quarantineAfter     int
+	quarantineCordon    bool
+	transferCompression string
+	deltaTransfer       bool
+	transferResume      bool
+	transferChunkSize   int
+	transferStreams     int
+	fanOut              bool
+	fanOutSeeds         int
+	forceDistribute     bool
+	transferRateLimit   string
+	workerRateLimit     string
+	distributionMode    string
+	loaderImage         string
+
+	// Registry distribution
+	registryAddress  string
+	registryUsername string
+	registryPassword string
+	registryPassIn   bool
+	registryInsecure bool
+	registryLocal    bool
 )
 
+// registryPasswordEnv is the environment variable holding the registry password
+const registryPasswordEnv = "M2DEPLOY_REGISTRY_PASSWORD"
+
 var rootCmd = &cobra.Command{
 	Use:   "m2deploy",
 	Short: "Generic Web Application Deployment Tool",
@@ -100,16 +142,50 @@ func init() {
 	rootCmd.PersistentFlags().IntVar(&sshTimeout, "ssh-timeout", 30, "SSH connection timeout in seconds")
 
 	// Global flags - Distribution Behavior
+	rootCmd.PersistentFlags().StringVar(&distributionMode, "distribution", distribution.ModeSSH, "Image distribution backend: ssh (copy to workers over SSH), daemonset (in-cluster loader, no SSH) or registry (push to --registry)")
+	rootCmd.PersistentFlags().StringVar(&loaderImage, "loader-image", constants.DefaultLoaderImage, "Image for the in-cluster loader DaemonSet (needs sh and nsenter)")
+	rootCmd.PersistentFlags().StringVar(&containerRuntime, "runtime", containerd.RuntimeAuto, "Container runtime command on nodes: auto (detect per node), k0s (k0s ctr), ctr or nerdctl")
+	rootCmd.PersistentFlags().StringVar(&containerdSocket, "containerd-socket", "", "Containerd socket for ctr and nerdctl (default: detected, e.g. /run/k3s/containerd/containerd.sock)")
 	rootCmd.PersistentFlags().StringVar(&workerTempDir, "worker-temp-dir", "/tmp", "Temporary directory on worker nodes")
 	rootCmd.PersistentFlags().IntVar(&parallelWorkers, "parallel-workers", 3, "Distribute to N workers in parallel")
+	rootCmd.PersistentFlags().IntVar(&parallelPerWorker, "parallel-per-worker", 1, "Distributions sent to one worker at a time when components are distributed concurrently")
 	rootCmd.PersistentFlags().IntVar(&retryCount, "retry-count", 3, "Number of retries per worker on failure")
 	rootCmd.PersistentFlags().IntVar(&minWorkers, "min-workers", 0, "Minimum workers that must succeed (0 = all required)")
 	rootCmd.PersistentFlags().BoolVar(&skipWorkerCleanup, "skip-worker-cleanup", false, "Keep tarballs on workers for debugging")
 	rootCmd.PersistentFlags().StringVar(&workers, "workers", "", "Comma-separated worker IPs (override auto-discovery)")
+	rootCmd.PersistentFlags().StringVar(&inventoryFile, "inventory", "", "Worker inventory file with per-host SSH settings and labels")
+	rootCmd.PersistentFlags().StringVar(&nodeSelector, "node-selector", "", "Distribute only to worker nodes matching this label selector (e.g. role=app,!gpu)")
+	rootCmd.PersistentFlags().StringVar(&workerHealthFile, "worker-health-file", constants.DefaultWorkerHealthFile, "File recording worker failures and quarantine across runs (empty = not tracked)")
+	rootCmd.PersistentFlags().IntVar(&quarantineAfter, "quarantine-after", constants.DefaultQuarantineAfter, "Quarantine a worker after this many consecutive failed runs (0 = never)")
+	rootCmd.PersistentFlags().BoolVar(&quarantineCordon, "quarantine-cordon", false, "Cordon quarantined workers so no pods are scheduled where the image is missing")
+	rootCmd.PersistentFlags().BoolVar(&manifestTargeting, "manifest-targeting", true, "Distribute each image only to nodes its workloads can be scheduled on (nodeSelector, required node affinity, taints)")
+	rootCmd.PersistentFlags().BoolVar(&deltaTransfer, "delta-transfer", false, "Send only image layers missing from each worker's containerd (falls back to the full tarball)")
+	rootCmd.PersistentFlags().StringVar(&transferCompression, "transfer-compression", constants.DefaultTransferCompression, "Tarball compression for worker transfers: zstd, gzip, or none (falls back if a tool is missing)")
+	rootCmd.PersistentFlags().BoolVar(&transferResume, "transfer-resume", true, "Resume partial transfers left on workers by failed attempts")
+	rootCmd.PersistentFlags().IntVar(&transferChunkSize, "transfer-chunk-size", 0, "Send tarballs in chunks of N MB (0 = single stream)")
+	rootCmd.PersistentFlags().IntVar(&transferStreams, "transfer-streams", 4, "Chunks sent in parallel over one SSH connection per worker")
+	rootCmd.PersistentFlags().BoolVar(&fanOut, "fan-out", false, "Let workers that received the image forward it to the remaining workers over SSH")
+	rootCmd.PersistentFlags().IntVar(&fanOutSeeds, "fan-out-seeds", 0, "Workers seeded directly by the controller in fan-out mode (0 = --parallel-workers)")
+	rootCmd.PersistentFlags().StringVar(&transferRateLimit, "transfer-rate-limit", "", "Total bandwidth for transfers to workers, e.g. 50M or 500K per second (plain numbers are MB/s; empty = unlimited)")
+	rootCmd.PersistentFlags().StringVar(&workerRateLimit, "transfer-rate-limit-per-worker", "", "Bandwidth for transfers to each worker, same format as --transfer-rate-limit")
+	rootCmd.PersistentFlags().BoolVar(&forceDistribute, "force-distribute", false, "Send images even to workers that already hold the exact digest")
+
+	// Global flags - Registry
+	rootCmd.PersistentFlags().StringVar(&registryAddress, "registry", "", "Registry host:port for --distribution registry (must be reachable from the nodes)")
+	rootCmd.PersistentFlags().StringVar(&registryUsername, "registry-username", "", "Registry username")
+	rootCmd.PersistentFlags().StringVar(&registryPassword, "registry-password", "", "Registry password (visible to other users in the process list; prefer --registry-password-stdin or "+registryPasswordEnv+")")
+	rootCmd.PersistentFlags().BoolVar(&registryPassIn, "registry-password-stdin", false, "Read the registry password from stdin")
+	rootCmd.PersistentFlags().BoolVar(&registryInsecure, "registry-insecure", false, "Allow plain HTTP or self-signed TLS for the registry")
+	rootCmd.PersistentFlags().BoolVar(&registryLocal, "registry-local", false, "Run the registry as a container on this host (port taken from --registry)")
 
 	// Global flags - Kubernetes
 	rootCmd.PersistentFlags().StringVar(&namespace, "namespace", "magnetiq-v2", "Kubernetes namespace")
-	rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "Path to kubeconfig file (default: k0s)")
+	rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "Path to kubeconfig file (default: the distribution's)")
+	rootCmd.PersistentFlags().StringVar(&kubeContext, "kube-context", "", "Kubeconfig context to use (default: current context)")
+	rootCmd.PersistentFlags().StringVar(&kubeDistribution, "kube-distribution", kubectl.DistributionAuto, "Kubernetes distribution driving kubectl: auto (detect), k0s (k0s kubectl), k3s (k3s kubectl) or kubectl (plain kubectl with --kubeconfig and --kube-context)")
+	rootCmd.PersistentFlags().StringSliceVar(&targetNames, "targets", nil, "Deploy to these clusters of the targets file, e.g. eu,us (deploy and update)")
+	rootCmd.PersistentFlags().StringVar(&targetsFile, "targets-file", constants.DefaultTargetsFile, "File defining the clusters selectable with --targets")
+	rootCmd.PersistentFlags().StringVar(&targetStrategy, "target-strategy", target.StrategySequential, "How --targets are deployed: sequential (stop at the first failed cluster) or parallel (all clusters to completion)")
 	rootCmd.PersistentFlags().StringVar(&k8sDir, "k8s-dir", "k8s", "Kubernetes manifests directory")
 
 	// Bind flags to viper
@@ -121,6 +197,11 @@ func init() {
 	viper.BindPFlag("local-image-tag", rootCmd.PersistentFlags().Lookup("local-image-tag"))
 	viper.BindPFlag("namespace", rootCmd.PersistentFlags().Lookup("namespace"))
 	viper.BindPFlag("kubeconfig", rootCmd.PersistentFlags().Lookup("kubeconfig"))
+	viper.BindPFlag("kube-context", rootCmd.PersistentFlags().Lookup("kube-context"))
+	viper.BindPFlag("kube-distribution", rootCmd.PersistentFlags().Lookup("kube-distribution"))
+	viper.BindPFlag("targets", rootCmd.PersistentFlags().Lookup("targets"))
+	viper.BindPFlag("targets-file", rootCmd.PersistentFlags().Lookup("targets-file"))
+	viper.BindPFlag("target-strategy", rootCmd.PersistentFlags().Lookup("target-strategy"))
 	viper.BindPFlag("k8s-dir", rootCmd.PersistentFlags().Lookup("k8s-dir"))
 	viper.BindPFlag("dry-run", rootCmd.PersistentFlags().Lookup("dry-run"))
 	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
@@ -134,16 +215,44 @@ func init() {
 	viper.BindPFlag("ssh-key", rootCmd.PersistentFlags().Lookup("ssh-key"))
 	viper.BindPFlag("ssh-port", rootCmd.PersistentFlags().Lookup("ssh-port"))
 	viper.BindPFlag("ssh-timeout", rootCmd.PersistentFlags().Lookup("ssh-timeout"))
+	viper.BindPFlag("distribution", rootCmd.PersistentFlags().Lookup("distribution"))
+	viper.BindPFlag("loader-image", rootCmd.PersistentFlags().Lookup("loader-image"))
+	viper.BindPFlag("registry", rootCmd.PersistentFlags().Lookup("registry"))
+	viper.BindPFlag("registry-username", rootCmd.PersistentFlags().Lookup("registry-username"))
+	viper.BindPFlag("registry-password", rootCmd.PersistentFlags().Lookup("registry-password"))
+	viper.BindPFlag("registry-password-stdin", rootCmd.PersistentFlags().Lookup("registry-password-stdin"))
+	viper.BindPFlag("registry-insecure", rootCmd.PersistentFlags().Lookup("registry-insecure"))
+	viper.BindPFlag("registry-local", rootCmd.PersistentFlags().Lookup("registry-local"))
 	viper.BindPFlag("worker-temp-dir", rootCmd.PersistentFlags().Lookup("worker-temp-dir"))
 	viper.BindPFlag("parallel-workers", rootCmd.PersistentFlags().Lookup("parallel-workers"))
+	viper.BindPFlag("runtime", rootCmd.PersistentFlags().Lookup("runtime"))
+	viper.BindPFlag("containerd-socket", rootCmd.PersistentFlags().Lookup("containerd-socket"))
+	viper.BindPFlag("parallel-per-worker", rootCmd.PersistentFlags().Lookup("parallel-per-worker"))
 	viper.BindPFlag("retry-count", rootCmd.PersistentFlags().Lookup("retry-count"))
 	viper.BindPFlag("min-workers", rootCmd.PersistentFlags().Lookup("min-workers"))
 	viper.BindPFlag("skip-worker-cleanup", rootCmd.PersistentFlags().Lookup("skip-worker-cleanup"))
 	viper.BindPFlag("workers", rootCmd.PersistentFlags().Lookup("workers"))
+	viper.BindPFlag("inventory", rootCmd.PersistentFlags().Lookup("inventory"))
+	viper.BindPFlag("node-selector", rootCmd.PersistentFlags().Lookup("node-selector"))
+	viper.BindPFlag("worker-health-file", rootCmd.PersistentFlags().Lookup("worker-health-file"))
+	viper.BindPFlag("quarantine-after", rootCmd.PersistentFlags().Lookup("quarantine-after"))
+	viper.BindPFlag("quarantine-cordon", rootCmd.PersistentFlags().Lookup("quarantine-cordon"))
+	viper.BindPFlag("manifest-targeting", rootCmd.PersistentFlags().Lookup("manifest-targeting"))
+	viper.BindPFlag("transfer-compression", rootCmd.PersistentFlags().Lookup("transfer-compression"))
+	viper.BindPFlag("delta-transfer", rootCmd.PersistentFlags().Lookup("delta-transfer"))
+	viper.BindPFlag("transfer-resume", rootCmd.PersistentFlags().Lookup("transfer-resume"))
+	viper.BindPFlag("transfer-chunk-size", rootCmd.PersistentFlags().Lookup("transfer-chunk-size"))
+	viper.BindPFlag("transfer-streams", rootCmd.PersistentFlags().Lookup("transfer-streams"))
+	viper.BindPFlag("fan-out", rootCmd.PersistentFlags().Lookup("fan-out"))
+	viper.BindPFlag("fan-out-seeds", rootCmd.PersistentFlags().Lookup("fan-out-seeds"))
+	viper.BindPFlag("transfer-rate-limit", rootCmd.PersistentFlags().Lookup("transfer-rate-limit"))
+	viper.BindPFlag("transfer-rate-limit-per-worker", rootCmd.PersistentFlags().Lookup("transfer-rate-limit-per-worker"))
+	viper.BindPFlag("force-distribute", rootCmd.PersistentFlags().Lookup("force-distribute"))
 }
 
 func initConfig() {
 	// Only support environment variables and command-line flags
 	// No config file support to force explicit parameterization
 	viper.AutomaticEnv()
+	viper.BindEnv("registry-password", registryPasswordEnv)
 }
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/database"
+	"github.com/wapsol/m2deploy/pkg/distribution"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/prereq"
+	"github.com/wapsol/m2deploy/pkg/target"
+)
+
+// cluster is one target with clients bound to its settings
+type cluster struct {
+	target    target.Target
+	logger    *config.Logger // Prefixes every line with the target name
+	namespace string
+	k8s       *k8s.Client
+	db        *database.Client
+	backend   distribution.Backend // nil when images are not distributed
+}
+
+// selectTargets returns the targets chosen with --targets, or nil when the
+// command runs against the single cluster given by the flags
+func selectTargets() ([]target.Target, error) {
+	names := viper.GetStringSlice("targets")
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if err := target.ValidateStrategy(viper.GetString("target-strategy")); err != nil {
+		return nil, err
+	}
+
+	path, err := expandHome(viper.GetString("targets-file"))
+	if err != nil {
+		return nil, err
+	}
+	file, err := target.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return file.Select(names)
+}
+
+// resolveEnvironment returns the target called name in the targets file or,
+// when there is none, the namespace name on the cluster given by the flags
+func resolveEnvironment(name string) (target.Target, error) {
+	path, err := expandHome(viper.GetString("targets-file"))
+	if err != nil {
+		return target.Target{}, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		file, err := target.Load(path)
+		if err != nil {
+			return target.Target{}, err
+		}
+		if t, ok := file.Targets[name]; ok {
+			return t, nil
+		}
+	}
+	return target.Target{Name: name, Namespace: name}, nil
+}
+
+// withTarget runs fn with the settings of t in place of the flags, so the
+// client constructors connect to its cluster. Workers are always the
+// target's (empty = discovered in its cluster), and every target keeps its
+// own worker health file.
+func withTarget(t target.Target, fn func() error) error {
+	overrides := map[string]string{"workers": t.Workers}
+	for key, value := range map[string]string{
+		"kubeconfig":        t.Kubeconfig,
+		"kube-context":      t.Context,
+		"kube-distribution": t.Distribution,
+		"namespace":         t.Namespace,
+		"inventory":         t.Inventory,
+		"node-selector":     t.NodeSelector,
+	} {
+		if value != "" {
+			overrides[key] = value
+		}
+	}
+	if path := viper.GetString("worker-health-file"); path != "" {
+		overrides["worker-health-file"] = target.Suffixed(path, t.Name)
+	}
+
+	previous := make(map[string]interface{}, len(overrides))
+	for key, value := range overrides {
+		previous[key] = viper.Get(key)
+		viper.Set(key, value)
+	}
+	defer func() {
+		for key, value := range previous {
+			viper.Set(key, value)
+		}
+	}()
+
+	return fn()
+}
+
+// checkTargets runs the prerequisite checks of every target before any
+// cluster is touched. check adds the command's checks for one target.
+func checkTargets(logger *config.Logger, cmdName string, targets []target.Target, check func(checker *prereq.Checker)) error {
+	failed := false
+	for _, t := range targets {
+		err := withTarget(t, func() error {
+			checker := newChecker(logger.WithPrefix("[" + t.Name + "] "))
+			check(checker)
+			if viper.GetBool("check") || checker.HasFailures() {
+				checker.PrintResults()
+			}
+			failed = failed || checker.HasFailures()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// If --check flag is set, the results are printed: exit
+	if viper.GetBool("check") {
+		if failed {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if failed {
+		return formatPrereqError(cmdName)
+	}
+	return nil
+}
+
+// newClusters creates the clients of every target, with a distribution
+// backend when distribute is set
+func newClusters(logger *config.Logger, targets []target.Target, distribute bool) ([]*cluster, error) {
+	clusters := make([]*cluster, 0, len(targets))
+	for _, t := range targets {
+		cl := &cluster{target: t, logger: logger.WithPrefix("[" + t.Name + "] ")}
+		err := withTarget(t, func() error {
+			cl.namespace = viper.GetString("namespace")
+			cl.k8s = newK8sClient(cl.logger)
+			cl.db = database.NewClient(cl.logger, viper.GetBool("dry-run"), cl.namespace, cl.k8s)
+			if !distribute {
+				return nil
+			}
+			backend, err := newDistributionBackend(cl.logger, cl.k8s)
+			cl.backend = backend
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", t.Name, err)
+		}
+		clusters = append(clusters, cl)
+	}
+	return clusters, nil
+}
+
+// runClusters runs fn for every cluster with --target-strategy, prints the
+// outcome per cluster and fails if any cluster failed
+func runClusters(logger *config.Logger, clusters []*cluster, fn func(cl *cluster) error) error {
+	strategy := viper.GetString("target-strategy")
+	byName := make(map[string]*cluster, len(clusters))
+	targets := make([]target.Target, 0, len(clusters))
+	for _, cl := range clusters {
+		byName[cl.target.Name] = cl
+		targets = append(targets, cl.target)
+	}
+
+	logger.Info("Deploying to %d clusters (%s)", len(clusters), strategy)
+	logger.Info("")
+	results := target.Run(targets, strategy, func(t target.Target) error {
+		return fn(byName[t.Name])
+	})
+
+	logger.Info("")
+	logger.Info("Clusters:")
+	for _, r := range results {
+		switch r.Status {
+		case target.StatusSucceeded:
+			logger.Success("  %s: succeeded in %s", r.Target, r.Duration.Round(time.Second))
+		case target.StatusFailed:
+			logger.Error("  %s: failed after %s: %v", r.Target, r.Duration.Round(time.Second), r.Error)
+		default:
+			logger.Warning("  %s: skipped, not touched after an earlier cluster failed", r.Target)
+		}
+	}
+
+	if failed := target.Failed(results); failed > 0 {
+		return fmt.Errorf("%d of %d clusters failed", failed, len(results))
+	}
+	return nil
+}
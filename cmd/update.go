@@ -3,13 +3,18 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/wapsol/m2deploy/pkg/config"
 	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/distribution"
+	"github.com/wapsol/m2deploy/pkg/docker"
 	"github.com/wapsol/m2deploy/pkg/payload"
 	"github.com/wapsol/m2deploy/pkg/prereq"
+	"github.com/wapsol/m2deploy/pkg/target"
 )
 
 var (
@@ -62,23 +67,38 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 
 	logger.Info("Using workspace: %s", workDir)
 
-	// Always check prerequisites first (fail-fast)
-	checker := prereq.NewChecker(logger)
-	checker.CheckUpdatePrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
+	// Several clusters from the targets file
+	targets, err := selectTargets()
+	if err != nil {
+		return formatError("update", err)
+	}
 
-	// If --check flag is set, print results and exit
-	if viper.GetBool("check") {
-		checker.PrintResults()
-		if checker.HasFailures() {
-			os.Exit(1)
+	// Always check prerequisites first (fail-fast), of every cluster
+	if targets != nil {
+		err := checkTargets(logger, "update", targets, func(checker *prereq.Checker) {
+			checker.CheckUpdatePrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		checker := newChecker(logger)
+		checker.CheckUpdatePrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
+
+		// If --check flag is set, print results and exit
+		if viper.GetBool("check") {
+			checker.PrintResults()
+			if checker.HasFailures() {
+				os.Exit(1)
+			}
+			os.Exit(0)
 		}
-		os.Exit(0)
-	}
 
-	// Otherwise, fail fast if prerequisites not met
-	if checker.HasFailures() {
-		checker.PrintResults()
-		return formatPrereqError("update")
+		// Otherwise, fail fast if prerequisites not met
+		if checker.HasFailures() {
+			checker.PrintResults()
+			return formatPrereqError("update")
+		}
 	}
 
 	cfg := getConfig()
@@ -116,6 +136,8 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 
 	// Resolve image tag with clear precedence
 	cfg.LocalImageTag = cfg.ResolveImageTag(logger, updateTag, workDir)
+	// Build, save and roll out the same tag
+	dockerClient.Config = cfg
 
 	// Validate payload structure
 	validator := payload.NewValidator(logger)
@@ -123,6 +145,11 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("payload validation failed: %w", err)
 	}
 
+	// Build once, then roll out to every cluster
+	if targets != nil {
+		return updateTargets(logger, cfg, workDir, dockerClient, targets)
+	}
+
 	// 2. Backup database
 	if updateBackupDB && (updateComponent == constants.ComponentBackend || updateComponent == constants.ComponentBoth) {
 		logger.Info("Step 2/6: Backing up database")
@@ -209,3 +236,108 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// updateTargets builds the images once and rolls them out to every selected
+// cluster: database backup, image distribution, migrations and the new images
+func updateTargets(logger *config.Logger, cfg *config.Config, workDir string, dockerClient *docker.Client, targets []target.Target) error {
+	clusters, err := newClusters(logger, targets, true)
+	if err != nil {
+		return formatError("update", err)
+	}
+
+	logger.Info("Building new images")
+	components := getComponents(updateComponent)
+	workloads := readWorkloads(logger, workDir)
+	var images []distribution.Image
+	for _, component := range components {
+		logger.Info("Building %s...", component)
+		if err := dockerClient.Build(workDir, component); err != nil {
+			return err
+		}
+		logger.Success("Built %s image", component)
+
+		img := distribution.Image{
+			Component:   component,
+			Name:        cfg.GetLocalImageName(component),
+			TarballPath: fmt.Sprintf(constants.TarballPathTemplate, component),
+		}
+		img.Placements = distribution.PlacementsFor(workloads, img.Name)
+		digest, err := dockerClient.GetImageDigest(component)
+		if err != nil && !viper.GetBool("dry-run") {
+			return fmt.Errorf("failed to read %s image digest: %w", component, err)
+		}
+		img.Digest = digest
+		images = append(images, img)
+	}
+	logger.Info("")
+
+	// Each image is exported once and its tarball shared by all clusters
+	exports := newImageExports(logger, func(img distribution.Image) error {
+		return dockerClient.SaveImage(img.Component, img.TarballPath)
+	})
+	defer exports.Remove()
+	err = runClusters(logger, clusters, func(cl *cluster) error {
+		return updateCluster(cl, components, exports.ForTarget(images, cl.target.Name), exports)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Success("Update completed successfully")
+	logger.Info("New version: %s", cfg.LocalImageTag)
+	return nil
+}
+
+// updateCluster rolls the built images out to one cluster
+func updateCluster(cl *cluster, components []string, images []distribution.Image, exports *imageExports) error {
+	logger := cl.logger
+	updatesBackend := updateComponent == constants.ComponentBackend || updateComponent == constants.ComponentBoth
+
+	if updateBackupDB && updatesBackend {
+		if err := cl.db.Backup(filepath.Join(constants.DefaultBackupPath, cl.target.Name), true); err != nil {
+			logger.Warning("Database backup failed: %v", err)
+			logger.Warning("Continuing with update...")
+		}
+	}
+
+	logger.Info("Distributing images to worker nodes (%s)", cl.backend.Name())
+	if err := cl.backend.Prepare(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := cl.backend.Cleanup(); err != nil {
+			logger.Warning("Failed to clean up %s distribution: %v", cl.backend.Name(), err)
+		}
+	}()
+	if err := distributeImages(logger, cl.backend, images, exports); err != nil {
+		return err
+	}
+
+	if updateAutoMigrate && updatesBackend {
+		if err := cl.db.Migrate(); err != nil {
+			logger.Warning("Migrations failed: %v", err)
+			logger.Info("You may need to run migrations manually with 'm2deploy db migrate' against this cluster")
+		}
+	}
+
+	logger.Info("Updating Kubernetes deployments")
+	for _, img := range images {
+		if err := cl.k8s.SetImage(getDeploymentName(img.Component), img.Component, img.Name); err != nil {
+			return err
+		}
+	}
+
+	if updateWait {
+		for _, component := range components {
+			deploymentName := getDeploymentName(component)
+			if err := cl.k8s.WaitForRollout(deploymentName, 5*time.Minute); err != nil {
+				logger.Error("Rollout failed for %s", deploymentName)
+				logger.Info("Consider rolling back with 'm2deploy rollback --component %s' against this cluster", component)
+				return err
+			}
+		}
+	}
+
+	logger.Success("Updated")
+	return nil
+}
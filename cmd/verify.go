@@ -7,7 +7,6 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/wapsol/m2deploy/pkg/k8s"
-	"github.com/wapsol/m2deploy/pkg/prereq"
 )
 
 var verifyCmd = &cobra.Command{
@@ -29,7 +28,7 @@ func runVerify(cmd *cobra.Command, args []string) error {
 	defer logger.Close()
 
 	// Always check prerequisites first (fail-fast)
-	checker := prereq.NewChecker(logger)
+	checker := newChecker(logger)
 	checker.CheckVerifyPrereqs(viper.GetString("namespace"), viper.GetBool("use-sudo"))
 
 	// If --check flag is set, print results and exit
@@ -47,13 +46,11 @@ func runVerify(cmd *cobra.Command, args []string) error {
 		return formatPrereqError("verify")
 	}
 
-	useSudo := getUseSudoWithAutoDetect(logger)
 	k8sClient := k8s.NewClient(
 		logger,
 		false, // Never dry-run verify
 		viper.GetString("namespace"),
-		viper.GetString("kubeconfig"),
-		useSudo,
+		newKubectl(logger),
 	)
 
 	logger.Info("Verifying Magnetiq2 deployment in namespace: %s", viper.GetString("namespace"))
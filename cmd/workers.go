@@ -0,0 +1,532 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/containerd"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/registry"
+	"github.com/wapsol/m2deploy/pkg/ssh"
+)
+
+var (
+	workersGCKeep     int
+	workersReleaseAll bool
+	workersOn         []string
+	workersGroup      bool
+	workersOutput     string
+)
+
+var workersCmd = &cobra.Command{
+	Use:   "workers",
+	Short: "Worker node operations",
+	Long:  `Manage the worker nodes images are distributed to over SSH.`,
+}
+
+var workersGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove old application images from the workers",
+	Long: `Remove old application images from each worker's containerd over SSH.
+
+Images used by any pod in the cluster and by the ReplicaSets of the namespace
+(the current release and the revision history kept for rollback) are always
+kept, as are the --keep newest images of each component. All tags of an
+image are removed together so containerd can free its content.`,
+	Example: `  m2deploy workers gc --dry-run
+  m2deploy workers gc --keep 3`,
+	RunE: runWorkersGC,
+}
+
+var workersStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show worker health and quarantine state",
+	Long: `Show the health m2deploy recorded for each worker across runs: consecutive
+and total failed runs, the last error and its class, and whether the worker is
+quarantined. Quarantined workers are skipped by ssh distribution until released.`,
+	Example: `  m2deploy workers status`,
+	RunE:    runWorkersStatus,
+}
+
+var workersReleaseCmd = &cobra.Command{
+	Use:   "release [worker...]",
+	Short: "Release quarantined workers",
+	Long: `Lift the quarantine of the given workers and reset their failure count.
+Workers cordoned by --quarantine-cordon are uncordoned.`,
+	Example: `  m2deploy workers release worker-3
+  m2deploy workers release --all`,
+	RunE: runWorkersRelease,
+}
+
+var workersExecCmd = &cobra.Command{
+	Use:   "exec -- <command>",
+	Short: "Run a command on the workers",
+	Long: `Run a shell command on every worker (or those named with --on) in parallel,
+with the same SSH user, key and port settings as distribution. The output and
+exit code of each worker are printed; the command fails if any worker did.`,
+	Example: `  m2deploy workers exec -- sudo k0s ctr images list -q
+  m2deploy workers exec --group -- df -h /tmp
+  m2deploy workers exec --on worker-1,worker-2 --output json -- uptime`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runWorkersExec,
+}
+
+var workersCopyCmd = &cobra.Command{
+	Use:   "copy <local> <remote>",
+	Short: "Copy a file to the workers",
+	Long: `Copy a local file to every worker (or those named with --on) in parallel.
+A remote path ending in "/" is a directory the file is copied into. Each copy
+is verified with SHA-256.`,
+	Example: `  m2deploy workers copy ./registries.yaml /tmp/
+  m2deploy workers copy --on worker-3 ./fix.sh /tmp/fix.sh`,
+	Args: cobra.ExactArgs(2),
+	RunE: runWorkersCopy,
+}
+
+func init() {
+	rootCmd.AddCommand(workersCmd)
+
+	// Exec and copy commands
+	workersCmd.AddCommand(workersExecCmd)
+	workersCmd.AddCommand(workersCopyCmd)
+	for _, c := range []*cobra.Command{workersExecCmd, workersCopyCmd} {
+		c.Flags().StringSliceVar(&workersOn, "on", nil, "Workers to run on (default: all)")
+		c.Flags().BoolVar(&workersGroup, "group", false, "Group workers with identical output")
+		c.Flags().StringVarP(&workersOutput, "output", "o", "text", "Output format (text, json)")
+	}
+
+	// Status and release commands
+	workersCmd.AddCommand(workersStatusCmd)
+	workersCmd.AddCommand(workersReleaseCmd)
+	workersReleaseCmd.Flags().BoolVar(&workersReleaseAll, "all", false, "Release every quarantined worker")
+
+	// GC command
+	workersCmd.AddCommand(workersGCCmd)
+	workersGCCmd.Flags().IntVar(&workersGCKeep, "keep", constants.DefaultWorkerGCKeep, "Newest images to keep per component in addition to those in use")
+}
+
+func runWorkersGC(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	distributor, err := newSSHDistributor(logger)
+	if err != nil {
+		return formatError("workers gc", err)
+	}
+	k8sClient := newK8sClient(logger)
+	workers, err := distributor.GetWorkerNodes(k8sClient)
+	if err != nil {
+		return formatError("workers gc", err)
+	}
+
+	return gcWorkers(logger, distributor, k8sClient, workers, workersGCKeep)
+}
+
+func runWorkersExec(cmd *cobra.Command, args []string) error {
+	command := strings.Join(args, " ")
+	return runOnWorkers(cmd, "workers exec", fmt.Sprintf("Would run on %%s: %s", command), func(distributor *ssh.Distributor, worker *ssh.WorkerNode) *ssh.ExecResult {
+		return distributor.Exec(worker, command)
+	})
+}
+
+func runWorkersCopy(cmd *cobra.Command, args []string) error {
+	localPath, remotePath := args[0], args[1]
+	if _, err := os.Stat(localPath); err != nil {
+		return formatError("workers copy", err)
+	}
+	return runOnWorkers(cmd, "workers copy", fmt.Sprintf("Would copy %s to %%s:%s", localPath, remotePath), func(distributor *ssh.Distributor, worker *ssh.WorkerNode) *ssh.ExecResult {
+		return distributor.Copy(worker, localPath, remotePath)
+	})
+}
+
+// runOnWorkers runs fn on the selected workers in parallel and reports the
+// results. dryRunFormat receives the worker name.
+func runOnWorkers(cmd *cobra.Command, name, dryRunFormat string, fn func(distributor *ssh.Distributor, worker *ssh.WorkerNode) *ssh.ExecResult) error {
+	if workersOutput != "text" && workersOutput != "json" {
+		return formatError(name, fmt.Errorf("invalid --output %q (expected text or json)", workersOutput))
+	}
+
+	logger := createLogger()
+	defer logger.Close()
+
+	distributor, err := newSSHDistributor(logger)
+	if err != nil {
+		return formatError(name, err)
+	}
+	workers, err := distributor.GetWorkerNodes(newK8sClient(logger))
+	if err != nil {
+		return formatError(name, err)
+	}
+	workers, err = selectWorkers(workers, workersOn)
+	if err != nil {
+		return formatError(name, err)
+	}
+
+	if viper.GetBool("dry-run") {
+		for _, worker := range workers {
+			logger.DryRun(dryRunFormat, worker.Name)
+		}
+		return nil
+	}
+
+	results := make([]*ssh.ExecResult, len(workers))
+	forEachWorker(distributor, workers, func(i int, worker *ssh.WorkerNode) {
+		results[i] = fn(distributor, worker)
+	})
+
+	if err := printExecResults(cmd.OutOrStdout(), logger, results); err != nil {
+		return formatError(name, err)
+	}
+	return execFailures(results)
+}
+
+// selectWorkers keeps the workers named in names (all if names is empty)
+func selectWorkers(workers []*ssh.WorkerNode, names []string) ([]*ssh.WorkerNode, error) {
+	if len(names) == 0 {
+		return workers, nil
+	}
+
+	byName := make(map[string]*ssh.WorkerNode, len(workers))
+	for _, worker := range workers {
+		byName[worker.Name] = worker
+	}
+	var selected []*ssh.WorkerNode
+	for _, name := range names {
+		worker, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown worker %s", name)
+		}
+		selected = append(selected, worker)
+	}
+	return selected, nil
+}
+
+// printExecResults prints per-worker (or grouped) results as text through
+// the logger, or as JSON to out
+func printExecResults(out io.Writer, logger *config.Logger, results []*ssh.ExecResult) error {
+	var value interface{} = results
+	if workersGroup {
+		value = ssh.GroupResults(results)
+	}
+
+	if workersOutput == "json" {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode results: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	if workersGroup {
+		for _, group := range ssh.GroupResults(results) {
+			printExecResult(logger, strings.Join(group.Workers, ", "), group.ExitCode, group.Output, group.Error)
+		}
+	} else {
+		for _, result := range results {
+			printExecResult(logger, fmt.Sprintf("%s (%s)", result.Worker, result.IP), result.ExitCode, result.Output, result.Error)
+		}
+	}
+	return nil
+}
+
+// printExecResult prints one worker's or group's result
+func printExecResult(logger *config.Logger, label string, exitCode int, output, errMsg string) {
+	switch {
+	case errMsg != "":
+		logger.Error("[%s] %s", label, errMsg)
+	case exitCode != 0:
+		logger.Warning("[%s] exit code %d", label, exitCode)
+	default:
+		logger.Success("[%s] exit code 0", label)
+	}
+	if output = strings.TrimRight(output, "\n"); output != "" {
+		logger.Print(output)
+	}
+}
+
+// execFailures reports the workers where the command failed
+func execFailures(results []*ssh.ExecResult) error {
+	var failures []string
+	for _, result := range results {
+		if result.ExitCode != 0 {
+			failures = append(failures, fmt.Sprintf("%s (exit %d)", result.Worker, result.ExitCode))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed on %d of %d workers: %s", len(failures), len(results), strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+func runWorkersStatus(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	store, err := newHealthStore()
+	if err != nil {
+		return formatError("workers status", err)
+	}
+	if store == nil {
+		return formatError("workers status", fmt.Errorf("worker health tracking is disabled (--worker-health-file is empty)"))
+	}
+
+	// Discovered workers first, then workers only known from earlier runs
+	var names []string
+	known := make(map[string]bool)
+	addresses := make(map[string]string)
+	if distributor, err := newSSHDistributor(logger); err == nil {
+		if workers, err := distributor.GetWorkerNodes(newK8sClient(logger)); err == nil {
+			for _, w := range workers {
+				names = append(names, w.Name)
+				known[w.Name] = true
+				addresses[w.Name] = w.IP
+			}
+		} else {
+			logger.Warning("Cannot discover workers, showing recorded state only: %v", err)
+		}
+	}
+	for _, name := range store.Names() {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+
+	logger.Info("Worker health (%s):", store.Path())
+	quarantined := 0
+	for _, name := range names {
+		label := name
+		if addr := addresses[name]; addr != "" {
+			label = fmt.Sprintf("%s (%s)", name, addr)
+		} else if !known[name] {
+			label = name + " (not discovered)"
+		}
+
+		record := store.Get(name)
+		switch {
+		case record == nil:
+			logger.Info("  %s: no runs recorded", label)
+		case record.Quarantined:
+			quarantined++
+			cordoned := ""
+			if record.Cordoned {
+				cordoned = ", cordoned"
+			}
+			logger.Error("  %s: QUARANTINED since %s%s - %d failed runs, last %s: %s",
+				label, record.QuarantinedAt.Format(time.RFC3339), cordoned, record.ConsecutiveFailures, record.ErrorClass, record.LastError)
+		case record.ConsecutiveFailures > 0:
+			logger.Warning("  %s: %d consecutive failed runs, last %s at %s: %s",
+				label, record.ConsecutiveFailures, record.ErrorClass, record.LastFailure.Format(time.RFC3339), record.LastError)
+		default:
+			logger.Success("  %s: healthy (last success %s, %d failed runs in total)",
+				label, formatTime(record.LastSuccess), record.TotalFailures)
+		}
+	}
+
+	if quarantined > 0 {
+		logger.Info("")
+		logger.Info("Release fixed workers with: m2deploy workers release <name>")
+	}
+	return nil
+}
+
+func runWorkersRelease(cmd *cobra.Command, args []string) error {
+	logger := createLogger()
+	defer logger.Close()
+
+	if len(args) == 0 && !workersReleaseAll {
+		return formatError("workers release", fmt.Errorf("name the workers to release or use --all"))
+	}
+
+	store, err := newHealthStore()
+	if err != nil {
+		return formatError("workers release", err)
+	}
+	if store == nil {
+		return formatError("workers release", fmt.Errorf("worker health tracking is disabled (--worker-health-file is empty)"))
+	}
+
+	names := args
+	if workersReleaseAll {
+		names = nil
+		for _, name := range store.Names() {
+			if store.IsQuarantined(name) {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			logger.Success("No quarantined workers")
+			return nil
+		}
+	}
+
+	k8sClient := newK8sClient(logger)
+	for _, name := range names {
+		if viper.GetBool("dry-run") {
+			logger.DryRun("Would release worker %s", name)
+			continue
+		}
+
+		previous := store.Release(name)
+		if previous == nil {
+			logger.Warning("No health recorded for worker %s", name)
+			continue
+		}
+		if previous.Cordoned {
+			if err := k8sClient.Uncordon(name); err != nil {
+				logger.Warning("Failed to uncordon %s: %v", name, err)
+			} else {
+				logger.Info("Uncordoned node %s", name)
+			}
+		}
+		if previous.Quarantined {
+			logger.Success("Released worker %s", name)
+		} else {
+			logger.Success("Reset failure count of worker %s", name)
+		}
+	}
+
+	if viper.GetBool("dry-run") {
+		return nil
+	}
+	return store.Save()
+}
+
+// formatTime renders a timestamp for status output ("never" if unset)
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// workerGCPlan is the outcome of listing one worker's images
+type workerGCPlan struct {
+	worker   *ssh.WorkerNode
+	images   int
+	removals []containerd.ReleaseImage
+	err      error
+}
+
+// gcWorkers removes old application images from every worker, keeping the
+// keep newest per component and every image in use
+func gcWorkers(logger *config.Logger, distributor *ssh.Distributor, k8sClient *k8s.Client, workers []*ssh.WorkerNode, keep int) error {
+	// Repositories of the application's components
+	cfg := getConfig()
+	var repositories []string
+	for _, component := range []string{constants.ComponentBackend, constants.ComponentFrontend} {
+		repository, _, _ := registry.SplitReference(cfg.GetLocalImageName(component))
+		repositories = append(repositories, repository)
+	}
+
+	// Images of running pods and of the current and previous releases must survive
+	inUse, err := k8sClient.PodImages()
+	if err != nil {
+		return fmt.Errorf("failed to read images in use: %w", err)
+	}
+	releaseImages, err := k8sClient.ReplicaSetImages(k8sClient.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to read release history: %w", err)
+	}
+	inUse = append(inUse, releaseImages...)
+	logger.Debug("%d image references in use", len(inUse))
+
+	logger.Info("Listing application images on %d workers (keeping %d newest per component and all in use)...", len(workers), keep)
+	plans := make([]*workerGCPlan, len(workers))
+	forEachWorker(distributor, workers, func(i int, worker *ssh.WorkerNode) {
+		plan := &workerGCPlan{worker: worker}
+		images, err := distributor.ListReleaseImages(worker, repositories)
+		if err != nil {
+			plan.err = err
+		} else {
+			plan.images = len(images)
+			plan.removals = containerd.PlanGC(images, inUse, keep)
+		}
+		plans[i] = plan
+	})
+
+	var failures []string
+	total := 0
+	for _, plan := range plans {
+		if plan.err != nil {
+			logger.Warning("[%s] %v", plan.worker.Name, plan.err)
+			failures = append(failures, plan.worker.Name)
+			continue
+		}
+		logger.Info("[%s] %d images, %d to remove", plan.worker.Name, plan.images, len(plan.removals))
+		for _, image := range plan.removals {
+			if viper.GetBool("dry-run") {
+				logger.DryRun("[%s] Would remove %s (%s)", plan.worker.Name, strings.Join(image.Tags(), ", "), image.ID)
+			} else {
+				logger.Debug("[%s] Removing %s (%s)", plan.worker.Name, strings.Join(image.Tags(), ", "), image.ID)
+			}
+		}
+		total += len(plan.removals)
+	}
+
+	if total == 0 {
+		logger.Success("Nothing to remove")
+		return gcFailures(failures)
+	}
+	if viper.GetBool("dry-run") {
+		return gcFailures(failures)
+	}
+
+	var mu sync.Mutex
+	forEachWorker(distributor, workers, func(i int, worker *ssh.WorkerNode) {
+		plan := plans[i]
+		if plan.err != nil || len(plan.removals) == 0 {
+			return
+		}
+
+		var refs []string
+		for _, image := range plan.removals {
+			refs = append(refs, image.Refs...)
+		}
+		if err := distributor.RemoveImages(worker, refs); err != nil {
+			logger.Warning("[%s] %v", worker.Name, err)
+			mu.Lock()
+			failures = append(failures, worker.Name)
+			mu.Unlock()
+			return
+		}
+		logger.Success("[%s] Removed %d images", worker.Name, len(plan.removals))
+	})
+
+	return gcFailures(failures)
+}
+
+// gcFailures reports the workers that could not be cleaned
+func gcFailures(failures []string) error {
+	if len(failures) > 0 {
+		return fmt.Errorf("image cleanup failed on %d workers: %s", len(failures), strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// forEachWorker runs fn for every worker, at most --parallel-workers at a time
+func forEachWorker(distributor *ssh.Distributor, workers []*ssh.WorkerNode, fn func(i int, worker *ssh.WorkerNode)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(distributor.Parallel, 1))
+
+	for i, worker := range workers {
+		wg.Add(1)
+		go func(idx int, w *ssh.WorkerNode) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			fn(idx, w)
+		}(i, worker)
+	}
+	wg.Wait()
+}
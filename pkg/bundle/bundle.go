@@ -0,0 +1,378 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/manifest"
+)
+
+// Files and directories inside a bundle
+const (
+	DescriptorFile = "bundle.json"
+	ChecksumFile   = "SHA256SUMS"
+	SignatureFile  = "SHA256SUMS.sig"
+	ManifestDir    = "k8s"
+	ImageDir       = "images"
+
+	// FormatVersion is the bundle layout version written by Create
+	FormatVersion = 1
+)
+
+// Descriptor describes the payload a bundle was built from
+type Descriptor struct {
+	FormatVersion int         `json:"formatVersion"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	Tag           string      `json:"tag"`
+	Commit        string      `json:"commit,omitempty"`
+	Namespace     string      `json:"namespace"`
+	Images        []ImageInfo `json:"images"`
+}
+
+// ImageInfo describes one component image tarball in a bundle
+type ImageInfo struct {
+	Component string `json:"component"`
+	Name      string `json:"name"`   // Image reference the tarball was saved from
+	Digest    string `json:"digest"` // Image ID (config digest)
+	File      string `json:"file"`   // Path of the docker save tarball inside the bundle
+	Size      int64  `json:"size"`
+}
+
+// Entry maps a local file to its path inside a bundle
+type Entry struct {
+	Name string // Slash-separated path inside the bundle
+	Path string // Local file
+}
+
+// DirEntries returns an entry for every regular file below root, placed under prefix
+func DirEntries(root, prefix string) ([]Entry, error) {
+	var entries []Entry
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{Name: path.Join(prefix, filepath.ToSlash(rel)), Path: p})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", root, err)
+	}
+	return entries, nil
+}
+
+// RenderManifests renders the manifests below srcDir into dstDir for namespace,
+// with images rewritten by repository (see manifest.RewriteImages), and returns
+// their entries under ManifestDir. Cluster-scoped objects are kept: a bundle
+// installs the whole environment.
+func RenderManifests(srcDir, dstDir, namespace string, images map[string]string) ([]Entry, error) {
+	rendering := &manifest.Rendering{
+		Namespace:         namespace,
+		Images:            images,
+		KeepClusterScoped: true,
+	}
+	if _, err := rendering.RenderDir(srcDir, dstDir); err != nil {
+		return nil, err
+	}
+	return DirEntries(dstDir, ManifestDir)
+}
+
+// Create writes a gzip-compressed tar bundle containing the descriptor and the
+// entries, followed by a SHA-256 checksum manifest and its ed25519 signature
+func Create(output string, desc *Descriptor, entries []Entry, key ed25519.PrivateKey) error {
+	descriptor, err := json.MarshalIndent(desc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle descriptor: %w", err)
+	}
+
+	// Write to a temporary name so an interrupted run leaves no valid-looking bundle
+	partial := output + ".partial"
+	file, err := os.Create(partial)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer os.Remove(partial)
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	sums := make(map[string]string)
+
+	if err := writeEntry(tw, DescriptorFile, strings.NewReader(string(descriptor)), int64(len(descriptor)), sums); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := addFile(tw, entry, sums); err != nil {
+			return err
+		}
+	}
+
+	checksums := formatChecksums(sums)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, checksums)) + "\n"
+	if err := writeEntry(tw, ChecksumFile, strings.NewReader(string(checksums)), int64(len(checksums)), nil); err != nil {
+		return err
+	}
+	if err := writeEntry(tw, SignatureFile, strings.NewReader(signature), int64(len(signature)), nil); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+
+	if err := os.Rename(partial, output); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	return nil
+}
+
+// addFile copies a local file into the bundle
+func addFile(tw *tar.Writer, entry Entry, sums map[string]string) error {
+	f, err := os.Open(entry.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", entry.Path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", entry.Path, err)
+	}
+	return writeEntry(tw, entry.Name, f, info.Size(), sums)
+}
+
+// writeEntry writes one regular file to the archive, recording its checksum in sums if set
+func writeEntry(tw *tar.Writer, name string, r io.Reader, size int64, sums map[string]string) error {
+	if _, err := cleanName(name); err != nil {
+		return err
+	}
+	if _, exists := sums[name]; exists {
+		return fmt.Errorf("duplicate bundle entry: %s", name)
+	}
+
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(tw, io.TeeReader(r, h)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if sums != nil {
+		sums[name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return nil
+}
+
+// Extract unpacks a bundle into destDir and verifies the signature of its
+// checksum manifest and the checksum of every file. Unlisted or missing files
+// fail verification. The caller removes destDir on error.
+func Extract(bundlePath, destDir string, key ed25519.PublicKey) (*Descriptor, error) {
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("not a bundle archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	actual := make(map[string]string)
+	var checksums, signature []byte
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+		default:
+			return nil, fmt.Errorf("unsupported entry type in bundle: %s", header.Name)
+		}
+
+		name, err := cleanName(header.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case ChecksumFile:
+			checksums, err = io.ReadAll(io.LimitReader(tr, 1<<20))
+		case SignatureFile:
+			signature, err = io.ReadAll(io.LimitReader(tr, 1<<10))
+		default:
+			if _, exists := actual[name]; exists {
+				return nil, fmt.Errorf("duplicate bundle entry: %s", name)
+			}
+			actual[name], err = extractFile(tr, filepath.Join(destDir, filepath.FromSlash(name)))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", name, err)
+		}
+	}
+
+	if checksums == nil || signature == nil {
+		return nil, fmt.Errorf("bundle is not signed (%s or %s missing)", ChecksumFile, SignatureFile)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(key, checksums, sig) {
+		return nil, fmt.Errorf("bundle signature verification failed: not signed by the given key or checksum manifest modified")
+	}
+
+	expected, err := parseChecksums(checksums)
+	if err != nil {
+		return nil, err
+	}
+	if err := compareChecksums(expected, actual); err != nil {
+		return nil, err
+	}
+
+	return readDescriptor(filepath.Join(destDir, DescriptorFile), expected)
+}
+
+// extractFile writes one archive entry to dest and returns its SHA-256
+func extractFile(r io.Reader, dest string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(f, io.TeeReader(r, h)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), f.Close()
+}
+
+// readDescriptor loads an extracted descriptor and checks it references only listed files
+func readDescriptor(descriptorPath string, listed map[string]string) (*Descriptor, error) {
+	data, err := os.ReadFile(descriptorPath)
+	if err != nil {
+		return nil, fmt.Errorf("bundle has no descriptor: %w", err)
+	}
+
+	var desc Descriptor
+	if err := json.Unmarshal(data, &desc); err != nil {
+		return nil, fmt.Errorf("invalid bundle descriptor: %w", err)
+	}
+	if desc.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d (expected %d)", desc.FormatVersion, FormatVersion)
+	}
+	for _, img := range desc.Images {
+		if _, ok := listed[img.File]; !ok {
+			return nil, fmt.Errorf("bundle descriptor references missing image %s", img.File)
+		}
+	}
+	return &desc, nil
+}
+
+// cleanName rejects archive paths that are absolute or escape the extraction directory
+func cleanName(name string) (string, error) {
+	cleaned := path.Clean(name)
+	if path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("unsafe path in bundle: %s", name)
+	}
+	return cleaned, nil
+}
+
+// formatChecksums renders checksums in sha256sum format, sorted by path
+func formatChecksums(sums map[string]string) []byte {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+	return []byte(b.String())
+}
+
+// parseChecksums parses sha256sum formatted lines into path -> hex digest
+func parseChecksums(data []byte) (map[string]string, error) {
+	sums := make(map[string]string)
+	for i, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok || len(sum) != sha256.Size*2 || name == "" {
+			return nil, fmt.Errorf("invalid checksum manifest line %d: %q", i+1, line)
+		}
+		sums[name] = sum
+	}
+	return sums, nil
+}
+
+// compareChecksums checks that the extracted files are exactly those listed, with matching digests
+func compareChecksums(expected, actual map[string]string) error {
+	var problems []string
+	for name, sum := range expected {
+		got, ok := actual[name]
+		switch {
+		case !ok:
+			problems = append(problems, name+" missing")
+		case got != sum:
+			problems = append(problems, name+" checksum mismatch")
+		}
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			problems = append(problems, name+" not in checksum manifest")
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("bundle verification failed: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createTestBundle writes a bundle with one manifest and one image tarball
+func createTestBundle(t *testing.T, key ed25519.PrivateKey) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	k8sDir := filepath.Join(dir, "payload", "k8s", "backend")
+	if err := os.MkdirAll(k8sDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(k8sDir, "deployment.yaml"), []byte("kind: Deployment\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tarball := filepath.Join(dir, "backend.tar")
+	if err := os.WriteFile(tarball, []byte("image data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := DirEntries(filepath.Join(dir, "payload", "k8s"), ManifestDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = append(entries, Entry{Name: "images/backend.tar", Path: tarball})
+
+	desc := &Descriptor{
+		FormatVersion: FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Tag:           "v1",
+		Namespace:     "magnetiq",
+		Images: []ImageInfo{
+			{Component: "backend", Name: "app/backend:v1", Digest: "sha256:abc", File: "images/backend.tar", Size: 10},
+		},
+	}
+
+	output := filepath.Join(dir, "bundle.tar.gz")
+	if err := Create(output, desc, entries, key); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return output
+}
+
+func TestCreateExtract(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	bundlePath := createTestBundle(t, private)
+
+	dest := t.TempDir()
+	desc, err := Extract(bundlePath, dest, public)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+
+	if desc.Tag != "v1" || len(desc.Images) != 1 || desc.Images[0].Digest != "sha256:abc" {
+		t.Errorf("Extract() descriptor = %+v", desc)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "k8s", "backend", "deployment.yaml"))
+	if err != nil || string(data) != "kind: Deployment\n" {
+		t.Errorf("manifest not extracted: %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "images", "backend.tar")); err != nil {
+		t.Errorf("image not extracted: %v", err)
+	}
+}
+
+func TestRenderManifests(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "backend"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: magnetiq-backend
+  namespace: magnetiq-v2
+spec:
+  template:
+    spec:
+      containers:
+        - name: backend
+          image: magnetiq/v2/backend:latest
+        - name: proxy
+          image: nginx:1.27
+`
+	if err := os.WriteFile(filepath.Join(src, "backend", "deployment.yaml"), []byte(deployment), 0644); err != nil {
+		t.Fatal(err)
+	}
+	volume := "apiVersion: v1\nkind: PersistentVolume\nmetadata:\n  name: magnetiq-data\n"
+	if err := os.WriteFile(filepath.Join(src, "volume.yaml"), []byte(volume), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	images := map[string]string{"magnetiq/v2/backend": "crepo.re-cloud.io/magnetiq/v2/backend:v1"}
+	entries, err := RenderManifests(src, dst, "magnetiq-prod", images)
+	if err != nil {
+		t.Fatalf("RenderManifests() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "k8s/backend/deployment.yaml" || entries[1].Name != "k8s/volume.yaml" {
+		t.Errorf("RenderManifests() entries = %+v", entries)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dst, "backend", "deployment.yaml"))
+	rendered := string(data)
+	for _, want := range []string{
+		"image: crepo.re-cloud.io/magnetiq/v2/backend:v1",
+		"image: nginx:1.27",
+		"namespace: magnetiq-prod",
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("rendered deployment lacks %q:\n%s", want, rendered)
+		}
+	}
+	if strings.Contains(rendered, "magnetiq/v2/backend:latest") {
+		t.Errorf("rendered deployment keeps the workspace image:\n%s", rendered)
+	}
+
+	data, _ = os.ReadFile(filepath.Join(dst, "volume.yaml"))
+	if !strings.Contains(string(data), "kind: PersistentVolume") || strings.Contains(string(data), "namespace:") {
+		t.Errorf("cluster-scoped volume not kept as-is:\n%s", data)
+	}
+}
+
+func TestExtractWrongKey(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	bundlePath := createTestBundle(t, private)
+
+	if _, err := Extract(bundlePath, t.TempDir(), other); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("Extract() with wrong key error = %v, want signature failure", err)
+	}
+}
+
+func TestExtractTampered(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	bundlePath := createTestBundle(t, private)
+
+	// Rewrite the archive with a modified image, keeping the signed manifest
+	tampered := filepath.Join(t.TempDir(), "tampered.tar.gz")
+	rewriteBundle(t, bundlePath, tampered, func(name string, data []byte) []byte {
+		if name == "images/backend.tar" {
+			return []byte("evil data!")
+		}
+		return data
+	})
+
+	_, err := Extract(tampered, t.TempDir(), public)
+	if err == nil || !strings.Contains(err.Error(), "images/backend.tar checksum mismatch") {
+		t.Errorf("Extract() of tampered bundle error = %v, want checksum mismatch", err)
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	for _, name := range []string{"../etc/passwd", "/etc/passwd", "k8s/../../x", "."} {
+		if _, err := cleanName(name); err == nil {
+			t.Errorf("cleanName(%q) accepted unsafe path", name)
+		}
+	}
+	if got, err := cleanName("k8s/./backend/deployment.yaml"); err != nil || got != "k8s/backend/deployment.yaml" {
+		t.Errorf("cleanName() = %q, %v", got, err)
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	sums := map[string]string{
+		"b.yaml": strings.Repeat("b", 64),
+		"a.yaml": strings.Repeat("a", 64),
+	}
+	data := formatChecksums(sums)
+	if !strings.HasPrefix(string(data), strings.Repeat("a", 64)+"  a.yaml\n") {
+		t.Errorf("formatChecksums() not sorted: %q", data)
+	}
+
+	parsed, err := parseChecksums(data)
+	if err != nil || len(parsed) != 2 || parsed["b.yaml"] != sums["b.yaml"] {
+		t.Errorf("parseChecksums() = %v, %v", parsed, err)
+	}
+
+	if _, err := parseChecksums([]byte("nothex  a.yaml\n")); err == nil {
+		t.Error("parseChecksums() accepted invalid line")
+	}
+}
+
+// rewriteBundle copies a bundle archive, passing each file through modify
+func rewriteBundle(t *testing.T, src, dst string, modify func(name string, data []byte) []byte) {
+	t.Helper()
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	gzr, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gzr)
+
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	gzw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gzw)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		data = modify(header.Name, data)
+		header.Size = int64(len(data))
+		tw.WriteHeader(header)
+		tw.Write(data)
+	}
+	tw.Close()
+	gzw.Close()
+}
@@ -2,10 +2,12 @@ package config
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -101,6 +103,16 @@ type Logger struct {
 	LogFile     *os.File
 	CommandName string // Track which command is logging
 	SessionID   string // Session correlation ID
+
+	// Console streams; nil writes to os.Stdout and os.Stderr
+	Stdout io.Writer
+	Stderr io.Writer
+
+	consoleMu   sync.Mutex
+	statusLines []string // Live status block kept below console output
+
+	prefix string  // Prepended to every line, e.g. "[eu] "
+	parent *Logger // Logger owning the console and log file (nil = this one)
 }
 
 // NewLogger creates a new logger instance
@@ -146,6 +158,23 @@ func generateSessionID() string {
 	return fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), os.Getpid())
 }
 
+// WithPrefix returns a logger writing to the same console and log file with
+// prefix before every line, e.g. to tell apart clusters deployed in parallel
+func (l *Logger) WithPrefix(prefix string) *Logger {
+	root := l
+	if l.parent != nil {
+		root = l.parent
+	}
+	return &Logger{
+		Verbose:     l.Verbose,
+		LogFile:     l.LogFile,
+		CommandName: l.CommandName,
+		SessionID:   l.SessionID,
+		prefix:      l.prefix + prefix,
+		parent:      root,
+	}
+}
+
 // logSessionHeader logs command invocation details
 func (l *Logger) logSessionHeader() {
 	if l.LogFile != nil {
@@ -160,9 +189,9 @@ func (l *Logger) logSessionHeader() {
 	}
 }
 
-// Close closes the log file if open
+// Close closes the log file if open. Prefixed loggers leave it to their parent.
 func (l *Logger) Close() error {
-	if l.LogFile != nil {
+	if l.LogFile != nil && l.parent == nil {
 		fmt.Fprintf(l.LogFile, "\n=== SESSION END: %s ===\n\n", l.SessionID)
 		return l.LogFile.Close()
 	}
@@ -172,6 +201,7 @@ func (l *Logger) Close() error {
 // writeToFile writes a message to the log file with timestamp and command context
 func (l *Logger) writeToFile(level, message string) {
 	if l.LogFile != nil {
+		message = l.prefix + message
 		timestamp := time.Now().Format("2006-01-02 15:04:05")
 		if l.CommandName != "" {
 			fmt.Fprintf(l.LogFile, "[%s] [%s] [%s] %s\n", timestamp, l.CommandName, level, message)
@@ -181,37 +211,45 @@ func (l *Logger) writeToFile(level, message string) {
 	}
 }
 
+// Print writes text as is, line by line, e.g. the output of a command
+func (l *Logger) Print(text string) {
+	for _, line := range strings.Split(text, "\n") {
+		l.console(l.stdout(), line)
+	}
+	l.writeToFile("OUTPUT", text)
+}
+
 // Info logs an info message
 func (l *Logger) Info(format string, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
-	fmt.Printf("[INFO] %s\n", message)
+	l.console(l.stdout(), "[INFO] "+message)
 	l.writeToFile("INFO", message)
 }
 
 // Success logs a success message
 func (l *Logger) Success(format string, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
-	fmt.Printf("[SUCCESS] %s\n", message)
+	l.console(l.stdout(), "[SUCCESS] "+message)
 	l.writeToFile("SUCCESS", message)
 }
 
 // Warning logs a warning message
 func (l *Logger) Warning(format string, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
-	fmt.Printf("[WARNING] %s\n", message)
+	l.console(l.stdout(), "[WARNING] "+message)
 	l.writeToFile("WARNING", message)
 }
 
 // WarningDetailed logs a concise warning to console, detailed to log file
 func (l *Logger) WarningDetailed(consoleMsg string, logMsg string) {
-	fmt.Printf("[WARNING] %s\n", consoleMsg)
+	l.console(l.stdout(), "[WARNING] "+consoleMsg)
 	l.writeToFile("WARNING", logMsg)
 }
 
 // Error logs an error message
 func (l *Logger) Error(format string, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
-	fmt.Fprintf(os.Stderr, "[ERROR] %s\n", message)
+	l.console(l.stderr(), "[ERROR] "+message)
 	l.writeToFile("ERROR", message)
 }
 
@@ -219,7 +257,7 @@ func (l *Logger) Error(format string, args ...interface{}) {
 func (l *Logger) Debug(format string, args ...interface{}) {
 	if l.Verbose {
 		message := fmt.Sprintf(format, args...)
-		fmt.Printf("[DEBUG] %s\n", message)
+		l.console(l.stdout(), "[DEBUG] "+message)
 		l.writeToFile("DEBUG", message)
 	}
 }
@@ -227,6 +265,74 @@ func (l *Logger) Debug(format string, args ...interface{}) {
 // DryRun logs a dry-run message
 func (l *Logger) DryRun(format string, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
-	fmt.Printf("[DRY-RUN] %s\n", message)
+	l.console(l.stdout(), "[DRY-RUN] "+message)
 	l.writeToFile("DRY-RUN", message)
 }
+
+// SetStatus replaces the live status block drawn below console output, such as
+// transfer progress. Messages logged meanwhile appear above it. Only use it when
+// stdout is a terminal; nil removes the block.
+func (l *Logger) SetStatus(lines []string) {
+	if l.parent != nil {
+		l.parent.SetStatus(lines)
+		return
+	}
+
+	l.consoleMu.Lock()
+	defer l.consoleMu.Unlock()
+
+	l.eraseStatus()
+	l.statusLines = lines
+	l.drawStatus()
+}
+
+// console writes one line to the console, keeping the status block below it
+func (l *Logger) console(w io.Writer, line string) {
+	if l.parent != nil {
+		l.parent.console(w, l.prefix+line)
+		return
+	}
+
+	l.consoleMu.Lock()
+	defer l.consoleMu.Unlock()
+
+	l.eraseStatus()
+	fmt.Fprintln(w, line)
+	l.drawStatus()
+}
+
+// eraseStatus moves the cursor up over the status block and clears it
+func (l *Logger) eraseStatus() {
+	if n := len(l.statusLines); n > 0 {
+		fmt.Fprintf(l.stdout(), "\x1b[%dA\x1b[J", n)
+	}
+}
+
+// drawStatus prints the status block at the cursor
+func (l *Logger) drawStatus() {
+	for _, line := range l.statusLines {
+		fmt.Fprintln(l.stdout(), line)
+	}
+}
+
+// stdout returns the console stream of the logger owning the console
+func (l *Logger) stdout() io.Writer {
+	if l.parent != nil {
+		return l.parent.stdout()
+	}
+	if l.Stdout != nil {
+		return l.Stdout
+	}
+	return os.Stdout
+}
+
+// stderr returns the error stream of the logger owning the console
+func (l *Logger) stderr() io.Writer {
+	if l.parent != nil {
+		return l.parent.stderr()
+	}
+	if l.Stderr != nil {
+		return l.Stderr
+	}
+	return os.Stderr
+}
@@ -1,6 +1,10 @@
 package config
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -73,3 +77,54 @@ func TestNewLogger(t *testing.T) {
 		})
 	}
 }
+
+func TestLoggerWithPrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "operations.log")
+	logger, err := NewLoggerWithFile(false, path, "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var console bytes.Buffer
+	logger.Stdout = &console
+
+	child := logger.WithPrefix("[eu] ")
+	child.Info("deploying")
+	if err := child.Close(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("done")
+	logger.Close()
+
+	if want := "[eu] [INFO] deploying\n[INFO] done\n"; console.String() != want {
+		t.Errorf("console = %q, want %q", console.String(), want)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "[INFO] [eu] deploying") {
+		t.Errorf("log file lacks the prefixed line:\n%s", data)
+	}
+	if !strings.Contains(string(data), "[INFO] done") {
+		t.Errorf("closing the prefixed logger closed the log file:\n%s", data)
+	}
+}
+
+func TestLoggerPrint(t *testing.T) {
+	logger := NewLogger(false)
+	var console bytes.Buffer
+	logger.Stdout = &console
+
+	logger.SetStatus([]string{"1/2 workers"})
+	logger.Print("line one\nline two")
+	logger.SetStatus(nil)
+
+	// Each line goes above the status block, which is redrawn below it
+	erase := "\x1b[1A\x1b[J"
+	want := "1/2 workers\n" + erase + "line one\n1/2 workers\n" + erase + "line two\n1/2 workers\n" + erase
+	if console.String() != want {
+		t.Errorf("console = %q, want %q", console.String(), want)
+	}
+}
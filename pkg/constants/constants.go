@@ -42,6 +42,54 @@ const (
 	DefaultParallelWorkers = 3
 	DefaultRetryCount      = 3
 
+	// Maximum time for a worker to forward a tarball to a peer in fan-out mode
+	PeerTransferTimeout = 30 * time.Minute
+
+	// Time allowed for hashing a file on a worker: a base plus the file size
+	// at the slowest disk read rate expected (bytes per second)
+	RemoteHashTimeout = 1 * time.Minute
+	RemoteHashMinRate = 10 * 1024 * 1024
+
+	// Default compression for tarball transfers to workers
+	DefaultTransferCompression = "zstd"
+
+	// Transfer progress: terminal refresh rate and log interval when not on a terminal
+	TransferProgressRefresh     = 500 * time.Millisecond
+	TransferProgressLogInterval = 10 * time.Second
+
+	// Worker health tracking: state file and consecutive failed runs before quarantine
+	DefaultWorkerHealthFile = "~/.m2deploy/worker-health.json"
+	DefaultQuarantineAfter  = 3
+
+	// Clusters selectable with --targets
+	DefaultTargetsFile = "~/.m2deploy/targets.yaml"
+
+	// Lifetime of preview environments before preview gc removes them
+	DefaultPreviewTTL = 72 * time.Hour
+
+	// Lifetime of cloned environments before preview gc removes them
+	DefaultCloneTTL = 24 * time.Hour
+
+	// Application images kept per component by workers gc, besides those in use
+	DefaultWorkerGCKeep = 5
+
+	// Clock difference between the controller and a worker reported by preflight
+	MaxWorkerClockSkew = 30 * time.Second
+
 	// Containerd namespace for k8s
 	ContainerdNamespace = "k8s.io"
+
+	// In-cluster image loader used by --distribution daemonset
+	LoaderName         = "m2deploy-image-loader"
+	LoaderNamespace    = "kube-system"
+	DefaultLoaderImage = "alpine:3.20"
+	LoaderReadyTimeout = 3 * time.Minute
+	LoaderPollInterval = 2 * time.Second
+
+	// Registry used by --distribution registry
+	RegistryContainerName = "m2deploy-registry"
+	DefaultRegistryImage  = "registry:2"
+	DefaultRegistryPort   = 5000
+	RegistryPullTimeout   = 5 * time.Minute
+	DefaultRegistryGCKeep = 3
 )
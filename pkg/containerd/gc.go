@@ -0,0 +1,163 @@
+package containerd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/registry"
+)
+
+// ReleaseImage is an application image on a node. Tags of the same image are
+// grouped by image ID (config digest).
+type ReleaseImage struct {
+	Repository string // Repository path without the registry host
+	ID         string // Config digest
+	Refs       []string
+	Created    time.Time
+}
+
+// ListReleaseImages returns the node's images from the given repositories.
+// References naming the image ID ("sha256:...") are included in Refs, so
+// removing all Refs frees the image.
+func ListReleaseImages(run Runner, repositories []string) ([]ReleaseImage, error) {
+	output, err := run("images", "list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	images := ParseImageList(output)
+
+	wanted := make(map[string]bool, len(repositories))
+	for _, repo := range repositories {
+		wanted[registry.RepositoryPath(repo)] = true
+	}
+	idRefs := make(map[string]bool)
+	for _, image := range images {
+		if strings.HasPrefix(image.Ref, "sha256:") {
+			idRefs[image.Ref] = true
+		}
+	}
+
+	byKey := make(map[string]*ReleaseImage)
+	var keys []string
+	resolved := make(map[string]*ReleaseImage) // Image ID and creation time keyed by target
+
+	for _, image := range images {
+		repository, _, _ := registry.SplitReference(image.Ref)
+		repository = registry.RepositoryPath(repository)
+		if !wanted[repository] {
+			continue
+		}
+
+		info, ok := resolved[image.Digest]
+		if !ok {
+			info, err = inspectImage(run, image.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to inspect %s: %w", image.Ref, err)
+			}
+			resolved[image.Digest] = info
+		}
+
+		key := repository + "@" + info.ID
+		release, ok := byKey[key]
+		if !ok {
+			release = &ReleaseImage{Repository: repository, ID: info.ID, Created: info.Created}
+			if idRefs[info.ID] {
+				release.Refs = append(release.Refs, info.ID)
+			}
+			byKey[key] = release
+			keys = append(keys, key)
+		}
+		release.Refs = append(release.Refs, image.Ref)
+	}
+
+	releases := make([]ReleaseImage, 0, len(keys))
+	for _, key := range keys {
+		releases = append(releases, *byKey[key])
+	}
+	return releases, nil
+}
+
+// inspectImage resolves an image target to its image ID and creation time
+func inspectImage(run Runner, target string) (*ReleaseImage, error) {
+	digests, err := ConfigDigests(run, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(digests) == 0 {
+		return nil, fmt.Errorf("no config for this platform in %s", shortDigest(target))
+	}
+
+	info := &ReleaseImage{ID: digests[0]}
+	data, err := run("content", "get", digests[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", shortDigest(digests[0]), err)
+	}
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if err := json.Unmarshal([]byte(data), &config); err == nil {
+		info.Created = config.Created
+	}
+	return info, nil
+}
+
+// PlanGC selects the release images to remove from a node. Per repository the
+// keep newest images survive, as do images referenced by inUse (image
+// references of running pods and release history).
+func PlanGC(images []ReleaseImage, inUse []string, keep int) []ReleaseImage {
+	used := make(map[string]bool, len(inUse))
+	for _, ref := range inUse {
+		used[ref] = true
+		used[registry.RepositoryPath(ref)] = true
+	}
+
+	byRepo := make(map[string][]ReleaseImage)
+	var repos []string
+	for _, image := range images {
+		if _, ok := byRepo[image.Repository]; !ok {
+			repos = append(repos, image.Repository)
+		}
+		byRepo[image.Repository] = append(byRepo[image.Repository], image)
+	}
+	sort.Strings(repos)
+
+	var removals []ReleaseImage
+	for _, repo := range repos {
+		repoImages := byRepo[repo]
+		sort.SliceStable(repoImages, func(i, j int) bool {
+			return repoImages[i].Created.After(repoImages[j].Created)
+		})
+
+		for i, image := range repoImages {
+			if i < keep || image.usedBy(used) {
+				continue
+			}
+			removals = append(removals, image)
+		}
+	}
+	return removals
+}
+
+// usedBy reports whether any of the image's references is in use
+func (r ReleaseImage) usedBy(used map[string]bool) bool {
+	for _, ref := range r.Refs {
+		if used[ref] || used[registry.RepositoryPath(ref)] {
+			return true
+		}
+	}
+	return false
+}
+
+// Tags returns the image's references without the ID reference
+func (r ReleaseImage) Tags() []string {
+	var tags []string
+	for _, ref := range r.Refs {
+		if ref != r.ID {
+			tags = append(tags, ref)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,77 @@
+package containerd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const gcImageListOutput = `REF                                      TYPE                                                 DIGEST      SIZE      PLATFORMS   LABELS
+docker.io/magnetiq/v2/backend:v1         application/vnd.docker.distribution.manifest.v2+json sha256:m1   120.5 MiB linux/amd64 -
+docker.io/magnetiq/v2/backend:v2         application/vnd.docker.distribution.manifest.v2+json sha256:m2   121.0 MiB linux/amd64 -
+docker.io/magnetiq/v2/backend:latest     application/vnd.docker.distribution.manifest.v2+json sha256:m3   121.0 MiB linux/amd64 -
+docker.io/magnetiq/v2/backend:v3         application/vnd.docker.distribution.manifest.v2+json sha256:m3   121.0 MiB linux/amd64 -
+sha256:c1                                application/vnd.docker.distribution.manifest.v2+json sha256:m1   120.5 MiB linux/amd64 -
+docker.io/library/alpine:3.20            application/vnd.docker.distribution.manifest.v2+json sha256:m9   3.4 MiB   linux/amd64 -
+`
+
+func gcRunner() Runner {
+	content := map[string]string{
+		"sha256:m1": `{"config":{"digest":"sha256:c1"}}`,
+		"sha256:m2": `{"config":{"digest":"sha256:c2"}}`,
+		"sha256:m3": `{"config":{"digest":"sha256:c3"}}`,
+		"sha256:c1": `{"created":"2026-01-01T00:00:00Z"}`,
+		"sha256:c2": `{"created":"2026-02-01T00:00:00Z"}`,
+		"sha256:c3": `{"created":"2026-03-01T00:00:00Z"}`,
+	}
+	return func(args ...string) (string, error) {
+		switch strings.Join(args[:2], " ") {
+		case "images list":
+			return gcImageListOutput, nil
+		case "content get":
+			if data, ok := content[args[2]]; ok {
+				return data, nil
+			}
+		}
+		return "", fmt.Errorf("unexpected command %v", args)
+	}
+}
+
+func TestListReleaseImages(t *testing.T) {
+	images, err := ListReleaseImages(gcRunner(), []string{"magnetiq/v2/backend"})
+	if err != nil {
+		t.Fatalf("ListReleaseImages() error = %v", err)
+	}
+	if len(images) != 3 {
+		t.Fatalf("ListReleaseImages() returned %d images, want 3: %+v", len(images), images)
+	}
+
+	v1 := images[0]
+	if v1.ID != "sha256:c1" || strings.Join(v1.Refs, " ") != "sha256:c1 docker.io/magnetiq/v2/backend:v1" {
+		t.Errorf("v1 = %+v, want the ID reference included", v1)
+	}
+	if got := strings.Join(v1.Tags(), " "); got != "docker.io/magnetiq/v2/backend:v1" {
+		t.Errorf("Tags() = %s", got)
+	}
+	if len(images[2].Refs) != 2 || !images[2].Created.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("latest = %+v, want :latest and :v3 grouped", images[2])
+	}
+}
+
+func TestPlanGC(t *testing.T) {
+	images, err := ListReleaseImages(gcRunner(), []string{"magnetiq/v2/backend"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Newest kept; v1 protected by a pod that references it without the registry host
+	removals := PlanGC(images, []string{"magnetiq/v2/backend:v1"}, 1)
+	if len(removals) != 1 || removals[0].ID != "sha256:c2" {
+		t.Errorf("PlanGC() = %+v, want only v2 removed", removals)
+	}
+
+	if removals := PlanGC(images, nil, 5); len(removals) != 0 {
+		t.Errorf("PlanGC() with keep 5 = %+v, want nothing removed", removals)
+	}
+}
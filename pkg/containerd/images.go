@@ -0,0 +1,165 @@
+package containerd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Verification status of an image on a node
+const (
+	StatusPresent = "present"
+	StatusMissing = "missing"
+	StatusStale   = "stale"
+)
+
+// Manifest media types that point at other manifests instead of a config
+var indexMediaTypes = map[string]bool{
+	"application/vnd.oci.image.index.v1+json":                   true,
+	"application/vnd.docker.distribution.manifest.list.v2+json": true,
+}
+
+// Runner executes a ctr subcommand (e.g. "images", "list") and returns its output
+type Runner func(args ...string) (string, error)
+
+// Image is an entry from 'ctr images list'
+type Image struct {
+	Ref       string
+	MediaType string
+	Digest    string // Digest of the image target (manifest or index)
+}
+
+// VerifyError reports that an image is missing or does not match the expected digest
+type VerifyError struct {
+	Image    string
+	Status   string // StatusMissing or StatusStale
+	Expected string
+	Actual   string
+}
+
+func (e *VerifyError) Error() string {
+	if e.Status == StatusStale {
+		return fmt.Sprintf("stale image %s (found %s, expected %s)", e.Image, shortDigest(e.Actual), shortDigest(e.Expected))
+	}
+	return fmt.Sprintf("image %s missing", e.Image)
+}
+
+// ParseImageList parses the output of 'ctr images list'
+// Columns: REF TYPE DIGEST SIZE PLATFORMS LABELS
+func ParseImageList(output string) []Image {
+	var images []Image
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] == "REF" {
+			continue
+		}
+		if !strings.HasPrefix(fields[2], "sha256:") {
+			continue
+		}
+		images = append(images, Image{
+			Ref:       fields[0],
+			MediaType: fields[1],
+			Digest:    fields[2],
+		})
+	}
+	return images
+}
+
+// FindImage returns the image whose reference exactly matches ref
+func FindImage(images []Image, ref string) *Image {
+	for i := range images {
+		if images[i].Ref == ref {
+			return &images[i]
+		}
+	}
+	return nil
+}
+
+// manifest holds the fields of an image manifest or index needed for verification
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+}
+
+// ConfigDigests resolves the config digests reachable from an image target.
+// Indexes are followed one level down to their platform manifests.
+func ConfigDigests(run Runner, target string) ([]string, error) {
+	data, err := run("content", "get", target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", shortDigest(target), err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", shortDigest(target), err)
+	}
+
+	if !indexMediaTypes[m.MediaType] && len(m.Manifests) == 0 {
+		if m.Config.Digest == "" {
+			return nil, fmt.Errorf("manifest %s has no config", shortDigest(target))
+		}
+		return []string{m.Config.Digest}, nil
+	}
+
+	var digests []string
+	for _, child := range m.Manifests {
+		childData, err := run("content", "get", child.Digest)
+		if err != nil {
+			// Platforms other than the node's are usually not present
+			continue
+		}
+		var cm manifest
+		if err := json.Unmarshal([]byte(childData), &cm); err == nil && cm.Config.Digest != "" {
+			digests = append(digests, cm.Config.Digest)
+		}
+	}
+	return digests, nil
+}
+
+// VerifyImage checks that imageName exists with exactly that reference and, when
+// expectedDigest is set, that it resolves to the expected image.
+// expectedDigest may be either the image ID (config digest) or the manifest digest.
+func VerifyImage(run Runner, imageName, expectedDigest string) (*Image, error) {
+	output, err := run("images", "list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	image := FindImage(ParseImageList(output), imageName)
+	if image == nil {
+		return nil, &VerifyError{Image: imageName, Status: StatusMissing, Expected: expectedDigest}
+	}
+
+	if expectedDigest == "" || image.Digest == expectedDigest {
+		return image, nil
+	}
+
+	configDigests, err := ConfigDigests(run, image.Digest)
+	if err != nil {
+		return image, err
+	}
+	for _, digest := range configDigests {
+		if digest == expectedDigest {
+			return image, nil
+		}
+	}
+
+	actual := image.Digest
+	if len(configDigests) > 0 {
+		actual = configDigests[0]
+	}
+	return image, &VerifyError{Image: imageName, Status: StatusStale, Expected: expectedDigest, Actual: actual}
+}
+
+// shortDigest shortens a digest for display (sha256:0123456789ab)
+func shortDigest(digest string) string {
+	if len(digest) > 19 {
+		return digest[:19]
+	}
+	return digest
+}
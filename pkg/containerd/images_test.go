@@ -0,0 +1,91 @@
+package containerd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const imageListOutput = `REF                                         TYPE                                                 DIGEST                                                                  SIZE     PLATFORMS   LABELS
+crepo.re-cloud.io/magnetiq/v2/backend:abc   application/vnd.docker.distribution.manifest.v2+json sha256:1111111111111111111111111111111111111111111111111111111111111111 120.5 MiB linux/amd64 io.cri-containerd.image=managed
+crepo.re-cloud.io/magnetiq/v2/backend:abc123 application/vnd.docker.distribution.manifest.v2+json sha256:2222222222222222222222222222222222222222222222222222222222222222 121.0 MiB linux/amd64 io.cri-containerd.image=managed
+`
+
+// fakeRunner serves 'images list' and 'content get' from fixed data
+func fakeRunner(manifests map[string]string) Runner {
+	return func(args ...string) (string, error) {
+		switch strings.Join(args[:2], " ") {
+		case "images list":
+			return imageListOutput, nil
+		case "content get":
+			if data, ok := manifests[args[2]]; ok {
+				return data, nil
+			}
+			return "", fmt.Errorf("content %s not found", args[2])
+		}
+		return "", fmt.Errorf("unexpected command %v", args)
+	}
+}
+
+func TestParseImageList(t *testing.T) {
+	images := ParseImageList(imageListOutput)
+	if len(images) != 2 {
+		t.Fatalf("ParseImageList() returned %d images, want 2", len(images))
+	}
+	if images[0].Ref != "crepo.re-cloud.io/magnetiq/v2/backend:abc" {
+		t.Errorf("images[0].Ref = %s", images[0].Ref)
+	}
+	if !strings.HasPrefix(images[1].Digest, "sha256:2222") {
+		t.Errorf("images[1].Digest = %s", images[1].Digest)
+	}
+}
+
+func TestFindImageExactMatch(t *testing.T) {
+	images := ParseImageList(imageListOutput)
+
+	image := FindImage(images, "crepo.re-cloud.io/magnetiq/v2/backend:abc")
+	if image == nil || !strings.HasPrefix(image.Digest, "sha256:1111") {
+		t.Errorf("FindImage() matched %+v, want the :abc image", image)
+	}
+
+	if image := FindImage(images, "crepo.re-cloud.io/magnetiq/v2/backend:ab"); image != nil {
+		t.Errorf("FindImage() matched prefix %s", image.Ref)
+	}
+}
+
+func TestVerifyImage(t *testing.T) {
+	manifests := map[string]string{
+		"sha256:1111111111111111111111111111111111111111111111111111111111111111": `{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"digest":"sha256:cfgaaa"}}`,
+	}
+	run := fakeRunner(manifests)
+
+	t.Run("matching config digest", func(t *testing.T) {
+		if _, err := VerifyImage(run, "crepo.re-cloud.io/magnetiq/v2/backend:abc", "sha256:cfgaaa"); err != nil {
+			t.Errorf("VerifyImage() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("matching manifest digest", func(t *testing.T) {
+		digest := "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		if _, err := VerifyImage(run, "crepo.re-cloud.io/magnetiq/v2/backend:abc", digest); err != nil {
+			t.Errorf("VerifyImage() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("stale image", func(t *testing.T) {
+		_, err := VerifyImage(run, "crepo.re-cloud.io/magnetiq/v2/backend:abc", "sha256:cfgbbb")
+		var verifyErr *VerifyError
+		if !errors.As(err, &verifyErr) || verifyErr.Status != StatusStale {
+			t.Errorf("VerifyImage() error = %v, want stale", err)
+		}
+	})
+
+	t.Run("missing image", func(t *testing.T) {
+		_, err := VerifyImage(run, "crepo.re-cloud.io/magnetiq/v2/backend:ab", "")
+		var verifyErr *VerifyError
+		if !errors.As(err, &verifyErr) || verifyErr.Status != StatusMissing {
+			t.Errorf("VerifyImage() error = %v, want missing", err)
+		}
+	})
+}
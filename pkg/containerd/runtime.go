@@ -0,0 +1,149 @@
+package containerd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Runtime kinds selectable with --runtime
+const (
+	RuntimeAuto    = "auto"
+	RuntimeK0s     = "k0s"
+	RuntimeCtr     = "ctr"
+	RuntimeNerdctl = "nerdctl"
+)
+
+// RuntimeKinds lists the supported --runtime values
+var RuntimeKinds = []string{RuntimeAuto, RuntimeK0s, RuntimeCtr, RuntimeNerdctl}
+
+// Sockets lists the containerd sockets of the distributions we know, in the
+// order detection tries them: k0s, k3s/RKE2, stock containerd (kubeadm)
+var Sockets = []string{
+	"/run/k0s/containerd.sock",
+	"/run/k3s/containerd/containerd.sock",
+	"/run/containerd/containerd.sock",
+}
+
+// Runtime is the command line tool used to reach a node's containerd.
+// Image queries always go through ctr subcommands (containerd ships ctr);
+// nerdctl is used for imports, where it handles archives ctr rejects.
+type Runtime struct {
+	Kind      string // RuntimeK0s, RuntimeCtr or RuntimeNerdctl
+	Socket    string // Containerd socket ("" = the tool's default)
+	Namespace string
+}
+
+// ValidateRuntime checks that kind is a supported --runtime value
+func ValidateRuntime(kind string) error {
+	for _, k := range RuntimeKinds {
+		if k == kind {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported runtime %q (supported: %v)", kind, RuntimeKinds)
+}
+
+// CtrArgs returns the command line running a ctr subcommand
+func (r *Runtime) CtrArgs(args ...string) []string {
+	var cmd []string
+	if r.Kind == RuntimeK0s {
+		cmd = []string{"k0s", "ctr"}
+	} else {
+		cmd = []string{"ctr"}
+	}
+	if r.Socket != "" {
+		cmd = append(cmd, "--address", r.Socket)
+	}
+	cmd = append(cmd, "-n", r.Namespace)
+	return append(cmd, args...)
+}
+
+// ImportArgs returns the command line importing an image archive. baseName
+// names the images of docker save archives ("" for OCI archives whose index
+// annotations carry the names).
+func (r *Runtime) ImportArgs(tarball, baseName string) []string {
+	if r.Kind == RuntimeNerdctl {
+		cmd := []string{"nerdctl"}
+		if r.Socket != "" {
+			cmd = append(cmd, "--address", r.Socket)
+		}
+		return append(cmd, "--namespace", r.Namespace, "load", "-i", tarball)
+	}
+
+	args := []string{"images", "import"}
+	if baseName != "" {
+		args = append(args, "--base-name", baseName)
+	}
+	return r.CtrArgs(append(args, tarball)...)
+}
+
+// String describes the runtime for logs, e.g. "ctr (/run/k3s/containerd/containerd.sock)"
+func (r *Runtime) String() string {
+	if r.Socket == "" {
+		return r.Kind
+	}
+	return fmt.Sprintf("%s (%s)", r.Kind, r.Socket)
+}
+
+// DetectScript prints "runtime=<kind>" and "socket=<path>" for the first
+// usable runtime on a node: k0s when its socket exists, otherwise nerdctl or
+// ctr with the first existing socket. Run it with sh.
+var DetectScript = fmt.Sprintf(`sock=""
+for s in %s; do
+  if [ -S "$s" ]; then sock="$s"; break; fi
+done
+if [ "$sock" = "%s" ] && command -v k0s >/dev/null 2>&1; then echo "runtime=k0s"
+elif command -v nerdctl >/dev/null 2>&1; then echo "runtime=nerdctl"
+elif command -v ctr >/dev/null 2>&1; then echo "runtime=ctr"
+fi
+echo "socket=$sock"`, strings.Join(Sockets, " "), Sockets[0])
+
+// ParseDetected parses the output of DetectScript
+func ParseDetected(output, namespace string) (*Runtime, error) {
+	runtime := &Runtime{Namespace: namespace}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "runtime":
+			runtime.Kind = value
+		case "socket":
+			runtime.Socket = value
+		}
+	}
+
+	if runtime.Kind == "" {
+		return nil, fmt.Errorf("no container runtime found (tried k0s, nerdctl and ctr)")
+	}
+	// k0s ctr knows its own socket
+	if runtime.Kind == RuntimeK0s {
+		runtime.Socket = ""
+	}
+	return runtime, nil
+}
+
+// Resolve returns the runtime for kind and socket, running detect when kind
+// is RuntimeAuto. An explicit socket overrides the detected one.
+func Resolve(kind, socket, namespace string, detect func() (string, error)) (*Runtime, error) {
+	if err := ValidateRuntime(kind); err != nil {
+		return nil, err
+	}
+	if kind != RuntimeAuto {
+		return &Runtime{Kind: kind, Socket: socket, Namespace: namespace}, nil
+	}
+
+	output, err := detect()
+	if err != nil {
+		return nil, fmt.Errorf("runtime detection failed: %w", err)
+	}
+	runtime, err := ParseDetected(output, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if socket != "" {
+		runtime.Socket = socket
+	}
+	return runtime, nil
+}
@@ -0,0 +1,102 @@
+package containerd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRuntimeArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		runtime Runtime
+		ctr     string
+		imports string
+	}{
+		{
+			name:    "k0s",
+			runtime: Runtime{Kind: RuntimeK0s, Namespace: "k8s.io"},
+			ctr:     "k0s ctr -n k8s.io images list",
+			imports: "k0s ctr -n k8s.io images import --base-name registry/app /tmp/app.tar",
+		},
+		{
+			name:    "ctr with socket",
+			runtime: Runtime{Kind: RuntimeCtr, Socket: "/run/k3s/containerd/containerd.sock", Namespace: "k8s.io"},
+			ctr:     "ctr --address /run/k3s/containerd/containerd.sock -n k8s.io images list",
+			imports: "ctr --address /run/k3s/containerd/containerd.sock -n k8s.io images import --base-name registry/app /tmp/app.tar",
+		},
+		{
+			name:    "nerdctl",
+			runtime: Runtime{Kind: RuntimeNerdctl, Socket: "/run/containerd/containerd.sock", Namespace: "k8s.io"},
+			ctr:     "ctr --address /run/containerd/containerd.sock -n k8s.io images list",
+			imports: "nerdctl --address /run/containerd/containerd.sock --namespace k8s.io load -i /tmp/app.tar",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tt.runtime.CtrArgs("images", "list"), " "); got != tt.ctr {
+				t.Errorf("CtrArgs = %q, want %q", got, tt.ctr)
+			}
+			if got := strings.Join(tt.runtime.ImportArgs("/tmp/app.tar", "registry/app"), " "); got != tt.imports {
+				t.Errorf("ImportArgs = %q, want %q", got, tt.imports)
+			}
+		})
+	}
+
+	// OCI archives carry their names, so no --base-name
+	r := Runtime{Kind: RuntimeCtr, Namespace: "k8s.io"}
+	if got := r.ImportArgs("/tmp/delta.tar", ""); !reflect.DeepEqual(got, []string{"ctr", "-n", "k8s.io", "images", "import", "/tmp/delta.tar"}) {
+		t.Errorf("ImportArgs without base name = %v", got)
+	}
+}
+
+func TestParseDetected(t *testing.T) {
+	r, err := ParseDetected("runtime=k0s\nsocket=/run/k0s/containerd.sock\n", "k8s.io")
+	if err != nil || r.Kind != RuntimeK0s || r.Socket != "" || r.Namespace != "k8s.io" {
+		t.Errorf("k0s = %+v, %v", r, err)
+	}
+
+	r, err = ParseDetected("runtime=ctr\nsocket=/run/k3s/containerd/containerd.sock\n", "k8s.io")
+	if err != nil || r.Kind != RuntimeCtr || r.Socket != "/run/k3s/containerd/containerd.sock" {
+		t.Errorf("k3s = %+v, %v", r, err)
+	}
+
+	if _, err := ParseDetected("socket=\n", "k8s.io"); err == nil {
+		t.Error("expected an error when no runtime was found")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	detected := func() (string, error) {
+		return "runtime=nerdctl\nsocket=/run/containerd/containerd.sock\n", nil
+	}
+	failing := func() (string, error) {
+		return "", errors.New("connection refused")
+	}
+
+	// Explicit kinds are not detected
+	r, err := Resolve(RuntimeCtr, "/custom.sock", "k8s.io", failing)
+	if err != nil || r.Kind != RuntimeCtr || r.Socket != "/custom.sock" {
+		t.Errorf("explicit = %+v, %v", r, err)
+	}
+
+	r, err = Resolve(RuntimeAuto, "", "k8s.io", detected)
+	if err != nil || r.Kind != RuntimeNerdctl || r.Socket != "/run/containerd/containerd.sock" {
+		t.Errorf("auto = %+v, %v", r, err)
+	}
+
+	// An explicit socket overrides the detected one
+	r, err = Resolve(RuntimeAuto, "/custom.sock", "k8s.io", detected)
+	if err != nil || r.Socket != "/custom.sock" {
+		t.Errorf("auto with socket = %+v, %v", r, err)
+	}
+
+	if _, err := Resolve(RuntimeAuto, "", "k8s.io", failing); err == nil {
+		t.Error("expected detection error")
+	}
+	if _, err := Resolve("crio", "", "k8s.io", detected); err == nil {
+		t.Error("expected unsupported runtime error")
+	}
+}
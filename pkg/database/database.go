@@ -10,41 +10,31 @@ import (
 	"time"
 
 	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/k8s"
 )
 
+// dbPath is the SQLite database inside the backend container
+const dbPath = "/app/data/magnetiq.db"
+
+// backupGlob matches the backups Backup writes, compressed or not
+const backupGlob = "magnetiq-db-*.db*"
+
 // Client handles database operations
 type Client struct {
-	Logger     *config.Logger
-	DryRun     bool
-	Namespace  string
-	Kubeconfig string
-	UseSudo    bool
+	Logger    *config.Logger
+	DryRun    bool
+	Namespace string
+	K8s       *k8s.Client
 }
 
 // NewClient creates a new database client
-func NewClient(logger *config.Logger, dryRun bool, namespace, kubeconfig string, useSudo bool) *Client {
+func NewClient(logger *config.Logger, dryRun bool, namespace string, k8sClient *k8s.Client) *Client {
 	return &Client{
-		Logger:     logger,
-		DryRun:     dryRun,
-		Namespace:  namespace,
-		Kubeconfig: kubeconfig,
-		UseSudo:    useSudo,
-	}
-}
-
-// buildKubectlCmd builds a kubectl command with proper kubeconfig
-func (c *Client) buildKubectlCmd(args ...string) *exec.Cmd {
-	var allArgs []string
-	if c.Kubeconfig != "" {
-		allArgs = append([]string{"k0s", "kubectl", "--kubeconfig", c.Kubeconfig}, args...)
-	} else {
-		allArgs = append([]string{"k0s", "kubectl"}, args...)
-	}
-
-	if c.UseSudo {
-		return exec.Command("sudo", allArgs...)
+		Logger:    logger,
+		DryRun:    dryRun,
+		Namespace: namespace,
+		K8s:       k8sClient,
 	}
-	return exec.Command(allArgs[0], allArgs[1:]...)
 }
 
 // Backup backs up the SQLite database from a pod
@@ -71,16 +61,19 @@ func (c *Client) Backup(backupPath string, compress bool) error {
 	backupFile := filepath.Join(backupPath, fmt.Sprintf("magnetiq-db-%s.db", timestamp))
 
 	// Copy database from pod
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"cp",
-		fmt.Sprintf("%s:/app/data/magnetiq.db", podName),
-		backupFile,
-	)
+	out, err := os.Create(backupFile)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
 
-	c.Logger.Debug("Executing: %s", cmd.String())
+	c.Logger.Debug("Streaming %s from pod %s", dbPath, podName)
 
-	if err := cmd.Run(); err != nil {
+	err = c.K8s.StreamInPod(c.Namespace, podName, nil, out, os.Stderr, "cat", dbPath)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(backupFile)
 		return fmt.Errorf("failed to backup database: %w", err)
 	}
 
@@ -138,14 +131,13 @@ func (c *Client) Restore(backupFile string) error {
 	}
 
 	// Copy database to pod
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"cp",
-		tempFile,
-		fmt.Sprintf("%s:/app/data/magnetiq.db", podName),
-	)
-
-	if err := cmd.Run(); err != nil {
+	in, err := os.Open(tempFile)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer in.Close()
+
+	if err := c.K8s.StreamInPod(c.Namespace, podName, in, os.Stdout, os.Stderr, "sh", "-c", "cat > "+dbPath); err != nil {
 		return fmt.Errorf("failed to restore database: %w", err)
 	}
 
@@ -169,24 +161,9 @@ func (c *Client) Migrate() error {
 	}
 
 	// Execute migration command in pod
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"exec",
-		podName,
-		"--",
-		"python",
-		"-m",
-		"alembic",
-		"upgrade",
-		"head",
-	)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	c.Logger.Debug("Executing: %s", cmd.String())
-
-	if err := cmd.Run(); err != nil {
+	c.Logger.Debug("Executing in %s: python -m alembic upgrade head", podName)
+
+	if err := c.K8s.StreamInPod(c.Namespace, podName, nil, os.Stdout, os.Stderr, "python", "-m", "alembic", "upgrade", "head"); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
@@ -205,21 +182,7 @@ func (c *Client) Status() error {
 	}
 
 	// Execute migration status command
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"exec",
-		podName,
-		"--",
-		"python",
-		"-m",
-		"alembic",
-		"current",
-	)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	if err := c.K8s.StreamInPod(c.Namespace, podName, nil, os.Stdout, os.Stderr, "python", "-m", "alembic", "current"); err != nil {
 		return fmt.Errorf("failed to check migration status: %w", err)
 	}
 
@@ -228,24 +191,17 @@ func (c *Client) Status() error {
 
 // getBackendPod finds the first running backend pod
 func (c *Client) getBackendPod() (string, error) {
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"get", "pods",
-		"-l", "app=magnetiq-backend",
-		"-o", "jsonpath={.items[0].metadata.name}",
-	)
-
-	output, err := cmd.Output()
+	pods, err := c.K8s.ListPods(c.Namespace, "app=magnetiq-backend")
 	if err != nil {
 		return "", fmt.Errorf("failed to get backend pod: %w", err)
 	}
 
-	podName := strings.TrimSpace(string(output))
-	if podName == "" {
-		return "", fmt.Errorf("no backend pod found")
+	for _, pod := range pods {
+		if pod.Phase == "Running" {
+			return pod.Name, nil
+		}
 	}
-
-	return podName, nil
+	return "", fmt.Errorf("no running backend pod found")
 }
 
 // CleanOldBackups removes old backup files, keeping only the most recent N backups
@@ -258,7 +214,7 @@ func (c *Client) CleanOldBackups(backupPath string, retention int) error {
 	}
 
 	// List backup files
-	pattern := filepath.Join(backupPath, "magnetiq-db-*.db*")
+	pattern := filepath.Join(backupPath, backupGlob)
 	matches, err := filepath.Glob(pattern)
 	if err != nil {
 		return fmt.Errorf("failed to list backups: %w", err)
@@ -305,3 +261,27 @@ func (c *Client) CleanOldBackups(backupPath string, retention int) error {
 	c.Logger.Success("Cleaned %d old backup(s)", removedCount)
 	return nil
 }
+
+// LatestBackup returns the most recently written backup in backupPath
+func LatestBackup(backupPath string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(backupPath, backupGlob))
+	if err != nil {
+		return "", fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	latest := ""
+	var latestTime time.Time
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		if latest == "" || info.ModTime().After(latestTime) {
+			latest, latestTime = match, info.ModTime()
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no backups found in %s", backupPath)
+	}
+	return latest, nil
+}
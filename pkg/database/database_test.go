@@ -0,0 +1,38 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLatestBackup(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LatestBackup(dir); err == nil {
+		t.Error("LatestBackup() of an empty directory expected error")
+	}
+
+	now := time.Now()
+	for name, age := range map[string]time.Duration{
+		"magnetiq-db-20260101-120000.db.gz": 2 * time.Hour,
+		"magnetiq-db-20260102-120000.db":    time.Hour,
+		"notes.txt":                         0,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := LatestBackup(dir)
+	if err != nil {
+		t.Fatalf("LatestBackup() error = %v", err)
+	}
+	if want := filepath.Join(dir, "magnetiq-db-20260102-120000.db"); got != want {
+		t.Errorf("LatestBackup() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,526 @@
+package distribution
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/containerd"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/ssh"
+)
+
+// loaderManifest is a privileged DaemonSet in the host's PID namespace, so
+// the host's own ctr can be run with nsenter against its containerd socket.
+// It is pinned to the target nodes by name and tolerates only their taints.
+const loaderManifest = `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: %[1]s
+  namespace: %[2]s
+  labels:
+    app.kubernetes.io/name: %[1]s
+    app.kubernetes.io/managed-by: m2deploy
+spec:
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: %[1]s
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: %[1]s
+    spec:
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchFields:
+              - key: metadata.name
+                operator: In
+                values: [%[4]s]
+      tolerations:%[5]s
+      hostPID: true
+      terminationGracePeriodSeconds: 0
+      containers:
+      - name: loader
+        image: %[3]s
+        command: ["sh", "-c", "trap 'exit 0' TERM; while true; do sleep 5; done"]
+        env:
+        - name: CONTAINERD_SOCKET
+          value: %[6]q
+        securityContext:
+          privileged: true
+`
+
+// hostCtrScript enters the host's mount namespace and runs the host's ctr
+// against $CONTAINERD_SOCKET or whichever containerd socket exists (k0s, k3s
+// or stock); on k0s without a ctr binary, 'k0s ctr' is used
+const hostCtrScript = `exec nsenter -t 1 -m -- sh -c '` +
+	`sock=$CONTAINERD_SOCKET; ` +
+	`if [ -z "$sock" ]; then ` +
+	`sock=/run/containerd/containerd.sock; ` +
+	`[ -S /run/k3s/containerd/containerd.sock ] && sock=/run/k3s/containerd/containerd.sock; ` +
+	`[ -S /run/k0s/containerd.sock ] && sock=/run/k0s/containerd.sock; ` +
+	`fi; ` +
+	`PATH=/var/lib/k0s/bin:/var/lib/rancher/rke2/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin; ` +
+	`command -v ctr >/dev/null || exec k0s ctr --address "$sock" -n ` + constants.ContainerdNamespace + ` "$@"; ` +
+	`exec ctr --address "$sock" -n ` + constants.ContainerdNamespace + ` "$@"' ctr "$@"`
+
+// renderLoader returns the loader DaemonSet manifest for the target nodes
+func (b *DaemonSetBackend) renderLoader(nodes []k8s.NodeInfo) (string, error) {
+	if len(nodes) == 0 {
+		return "", fmt.Errorf("no target nodes for the image loader")
+	}
+
+	var names []string
+	for _, node := range nodes {
+		names = append(names, strconv.Quote(node.Name))
+	}
+	return fmt.Sprintf(loaderManifest, constants.LoaderName, b.Namespace, b.LoaderImage, strings.Join(names, ", "),
+		loaderTolerations(nodes), b.Socket), nil
+}
+
+// loaderTolerations returns the YAML tolerations for the scheduling taints of
+// the nodes, each listed once
+func loaderTolerations(nodes []k8s.NodeInfo) string {
+	var out strings.Builder
+	seen := make(map[k8s.Taint]bool)
+	for _, node := range nodes {
+		for _, taint := range node.Taints {
+			if taint.Effect != k8s.TaintNoSchedule && taint.Effect != k8s.TaintNoExecute || seen[taint] {
+				continue
+			}
+			seen[taint] = true
+			fmt.Fprintf(&out, "\n      - key: %q\n        operator: Equal\n        value: %q\n        effect: %s", taint.Key, taint.Value, taint.Effect)
+		}
+	}
+	if out.Len() == 0 {
+		return " []"
+	}
+	return out.String()
+}
+
+// DaemonSetBackend streams image tarballs through the Kubernetes API into a
+// short-lived loader DaemonSet that imports them on each node. No SSH access
+// to the nodes is needed.
+type DaemonSetBackend struct {
+	Logger      *config.Logger
+	K8s         *k8s.Client
+	DryRun      bool
+	Namespace   string // Namespace for the loader DaemonSet
+	LoaderImage string // Image providing sh and nsenter
+	Socket      string // Containerd socket on the nodes ("" = detected per node)
+	Parallel    int    // Max nodes imported into at once
+	MinNodes    int    // Minimum nodes that must succeed (0 = all required)
+	SkipPresent bool   // Skip nodes that already hold the image with the expected digest
+
+	NodeSelector k8s.Selector // Only nodes whose labels match
+
+	nodes     map[string]k8s.NodeInfo // Target nodes keyed by name
+	pods      []k8s.PodInfo
+	unready   []string                   // Target nodes without a ready loader pod
+	present   map[string]map[string]bool // Nodes holding an image, from CheckPresence
+	presentMu sync.Mutex
+}
+
+// NewDaemonSetBackend creates a DaemonSet distribution backend
+func NewDaemonSetBackend(logger *config.Logger, k8sClient *k8s.Client, dryRun bool) *DaemonSetBackend {
+	return &DaemonSetBackend{
+		Logger:      logger,
+		K8s:         k8sClient,
+		DryRun:      dryRun,
+		Namespace:   constants.LoaderNamespace,
+		LoaderImage: constants.DefaultLoaderImage,
+		Parallel:    constants.DefaultParallelWorkers,
+		MinNodes:    0,
+		SkipPresent: true,
+		present:     make(map[string]map[string]bool),
+		nodes:       make(map[string]k8s.NodeInfo),
+	}
+}
+
+// Name returns the distribution mode
+func (b *DaemonSetBackend) Name() string {
+	return ModeDaemonSet
+}
+
+// Prepare deploys the loader DaemonSet and waits up to LoaderReadyTimeout for
+// a ready pod on each node. Nodes still without one count as failed; at least
+// MinNodes (0 = all) must have one.
+func (b *DaemonSetBackend) Prepare() error {
+	workers, err := b.K8s.WorkerNodes()
+	if err != nil {
+		return fmt.Errorf("failed to get worker nodes: %w", err)
+	}
+
+	var nodes []k8s.NodeInfo
+	for _, node := range workers {
+		if !b.NodeSelector.Matches(node.Labels) {
+			b.Logger.Debug("Skipping %s: labels do not match node selector", node.Name)
+			continue
+		}
+		b.nodes[node.Name] = node
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("no worker nodes match the node selector")
+	}
+
+	b.Logger.Info("Deploying image loader DaemonSet %s/%s (%s)...", b.Namespace, constants.LoaderName, b.LoaderImage)
+
+	manifest, err := b.renderLoader(nodes)
+	if err != nil {
+		return err
+	}
+	if err := b.K8s.ApplyManifestData(manifest); err != nil {
+		return fmt.Errorf("failed to deploy image loader: %w", err)
+	}
+
+	if b.DryRun {
+		return nil
+	}
+
+	if err := b.waitForLoaders(constants.LoaderReadyTimeout); err != nil {
+		b.Cleanup()
+		return err
+	}
+
+	b.Logger.Info("Found %d worker nodes", len(b.pods))
+	for _, pod := range b.pods {
+		b.Logger.Info("  - %s (%s, pod %s)", pod.NodeName, pod.HostIP, pod.Name)
+	}
+	for _, name := range b.unready {
+		b.Logger.Warning("  - %s: no ready image loader pod after %s", name, constants.LoaderReadyTimeout)
+	}
+	b.Logger.Info("")
+
+	minRequired := b.MinNodes
+	if minRequired == 0 {
+		minRequired = len(b.nodes)
+	}
+	if len(b.pods) < minRequired {
+		b.Cleanup()
+		return fmt.Errorf("image loader ready on only %d/%d nodes (minimum: %d)", len(b.pods), len(b.nodes), minRequired)
+	}
+
+	return nil
+}
+
+// waitForLoaders polls the loader pods until every target node has a ready
+// one or timeout expires, and records the ready pods and the nodes without
+func (b *DaemonSetBackend) waitForLoaders(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pods, err := b.K8s.ListPods(b.Namespace, "app.kubernetes.io/name="+constants.LoaderName)
+		if err != nil {
+			return err
+		}
+		b.pods, b.unready = readyLoaders(pods, b.nodes)
+		if len(b.unready) == 0 || time.Now().After(deadline) {
+			return nil
+		}
+		time.Sleep(constants.LoaderPollInterval)
+	}
+}
+
+// readyLoaders returns the ready loader pods on the target nodes, one per
+// node, and the names of the target nodes without one
+func readyLoaders(pods []k8s.PodInfo, nodes map[string]k8s.NodeInfo) ([]k8s.PodInfo, []string) {
+	var ready []k8s.PodInfo
+	seen := make(map[string]bool)
+	for _, pod := range pods {
+		if _, ok := nodes[pod.NodeName]; !ok || !pod.Ready || seen[pod.NodeName] {
+			continue
+		}
+		seen[pod.NodeName] = true
+		ready = append(ready, pod)
+	}
+
+	var unready []string
+	for name := range nodes {
+		if !seen[name] {
+			unready = append(unready, name)
+		}
+	}
+	sort.Strings(unready)
+	return ready, unready
+}
+
+// NeedsTarball returns true; images are shipped as docker save tarballs
+func (b *DaemonSetBackend) NeedsTarball() bool {
+	return true
+}
+
+// Distribute streams the tarball into each loader pod and imports it on its node
+func (b *DaemonSetBackend) Distribute(img Image) ([]*ssh.DistributionResult, error) {
+	if b.DryRun {
+		b.Logger.DryRun("Would stream %s to every node through the image loader", img.Name)
+		return nil, nil
+	}
+
+	pods := b.targets(img, true)
+	unready := b.unreadyTargets(img)
+	total := len(pods) + len(unready)
+	if total == 0 {
+		return nil, nil
+	}
+
+	// Nodes without a ready loader pod cannot receive the image
+	var results []*ssh.DistributionResult
+	for _, name := range unready {
+		results = append(results, &ssh.DistributionResult{
+			Worker:    &ssh.WorkerNode{Name: name, IP: b.nodes[name].IP},
+			Component: img.Component,
+			Error:     fmt.Errorf("no ready image loader pod"),
+		})
+	}
+
+	// Nodes that already hold the exact image are not sent anything
+	targets := pods
+	if b.SkipPresent {
+		b.presentMu.Lock()
+		present, ok := b.present[img.Name]
+		delete(b.present, img.Name)
+		b.presentMu.Unlock()
+		if !ok {
+			present = b.checkPresence(img)
+		}
+
+		targets = nil
+		for _, pod := range pods {
+			if !present[pod.NodeName] {
+				targets = append(targets, pod)
+				continue
+			}
+			b.Logger.Info("  [%s] %s already present", pod.NodeName, img.Component)
+			results = append(results, &ssh.DistributionResult{
+				Worker:         b.nodeFor(pod),
+				Component:      img.Component,
+				Success:        true,
+				AlreadyPresent: true,
+			})
+		}
+	}
+
+	if len(targets) > 0 {
+		b.Logger.Info("Distributing %s to %d nodes via image loader (parallel: %d)", img.Component, len(targets), b.Parallel)
+	}
+
+	loaded := make([]*ssh.DistributionResult, len(targets))
+	sem := make(chan struct{}, max(b.Parallel, 1))
+	var wg sync.WaitGroup
+
+	for i, pod := range targets {
+		wg.Add(1)
+		go func(idx int, pod k8s.PodInfo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			loaded[idx] = b.loadOnNode(pod, img)
+		}(i, pod)
+	}
+	wg.Wait()
+	results = append(results, loaded...)
+
+	successCount := 0
+	for _, result := range results {
+		if result.Success {
+			successCount++
+		}
+	}
+
+	minRequired := b.MinNodes
+	if minRequired == 0 {
+		minRequired = total
+	}
+
+	b.Logger.Info("")
+	if successCount < minRequired {
+		return results, fmt.Errorf("only %d/%d nodes received image (minimum: %d)", successCount, total, minRequired)
+	}
+	if successCount < total {
+		b.Logger.Warning("Image distributed to %d/%d nodes (some failures)", successCount, total)
+	} else if presentCount := len(pods) - len(targets); presentCount > 0 {
+		b.Logger.Success("Image available on all %d nodes (%d already present)", successCount, presentCount)
+	} else {
+		b.Logger.Success("Image distributed to all %d nodes", successCount)
+	}
+
+	return results, nil
+}
+
+// loadOnNode imports the tarball through one loader pod and verifies it
+func (b *DaemonSetBackend) loadOnNode(pod k8s.PodInfo, img Image) *ssh.DistributionResult {
+	startTime := time.Now()
+	result := &ssh.DistributionResult{
+		Worker:      b.nodeFor(pod),
+		Component:   img.Component,
+		Compression: ssh.CompressionNone,
+		Hop:         1,
+	}
+
+	fail := func(err error) *ssh.DistributionResult {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		b.Logger.Warning("  [%s] %v", pod.NodeName, err)
+		return result
+	}
+
+	tarball, err := os.Open(img.TarballPath)
+	if err != nil {
+		return fail(fmt.Errorf("cannot open tarball: %w", err))
+	}
+	defer tarball.Close()
+
+	info, err := tarball.Stat()
+	if err != nil {
+		return fail(fmt.Errorf("cannot stat tarball: %w", err))
+	}
+	result.OriginalBytes = info.Size()
+
+	b.Logger.Info("  [%s] Streaming tarball (%.1f MB) and importing...", pod.NodeName, float64(info.Size())/1024/1024)
+
+	// Example: crepo.re-cloud.io/magnetiq/v2/backend:latest -> crepo.re-cloud.io/magnetiq/v2
+	parts := strings.Split(img.Name, "/")
+	baseName := strings.Join(parts[:len(parts)-1], "/")
+
+	transferStart := time.Now()
+	if _, err := b.K8s.ExecInPod(b.Namespace, pod.Name, tarball, hostCtr("images", "import", "--base-name", baseName, "-")...); err != nil {
+		return fail(fmt.Errorf("import failed: %w", err))
+	}
+	result.TransferDuration = time.Since(transferStart)
+	result.BytesTransferred = info.Size()
+
+	if _, err := containerd.VerifyImage(b.ctrRunner(pod), img.Name, img.Digest); err != nil {
+		return fail(fmt.Errorf("verification failed: %w", err))
+	}
+
+	result.Success = true
+	result.Duration = time.Since(startTime)
+	b.Logger.Success("  [%s] Completed in %s", pod.NodeName, result.Duration)
+	return result
+}
+
+// VerifiesInline returns true; every node is verified right after its import
+func (b *DaemonSetBackend) VerifiesInline() bool {
+	return true
+}
+
+// CheckPresence checks which nodes already hold the image
+func (b *DaemonSetBackend) CheckPresence(img Image) (present, total int) {
+	nodes := b.checkPresence(img)
+	b.presentMu.Lock()
+	b.present[img.Name] = nodes
+	b.presentMu.Unlock()
+	return len(nodes), len(b.targets(img, false)) + len(b.unreadyTargets(img))
+}
+
+// checkPresence verifies the image through every loader pod, keyed by node name.
+// Without an expected digest no node counts as holding the image.
+func (b *DaemonSetBackend) checkPresence(img Image) map[string]bool {
+	pods := b.targets(img, false)
+	present := make(map[string]bool, len(pods))
+	if b.DryRun || img.Digest == "" {
+		return present
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(b.Parallel, 1))
+
+	for _, pod := range pods {
+		wg.Add(1)
+		go func(pod k8s.PodInfo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if _, err := containerd.VerifyImage(b.ctrRunner(pod), img.Name, img.Digest); err != nil {
+				b.Logger.Debug("  [%s] needs %s: %v", pod.NodeName, img.Name, err)
+				return
+			}
+			mu.Lock()
+			present[pod.NodeName] = true
+			mu.Unlock()
+		}(pod)
+	}
+
+	wg.Wait()
+	return present
+}
+
+// Verify checks the image in each node's containerd through its loader pod
+func (b *DaemonSetBackend) Verify(img Image) error {
+	if b.DryRun {
+		return nil
+	}
+
+	pods := b.targets(img, false)
+	podsByNode := make(map[string]k8s.PodInfo, len(pods))
+	nodes := make([]*ssh.WorkerNode, 0, len(pods))
+	for _, pod := range pods {
+		podsByNode[pod.NodeName] = pod
+		nodes = append(nodes, b.nodeFor(pod))
+	}
+
+	return verifyOnNodes(b.Logger, nodes, img.Name, b.MinNodes, func(node *ssh.WorkerNode) error {
+		_, err := containerd.VerifyImage(b.ctrRunner(podsByNode[node.Name]), img.Name, img.Digest)
+		return err
+	})
+}
+
+// Cleanup deletes the loader DaemonSet
+func (b *DaemonSetBackend) Cleanup() error {
+	b.Logger.Debug("Removing image loader DaemonSet %s/%s", b.Namespace, constants.LoaderName)
+	return b.K8s.DeleteResource(b.Namespace, "daemonset", constants.LoaderName)
+}
+
+// targets returns the loader pods on nodes a workload running img can be scheduled on
+func (b *DaemonSetBackend) targets(img Image, log bool) []k8s.PodInfo {
+	var pods []k8s.PodInfo
+	for _, pod := range b.pods {
+		if img.Schedulable(b.nodes[pod.NodeName]) {
+			pods = append(pods, pod)
+		}
+	}
+	if log {
+		logTargets(b.Logger, img, len(pods)+len(b.unreadyTargets(img)), len(b.nodes))
+	}
+	return pods
+}
+
+// unreadyTargets returns the nodes without a ready loader pod that a workload
+// running img can be scheduled on
+func (b *DaemonSetBackend) unreadyTargets(img Image) []string {
+	var names []string
+	for _, name := range b.unready {
+		if img.Schedulable(b.nodes[name]) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// nodeFor describes the node a loader pod runs on
+func (b *DaemonSetBackend) nodeFor(pod k8s.PodInfo) *ssh.WorkerNode {
+	return &ssh.WorkerNode{Name: pod.NodeName, IP: pod.HostIP, Reachable: true}
+}
+
+// ctrRunner returns a containerd.Runner that executes the host's ctr in a loader pod
+func (b *DaemonSetBackend) ctrRunner(pod k8s.PodInfo) containerd.Runner {
+	return func(args ...string) (string, error) {
+		return b.K8s.ExecInPod(b.Namespace, pod.Name, nil, hostCtr(args...)...)
+	}
+}
+
+// hostCtr builds a loader pod command running ctr on the host
+func hostCtr(args ...string) []string {
+	return append([]string{"sh", "-c", hostCtrScript, "ctr"}, args...)
+}
@@ -0,0 +1,157 @@
+package distribution
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/containerd"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/registry"
+	"github.com/wapsol/m2deploy/pkg/ssh"
+)
+
+// Distribution modes selectable with --distribution
+const (
+	ModeSSH       = "ssh"
+	ModeDaemonSet = "daemonset"
+	ModeRegistry  = "registry"
+)
+
+// Modes lists the supported distribution modes
+var Modes = []string{ModeSSH, ModeDaemonSet, ModeRegistry}
+
+// Image is a component image to make available on the cluster's nodes
+type Image struct {
+	Component   string
+	Name        string // Image reference the nodes must hold
+	TarballPath string // Output of docker save
+	Digest      string // Expected image ID ("" = name check only)
+
+	// Workloads running the image; nodes none of them can be scheduled on are
+	// skipped (nil = every node)
+	Placements []k8s.Placement
+}
+
+// Backend moves images built on the controller onto the cluster's nodes
+type Backend interface {
+	// Name returns the distribution mode implemented by the backend
+	Name() string
+	// Prepare discovers the target nodes and makes sure they can be reached
+	Prepare() error
+	// NeedsTarball reports whether Distribute reads Image.TarballPath
+	NeedsTarball() bool
+	// Distribute makes the image available on every target node. It may be
+	// called for several images concurrently.
+	Distribute(img Image) ([]*ssh.DistributionResult, error)
+	// Verify checks that enough nodes hold exactly the expected image
+	Verify(img Image) error
+	// Cleanup removes anything the backend created on the cluster
+	Cleanup() error
+}
+
+// RolloutVerifier is implemented by backends whose nodes pull images only once
+// the deployment rolls out; VerifyRollout runs after the manifests are applied
+type RolloutVerifier interface {
+	VerifyRollout(img Image) error
+}
+
+// InlineVerifier is implemented by backends whose Distribute verifies the
+// image on every node it reports as successful and fails below the minimum
+// node count, so no separate Verify pass is needed afterwards
+type InlineVerifier interface {
+	VerifiesInline() bool
+}
+
+// PresenceChecker is implemented by backends that can tell which nodes already
+// hold an image. Distribute then skips those nodes.
+type PresenceChecker interface {
+	// CheckPresence returns how many of the target nodes hold exactly the image
+	CheckPresence(img Image) (present, total int)
+}
+
+// ValidateMode checks that mode is a supported distribution mode
+func ValidateMode(mode string) error {
+	for _, m := range Modes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported distribution mode %q (supported: %v)", mode, Modes)
+}
+
+// PlacementsFor returns the placements of the workloads that run imageName.
+// Images are compared by repository path, ignoring registry host and tag.
+func PlacementsFor(placements []k8s.Placement, imageName string) []k8s.Placement {
+	repository, _, _ := registry.SplitReference(registry.RepositoryPath(imageName))
+
+	var matched []k8s.Placement
+	for _, p := range placements {
+		for _, image := range p.Images {
+			if r, _, _ := registry.SplitReference(registry.RepositoryPath(image)); r == repository {
+				matched = append(matched, p)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// Schedulable reports whether a workload running img can be scheduled on node
+func (img Image) Schedulable(node k8s.NodeInfo) bool {
+	if len(img.Placements) == 0 {
+		return true
+	}
+	for _, p := range img.Placements {
+		if p.Allows(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// logTargets reports how many of total nodes img is sent to
+func logTargets(logger *config.Logger, img Image, targets, total int) {
+	if targets == total {
+		return
+	}
+	workloads := make([]string, len(img.Placements))
+	for i, p := range img.Placements {
+		workloads[i] = p.Workload
+	}
+	if targets == 0 {
+		logger.Warning("%s cannot be scheduled on any target node (%s)", img.Component, strings.Join(workloads, ", "))
+		return
+	}
+	logger.Info("%s targets %d/%d nodes where %s can be scheduled", img.Component, targets, total, strings.Join(workloads, ", "))
+}
+
+// verifyOnNodes runs verify for every node and fails if fewer than minRequired
+// nodes hold the image (0 = all nodes required)
+func verifyOnNodes(logger *config.Logger, nodes []*ssh.WorkerNode, imageName string, minRequired int, verify func(node *ssh.WorkerNode) error) error {
+	successCount := 0
+	for _, node := range nodes {
+		if err := verify(node); err != nil {
+			var verifyErr *containerd.VerifyError
+			if errors.As(err, &verifyErr) && verifyErr.Status == containerd.StatusStale {
+				logger.Warning("Stale image on %s: %v", node.Name, err)
+			} else {
+				logger.Warning("Verification failed on %s: %v", node.Name, err)
+			}
+			continue
+		}
+		logger.Success("✓ %s has %s", node.Name, imageName)
+		successCount++
+	}
+
+	if minRequired == 0 {
+		minRequired = len(nodes)
+	}
+
+	if successCount < minRequired {
+		return fmt.Errorf("image %s not available on enough workers (%d/%d, minimum: %d)",
+			imageName, successCount, len(nodes), minRequired)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package distribution
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/containerd"
+	"github.com/wapsol/m2deploy/pkg/health"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/ssh"
+)
+
+func TestValidateMode(t *testing.T) {
+	for _, mode := range []string{ModeSSH, ModeDaemonSet} {
+		if err := ValidateMode(mode); err != nil {
+			t.Errorf("ValidateMode(%q) error = %v", mode, err)
+		}
+	}
+	if err := ValidateMode("rsync"); err == nil {
+		t.Error("ValidateMode(\"rsync\") expected error")
+	}
+}
+
+func TestVerifyOnNodes(t *testing.T) {
+	logger := config.NewLogger(false)
+	nodes := []*ssh.WorkerNode{{Name: "worker-1"}, {Name: "worker-2"}, {Name: "worker-3"}}
+	verify := func(node *ssh.WorkerNode) error {
+		if node.Name == "worker-3" {
+			return &containerd.VerifyError{Image: "app:latest", Status: containerd.StatusStale}
+		}
+		return nil
+	}
+
+	if err := verifyOnNodes(logger, nodes, "app:latest", 2, verify); err != nil {
+		t.Errorf("verifyOnNodes() with minimum 2 error = %v", err)
+	}
+
+	err := verifyOnNodes(logger, nodes, "app:latest", 0, verify)
+	if err == nil || !strings.Contains(err.Error(), "2/3") {
+		t.Errorf("verifyOnNodes() with all required error = %v, want 2/3 failure", err)
+	}
+}
+
+func TestSSHBackendHealth(t *testing.T) {
+	store, err := health.Load(filepath.Join(t.TempDir(), "health.json"), 3)
+	if err != nil {
+		t.Fatalf("health.Load() error = %v", err)
+	}
+	backend := NewSSHBackend(config.NewLogger(false), nil, &ssh.Distributor{})
+	backend.Health = store
+
+	workers := []*ssh.WorkerNode{
+		{Name: "worker-1", Reachable: true},
+		{Name: "worker-2", LastError: errors.New("connection refused")},
+		{Name: "worker-3", Reachable: true},
+	}
+	backend.tracked = workers
+	backend.workers = backend.dropUnreachable(workers)
+	if len(backend.workers) != 2 || backend.workers[1].Name != "worker-3" {
+		t.Fatalf("dropUnreachable() kept %v", backend.workers)
+	}
+
+	// worker-3 never got an image, so this run says nothing about it
+	backend.recordCompleted("worker-1")
+	backend.recordHealth()
+
+	if record := store.Get("worker-1"); record == nil || record.LastSuccess.IsZero() {
+		t.Errorf("worker-1 record = %+v, want a success", record)
+	}
+	if record := store.Get("worker-2"); record == nil || record.ConsecutiveFailures != 1 {
+		t.Errorf("worker-2 record = %+v, want one failure", record)
+	}
+	if record := store.Get("worker-3"); record != nil && (!record.LastSuccess.IsZero() || record.TotalFailures > 0) {
+		t.Errorf("worker-3 record = %+v, want nothing recorded", record)
+	}
+}
+
+func TestHostCtr(t *testing.T) {
+	cmd := hostCtr("images", "list")
+	if cmd[0] != "sh" || cmd[3] != "ctr" {
+		t.Fatalf("hostCtr() = %v", cmd)
+	}
+	if got := strings.Join(cmd[4:], " "); got != "images list" {
+		t.Errorf("hostCtr() args = %q, want %q", got, "images list")
+	}
+	if !strings.Contains(cmd[2], "-n k8s.io") {
+		t.Errorf("hostCtr() script does not select the k8s.io namespace: %s", cmd[2])
+	}
+}
+
+func TestRenderLoader(t *testing.T) {
+	backend := NewDaemonSetBackend(config.NewLogger(false), nil, false)
+	nodes := []k8s.NodeInfo{
+		{Name: "worker-1", Taints: []k8s.Taint{{Key: "dedicated", Value: "app", Effect: k8s.TaintNoSchedule}}},
+		{Name: "worker-2", Taints: []k8s.Taint{
+			{Key: "dedicated", Value: "app", Effect: k8s.TaintNoSchedule},
+			{Key: "spot", Effect: "PreferNoSchedule"},
+		}},
+	}
+
+	manifest, err := backend.renderLoader(nodes)
+	if err != nil {
+		t.Fatalf("renderLoader() error = %v", err)
+	}
+	for _, want := range []string{
+		"values: [\"worker-1\", \"worker-2\"]",
+		"      tolerations:\n      - key: \"dedicated\"\n        operator: Equal\n        value: \"app\"\n        effect: NoSchedule\n      hostPID: true",
+		"privileged: true",
+		"name: CONTAINERD_SOCKET\n          value: \"\"",
+	} {
+		if !strings.Contains(manifest, want) {
+			t.Errorf("loader manifest lacks %q:\n%s", want, manifest)
+		}
+	}
+	for _, unwanted := range []string{"operator: Exists", "hostPath", "spot"} {
+		if strings.Contains(manifest, unwanted) {
+			t.Errorf("loader manifest contains %q:\n%s", unwanted, manifest)
+		}
+	}
+
+	backend.Socket = "/run/custom/containerd.sock"
+	manifest, _ = backend.renderLoader(nodes[:1])
+	if !strings.Contains(manifest, "value: \"/run/custom/containerd.sock\"") {
+		t.Errorf("loader manifest ignores the socket override:\n%s", manifest)
+	}
+}
+
+func TestReadyLoaders(t *testing.T) {
+	nodes := map[string]k8s.NodeInfo{"worker-1": {Name: "worker-1"}, "worker-2": {Name: "worker-2"}, "worker-3": {Name: "worker-3"}}
+	pods := []k8s.PodInfo{
+		{Name: "loader-a", NodeName: "worker-1", Ready: true},
+		{Name: "loader-b", NodeName: "worker-2", Ready: false},
+		{Name: "loader-c", NodeName: "controller", Ready: true},
+		{Name: "loader-d", NodeName: "worker-1", Ready: true},
+	}
+
+	ready, unready := readyLoaders(pods, nodes)
+	if len(ready) != 1 || ready[0].Name != "loader-a" {
+		t.Errorf("readyLoaders() ready = %+v, want loader-a only", ready)
+	}
+	if strings.Join(unready, ",") != "worker-2,worker-3" {
+		t.Errorf("readyLoaders() unready = %v, want worker-2 and worker-3", unready)
+	}
+}
+
+func TestDistributeUnreadyNodes(t *testing.T) {
+	backend := NewDaemonSetBackend(config.NewLogger(false), nil, false)
+	backend.nodes = map[string]k8s.NodeInfo{"worker-1": {Name: "worker-1", IP: "10.0.0.1"}, "worker-2": {Name: "worker-2", IP: "10.0.0.2"}}
+	backend.unready = []string{"worker-1", "worker-2"}
+	backend.MinNodes = 1
+
+	results, err := backend.Distribute(Image{Component: "backend", Name: "magnetiq/v2/backend:latest"})
+	if err == nil || !strings.Contains(err.Error(), "only 0/2 nodes") {
+		t.Errorf("Distribute() error = %v, want 0/2 nodes", err)
+	}
+	if len(results) != 2 || results[0].Success || results[0].Error == nil || results[1].Worker.IP != "10.0.0.2" {
+		t.Errorf("Distribute() results = %+v, want a failure per node", results)
+	}
+}
+
+func TestLoaderTolerationsNone(t *testing.T) {
+	if got := loaderTolerations([]k8s.NodeInfo{{Name: "worker-1"}}); got != " []" {
+		t.Errorf("loaderTolerations() = %q, want none", got)
+	}
+}
+
+func TestPlacementsFor(t *testing.T) {
+	placements := []k8s.Placement{
+		{Workload: "deployment/magnetiq-backend", Images: []string{"magnetiq/v2/backend:latest"}},
+		{Workload: "deployment/magnetiq-frontend", Images: []string{"crepo.re-cloud.io/magnetiq/v2/frontend:abc123"}},
+	}
+
+	got := PlacementsFor(placements, "crepo.re-cloud.io/magnetiq/v2/backend:abc123")
+	if len(got) != 1 || got[0].Workload != "deployment/magnetiq-backend" {
+		t.Errorf("PlacementsFor(backend) = %+v", got)
+	}
+	got = PlacementsFor(placements, "magnetiq/v2/frontend:latest")
+	if len(got) != 1 || got[0].Workload != "deployment/magnetiq-frontend" {
+		t.Errorf("PlacementsFor(frontend) = %+v", got)
+	}
+	if got := PlacementsFor(placements, "magnetiq/v2/worker:latest"); len(got) != 0 {
+		t.Errorf("PlacementsFor(worker) = %+v, want none", got)
+	}
+}
+
+func TestImageSchedulable(t *testing.T) {
+	gpu := k8s.NodeInfo{Name: "gpu-1", Labels: map[string]string{"pool": "gpu"}}
+	app := k8s.NodeInfo{Name: "app-1", Labels: map[string]string{"pool": "app"}}
+
+	untargeted := Image{Name: "app:latest"}
+	if !untargeted.Schedulable(gpu) || !untargeted.Schedulable(app) {
+		t.Error("image without placements should target every node")
+	}
+
+	img := Image{Name: "app:latest", Placements: []k8s.Placement{
+		{NodeSelector: map[string]string{"pool": "app"}},
+		{NodeSelector: map[string]string{"pool": "edge"}},
+	}}
+	if img.Schedulable(gpu) || !img.Schedulable(app) {
+		t.Error("image should target only nodes one of its workloads can run on")
+	}
+}
@@ -0,0 +1,246 @@
+package distribution
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/docker"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/registry"
+	"github.com/wapsol/m2deploy/pkg/retry"
+	"github.com/wapsol/m2deploy/pkg/ssh"
+)
+
+// RegistryBackend pushes images to an OCI registry and points the Deployments
+// at it; nodes pull the images themselves when the pods roll out.
+type RegistryBackend struct {
+	Logger      *config.Logger
+	Docker      *docker.Client
+	K8s         *k8s.Client // Manifests applied through this client use the pushed images
+	Registry    *registry.Client
+	DryRun      bool
+	RunLocal    bool   // Run the registry as a container on the controller
+	LocalImage  string // Image for the local registry container
+	PullTimeout time.Duration
+
+	refs   map[string]string // Local image name -> pushed reference pinned by digest
+	refsMu sync.Mutex        // Guards refs and K8s.ImageOverrides
+}
+
+// NewRegistryBackend creates a registry distribution backend
+func NewRegistryBackend(logger *config.Logger, dockerClient *docker.Client, k8sClient *k8s.Client, registryClient *registry.Client, dryRun bool) *RegistryBackend {
+	return &RegistryBackend{
+		Logger:      logger,
+		Docker:      dockerClient,
+		K8s:         k8sClient,
+		Registry:    registryClient,
+		DryRun:      dryRun,
+		RunLocal:    false,
+		LocalImage:  constants.DefaultRegistryImage,
+		PullTimeout: constants.RegistryPullTimeout,
+		refs:        make(map[string]string),
+	}
+}
+
+// Name returns the distribution mode
+func (b *RegistryBackend) Name() string {
+	return ModeRegistry
+}
+
+// Prepare starts the local registry if requested, logs in and checks the registry API
+func (b *RegistryBackend) Prepare() error {
+	address := b.Registry.Address
+
+	if b.RunLocal {
+		port := constants.DefaultRegistryPort
+		if _, portStr, err := net.SplitHostPort(address); err == nil {
+			if p, err := strconv.Atoi(portStr); err == nil {
+				port = p
+			}
+		}
+		if err := b.Docker.EnsureRegistryContainer(constants.RegistryContainerName, b.LocalImage, port); err != nil {
+			return err
+		}
+	}
+
+	if b.Registry.Username != "" {
+		if err := b.Docker.Login(address, b.Registry.Username, b.Registry.Password); err != nil {
+			return err
+		}
+	}
+
+	if b.DryRun {
+		return nil
+	}
+
+	// A freshly started registry container may need a moment to listen
+	if err := retry.WithRetry(b.Registry.Ping, nil); err != nil {
+		return err
+	}
+
+	b.Logger.Success("Registry %s reachable", address)
+	if b.Registry.Insecure {
+		b.Logger.Info("Nodes must trust the insecure registry %s (containerd registry host config)", address)
+	}
+	b.Logger.Info("")
+
+	return nil
+}
+
+// NeedsTarball returns false; images are pushed from the local Docker daemon
+func (b *RegistryBackend) NeedsTarball() bool {
+	return false
+}
+
+// Distribute pushes the image and overrides it in the manifests applied later.
+// No per-node results exist yet; nodes pull when the pods are scheduled.
+func (b *RegistryBackend) Distribute(img Image) ([]*ssh.DistributionResult, error) {
+	ref := registry.Rehost(b.Registry.Address, img.Name)
+
+	if err := b.Docker.TagImage(img.Name, ref); err != nil {
+		return nil, err
+	}
+	digest, err := b.Docker.PushImage(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pin the reference so nodes run exactly the pushed image
+	pinned := ref
+	if digest != "" {
+		pinned = ref + "@" + digest
+	}
+	repository, _, _ := registry.SplitReference(img.Name)
+	b.refsMu.Lock()
+	b.refs[img.Name] = pinned
+	if b.K8s.ImageOverrides == nil {
+		b.K8s.ImageOverrides = make(map[string]string)
+	}
+	b.K8s.ImageOverrides[repository] = pinned
+	b.refsMu.Unlock()
+	b.Logger.Info("  Deployments will use %s", pinned)
+
+	return nil, nil
+}
+
+// Verify checks that the registry serves the pushed digest under the image's tag
+func (b *RegistryBackend) Verify(img Image) error {
+	if b.DryRun {
+		return nil
+	}
+
+	b.refsMu.Lock()
+	pinned, ok := b.refs[img.Name]
+	b.refsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("image %s was not pushed", img.Name)
+	}
+
+	repository, tag, digest := registry.SplitReference(pinned)
+	path := registry.RepositoryPath(repository)
+	stored, err := b.Registry.ManifestDigest(path, tag)
+	if err != nil {
+		return fmt.Errorf("registry verification failed for %s: %w", img.Name, err)
+	}
+	if digest != "" && stored != digest {
+		return fmt.Errorf("registry has %s:%s at %s, expected %s", path, tag, stored, digest)
+	}
+
+	b.Logger.Success("✓ %s has %s:%s", b.Registry.Address, path, tag)
+	return nil
+}
+
+// VerifyRollout waits until every node running a pod with the image reports
+// the pushed digest in its image status
+func (b *RegistryBackend) VerifyRollout(img Image) error {
+	if b.DryRun {
+		return nil
+	}
+
+	pinned := b.refs[img.Name]
+	repository, _, digest := registry.SplitReference(pinned)
+	want := repository + "@" + digest
+
+	b.Logger.Info("Waiting for nodes to pull %s...", want)
+	deadline := time.Now().Add(b.PullTimeout)
+	for {
+		pulled, pending, err := b.pullStatus(pinned, want)
+		if err == nil && len(pending) == 0 {
+			for _, node := range pulled {
+				b.Logger.Success("✓ %s pulled %s", node, img.Component)
+			}
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("pull verification for %s failed: %w", img.Name, err)
+			}
+			return fmt.Errorf("image %s not pulled after %s: %s", want, b.PullTimeout, strings.Join(pending, ", "))
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// pullStatus returns the nodes that pulled the image and the pods still waiting for it
+func (b *RegistryBackend) pullStatus(pinned, want string) (pulled, pending []string, err error) {
+	pods, err := b.K8s.ListPods(b.K8s.Namespace, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	nodeImages, err := b.K8s.NodeImages()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pulledNodes := make(map[string]bool)
+	found := false
+	for _, pod := range pods {
+		if !containsString(pod.Images, pinned) {
+			continue
+		}
+		found = true
+
+		if pod.NodeName == "" {
+			pending = append(pending, pod.Name+" (unscheduled)")
+			continue
+		}
+		if !containsString(nodeImages[pod.NodeName], want) {
+			pending = append(pending, fmt.Sprintf("%s on %s", pod.Name, pod.NodeName))
+			continue
+		}
+		pulledNodes[pod.NodeName] = true
+	}
+
+	if !found {
+		return nil, nil, fmt.Errorf("no pods use %s; check the image references in the manifests", pinned)
+	}
+
+	for node := range pulledNodes {
+		pulled = append(pulled, node)
+	}
+	sort.Strings(pulled)
+	return pulled, pending, nil
+}
+
+// Cleanup is a no-op; the registry keeps the images for later rollouts
+func (b *RegistryBackend) Cleanup() error {
+	return nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
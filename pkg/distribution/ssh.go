@@ -0,0 +1,267 @@
+package distribution
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/health"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/ssh"
+)
+
+// SSHBackend copies image tarballs to workers over SSH and imports them with ctr
+type SSHBackend struct {
+	Logger      *config.Logger
+	K8s         *k8s.Client
+	Distributor *ssh.Distributor
+	Health      *health.Store // Worker health across runs (nil = not tracked)
+	Cordon      bool          // Cordon workers when they are quarantined
+
+	workers    []*ssh.WorkerNode
+	tracked    []*ssh.WorkerNode // Workers whose health this run records, reachable or not
+	failures   map[string]error  // Failures of this run keyed by worker
+	completed  map[string]bool   // Workers that received or already held an image
+	failuresMu sync.Mutex        // Components are distributed concurrently
+}
+
+// NewSSHBackend creates an SSH distribution backend
+func NewSSHBackend(logger *config.Logger, k8sClient *k8s.Client, distributor *ssh.Distributor) *SSHBackend {
+	return &SSHBackend{
+		Logger:      logger,
+		K8s:         k8sClient,
+		Distributor: distributor,
+		failures:    make(map[string]error),
+		completed:   make(map[string]bool),
+	}
+}
+
+// Name returns the distribution mode
+func (b *SSHBackend) Name() string {
+	return ModeSSH
+}
+
+// Prepare discovers worker nodes and tests SSH connectivity
+func (b *SSHBackend) Prepare() error {
+	workers, err := b.Distributor.GetWorkerNodes(b.K8s)
+	if err != nil {
+		return fmt.Errorf("failed to get worker nodes: %w", err)
+	}
+	if workers, err = b.skipQuarantined(workers); err != nil {
+		return err
+	}
+	b.workers = workers
+	b.tracked = workers
+
+	b.Logger.Info("Found %d worker nodes", len(workers))
+	for _, w := range workers {
+		b.Logger.Info("  - %s (%s)", w.Name, w.IP)
+	}
+	b.Logger.Info("")
+
+	b.Logger.Info("Testing SSH connectivity to all workers...")
+	if err := b.Distributor.TestConnectivity(workers); err != nil {
+		b.workers = b.dropUnreachable(workers)
+
+		minRequired := b.Distributor.MinWorkers
+		if minRequired == 0 {
+			minRequired = len(workers)
+		}
+		if len(b.workers) < minRequired {
+			b.recordHealth()
+			return fmt.Errorf("SSH connectivity test failed (%d/%d workers reachable, need %d): %w",
+				len(b.workers), len(workers), minRequired, err)
+		}
+		b.Logger.Warning("%d/%d workers reachable via SSH; continuing without the others", len(b.workers), len(workers))
+		b.Logger.Info("")
+		return nil
+	}
+	b.Logger.Success("All workers reachable via SSH")
+	b.Logger.Info("")
+
+	return nil
+}
+
+// dropUnreachable records a failure for each unreachable worker and returns
+// the reachable ones
+func (b *SSHBackend) dropUnreachable(workers []*ssh.WorkerNode) []*ssh.WorkerNode {
+	var reachable []*ssh.WorkerNode
+	for _, w := range workers {
+		if w.Reachable {
+			reachable = append(reachable, w)
+			continue
+		}
+		err := w.LastError
+		if err == nil {
+			err = fmt.Errorf("unreachable via SSH")
+		}
+		b.Logger.Warning("Skipping unreachable worker %s: %v", w.Name, err)
+		b.recordFailure(w.Name, err)
+	}
+	return reachable
+}
+
+// Workers returns the workers found by Prepare
+func (b *SSHBackend) Workers() []*ssh.WorkerNode {
+	return b.workers
+}
+
+// NeedsTarball returns true; images are shipped as docker save tarballs
+func (b *SSHBackend) NeedsTarball() bool {
+	return true
+}
+
+// Distribute sends the image tarball to every worker
+func (b *SSHBackend) Distribute(img Image) ([]*ssh.DistributionResult, error) {
+	workers := b.targets(img, true)
+	if len(workers) == 0 {
+		return nil, nil
+	}
+	b.Distributor.SetImageDigest(img.Name, img.Digest)
+	results, err := b.Distributor.DistributeToAllWorkers(workers, img.TarballPath, img.Component, img.Name)
+	for _, result := range results {
+		switch {
+		case result.Success:
+			b.recordCompleted(result.Worker.Name)
+		case result.Error != nil:
+			b.recordFailure(result.Worker.Name, result.Error)
+		}
+	}
+	return results, err
+}
+
+// VerifiesInline returns true; every worker is verified right after its import
+func (b *SSHBackend) VerifiesInline() bool {
+	return true
+}
+
+// CheckPresence checks which workers already hold the image
+func (b *SSHBackend) CheckPresence(img Image) (present, total int) {
+	workers := b.targets(img, false)
+	b.Distributor.SetImageDigest(img.Name, img.Digest)
+	held := b.Distributor.CheckPresence(workers, img.Name)
+	for worker, ok := range held {
+		if ok {
+			b.recordCompleted(worker)
+		}
+	}
+	return len(held), len(workers)
+}
+
+// Verify checks the image in each worker's containerd over SSH
+func (b *SSHBackend) Verify(img Image) error {
+	return verifyOnNodes(b.Logger, b.targets(img, false), img.Name, b.Distributor.MinWorkers, func(node *ssh.WorkerNode) error {
+		err := b.Distributor.VerifyImportOnWorker(node, img.Name)
+		if err != nil {
+			b.recordFailure(node.Name, err)
+		}
+		return err
+	})
+}
+
+// recordFailure remembers the failure of worker for its health record
+func (b *SSHBackend) recordFailure(worker string, err error) {
+	b.failuresMu.Lock()
+	defer b.failuresMu.Unlock()
+
+	b.failures[worker] = err
+}
+
+// recordCompleted remembers that worker holds an image of this run
+func (b *SSHBackend) recordCompleted(worker string) {
+	b.failuresMu.Lock()
+	defer b.failuresMu.Unlock()
+
+	b.completed[worker] = true
+}
+
+// targets returns the workers a workload running img can be scheduled on.
+// Workers given with --workers carry no labels and are always targeted.
+func (b *SSHBackend) targets(img Image, log bool) []*ssh.WorkerNode {
+	if len(b.Distributor.WorkerIPs) > 0 {
+		return b.workers
+	}
+
+	var workers []*ssh.WorkerNode
+	for _, w := range b.workers {
+		if img.Schedulable(w.NodeInfo()) {
+			workers = append(workers, w)
+		}
+	}
+	if log {
+		logTargets(b.Logger, img, len(workers), len(b.workers))
+	}
+	return workers
+}
+
+// Cleanup records the health of this run's workers; tarballs are removed from
+// workers during distribution
+func (b *SSHBackend) Cleanup() error {
+	b.recordHealth()
+	return nil
+}
+
+// skipQuarantined leaves out quarantined workers
+func (b *SSHBackend) skipQuarantined(workers []*ssh.WorkerNode) ([]*ssh.WorkerNode, error) {
+	if b.Health == nil {
+		return workers, nil
+	}
+
+	var healthy []*ssh.WorkerNode
+	for _, w := range workers {
+		if record := b.Health.Get(w.Name); record != nil && record.Quarantined {
+			b.Logger.Warning("Skipping quarantined worker %s (%d failed runs, last: %s)", w.Name, record.ConsecutiveFailures, record.ErrorClass)
+			continue
+		}
+		healthy = append(healthy, w)
+	}
+
+	if len(healthy) == 0 {
+		return nil, fmt.Errorf("all %d workers are quarantined; check them and run 'm2deploy workers release'", len(workers))
+	}
+	if len(healthy) < len(workers) {
+		b.Logger.Info("Run 'm2deploy workers status' for details, 'm2deploy workers release <name>' once fixed")
+	}
+	return healthy, nil
+}
+
+// recordHealth saves one failure per failed worker and one success per worker
+// that completed distribution, and quarantines workers that failed too often.
+// Runs once per backend.
+func (b *SSHBackend) recordHealth() {
+	if b.Health == nil || b.tracked == nil {
+		return
+	}
+	workers := b.tracked
+	b.tracked = nil
+
+	now := time.Now()
+	for _, w := range workers {
+		err, failed := b.failures[w.Name]
+		if !failed {
+			if b.completed[w.Name] {
+				b.Health.RecordSuccess(w.Name, now)
+			}
+			continue
+		}
+		if !b.Health.RecordFailure(w.Name, err, now) {
+			continue
+		}
+
+		b.Logger.Warning("Worker %s quarantined after %d failed runs (%s); it is skipped until released",
+			w.Name, b.Health.Get(w.Name).ConsecutiveFailures, b.Health.Get(w.Name).ErrorClass)
+		if b.Cordon && len(b.Distributor.WorkerIPs) == 0 {
+			if err := b.K8s.Cordon(w.Name); err != nil {
+				b.Logger.Warning("Failed to cordon %s: %v", w.Name, err)
+			} else {
+				b.Health.Get(w.Name).Cordoned = true
+				b.Logger.Warning("Cordoned node %s so no pods are scheduled without the image", w.Name)
+			}
+		}
+	}
+
+	if err := b.Health.Save(); err != nil {
+		b.Logger.Warning("Failed to save worker health: %v", err)
+	}
+}
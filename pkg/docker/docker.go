@@ -6,11 +6,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/wapsol/m2deploy/pkg/builder"
 	"github.com/wapsol/m2deploy/pkg/config"
 	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/containerd"
 )
 
 // Client handles Docker operations
@@ -20,6 +22,10 @@ type Client struct {
 	Config         *config.Config
 	UseSudo        bool
 	ExternalBuilder *builder.ExternalBuilder // Optional: use external build script
+	Runtime        string // Local container runtime (containerd.RuntimeAuto = detect)
+	RuntimeSocket  string // Local containerd socket ("" = runtime default or detected)
+
+	runtime *containerd.Runtime // Resolved on first use
 }
 
 // NewClient creates a new Docker client
@@ -30,6 +36,7 @@ func NewClient(logger *config.Logger, dryRun bool, cfg *config.Config, useSudo b
 		Config:          cfg,
 		UseSudo:         useSudo,
 		ExternalBuilder: nil, // Will be initialized if needed
+		Runtime:         containerd.RuntimeAuto,
 	}
 }
 
@@ -88,11 +95,14 @@ func (c *Client) Build(workDir, component string) error {
 	return c.ExternalBuilder.Build(workDir, component)
 }
 
-// SaveImage saves a Docker image to a tarball
+// SaveImage saves a component's Docker image to a tarball
 func (c *Client) SaveImage(component, outputPath string) error {
-	imageName := c.Config.GetLocalImageName(component)
+	return c.SaveImageByName(c.Config.GetLocalImageName(component), outputPath)
+}
 
-	c.Logger.Info("Saving %s image to tarball", component)
+// SaveImageByName saves a Docker image given by reference to a tarball
+func (c *Client) SaveImageByName(imageName, outputPath string) error {
+	c.Logger.Info("Saving %s to tarball", imageName)
 
 	if c.DryRun {
 		c.Logger.DryRun("Would save image %s to %s", imageName, outputPath)
@@ -119,19 +129,20 @@ func (c *Client) SaveImage(component, outputPath string) error {
 	c.Logger.Debug("Executing: docker save %s > %s", imageName, outputPath)
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to save %s image: %w", component, err)
+		return fmt.Errorf("failed to save %s: %w", imageName, err)
 	}
 
-	c.Logger.Success("Saved %s image to: %s", component, outputPath)
+	c.Logger.Success("Saved %s to: %s", imageName, outputPath)
 	return nil
 }
 
-// ImportToK0s imports a Docker image tarball into k0s containerd
+// ImportToK0s imports a Docker image tarball into the local containerd
+// (k0s ctr, ctr or nerdctl, see localRuntime)
 func (c *Client) ImportToK0s(tarballPath string) error {
-	c.Logger.Info("Importing image to k0s containerd")
+	c.Logger.Info("Importing image to local containerd")
 
 	if c.DryRun {
-		c.Logger.DryRun("Would import tarball %s to k0s", tarballPath)
+		c.Logger.DryRun("Would import tarball %s to local containerd", tarballPath)
 		return nil
 	}
 
@@ -140,61 +151,130 @@ func (c *Client) ImportToK0s(tarballPath string) error {
 		return fmt.Errorf("tarball not found: %s", tarballPath)
 	}
 
-	// Build k0s ctr command
-	var cmd *exec.Cmd
-	if c.UseSudo {
-		cmd = exec.Command("sudo", "k0s", "ctr", "images", "import", tarballPath)
-	} else {
-		cmd = exec.Command("k0s", "ctr", "images", "import", tarballPath)
+	runtime, err := c.localRuntime()
+	if err != nil {
+		return err
 	}
+	cmd := c.runtimeCmd(runtime.ImportArgs(tarballPath, ""))
 
-	c.Logger.Debug("Executing: k0s ctr images import %s", tarballPath)
+	c.Logger.Debug("Executing: %s", strings.Join(runtime.ImportArgs(tarballPath, ""), " "))
 
 	// Use runCmdWithError to capture detailed errors
 	if err := c.runCmdWithError(cmd); err != nil {
 		// Concise console message, detailed log
-		consoleMsg := "Failed to import image to k0s (see log for details)"
-		logMsg := fmt.Sprintf("Failed to import image to k0s: %v", err)
+		consoleMsg := fmt.Sprintf("Failed to import image with %s (see log for details)", runtime)
+		logMsg := fmt.Sprintf("Failed to import image with %s: %v", runtime, err)
 		c.Logger.WarningDetailed(consoleMsg, logMsg)
-		return fmt.Errorf("k0s import failed")
+		return fmt.Errorf("%s import failed", runtime.Kind)
 	}
 
-	c.Logger.Success("Imported image to k0s containerd")
+	c.Logger.Success("Imported image to local containerd (%s)", runtime)
 	return nil
 }
 
-// ListK0sImages lists images in k0s containerd
+// ListK0sImages lists images in the local containerd
 func (c *Client) ListK0sImages() (string, error) {
-	c.Logger.Debug("Listing k0s containerd images")
+	c.Logger.Debug("Listing local containerd images")
 
-	var cmd *exec.Cmd
-	if c.UseSudo {
-		cmd = exec.Command("sudo", "k0s", "ctr", "images", "list")
-	} else {
-		cmd = exec.Command("k0s", "ctr", "images", "list")
+	runtime, err := c.localRuntime()
+	if err != nil {
+		return "", err
 	}
 
-	output, err := cmd.CombinedOutput()
+	output, err := c.runtimeCmd(runtime.CtrArgs("images", "list")).CombinedOutput()
 	if err != nil {
-		return "", fmt.Errorf("failed to list k0s images: %w", err)
+		return "", fmt.Errorf("failed to list containerd images: %w", err)
 	}
 
 	return string(output), nil
 }
 
+// GetImageDigest returns the image ID (config digest) of a local Docker image
+func (c *Client) GetImageDigest(component string) (string, error) {
+	imageName := c.Config.GetLocalImageName(component)
+
+	cmd := c.buildDockerCmd("image", "inspect", "--format", "{{.Id}}", imageName)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", imageName, err)
+	}
+
+	digest := strings.TrimSpace(string(output))
+	if !strings.HasPrefix(digest, "sha256:") {
+		return "", fmt.Errorf("unexpected image ID for %s: %s", imageName, digest)
+	}
+
+	return digest, nil
+}
+
+// InspectImage returns the image ID (config digest) and the repository
+// digests of a local Docker image given by reference
+func (c *Client) InspectImage(imageName string) (string, []string, error) {
+	cmd := c.buildDockerCmd("image", "inspect", "--format", "{{.Id}}{{range .RepoDigests}} {{.}}{{end}}", imageName)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to inspect image %s: %w", imageName, err)
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", nil, fmt.Errorf("unexpected image ID for %s", imageName)
+	}
+	return fields[0], fields[1:], nil
+}
+
+// GetImageSize returns the size in bytes of a local Docker image, roughly the
+// size of its docker save tarball
+func (c *Client) GetImageSize(component string) (int64, error) {
+	imageName := c.Config.GetLocalImageName(component)
+
+	cmd := c.buildDockerCmd("image", "inspect", "--format", "{{.Size}}", imageName)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect image %s: %w", imageName, err)
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected image size for %s: %s", imageName, output)
+	}
+	return size, nil
+}
+
 // VerifyImageInK0s verifies that an image exists in k0s containerd
-func (c *Client) VerifyImageInK0s(component string) (bool, error) {
+// The image reference must match exactly and resolve to the same digest as the
+// local Docker image. Returns a *containerd.VerifyError if the image is missing
+// or stale.
+func (c *Client) VerifyImageInK0s(component string) error {
 	imageName := c.Config.GetLocalImageName(component)
 
 	c.Logger.Debug("Verifying image in k0s: %s", imageName)
 
-	output, err := c.ListK0sImages()
+	expectedDigest, err := c.GetImageDigest(component)
 	if err != nil {
-		return false, err
+		c.Logger.Debug("Cannot determine local digest, checking name only: %v", err)
+		expectedDigest = ""
 	}
 
-	// Check if image name appears in the output
-	return strings.Contains(output, imageName), nil
+	_, err = containerd.VerifyImage(c.k0sCtrRunner(), imageName, expectedDigest)
+	return err
+}
+
+// k0sCtrRunner returns a containerd.Runner that executes ctr locally through
+// the local runtime
+func (c *Client) k0sCtrRunner() containerd.Runner {
+	return func(args ...string) (string, error) {
+		runtime, err := c.localRuntime()
+		if err != nil {
+			return "", err
+		}
+
+		output, err := c.runtimeCmd(runtime.CtrArgs(args...)).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s ctr %s failed: %w", runtime.Kind, strings.Join(args, " "), err)
+		}
+		return string(output), nil
+	}
 }
 
 // Run runs a Docker container for testing
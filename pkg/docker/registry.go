@@ -0,0 +1,126 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pushDigestPattern matches the digest line printed by docker push
+var pushDigestPattern = regexp.MustCompile(`digest: (sha256:[0-9a-f]{64})`)
+
+// TagImage tags a local image with an additional reference
+func (c *Client) TagImage(source, target string) error {
+	if c.DryRun {
+		c.Logger.DryRun("Would tag %s as %s", source, target)
+		return nil
+	}
+
+	if err := c.runCmdWithError(c.buildDockerCmd("tag", source, target)); err != nil {
+		return fmt.Errorf("failed to tag %s as %s: %w", source, target, err)
+	}
+	return nil
+}
+
+// PushImage pushes an image and returns the manifest digest reported by the registry
+func (c *Client) PushImage(ref string) (string, error) {
+	c.Logger.Info("Pushing %s", ref)
+
+	if c.DryRun {
+		c.Logger.DryRun("Would push %s", ref)
+		return "", nil
+	}
+
+	cmd := c.buildDockerCmd("push", ref)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to push %s: %w: %s", ref, err, strings.TrimSpace(string(output)))
+	}
+
+	digest := parsePushDigest(string(output))
+	if digest == "" {
+		return "", fmt.Errorf("push of %s did not report a digest", ref)
+	}
+
+	c.Logger.Success("Pushed %s (%s)", ref, digest)
+	return digest, nil
+}
+
+// parsePushDigest extracts the manifest digest from docker push output
+func parsePushDigest(output string) string {
+	match := pushDigestPattern.FindStringSubmatch(output)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// Login authenticates docker against a registry, passing the password on stdin
+func (c *Client) Login(registry, username, password string) error {
+	if c.DryRun {
+		c.Logger.DryRun("Would log in to %s as %s", registry, username)
+		return nil
+	}
+
+	cmd := c.buildDockerCmd("login", registry, "--username", username, "--password-stdin")
+	cmd.Stdin = strings.NewReader(password)
+	if err := c.runCmdWithError(cmd); err != nil {
+		return fmt.Errorf("failed to log in to %s: %w", registry, err)
+	}
+
+	c.Logger.Debug("Logged in to %s as %s", registry, username)
+	return nil
+}
+
+// EnsureRegistryContainer starts a local registry container, creating it if needed.
+// Deletion is enabled so 'registry gc' can prune old images.
+func (c *Client) EnsureRegistryContainer(name, image string, port int) error {
+	if c.DryRun {
+		c.Logger.DryRun("Would ensure local registry container %s on port %d", name, port)
+		return nil
+	}
+
+	output, err := c.buildDockerCmd("inspect", "--format", "{{.State.Running}}", name).Output()
+	if err == nil {
+		if strings.TrimSpace(string(output)) == "true" {
+			c.Logger.Debug("Local registry %s already running", name)
+			return nil
+		}
+		c.Logger.Info("Starting local registry container %s", name)
+		if err := c.runCmdWithError(c.buildDockerCmd("start", name)); err != nil {
+			return fmt.Errorf("failed to start registry container %s: %w", name, err)
+		}
+		return nil
+	}
+
+	c.Logger.Info("Creating local registry container %s on port %d", name, port)
+	cmd := c.buildDockerCmd(
+		"run", "-d",
+		"--restart=always",
+		"--name", name,
+		"-p", fmt.Sprintf("%d:5000", port),
+		"-e", "REGISTRY_STORAGE_DELETE_ENABLED=true",
+		image,
+	)
+	if err := c.runCmdWithError(cmd); err != nil {
+		return fmt.Errorf("failed to create registry container %s: %w", name, err)
+	}
+
+	c.Logger.Success("Local registry running: %s", name)
+	return nil
+}
+
+// ExecInContainer runs a command in a running container and returns its output
+func (c *Client) ExecInContainer(name string, command ...string) (string, error) {
+	if c.DryRun {
+		c.Logger.DryRun("Would run in %s: %s", name, strings.Join(command, " "))
+		return "", nil
+	}
+
+	args := append([]string{"exec", name}, command...)
+	output, err := c.buildDockerCmd(args...).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("exec in %s failed: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
@@ -0,0 +1,40 @@
+package docker
+
+import (
+	"os/exec"
+
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/containerd"
+)
+
+// localRuntime returns the container runtime of this host, detected on first
+// use when Runtime is auto
+func (c *Client) localRuntime() (*containerd.Runtime, error) {
+	if c.runtime != nil {
+		return c.runtime, nil
+	}
+
+	kind := c.Runtime
+	if kind == "" {
+		kind = containerd.RuntimeAuto
+	}
+	runtime, err := containerd.Resolve(kind, c.RuntimeSocket, constants.ContainerdNamespace, func() (string, error) {
+		output, err := exec.Command("sh", "-c", containerd.DetectScript).Output()
+		return string(output), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.Logger.Debug("Local container runtime: %s", runtime)
+	c.runtime = runtime
+	return runtime, nil
+}
+
+// runtimeCmd builds a runtime command with optional sudo
+func (c *Client) runtimeCmd(args []string) *exec.Cmd {
+	if c.UseSudo {
+		return exec.Command("sudo", args...)
+	}
+	return exec.Command(args[0], args[1:]...)
+}
@@ -0,0 +1,191 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Error classes recorded for failed workers
+const (
+	ClassUnreachable = "unreachable"
+	ClassAuth        = "auth"
+	ClassDisk        = "disk"
+	ClassSudo        = "sudo"
+	ClassImport      = "import"
+	ClassVerify      = "verify"
+	ClassOther       = "other"
+)
+
+// Record is the health of one worker across runs
+type Record struct {
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	TotalFailures       int       `json:"totalFailures"`
+	LastFailure         time.Time `json:"lastFailure,omitempty"`
+	LastError           string    `json:"lastError,omitempty"`
+	ErrorClass          string    `json:"errorClass,omitempty"`
+	LastSuccess         time.Time `json:"lastSuccess,omitempty"`
+	Quarantined         bool      `json:"quarantined"`
+	QuarantinedAt       time.Time `json:"quarantinedAt,omitempty"`
+	Cordoned            bool      `json:"cordoned"` // Cordoned by m2deploy when quarantined
+}
+
+// Store persists worker health in a JSON file
+type Store struct {
+	Workers map[string]*Record `json:"workers"`
+
+	path      string
+	threshold int // Consecutive failed runs before quarantine (0 = never)
+}
+
+// Load reads the store at path; a missing file gives an empty store
+func Load(path string, threshold int) (*Store, error) {
+	store := &Store{Workers: make(map[string]*Record), path: path, threshold: threshold}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worker health: %w", err)
+	}
+
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("invalid worker health file %s: %w", path, err)
+	}
+	if store.Workers == nil {
+		store.Workers = make(map[string]*Record)
+	}
+	return store, nil
+}
+
+// Save writes the store atomically
+func (s *Store) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create worker health directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode worker health: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write worker health: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write worker health: %w", err)
+	}
+	return nil
+}
+
+// Path returns the file the store is saved to
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns the record of worker, or nil if it never failed or succeeded
+func (s *Store) Get(worker string) *Record {
+	return s.Workers[worker]
+}
+
+// Names returns the recorded workers in alphabetical order
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.Workers))
+	for name := range s.Workers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsQuarantined reports whether worker is quarantined
+func (s *Store) IsQuarantined(worker string) bool {
+	record := s.Workers[worker]
+	return record != nil && record.Quarantined
+}
+
+// RecordFailure records a failed run for worker. Returns true if the worker
+// was quarantined by this failure.
+func (s *Store) RecordFailure(worker string, err error, now time.Time) bool {
+	record := s.record(worker)
+	record.ConsecutiveFailures++
+	record.TotalFailures++
+	record.LastFailure = now
+	record.LastError = err.Error()
+	record.ErrorClass = Classify(err)
+
+	if !record.Quarantined && s.threshold > 0 && record.ConsecutiveFailures >= s.threshold {
+		record.Quarantined = true
+		record.QuarantinedAt = now
+		return true
+	}
+	return false
+}
+
+// RecordSuccess records a successful run for worker
+func (s *Store) RecordSuccess(worker string, now time.Time) {
+	record := s.record(worker)
+	record.ConsecutiveFailures = 0
+	record.LastSuccess = now
+}
+
+// Release lifts the quarantine of worker and resets its failure count.
+// Returns the previous record, or nil if the worker was not recorded.
+func (s *Store) Release(worker string) *Record {
+	record := s.Workers[worker]
+	if record == nil {
+		return nil
+	}
+	previous := *record
+
+	record.ConsecutiveFailures = 0
+	record.Quarantined = false
+	record.QuarantinedAt = time.Time{}
+	record.Cordoned = false
+	return &previous
+}
+
+func (s *Store) record(worker string) *Record {
+	record := s.Workers[worker]
+	if record == nil {
+		record = &Record{}
+		s.Workers[worker] = record
+	}
+	return record
+}
+
+// Classify assigns an error class to a worker failure from its message
+func Classify(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case containsAny(msg, "unable to authenticate", "permission denied (publickey", "handshake failed", "cannot read ssh key"):
+		return ClassAuth
+	case containsAny(msg, "no space left", "disk full", "free, "):
+		return ClassDisk
+	case containsAny(msg, "password is required", "sudo:", "a terminal is required"):
+		return ClassSudo
+	case containsAny(msg, "connection refused", "no route to host", "i/o timeout", "dial tcp", "connection reset", "timeout", "unreachable"):
+		return ClassUnreachable
+	case containsAny(msg, "stale image", "missing", "verification failed"):
+		return ClassVerify
+	case containsAny(msg, "import"):
+		return ClassImport
+	}
+	return ClassOther
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package health
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQuarantineAfterConsecutiveFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "health.json")
+	store, err := Load(path, 2)
+	if err != nil {
+		t.Fatalf("Load() of missing file error = %v", err)
+	}
+
+	now := time.Now()
+	failure := errors.New("SSH dial failed: dial tcp 10.0.0.3:22: connect: no route to host")
+
+	if store.RecordFailure("worker-3", failure, now) {
+		t.Error("quarantined after the first failure")
+	}
+	store.RecordSuccess("worker-3", now)
+	if store.RecordFailure("worker-3", failure, now) {
+		t.Error("a success should reset the consecutive failure count")
+	}
+	if !store.RecordFailure("worker-3", failure, now) {
+		t.Error("not quarantined after 2 consecutive failures")
+	}
+	if store.RecordFailure("worker-3", failure, now) {
+		t.Error("RecordFailure() reported a new quarantine for a quarantined worker")
+	}
+
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := Load(path, 2)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	record := loaded.Get("worker-3")
+	if record == nil || !record.Quarantined || record.ErrorClass != ClassUnreachable || record.TotalFailures != 4 {
+		t.Fatalf("loaded record = %+v", record)
+	}
+
+	previous := loaded.Release("worker-3")
+	if previous == nil || !previous.Quarantined {
+		t.Errorf("Release() previous = %+v", previous)
+	}
+	if loaded.IsQuarantined("worker-3") || loaded.Get("worker-3").ConsecutiveFailures != 0 {
+		t.Errorf("record after release = %+v", loaded.Get("worker-3"))
+	}
+	if loaded.Release("worker-9") != nil {
+		t.Error("Release() of an unknown worker returned a record")
+	}
+}
+
+func TestQuarantineDisabled(t *testing.T) {
+	store, _ := Load(filepath.Join(t.TempDir(), "health.json"), 0)
+	for i := 0; i < 10; i++ {
+		if store.RecordFailure("worker-1", errors.New("import failed"), time.Now()) {
+			t.Fatal("quarantined with threshold 0")
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := map[string]string{
+		"ssh: handshake failed: ssh: unable to authenticate":     ClassAuth,
+		"import failed: write /tmp/x: no space left on device":   ClassDisk,
+		"sudo: a password is required":                           ClassSudo,
+		"SSH dial failed: dial tcp 10.0.0.3:22: i/o timeout":     ClassUnreachable,
+		"stale image app:v2 (found sha256:1, expected sha256:2)": ClassVerify,
+		"ctr import failed: exit status 1":                       ClassImport,
+		"something else":                                         ClassOther,
+	}
+	for msg, want := range tests {
+		if got := Classify(errors.New(msg)); got != want {
+			t.Errorf("Classify(%q) = %s, want %s", msg, got, want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package inventory
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/wapsol/m2deploy/pkg/containerd"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+)
+
+// Host holds the connection settings of one worker. Empty fields fall back to
+// the inventory defaults and then to the command-line flags.
+type Host struct {
+	Name      string            `yaml:"name"`    // Kubernetes node name
+	Address   string            `yaml:"address"` // SSH address (default: node InternalIP)
+	User      string            `yaml:"user"`
+	Port      int               `yaml:"port"`
+	Key       string            `yaml:"key"`
+	TempDir   string            `yaml:"tempDir"`
+	Namespace string            `yaml:"containerdNamespace"`
+	Runtime   string            `yaml:"runtime"` // k0s, ctr or nerdctl (default: --runtime)
+	Socket    string            `yaml:"containerdSocket"`
+	Sudo      *bool             `yaml:"sudo"` // ctr needs sudo (default: true)
+	Labels    map[string]string `yaml:"labels"`
+}
+
+// Inventory lists the workers and their per-host settings
+type Inventory struct {
+	Defaults Host   `yaml:"defaults"`
+	Workers  []Host `yaml:"workers"`
+}
+
+// Mismatch kinds found when reconciling the inventory with the cluster
+const (
+	MismatchNotInInventory = "not in inventory"
+	MismatchNotInCluster   = "not in cluster"
+	MismatchAddress        = "address differs"
+)
+
+// Mismatch is a difference between the inventory and the cluster's nodes
+type Mismatch struct {
+	Node   string
+	Kind   string
+	Detail string
+}
+
+func (m Mismatch) String() string {
+	if m.Detail == "" {
+		return fmt.Sprintf("%s: %s", m.Node, m.Kind)
+	}
+	return fmt.Sprintf("%s: %s (%s)", m.Node, m.Kind, m.Detail)
+}
+
+// Load reads and validates an inventory file
+func Load(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %w", err)
+	}
+
+	var inv Inventory
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&inv); err != nil {
+		return nil, fmt.Errorf("invalid inventory %s: %w", path, err)
+	}
+
+	if err := inv.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid inventory %s: %w", path, err)
+	}
+	return &inv, nil
+}
+
+// Validate checks that every worker has a unique name
+func (inv *Inventory) Validate() error {
+	seen := make(map[string]bool, len(inv.Workers))
+	for i, host := range inv.Workers {
+		if host.Name == "" {
+			return fmt.Errorf("worker %d has no name", i+1)
+		}
+		if seen[host.Name] {
+			return fmt.Errorf("worker %s listed twice", host.Name)
+		}
+		seen[host.Name] = true
+		if host.Port < 0 || host.Port > 65535 {
+			return fmt.Errorf("worker %s has invalid port %d", host.Name, host.Port)
+		}
+		if host.Runtime != "" {
+			if err := containerd.ValidateRuntime(host.Runtime); err != nil {
+				return fmt.Errorf("worker %s: %w", host.Name, err)
+			}
+		}
+	}
+	if inv.Defaults.Runtime != "" {
+		if err := containerd.ValidateRuntime(inv.Defaults.Runtime); err != nil {
+			return fmt.Errorf("defaults: %w", err)
+		}
+	}
+	return nil
+}
+
+// Resolve applies the inventory defaults to host
+func (inv *Inventory) Resolve(host Host) Host {
+	d := inv.Defaults
+	if host.User == "" {
+		host.User = d.User
+	}
+	if host.Port == 0 {
+		host.Port = d.Port
+	}
+	if host.Key == "" {
+		host.Key = d.Key
+	}
+	if host.TempDir == "" {
+		host.TempDir = d.TempDir
+	}
+	if host.Namespace == "" {
+		host.Namespace = d.Namespace
+	}
+	if host.Runtime == "" {
+		host.Runtime = d.Runtime
+	}
+	if host.Socket == "" {
+		host.Socket = d.Socket
+	}
+	if host.Sudo == nil {
+		host.Sudo = d.Sudo
+	}
+
+	labels := make(map[string]string, len(d.Labels)+len(host.Labels))
+	for k, v := range d.Labels {
+		labels[k] = v
+	}
+	for k, v := range host.Labels {
+		labels[k] = v
+	}
+	host.Labels = labels
+
+	host.Key = expandHome(host.Key)
+	return host
+}
+
+// Reconcile matches the inventory against the cluster's worker nodes. Every
+// node is returned with its resolved settings, in cluster order; nodes missing
+// from the inventory use the defaults. Inventory workers that are not in the
+// cluster are left out. All differences are reported as mismatches.
+func Reconcile(inv *Inventory, nodes []k8s.NodeInfo) ([]Host, []Mismatch) {
+	byName := make(map[string]Host, len(inv.Workers))
+	for _, host := range inv.Workers {
+		byName[host.Name] = host
+	}
+
+	var hosts []Host
+	var mismatches []Mismatch
+	inCluster := make(map[string]bool, len(nodes))
+
+	for _, node := range nodes {
+		inCluster[node.Name] = true
+
+		host, ok := byName[node.Name]
+		if !ok {
+			mismatches = append(mismatches, Mismatch{Node: node.Name, Kind: MismatchNotInInventory, Detail: "using defaults"})
+			host = Host{Name: node.Name}
+		}
+
+		host = inv.Resolve(host)
+		if host.Address == "" {
+			host.Address = node.IP
+		} else if node.IP != "" && host.Address != node.IP {
+			mismatches = append(mismatches, Mismatch{
+				Node:   node.Name,
+				Kind:   MismatchAddress,
+				Detail: fmt.Sprintf("inventory %s, cluster %s", host.Address, node.IP),
+			})
+		}
+		hosts = append(hosts, host)
+	}
+
+	for _, host := range inv.Workers {
+		if !inCluster[host.Name] {
+			mismatches = append(mismatches, Mismatch{Node: host.Name, Kind: MismatchNotInCluster, Detail: "skipped"})
+		}
+	}
+
+	return hosts, mismatches
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,120 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wapsol/m2deploy/pkg/k8s"
+)
+
+const testInventory = `defaults:
+  user: deploy
+  port: 2222
+  sudo: true
+  labels:
+    site: eu
+workers:
+  - name: worker-a
+    address: 192.168.1.11
+    tempDir: /data/tmp
+    labels:
+      gpu: "true"
+  - name: worker-b
+    user: root
+    sudo: false
+    containerdNamespace: custom
+  - name: worker-old
+`
+
+func writeInventory(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "inventory.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	inv, err := Load(writeInventory(t, testInventory))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(inv.Workers) != 3 || inv.Defaults.User != "deploy" {
+		t.Errorf("Load() = %+v", inv)
+	}
+
+	for name, content := range map[string]string{
+		"unknown field": "workers:\n  - name: a\n    hostname: x\n",
+		"duplicate":     "workers:\n  - name: a\n  - name: a\n",
+		"missing name":  "workers:\n  - address: 10.0.0.1\n",
+		"bad port":      "workers:\n  - name: a\n    port: 70000\n",
+		"bad runtime":   "workers:\n  - name: a\n    runtime: crio\n",
+	} {
+		if _, err := Load(writeInventory(t, content)); err == nil {
+			t.Errorf("Load() accepted inventory with %s", name)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	inv, err := Load(writeInventory(t, testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := inv.Resolve(inv.Workers[0])
+	if a.User != "deploy" || a.Port != 2222 || a.TempDir != "/data/tmp" || a.Sudo == nil || !*a.Sudo {
+		t.Errorf("Resolve(worker-a) = %+v", a)
+	}
+	if a.Labels["site"] != "eu" || a.Labels["gpu"] != "true" {
+		t.Errorf("Resolve(worker-a) labels = %v, want site and gpu", a.Labels)
+	}
+
+	b := inv.Resolve(inv.Workers[1])
+	if b.User != "root" || b.Namespace != "custom" || *b.Sudo {
+		t.Errorf("Resolve(worker-b) = %+v", b)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	inv, err := Load(writeInventory(t, testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := []k8s.NodeInfo{
+		{Name: "worker-a", IP: "10.0.0.11"},
+		{Name: "worker-b", IP: "10.0.0.12"},
+		{Name: "worker-new", IP: "10.0.0.13"},
+	}
+	hosts, mismatches := Reconcile(inv, nodes)
+
+	if len(hosts) != 3 {
+		t.Fatalf("Reconcile() returned %d hosts, want 3", len(hosts))
+	}
+	if hosts[0].Address != "192.168.1.11" {
+		t.Errorf("worker-a address = %s, want inventory address", hosts[0].Address)
+	}
+	if hosts[1].Address != "10.0.0.12" {
+		t.Errorf("worker-b address = %s, want node IP", hosts[1].Address)
+	}
+	if hosts[2].Name != "worker-new" || hosts[2].User != "deploy" {
+		t.Errorf("worker-new = %+v, want defaults", hosts[2])
+	}
+
+	want := map[string]string{
+		"worker-a":   MismatchAddress,
+		"worker-new": MismatchNotInInventory,
+		"worker-old": MismatchNotInCluster,
+	}
+	if len(mismatches) != len(want) {
+		t.Fatalf("Reconcile() mismatches = %v, want %d", mismatches, len(want))
+	}
+	for _, m := range mismatches {
+		if want[m.Node] != m.Kind {
+			t.Errorf("mismatch %s, want kind %q", m, want[m.Node])
+		}
+	}
+}
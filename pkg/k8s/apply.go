@@ -0,0 +1,162 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+// FieldManager owns the fields m2deploy sets with server-side apply
+const FieldManager = "m2deploy"
+
+// applyOptions returns the server-side apply options. Conflicts are forced:
+// m2deploy owns the manifests it applies, including fields last set by
+// 'kubectl apply' before m2deploy talked to the API directly.
+func applyOptions(dryRun bool) metav1.ApplyOptions {
+	opts := metav1.ApplyOptions{FieldManager: FieldManager, Force: true}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	return opts
+}
+
+// decodeManifest decodes a YAML (multi-document) or JSON manifest into
+// objects, expanding Lists and skipping empty documents
+func decodeManifest(data []byte) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+
+	var objects []*unstructured.Unstructured
+	for {
+		var raw runtime.RawExtension
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to decode manifest: %w", err)
+		}
+		raw.Raw = bytes.TrimSpace(raw.Raw)
+		if len(raw.Raw) == 0 || string(raw.Raw) == "null" {
+			continue
+		}
+
+		obj, _, err := unstructured.UnstructuredJSONScheme.Decode(raw.Raw, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode manifest: %w", err)
+		}
+		switch o := obj.(type) {
+		case *unstructured.Unstructured:
+			objects = append(objects, o)
+		case *unstructured.UnstructuredList:
+			for i := range o.Items {
+				objects = append(objects, &o.Items[i])
+			}
+		}
+	}
+	return objects, nil
+}
+
+// describe names an object for messages, e.g. "Deployment/magnetiq-backend"
+func describe(obj *unstructured.Unstructured) string {
+	return obj.GetKind() + "/" + obj.GetName()
+}
+
+// resourceFor returns the dynamic client for obj's resource, defaulting the
+// namespace of namespaced objects to the client's namespace
+func (c *Client) resourceFor(obj *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		// The kind may come from a CRD created since discovery was cached
+		resettable, ok := c.Mapper.(meta.ResettableRESTMapper)
+		if !ok {
+			return nil, fmt.Errorf("unknown resource %s: %w", gvk, err)
+		}
+		resettable.Reset()
+		if mapping, err = c.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			return nil, fmt.Errorf("unknown resource %s: %w", gvk, err)
+		}
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.Dynamic.Resource(mapping.Resource), nil
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(c.Namespace)
+	}
+	return c.Dynamic.Resource(mapping.Resource).Namespace(obj.GetNamespace()), nil
+}
+
+// applyObjects server-side applies objects in order (dryRun = validate only)
+func (c *Client) applyObjects(objects []*unstructured.Unstructured, dryRun bool) error {
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for _, obj := range objects {
+		resource, err := c.resourceFor(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := resource.Apply(ctx, obj.GetName(), obj, applyOptions(dryRun)); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", describe(obj), err)
+		}
+		if !dryRun {
+			c.Logger.Debug("%s applied", describe(obj))
+		}
+	}
+	return nil
+}
+
+// deleteObjects deletes objects in reverse order, ignoring those already gone
+func (c *Client) deleteObjects(objects []*unstructured.Unstructured) error {
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	propagation := metav1.DeletePropagationBackground
+	for i := len(objects) - 1; i >= 0; i-- {
+		obj := objects[i]
+		resource, err := c.resourceFor(obj)
+		if err != nil {
+			return err
+		}
+		err = resource.Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s: %w", describe(obj), err)
+		}
+		c.Logger.Debug("%s deleted", describe(obj))
+	}
+	return nil
+}
+
+// deleteResource deletes a single resource by its resource name (e.g. "daemonset")
+func (c *Client) deleteResource(namespace, resource, name string) error {
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	gvr, err := c.Mapper.ResourceFor(schema.GroupVersionResource{Resource: resource})
+	if err != nil {
+		return fmt.Errorf("unknown resource %s: %w", resource, err)
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	err = c.Dynamic.Resource(gvr).Namespace(namespace).Delete(context.Background(), name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
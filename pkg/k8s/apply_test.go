@@ -0,0 +1,92 @@
+package k8s
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testManifest = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: magnetiq-v2
+---
+# comment-only document
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: magnetiq-config
+data:
+  LOG_LEVEL: info
+`
+
+func TestDecodeManifest(t *testing.T) {
+	objects, err := decodeManifest([]byte(testManifest))
+	if err != nil {
+		t.Fatalf("decodeManifest() error = %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("decodeManifest() returned %d objects, want 2", len(objects))
+	}
+	if describe(objects[0]) != "Namespace/magnetiq-v2" || describe(objects[1]) != "ConfigMap/magnetiq-config" {
+		t.Errorf("objects = %s, %s", describe(objects[0]), describe(objects[1]))
+	}
+
+	if _, err := decodeManifest([]byte("kind: [")); err == nil {
+		t.Error("decodeManifest() expected error for invalid YAML")
+	}
+}
+
+func TestApplyManifestData(t *testing.T) {
+	c := newFakeClient()
+
+	type applied struct {
+		namespace, name string
+	}
+	var patches []applied
+	c.Dynamic.(*dynamicfake.FakeDynamicClient).PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchActionImpl)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			t.Errorf("patch type = %s, want server-side apply", patch.GetPatchType())
+		}
+		patches = append(patches, applied{patch.GetNamespace(), patch.GetName()})
+		return true, &unstructured.Unstructured{Object: map[string]interface{}{}}, nil
+	})
+
+	if err := c.ApplyManifestData(testManifest); err != nil {
+		t.Fatalf("ApplyManifestData() error = %v", err)
+	}
+
+	want := []applied{
+		{"", "magnetiq-v2"},
+		{"magnetiq-v2", "magnetiq-config"},
+	}
+	if len(patches) != len(want) {
+		t.Fatalf("applied %d objects, want %d", len(patches), len(want))
+	}
+	for i := range want {
+		if patches[i] != want[i] {
+			t.Errorf("apply %d = %+v, want %+v", i, patches[i], want[i])
+		}
+	}
+
+	if err := c.ApplyManifestData("apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\n"); err == nil {
+		t.Error("ApplyManifestData() expected error for an unknown kind")
+	}
+}
+
+func TestApplyOptions(t *testing.T) {
+	opts := applyOptions(false)
+	if opts.FieldManager != "m2deploy" || !opts.Force || len(opts.DryRun) != 0 {
+		t.Errorf("applyOptions(false) = %+v", opts)
+	}
+	if opts := applyOptions(true); len(opts.DryRun) != 1 || opts.DryRun[0] != metav1.DryRunAll {
+		t.Errorf("applyOptions(true) = %+v, want a server-side dry-run", opts)
+	}
+}
@@ -1,63 +1,113 @@
 package k8s
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/wapsol/m2deploy/pkg/config"
 	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/kubectl"
+	"github.com/wapsol/m2deploy/pkg/manifest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 )
 
-// Client handles Kubernetes operations
+// Client handles Kubernetes operations through the API server of Kubectl's
+// kubeconfig
 type Client struct {
-	Logger     *config.Logger
-	DryRun     bool
-	Namespace  string
-	Kubeconfig string
-	UseSudo    bool
+	Logger    *config.Logger
+	DryRun    bool
+	Namespace string
+	Kubectl   *kubectl.Executor
+
+	// API clients, connected on first use. Tests set them to fakes.
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+	Mapper    meta.RESTMapper
+	Config    *rest.Config
+	connectMu sync.Mutex
+
+	// ImageOverrides maps image repositories to the references used instead
+	// when manifests are applied (e.g. images pushed to a distribution registry)
+	ImageOverrides map[string]string
 }
 
 // NewClient creates a new Kubernetes client
-func NewClient(logger *config.Logger, dryRun bool, namespace, kubeconfig string, useSudo bool) *Client {
+func NewClient(logger *config.Logger, dryRun bool, namespace string, executor *kubectl.Executor) *Client {
 	return &Client{
-		Logger:     logger,
-		DryRun:     dryRun,
-		Namespace:  namespace,
-		Kubeconfig: kubeconfig,
-		UseSudo:    useSudo,
+		Logger:    logger,
+		DryRun:    dryRun,
+		Namespace: namespace,
+		Kubectl:   executor,
 	}
 }
 
-// buildKubectlCmd builds a kubectl command with proper kubeconfig
-func (c *Client) buildKubectlCmd(args ...string) *exec.Cmd {
-	var allArgs []string
-	if c.Kubeconfig != "" {
-		allArgs = append([]string{"k0s", "kubectl", "--kubeconfig", c.Kubeconfig}, args...)
-	} else {
-		allArgs = append([]string{"k0s", "kubectl"}, args...)
+// connect creates the API clients that are not set yet
+func (c *Client) connect() error {
+	c.connectMu.Lock()
+	defer c.connectMu.Unlock()
+
+	if c.Clientset != nil && c.Dynamic != nil && c.Mapper != nil {
+		return nil
 	}
 
-	if c.UseSudo {
-		return exec.Command("sudo", allArgs...)
+	if c.Config == nil {
+		if c.Kubectl == nil {
+			return fmt.Errorf("no kubeconfig configured")
+		}
+		restConfig, err := c.Kubectl.RESTConfig()
+		if err != nil {
+			return err
+		}
+		c.Config = restConfig
+		c.Logger.Debug("Connecting to Kubernetes API at %s", restConfig.Host)
+	}
+
+	if c.Clientset == nil {
+		clientset, err := kubernetes.NewForConfig(c.Config)
+		if err != nil {
+			return fmt.Errorf("failed to create Kubernetes client: %w", err)
+		}
+		c.Clientset = clientset
 	}
-	return exec.Command(allArgs[0], allArgs[1:]...)
+	if c.Dynamic == nil {
+		dynamicClient, err := dynamic.NewForConfig(c.Config)
+		if err != nil {
+			return fmt.Errorf("failed to create Kubernetes client: %w", err)
+		}
+		c.Dynamic = dynamicClient
+	}
+	if c.Mapper == nil {
+		c.Mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(c.Clientset.Discovery()))
+	}
+	return nil
 }
 
-// ValidateManifest validates a manifest using kubectl dry-run
+// ValidateManifest validates a manifest with a server-side dry-run apply
 func (c *Client) ValidateManifest(manifestPath string) error {
 	c.Logger.Debug("Validating manifest: %s", manifestPath)
 
-	cmd := c.buildKubectlCmd("apply", "--dry-run=client", "-f", manifestPath)
-	output, err := cmd.CombinedOutput()
-
+	objects, err := c.readManifest(manifestPath)
 	if err != nil {
+		return err
+	}
+	if err := c.applyObjects(objects, true); err != nil {
 		c.Logger.Error("Validation failed for %s:", manifestPath)
-		c.Logger.Error(string(output))
+		c.Logger.Error("%v", err)
 		return fmt.Errorf("manifest validation failed: %w", err)
 	}
 
@@ -65,7 +115,7 @@ func (c *Client) ValidateManifest(manifestPath string) error {
 	return nil
 }
 
-// Apply applies Kubernetes manifests
+// Apply applies Kubernetes manifests with server-side apply
 func (c *Client) Apply(manifestPath string) error {
 	c.Logger.Info("Applying manifest: %s", manifestPath)
 
@@ -74,13 +124,11 @@ func (c *Client) Apply(manifestPath string) error {
 		return nil
 	}
 
-	cmd := c.buildKubectlCmd("apply", "-f", manifestPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	c.Logger.Debug("Executing: %s", cmd.String())
-
-	if err := cmd.Run(); err != nil {
+	objects, err := c.readManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if err := c.applyObjects(objects, false); err != nil {
 		return fmt.Errorf("failed to apply manifest %s: %w", manifestPath, err)
 	}
 
@@ -88,6 +136,27 @@ func (c *Client) Apply(manifestPath string) error {
 	return nil
 }
 
+// readManifest reads and decodes a manifest file, rewriting overridden images
+func (c *Client) readManifest(manifestPath string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", manifestPath, err)
+	}
+
+	if len(c.ImageOverrides) > 0 {
+		if rewritten, count := manifest.RewriteImages(data, c.ImageOverrides); count > 0 {
+			c.Logger.Debug("Rewrote %d image references in %s", count, manifestPath)
+			data = rewritten
+		}
+	}
+
+	objects, err := decodeManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", manifestPath, err)
+	}
+	return objects, nil
+}
+
 // Delete deletes Kubernetes resources
 func (c *Client) Delete(manifestPath string) error {
 	c.Logger.Info("Deleting resources from: %s", manifestPath)
@@ -97,11 +166,15 @@ func (c *Client) Delete(manifestPath string) error {
 		return nil
 	}
 
-	cmd := c.buildKubectlCmd("delete", "-f", manifestPath, "--ignore-not-found=true")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest %s: %w", manifestPath, err)
+	}
+	objects, err := decodeManifest(data)
+	if err != nil {
+		return fmt.Errorf("invalid manifest %s: %w", manifestPath, err)
+	}
+	if err := c.deleteObjects(objects); err != nil {
 		return fmt.Errorf("failed to delete resources from %s: %w", manifestPath, err)
 	}
 
@@ -255,156 +328,87 @@ func (c *Client) Undeploy(workDir string, keepNamespace, keepPVCs bool) error {
 	return nil
 }
 
-// SetImage updates the image for a deployment
-func (c *Client) SetImage(deployment, container, image string) error {
-	c.Logger.Info("Updating image for %s/%s to %s", deployment, container, image)
-
-	if c.DryRun {
-		c.Logger.DryRun("Would update image for %s/%s to %s", deployment, container, image)
-		return nil
+// GetPods lists the pods in the namespace as a table
+func (c *Client) GetPods() (string, error) {
+	if err := c.connect(); err != nil {
+		return "", err
 	}
 
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"set", "image",
-		fmt.Sprintf("deployment/%s", deployment),
-		fmt.Sprintf("%s=%s", container, image),
-	)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to update image: %w", err)
+	pods, err := c.Clientset.CoreV1().Pods(c.Namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get pods: %w", err)
 	}
 
-	c.Logger.Success("Image updated for %s/%s", deployment, container)
-	return nil
+	return podTable(pods.Items), nil
 }
 
-// WaitForRollout waits for a deployment rollout to complete
-func (c *Client) WaitForRollout(deployment string, timeout time.Duration) error {
-	c.Logger.Info("Waiting for rollout of %s (timeout: %v)", deployment, timeout)
-
-	if c.DryRun {
-		c.Logger.DryRun("Would wait for rollout of %s", deployment)
-		return nil
+// GetServices lists the services in the namespace as a table
+func (c *Client) GetServices() (string, error) {
+	if err := c.connect(); err != nil {
+		return "", err
 	}
 
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"rollout", "status",
-		fmt.Sprintf("deployment/%s", deployment),
-		fmt.Sprintf("--timeout=%s", timeout.String()),
-	)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("rollout failed or timed out: %w", err)
+	services, err := c.Clientset.CoreV1().Services(c.Namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get services: %w", err)
 	}
 
-	c.Logger.Success("Rollout completed for %s", deployment)
-	return nil
+	return serviceTable(services.Items), nil
 }
 
-// Rollback rolls back a deployment
-func (c *Client) Rollback(deployment string) error {
-	c.Logger.Info("Rolling back deployment: %s", deployment)
-
-	if c.DryRun {
-		c.Logger.DryRun("Would rollback deployment %s", deployment)
-		return nil
-	}
-
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"rollout", "undo",
-		fmt.Sprintf("deployment/%s", deployment),
-	)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to rollback deployment: %w", err)
+// GetIngress lists the ingress resources in the namespace as a table
+func (c *Client) GetIngress() (string, error) {
+	if err := c.connect(); err != nil {
+		return "", err
 	}
 
-	c.Logger.Success("Rolled back deployment: %s", deployment)
-	return nil
-}
-
-// GetPods gets pods in the namespace
-func (c *Client) GetPods() (string, error) {
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"get", "pods",
-		"-o", "wide",
-	)
-
-	output, err := cmd.CombinedOutput()
+	ingresses, err := c.Clientset.NetworkingV1().Ingresses(c.Namespace).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
-		return "", fmt.Errorf("failed to get pods: %w", err)
+		return "", fmt.Errorf("failed to get ingress: %w", err)
 	}
 
-	return string(output), nil
+	return ingressTable(ingresses.Items), nil
 }
 
-// GetServices gets services in the namespace
-func (c *Client) GetServices() (string, error) {
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"get", "services",
-	)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("failed to get services: %w", err)
+// NamespaceExists reports whether namespace exists
+func (c *Client) NamespaceExists(namespace string) (bool, error) {
+	if err := c.connect(); err != nil {
+		return false, err
 	}
 
-	return string(output), nil
-}
-
-// GetIngress gets ingress resources in the namespace
-func (c *Client) GetIngress() (string, error) {
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"get", "ingress",
-	)
-
-	output, err := cmd.CombinedOutput()
+	_, err := c.Clientset.CoreV1().Namespaces().Get(context.Background(), namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to get ingress: %w", err)
+		return false, fmt.Errorf("failed to get namespace %s: %w", namespace, err)
 	}
-
-	return string(output), nil
+	return true, nil
 }
 
 // CheckPodHealth checks if all pods are running and ready
 func (c *Client) CheckPodHealth() error {
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"get", "pods",
-		"-o", "jsonpath={.items[*].status.phase}",
-	)
+	if err := c.connect(); err != nil {
+		return err
+	}
 
-	output, err := cmd.Output()
+	pods, err := c.Clientset.CoreV1().Pods(c.Namespace).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to check pod health: %w", err)
 	}
 
-	phases := strings.Fields(string(output))
-	for _, phase := range phases {
-		if phase != "Running" && phase != "Succeeded" {
-			return fmt.Errorf("found pod in %s state", phase)
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning && pod.Status.Phase != corev1.PodSucceeded {
+			return fmt.Errorf("found pod %s in %s state", pod.Name, pod.Status.Phase)
 		}
 	}
 
 	return nil
 }
 
-// CopySecretToNamespace copies a secret from one namespace to another
+// CopySecretToNamespace copies a secret from one namespace to another. Only
+// the name, labels, annotations, type and data are copied; server-set
+// metadata such as resourceVersion and uid stays behind.
 func (c *Client) CopySecretToNamespace(secretName, fromNamespace, toNamespace string) error {
 	c.Logger.Info("Copying secret %s from %s to %s", secretName, fromNamespace, toNamespace)
 
@@ -413,29 +417,25 @@ func (c *Client) CopySecretToNamespace(secretName, fromNamespace, toNamespace st
 		return nil
 	}
 
-	// Get the secret
-	getCmd := c.buildKubectlCmd(
-		"-n", fromNamespace,
-		"get", "secret", secretName,
-		"-o", "yaml",
-	)
+	if err := c.connect(); err != nil {
+		return err
+	}
 
-	secretYAML, err := getCmd.Output()
+	ctx := context.Background()
+	secret, err := c.Clientset.CoreV1().Secrets(fromNamespace).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to get secret: %w", err)
 	}
 
-	// Modify namespace and remove resourceVersion/uid
-	modifiedYAML := string(secretYAML)
-	modifiedYAML = strings.ReplaceAll(modifiedYAML, fmt.Sprintf("namespace: %s", fromNamespace), fmt.Sprintf("namespace: %s", toNamespace))
+	// Only labels, annotations, type and data are applied; uid,
+	// resourceVersion, owners and timestamps stay with the source
+	secretCopy := applycorev1.Secret(secretName, toNamespace).
+		WithLabels(secret.Labels).
+		WithAnnotations(copiedAnnotations(secret.Annotations)).
+		WithType(secret.Type).
+		WithData(secret.Data)
 
-	// Apply to new namespace
-	applyCmd := c.buildKubectlCmd("apply", "-f", "-")
-	applyCmd.Stdin = strings.NewReader(modifiedYAML)
-	applyCmd.Stdout = os.Stdout
-	applyCmd.Stderr = os.Stderr
-
-	if err := applyCmd.Run(); err != nil {
+	if _, err := c.Clientset.CoreV1().Secrets(toNamespace).Apply(ctx, secretCopy, applyOptions(false)); err != nil {
 		return fmt.Errorf("failed to copy secret: %w", err)
 	}
 
@@ -443,6 +443,51 @@ func (c *Client) CopySecretToNamespace(secretName, fromNamespace, toNamespace st
 	return nil
 }
 
+// CopyConfigMapToNamespace copies a ConfigMap from one namespace to another
+func (c *Client) CopyConfigMapToNamespace(name, fromNamespace, toNamespace string) error {
+	c.Logger.Info("Copying configmap %s from %s to %s", name, fromNamespace, toNamespace)
+
+	if c.DryRun {
+		c.Logger.DryRun("Would copy configmap %s from %s to %s", name, fromNamespace, toNamespace)
+		return nil
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	configMap, err := c.Clientset.CoreV1().ConfigMaps(fromNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get configmap: %w", err)
+	}
+
+	configMapCopy := applycorev1.ConfigMap(name, toNamespace).
+		WithLabels(configMap.Labels).
+		WithAnnotations(copiedAnnotations(configMap.Annotations)).
+		WithData(configMap.Data).
+		WithBinaryData(configMap.BinaryData)
+
+	if _, err := c.Clientset.CoreV1().ConfigMaps(toNamespace).Apply(ctx, configMapCopy, applyOptions(false)); err != nil {
+		return fmt.Errorf("failed to copy configmap: %w", err)
+	}
+
+	c.Logger.Success("Copied configmap %s to namespace %s", name, toNamespace)
+	return nil
+}
+
+// copiedAnnotations returns annotations without the last-applied one, which
+// would carry the source namespace along
+func copiedAnnotations(annotations map[string]string) map[string]string {
+	copied := make(map[string]string)
+	for key, value := range annotations {
+		if key != corev1.LastAppliedConfigAnnotation {
+			copied[key] = value
+		}
+	}
+	return copied
+}
+
 // ScaleDeployment scales a deployment to a specific number of replicas
 func (c *Client) ScaleDeployment(deployment string, replicas int) error {
 	c.Logger.Info("Scaling %s to %d replicas", deployment, replicas)
@@ -452,14 +497,12 @@ func (c *Client) ScaleDeployment(deployment string, replicas int) error {
 		return nil
 	}
 
-	cmd := c.buildKubectlCmd(
-		"-n", c.Namespace,
-		"scale",
-		fmt.Sprintf("deployment/%s", deployment),
-		fmt.Sprintf("--replicas=%d", replicas),
-	)
+	if err := c.connect(); err != nil {
+		return err
+	}
 
-	if err := cmd.Run(); err != nil {
+	patch := fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)
+	if _, err := c.Clientset.AppsV1().Deployments(c.Namespace).Patch(context.Background(), deployment, types.MergePatchType, []byte(patch), metav1.PatchOptions{FieldManager: FieldManager}); err != nil {
 		return fmt.Errorf("failed to scale deployment: %w", err)
 	}
 
@@ -469,68 +512,14 @@ func (c *Client) ScaleDeployment(deployment string, replicas int) error {
 
 // GetWorkerIPs returns the internal IPs of all worker nodes in the cluster
 func (c *Client) GetWorkerIPs() ([]string, error) {
-	c.Logger.Debug("Querying k8s API for worker node IPs")
-
-	// Get nodes in JSON format
-	cmd := c.buildKubectlCmd("get", "nodes", "-o", "json")
-	output, err := cmd.CombinedOutput()
+	workers, err := c.WorkerNodes()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get nodes: %w: %s", err, string(output))
-	}
-
-	// Parse JSON response
-	var nodeList struct {
-		Items []struct {
-			Metadata struct {
-				Name   string            `json:"name"`
-				Labels map[string]string `json:"labels"`
-			} `json:"metadata"`
-			Status struct {
-				Addresses []struct {
-					Type    string `json:"type"`
-					Address string `json:"address"`
-				} `json:"addresses"`
-			} `json:"status"`
-		} `json:"items"`
-	}
-
-	if err := json.Unmarshal(output, &nodeList); err != nil {
-		return nil, fmt.Errorf("failed to parse node list JSON: %w", err)
-	}
-
-	var workerIPs []string
-
-	// Extract IPs from worker nodes (skip control-plane/master nodes)
-	for _, node := range nodeList.Items {
-		// Check if this is a control-plane/master node
-		isControlPlane := false
-		for label := range node.Metadata.Labels {
-			if strings.Contains(label, "control-plane") || strings.Contains(label, "master") {
-				isControlPlane = true
-				break
-			}
-		}
-
-		// Skip control-plane nodes
-		if isControlPlane {
-			c.Logger.Debug("Skipping control-plane node: %s", node.Metadata.Name)
-			continue
-		}
-
-		// Extract internal IP
-		for _, addr := range node.Status.Addresses {
-			if addr.Type == "InternalIP" {
-				workerIPs = append(workerIPs, addr.Address)
-				c.Logger.Debug("Found worker node %s with IP %s", node.Metadata.Name, addr.Address)
-				break
-			}
-		}
+		return nil, err
 	}
 
-	if len(workerIPs) == 0 {
-		return nil, fmt.Errorf("no worker nodes found in cluster")
+	workerIPs := make([]string, 0, len(workers))
+	for _, node := range workers {
+		workerIPs = append(workerIPs, node.IP)
 	}
-
-	c.Logger.Debug("Found %d worker nodes", len(workerIPs))
 	return workerIPs, nil
 }
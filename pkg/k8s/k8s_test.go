@@ -0,0 +1,88 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// newFakeClient returns a client backed by a fake clientset holding objects
+func newFakeClient(objects ...runtime.Object) *Client {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"}, meta.RESTScopeNamespace)
+
+	return &Client{
+		Logger:    config.NewLogger(false),
+		Namespace: "magnetiq-v2",
+		Clientset: fake.NewClientset(objects...),
+		Dynamic:   dynamicfake.NewSimpleDynamicClient(scheme.Scheme),
+		Mapper:    mapper,
+	}
+}
+
+func TestCopySecretToNamespace(t *testing.T) {
+	c := newFakeClient(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "registry-auth",
+			Namespace:       "magnetiq-v2",
+			UID:             "3f9c6d1e",
+			ResourceVersion: "4711",
+			Labels:          map[string]string{"app": "magnetiq"},
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "deployer", UID: "7a2e"}},
+			Annotations: map[string]string{
+				"owner":                            "ops",
+				corev1.LastAppliedConfigAnnotation: `{"metadata":{"namespace":"magnetiq-v2"}}`,
+			},
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+	})
+
+	if err := c.CopySecretToNamespace("registry-auth", "magnetiq-v2", "debug-123"); err != nil {
+		t.Fatalf("CopySecretToNamespace() error = %v", err)
+	}
+
+	copied, err := c.Clientset.CoreV1().Secrets("debug-123").Get(context.Background(), "registry-auth", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("copied secret not found: %v", err)
+	}
+	if copied.UID == "3f9c6d1e" || copied.ResourceVersion == "4711" {
+		t.Errorf("copied secret kept the source uid or resourceVersion: %s %s", copied.UID, copied.ResourceVersion)
+	}
+	if len(copied.OwnerReferences) != 0 {
+		t.Errorf("copied secret kept the source owners: %v", copied.OwnerReferences)
+	}
+	if copied.Type != corev1.SecretTypeDockerConfigJson || string(copied.Data[corev1.DockerConfigJsonKey]) != `{"auths":{}}` {
+		t.Errorf("copied secret = %+v, want type and data of the source", copied)
+	}
+	if copied.Labels["app"] != "magnetiq" || copied.Annotations["owner"] != "ops" {
+		t.Errorf("copied metadata = %v %v, want source labels and annotations", copied.Labels, copied.Annotations)
+	}
+	if _, ok := copied.Annotations[corev1.LastAppliedConfigAnnotation]; ok {
+		t.Error("copied secret kept the last-applied annotation")
+	}
+}
+
+func TestCheckPodHealth(t *testing.T) {
+	running := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "backend", Namespace: "magnetiq-v2"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+	if err := newFakeClient(running).CheckPodHealth(); err != nil {
+		t.Errorf("CheckPodHealth() = %v, want nil", err)
+	}
+
+	pending := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "magnetiq-v2"}, Status: corev1.PodStatus{Phase: corev1.PodPending}}
+	if err := newFakeClient(running, pending).CheckPodHealth(); err == nil {
+		t.Error("CheckPodHealth() expected error for a pending pod")
+	}
+}
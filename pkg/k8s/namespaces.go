@@ -0,0 +1,135 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+)
+
+// Labels and annotations of namespaces that live for a limited time
+const (
+	EphemeralLabel      = ProvenancePrefix + "ephemeral"  // What created the namespace, e.g. "preview"
+	ExpiresAtAnnotation = ProvenancePrefix + "expires-at" // RFC 3339 time after which gc deletes it
+)
+
+// lifecycleManager owns the lifecycle labels and annotations of namespaces,
+// so applying the manifests' Namespace under FieldManager keeps them
+const lifecycleManager = FieldManager + "-lifecycle"
+
+// NamespaceInfo describes a namespace
+type NamespaceInfo struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	Created     time.Time
+	Terminating bool
+}
+
+// ExpiresAt returns when the namespace expires. ok is false when it has no
+// valid expiry and is kept.
+func (n NamespaceInfo) ExpiresAt() (expires time.Time, ok bool) {
+	expires, err := time.Parse(time.RFC3339, n.Annotations[ExpiresAtAnnotation])
+	return expires, err == nil
+}
+
+// EnsureNamespace creates a namespace if needed and sets labels and annotations on it
+func (c *Client) EnsureNamespace(name string, labels, annotations map[string]string) error {
+	if c.DryRun {
+		c.Logger.DryRun("Would create namespace %s", name)
+		return nil
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	namespace := applycorev1.Namespace(name).WithLabels(labels).WithAnnotations(annotations)
+	opts := metav1.ApplyOptions{FieldManager: lifecycleManager, Force: true}
+	if _, err := c.Clientset.CoreV1().Namespaces().Apply(context.Background(), namespace, opts); err != nil {
+		return fmt.Errorf("failed to create namespace %s: %w", name, err)
+	}
+	return nil
+}
+
+// EphemeralNamespaces returns the namespaces labeled with EphemeralLabel
+func (c *Client) EphemeralNamespaces() ([]NamespaceInfo, error) {
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	list, err := c.Clientset.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{LabelSelector: EphemeralLabel})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	namespaces := make([]NamespaceInfo, 0, len(list.Items))
+	for _, ns := range list.Items {
+		namespaces = append(namespaces, NamespaceInfo{
+			Name:        ns.Name,
+			Labels:      ns.Labels,
+			Annotations: ns.Annotations,
+			Created:     ns.CreationTimestamp.Time,
+			Terminating: ns.Status.Phase == corev1.NamespaceTerminating,
+		})
+	}
+	return namespaces, nil
+}
+
+// DeleteNamespace deletes a namespace with everything in it
+func (c *Client) DeleteNamespace(name string) error {
+	if c.DryRun {
+		c.Logger.DryRun("Would delete namespace %s", name)
+		return nil
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	err := c.Clientset.CoreV1().Namespaces().Delete(context.Background(), name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete namespace %s: %w", name, err)
+	}
+	c.Logger.Success("Deleted namespace %s", name)
+	return nil
+}
+
+// rootCAConfigMap is the ConfigMap Kubernetes creates in every namespace
+const rootCAConfigMap = "kube-root-ca.crt"
+
+// NamespaceConfig returns the names of the ConfigMaps and Secrets in
+// namespace, without those Kubernetes and Helm manage themselves
+func (c *Client) NamespaceConfig(namespace string) (configMaps, secrets []string, err error) {
+	if err := c.connect(); err != nil {
+		return nil, nil, err
+	}
+
+	ctx := context.Background()
+	configMapList, err := c.Clientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list configmaps in %s: %w", namespace, err)
+	}
+	for _, configMap := range configMapList.Items {
+		if configMap.Name != rootCAConfigMap {
+			configMaps = append(configMaps, configMap.Name)
+		}
+	}
+
+	secretList, err := c.Clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list secrets in %s: %w", namespace, err)
+	}
+	for _, secret := range secretList.Items {
+		switch secret.Type {
+		case corev1.SecretTypeServiceAccountToken, "helm.sh/release.v1":
+		default:
+			secrets = append(secrets, secret.Name)
+		}
+	}
+	return configMaps, secrets, nil
+}
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEphemeralNamespaces(t *testing.T) {
+	c := newFakeClient(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "magnetiq-v2"}})
+
+	expires := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := c.EnsureNamespace("magnetiq-v2-feature-x",
+		map[string]string{EphemeralLabel: "preview"},
+		map[string]string{ExpiresAtAnnotation: expires.Format(time.RFC3339)})
+	if err != nil {
+		t.Fatalf("EnsureNamespace() error = %v", err)
+	}
+
+	namespaces, err := c.EphemeralNamespaces()
+	if err != nil {
+		t.Fatalf("EphemeralNamespaces() error = %v", err)
+	}
+	if len(namespaces) != 1 || namespaces[0].Name != "magnetiq-v2-feature-x" {
+		t.Fatalf("EphemeralNamespaces() = %+v, want only the preview", namespaces)
+	}
+	if got, ok := namespaces[0].ExpiresAt(); !ok || !got.Equal(expires) {
+		t.Errorf("ExpiresAt() = %v, %v; want %v", got, ok, expires)
+	}
+
+	if err := c.DeleteNamespace("magnetiq-v2-feature-x"); err != nil {
+		t.Fatalf("DeleteNamespace() error = %v", err)
+	}
+	if _, err := c.Clientset.CoreV1().Namespaces().Get(context.Background(), "magnetiq-v2-feature-x", metav1.GetOptions{}); err == nil {
+		t.Error("namespace still exists after DeleteNamespace()")
+	}
+	if err := c.DeleteNamespace("magnetiq-v2-feature-x"); err != nil {
+		t.Errorf("DeleteNamespace() of a deleted namespace = %v, want nil", err)
+	}
+}
+
+func TestExpiresAtMissing(t *testing.T) {
+	if _, ok := (NamespaceInfo{Annotations: map[string]string{ExpiresAtAnnotation: "soon"}}).ExpiresAt(); ok {
+		t.Error("ExpiresAt() ok for an invalid time")
+	}
+}
+
+func TestCopyNamespaceConfig(t *testing.T) {
+	c := newFakeClient(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "backend-config", Namespace: "magnetiq-v2", UID: "1c2d", ResourceVersion: "815"}, Data: map[string]string{"LOG_LEVEL": "info"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "kube-root-ca.crt", Namespace: "magnetiq-v2"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "backend-secrets", Namespace: "magnetiq-v2"}, Type: corev1.SecretTypeOpaque},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "default-token", Namespace: "magnetiq-v2"}, Type: corev1.SecretTypeServiceAccountToken},
+	)
+
+	configMaps, secrets, err := c.NamespaceConfig("magnetiq-v2")
+	if err != nil {
+		t.Fatalf("NamespaceConfig() error = %v", err)
+	}
+	if len(configMaps) != 1 || configMaps[0] != "backend-config" || len(secrets) != 1 || secrets[0] != "backend-secrets" {
+		t.Fatalf("NamespaceConfig() = %v %v, want only the application's", configMaps, secrets)
+	}
+
+	if err := c.CopyConfigMapToNamespace("backend-config", "magnetiq-v2", "debug-123"); err != nil {
+		t.Fatalf("CopyConfigMapToNamespace() error = %v", err)
+	}
+	copied, err := c.Clientset.CoreV1().ConfigMaps("debug-123").Get(context.Background(), "backend-config", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("copied configmap not found: %v", err)
+	}
+	if copied.Data["LOG_LEVEL"] != "info" {
+		t.Errorf("copied data = %v, want the source's", copied.Data)
+	}
+	if copied.UID == "1c2d" || copied.ResourceVersion == "815" {
+		t.Errorf("copied configmap kept the source uid or resourceVersion: %s %s", copied.UID, copied.ResourceVersion)
+	}
+}
@@ -0,0 +1,123 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// NodeInfo describes a cluster node
+type NodeInfo struct {
+	Name         string
+	IP           string // InternalIP
+	Labels       map[string]string
+	Taints       []Taint
+	ControlPlane bool
+}
+
+// Nodes returns all nodes of the cluster
+func (c *Client) Nodes() ([]NodeInfo, error) {
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	nodeList, err := c.Clientset.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	nodes := make([]NodeInfo, 0, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		nodes = append(nodes, nodeInfo(node))
+	}
+	return nodes, nil
+}
+
+// WorkerNodes returns the nodes that run workloads: every node except tainted
+// control-plane nodes. An untainted controller, such as a single-node k0s
+// controller+worker, is included.
+func (c *Client) WorkerNodes() ([]NodeInfo, error) {
+	c.Logger.Debug("Querying k8s API for worker nodes")
+
+	nodes, err := c.Nodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var workers []NodeInfo
+	for _, node := range nodes {
+		if !node.AcceptsWorkloads() {
+			c.Logger.Debug("Skipping tainted control-plane node: %s", node.Name)
+			continue
+		}
+		if node.IP == "" {
+			c.Logger.Debug("Skipping node without InternalIP: %s", node.Name)
+			continue
+		}
+		c.Logger.Debug("Found worker node %s with IP %s", node.Name, node.IP)
+		workers = append(workers, node)
+	}
+
+	if len(workers) == 0 {
+		return nil, fmt.Errorf("no worker nodes found in cluster")
+	}
+
+	c.Logger.Debug("Found %d worker nodes", len(workers))
+	return workers, nil
+}
+
+// nodeInfo summarizes a node
+func nodeInfo(node corev1.Node) NodeInfo {
+	info := NodeInfo{
+		Name:   node.Name,
+		Labels: node.Labels,
+	}
+	for _, taint := range node.Spec.Taints {
+		info.Taints = append(info.Taints, Taint{Key: taint.Key, Value: taint.Value, Effect: string(taint.Effect)})
+	}
+	for label := range node.Labels {
+		if strings.Contains(label, "control-plane") || strings.Contains(label, "master") {
+			info.ControlPlane = true
+			break
+		}
+	}
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP {
+			info.IP = addr.Address
+			break
+		}
+	}
+	return info
+}
+
+// Cordon marks a node unschedulable
+func (c *Client) Cordon(node string) error {
+	return c.setUnschedulable("cordon", node, true)
+}
+
+// Uncordon marks a node schedulable again
+func (c *Client) Uncordon(node string) error {
+	return c.setUnschedulable("uncordon", node, false)
+}
+
+// setUnschedulable patches spec.unschedulable of a node, like 'kubectl cordon|uncordon'
+func (c *Client) setUnschedulable(action, node string, unschedulable bool) error {
+	if c.DryRun {
+		c.Logger.DryRun("Would %s node %s", action, node)
+		return nil
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	if _, err := c.Clientset.CoreV1().Nodes().Patch(context.Background(), node, types.MergePatchType, []byte(patch), metav1.PatchOptions{FieldManager: FieldManager}); err != nil {
+		return fmt.Errorf("failed to %s node %s: %w", action, node, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWorkerNodes(t *testing.T) {
+	c := newFakeClient(
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "controller", Labels: map[string]string{"node-role.kubernetes.io/control-plane": "true"}},
+			Spec:       corev1.NodeSpec{Taints: []corev1.Taint{{Key: "node-role.kubernetes.io/control-plane", Effect: corev1.TaintEffectNoSchedule}}},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.10"}}},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker-a", Labels: map[string]string{"zone": "eu-1"}},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "worker-a"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.11"},
+			}},
+		},
+	)
+
+	nodes, err := c.Nodes()
+	if err != nil {
+		t.Fatalf("Nodes() error = %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("Nodes() returned %d nodes, want 2", len(nodes))
+	}
+
+	workers, err := c.WorkerNodes()
+	if err != nil {
+		t.Fatalf("WorkerNodes() error = %v", err)
+	}
+	if len(workers) != 1 {
+		t.Fatalf("WorkerNodes() returned %d nodes, want 1", len(workers))
+	}
+	worker := workers[0]
+	if worker.Name != "worker-a" || worker.IP != "10.0.0.11" || worker.ControlPlane || worker.Labels["zone"] != "eu-1" {
+		t.Errorf("worker = %+v, want worker-a with IP 10.0.0.11", worker)
+	}
+}
+
+func TestCordon(t *testing.T) {
+	c := newFakeClient(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-a"}})
+
+	if err := c.Cordon("worker-a"); err != nil {
+		t.Fatalf("Cordon() error = %v", err)
+	}
+	node, _ := c.Clientset.CoreV1().Nodes().Get(context.Background(), "worker-a", metav1.GetOptions{})
+	if !node.Spec.Unschedulable {
+		t.Error("node is schedulable after Cordon()")
+	}
+
+	if err := c.Uncordon("worker-a"); err != nil {
+		t.Fatalf("Uncordon() error = %v", err)
+	}
+	node, _ = c.Clientset.CoreV1().Nodes().Get(context.Background(), "worker-a", metav1.GetOptions{})
+	if node.Spec.Unschedulable {
+		t.Error("node is unschedulable after Uncordon()")
+	}
+}
@@ -0,0 +1,203 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// PodInfo describes a pod and the node it runs on
+type PodInfo struct {
+	Name     string
+	NodeName string
+	HostIP   string
+	Phase    string
+	Ready    bool
+	Images   []string // Container images from the pod spec
+}
+
+// ApplyManifestData server-side applies a manifest passed as YAML or JSON
+func (c *Client) ApplyManifestData(manifest string) error {
+	if c.DryRun {
+		c.Logger.DryRun("Would apply generated manifest")
+		return nil
+	}
+
+	objects, err := decodeManifest([]byte(manifest))
+	if err != nil {
+		return fmt.Errorf("failed to apply manifest: %w", err)
+	}
+	if err := c.applyObjects(objects, false); err != nil {
+		return fmt.Errorf("failed to apply manifest: %w", err)
+	}
+	return nil
+}
+
+// DeleteResource deletes a single resource (e.g. "daemonset", "m2deploy-loader") from namespace
+func (c *Client) DeleteResource(namespace, kind, name string) error {
+	if c.DryRun {
+		c.Logger.DryRun("Would delete %s/%s in %s", kind, name, namespace)
+		return nil
+	}
+
+	if err := c.deleteResource(namespace, kind, name); err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", kind, name, err)
+	}
+	return nil
+}
+
+// ListPods returns the pods in namespace matching a label selector ("" = all pods)
+func (c *Client) ListPods(namespace, selector string) ([]PodInfo, error) {
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	podList, err := c.Clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	pods := make([]PodInfo, 0, len(podList.Items))
+	for _, pod := range podList.Items {
+		pods = append(pods, podInfo(pod))
+	}
+	return pods, nil
+}
+
+// podInfo summarizes a pod
+func podInfo(pod corev1.Pod) PodInfo {
+	info := PodInfo{
+		Name:     pod.Name,
+		NodeName: pod.Spec.NodeName,
+		HostIP:   pod.Status.HostIP,
+		Phase:    string(pod.Status.Phase),
+	}
+	for _, container := range pod.Spec.Containers {
+		info.Images = append(info.Images, container.Image)
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+			info.Ready = true
+		}
+	}
+	return info
+}
+
+// ExecInPod runs a command in a pod, streaming stdin to it if provided, and
+// returns its stdout
+func (c *Client) ExecInPod(namespace, pod string, stdin io.Reader, command ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	if err := c.StreamInPod(namespace, pod, stdin, &stdout, &stderr, command...); err != nil {
+		return stdout.String(), fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// StreamInPod runs a command in a pod's first container, connecting its
+// stdin (optional), stdout and stderr
+func (c *Client) StreamInPod(namespace, pod string, stdin io.Reader, stdout, stderr io.Writer, command ...string) error {
+	if err := c.connect(); err != nil {
+		return err
+	}
+	if c.Config == nil {
+		return fmt.Errorf("exec in %s needs an API server connection", pod)
+	}
+
+	req := c.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Command: command,
+			Stdin:   stdin != nil,
+			Stdout:  true,
+			Stderr:  true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(c.Config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("exec in %s failed: %w", pod, err)
+	}
+
+	err = executor.StreamWithContext(context.Background(), remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		return fmt.Errorf("exec in %s failed: %w", pod, err)
+	}
+	return nil
+}
+
+// NodeImages returns the image names each node reports in its status, keyed by node name
+func (c *Client) NodeImages() (map[string][]string, error) {
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	nodes, err := c.Clientset.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	images := make(map[string][]string, len(nodes.Items))
+	for _, node := range nodes.Items {
+		for _, image := range node.Status.Images {
+			images[node.Name] = append(images[node.Name], image.Names...)
+		}
+	}
+	return images, nil
+}
+
+// ReplicaSetImages returns the container images of every ReplicaSet in namespace,
+// i.e. the images of the current and previous releases kept for rollback
+func (c *Client) ReplicaSetImages(namespace string) ([]string, error) {
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	replicaSets, err := c.Clientset.AppsV1().ReplicaSets(namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replicasets: %w", err)
+	}
+
+	var images []string
+	for _, rs := range replicaSets.Items {
+		for _, container := range rs.Spec.Template.Spec.Containers {
+			images = append(images, container.Image)
+		}
+	}
+	return images, nil
+}
+
+// PodImages returns the container images of all pods in the cluster
+func (c *Client) PodImages() ([]string, error) {
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	pods, err := c.Clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pods: %w", err)
+	}
+
+	var images []string
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			images = append(images, container.Image)
+		}
+		for _, container := range pod.Spec.InitContainers {
+			images = append(images, container.Image)
+		}
+	}
+	return images, nil
+}
@@ -0,0 +1,69 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestListPods(t *testing.T) {
+	c := newFakeClient(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "m2deploy-image-loader-abcde", Namespace: "magnetiq-v2", Labels: map[string]string{"app.kubernetes.io/name": "m2deploy-image-loader"}},
+			Spec:       corev1.PodSpec{NodeName: "worker-1", Containers: []corev1.Container{{Name: "loader", Image: "alpine:3.20"}}},
+			Status: corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				HostIP:     "10.0.0.11",
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "magnetiq-backend-xyz", Namespace: "magnetiq-v2", Labels: map[string]string{"app": "magnetiq-backend"}},
+			Status:     corev1.PodStatus{Phase: corev1.PodPending},
+		},
+	)
+
+	pods, err := c.ListPods("magnetiq-v2", "app.kubernetes.io/name=m2deploy-image-loader")
+	if err != nil {
+		t.Fatalf("ListPods() error = %v", err)
+	}
+	if len(pods) != 1 {
+		t.Fatalf("ListPods() returned %d pods, want 1", len(pods))
+	}
+
+	want := PodInfo{Name: "m2deploy-image-loader-abcde", NodeName: "worker-1", HostIP: "10.0.0.11", Phase: "Running", Ready: true, Images: []string{"alpine:3.20"}}
+	if !reflect.DeepEqual(pods[0], want) {
+		t.Errorf("pods[0] = %+v, want %+v", pods[0], want)
+	}
+
+	all, err := c.ListPods("magnetiq-v2", "")
+	if err != nil || len(all) != 2 {
+		t.Errorf("ListPods() without selector = %d pods, %v; want 2", len(all), err)
+	}
+}
+
+func TestNodeImages(t *testing.T) {
+	c := newFakeClient(
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker-1"},
+			Status: corev1.NodeStatus{Images: []corev1.ContainerImage{
+				{Names: []string{"10.0.0.5:5000/magnetiq/v2/backend@sha256:aaa", "10.0.0.5:5000/magnetiq/v2/backend:abc123"}},
+				{Names: []string{"alpine:3.20"}},
+			}},
+		},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-2"}},
+	)
+
+	images, err := c.NodeImages()
+	if err != nil {
+		t.Fatalf("NodeImages() error = %v", err)
+	}
+	if got := len(images["worker-1"]); got != 3 {
+		t.Errorf("worker-1 has %d image names, want 3", got)
+	}
+	if got := len(images["worker-2"]); got != 0 {
+		t.Errorf("worker-2 has %d image names, want 0", got)
+	}
+}
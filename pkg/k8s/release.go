@@ -0,0 +1,179 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// ProvenancePrefix prefixes the Deployment annotations recording where a
+// release came from. They travel with the release when it is promoted.
+const ProvenancePrefix = "m2deploy.io/"
+
+// Provenance annotations set by promote
+const (
+	PromotedFromAnnotation = ProvenancePrefix + "promoted-from"
+	PromotedAtAnnotation   = ProvenancePrefix + "promoted-at"
+	DigestAnnotationPrefix = ProvenancePrefix + "digest-" // + container name
+)
+
+// Release is what a Deployment runs
+type Release struct {
+	Deployment string
+	Images     map[string]string // Image reference by container
+	Digests    map[string]string // Image digest the ready pods run, by container
+	Provenance map[string]string // ProvenancePrefix annotations
+}
+
+// Containers returns the container names of the release, sorted
+func (r *Release) Containers() []string {
+	names := make([]string, 0, len(r.Images))
+	for name := range r.Images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadRelease returns the images of a Deployment and the digests its ready
+// pods run. A Deployment whose pods run different digests, e.g. mid-rollout,
+// has no single release and is an error.
+func (c *Client) ReadRelease(deployment string) (*Release, error) {
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	d, err := c.Clientset.AppsV1().Deployments(c.Namespace).Get(ctx, deployment, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %s: %w", deployment, err)
+	}
+
+	release := &Release{
+		Deployment: deployment,
+		Images:     make(map[string]string),
+		Digests:    make(map[string]string),
+		Provenance: make(map[string]string),
+	}
+	for _, container := range d.Spec.Template.Spec.Containers {
+		release.Images[container.Name] = container.Image
+	}
+	for key, value := range d.Annotations {
+		if strings.HasPrefix(key, ProvenancePrefix) {
+			release.Provenance[key] = value
+		}
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("deployment %s has an invalid selector: %w", deployment, err)
+	}
+	pods, err := c.Clientset.CoreV1().Pods(c.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of %s: %w", deployment, err)
+	}
+
+	for _, pod := range pods.Items {
+		// Terminating pods of the previous release do not count
+		if pod.DeletionTimestamp != nil || !podInfo(pod).Ready {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if _, ok := release.Images[status.Name]; !ok || status.ImageID == "" {
+				continue
+			}
+			digest := ImageDigest(status.ImageID)
+			if previous, ok := release.Digests[status.Name]; ok && previous != digest {
+				return nil, fmt.Errorf("pods of %s run different %s images (%s, %s), wait for its rollout to finish", deployment, status.Name, previous, digest)
+			}
+			release.Digests[status.Name] = digest
+		}
+	}
+
+	for _, name := range release.Containers() {
+		if release.Digests[name] == "" {
+			return nil, fmt.Errorf("no ready pod of %s reports the digest of %s", deployment, name)
+		}
+	}
+	return release, nil
+}
+
+// ImageDigest returns the digest of a container status image ID, which the
+// runtime reports as "sha256:...", "repo@sha256:..." or
+// "docker-pullable://repo@sha256:..."
+func ImageDigest(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i >= 0 {
+		return imageID[i+1:]
+	}
+	return strings.TrimPrefix(imageID, "docker://")
+}
+
+// SetRelease sets the images of a Deployment's containers and its annotations
+// in one update, so the new pods and the recorded provenance go together.
+// Digest annotations also go on the pod template: a release under the same
+// tag but another digest changes the template and so rolls the Deployment.
+func (c *Client) SetRelease(deployment string, images, annotations map[string]string) error {
+	if c.DryRun {
+		c.Logger.DryRun("Would update %s to %d images", deployment, len(images))
+		return nil
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	deployments := c.Clientset.AppsV1().Deployments(c.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		d, err := deployments.Get(context.Background(), deployment, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if err := setContainerImages(d.Spec.Template.Spec.Containers, images); err != nil {
+			return fmt.Errorf("deployment %s: %w", deployment, err)
+		}
+		if d.Annotations == nil {
+			d.Annotations = make(map[string]string)
+		}
+		for key, value := range annotations {
+			d.Annotations[key] = value
+			if strings.HasPrefix(key, DigestAnnotationPrefix) {
+				if d.Spec.Template.Annotations == nil {
+					d.Spec.Template.Annotations = make(map[string]string)
+				}
+				d.Spec.Template.Annotations[key] = value
+			}
+		}
+
+		_, err = deployments.Update(context.Background(), d, metav1.UpdateOptions{FieldManager: FieldManager})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", deployment, err)
+	}
+
+	c.Logger.Success("Updated %s", deployment)
+	return nil
+}
+
+// setContainerImages sets the image of every container named in images
+func setContainerImages(containers []corev1.Container, images map[string]string) error {
+	for name, image := range images {
+		found := false
+		for i := range containers {
+			if containers[i].Name == name {
+				containers[i].Image = image
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no container %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// backendPod returns a magnetiq-backend pod running imageID
+func backendPod(name, imageID string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "magnetiq-v2", Labels: map[string]string{"app": "magnetiq-backend"}},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "backend", ImageID: imageID}},
+		},
+	}
+}
+
+func TestReadRelease(t *testing.T) {
+	d := deployment("magnetiq/v2/backend:abc123")
+	d.Annotations[ProvenancePrefix+"commit"] = "abc123"
+	c := newFakeClient(d,
+		backendPod("magnetiq-backend-1", "sha256:aaa", true),
+		backendPod("magnetiq-backend-2", "docker-pullable://magnetiq/v2/backend@sha256:aaa", true),
+		backendPod("magnetiq-backend-3", "sha256:old", false), // Not ready: ignored
+	)
+
+	release, err := c.ReadRelease("magnetiq-backend")
+	if err != nil {
+		t.Fatalf("ReadRelease() error = %v", err)
+	}
+	if release.Images["backend"] != "magnetiq/v2/backend:abc123" || release.Digests["backend"] != "sha256:aaa" {
+		t.Errorf("release = %+v", release)
+	}
+	if len(release.Provenance) != 1 || release.Provenance[ProvenancePrefix+"commit"] != "abc123" {
+		t.Errorf("Provenance = %v, want only the commit", release.Provenance)
+	}
+}
+
+func TestReadReleaseMidRollout(t *testing.T) {
+	c := newFakeClient(deployment("magnetiq/v2/backend:abc123"),
+		backendPod("magnetiq-backend-1", "sha256:aaa", true),
+		backendPod("magnetiq-backend-2", "sha256:bbb", true),
+	)
+	if _, err := c.ReadRelease("magnetiq-backend"); err == nil {
+		t.Error("ReadRelease() expected error for pods running different digests")
+	}
+}
+
+func TestSetRelease(t *testing.T) {
+	c := newFakeClient(deployment("magnetiq/v2/backend:old"))
+
+	err := c.SetRelease("magnetiq-backend",
+		map[string]string{"backend": "magnetiq/v2/backend:abc123"},
+		map[string]string{PromotedFromAnnotation: "staging"})
+	if err != nil {
+		t.Fatalf("SetRelease() error = %v", err)
+	}
+
+	d, _ := c.Clientset.AppsV1().Deployments("magnetiq-v2").Get(context.Background(), "magnetiq-backend", metav1.GetOptions{})
+	if image := d.Spec.Template.Spec.Containers[0].Image; image != "magnetiq/v2/backend:abc123" {
+		t.Errorf("image = %s", image)
+	}
+	if d.Annotations[PromotedFromAnnotation] != "staging" || d.Annotations[revisionAnnotation] != "2" {
+		t.Errorf("annotations = %v", d.Annotations)
+	}
+
+	if err := c.SetRelease("magnetiq-backend", map[string]string{"worker": "x"}, nil); err == nil {
+		t.Error("SetRelease() expected error for an unknown container")
+	}
+}
+
+func TestSetReleaseSameTag(t *testing.T) {
+	c := newFakeClient(deployment("magnetiq/v2/backend:latest"))
+	deployments := c.Clientset.AppsV1().Deployments("magnetiq-v2")
+	before, _ := deployments.Get(context.Background(), "magnetiq-backend", metav1.GetOptions{})
+
+	err := c.SetRelease("magnetiq-backend",
+		map[string]string{"backend": "magnetiq/v2/backend:latest"},
+		map[string]string{DigestAnnotationPrefix + "backend": "sha256:bbb"})
+	if err != nil {
+		t.Fatalf("SetRelease() error = %v", err)
+	}
+
+	// Only a changed pod template makes the Deployment roll out new pods
+	after, _ := deployments.Get(context.Background(), "magnetiq-backend", metav1.GetOptions{})
+	if after.Spec.Template.Annotations[DigestAnnotationPrefix+"backend"] != "sha256:bbb" {
+		t.Errorf("template annotations = %v, want the digest", after.Spec.Template.Annotations)
+	}
+	if reflect.DeepEqual(before.Spec.Template, after.Spec.Template) {
+		t.Error("pod template unchanged for a new digest under the same tag")
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	for imageID, want := range map[string]string{
+		"sha256:aaa":                           "sha256:aaa",
+		"docker://sha256:aaa":                  "sha256:aaa",
+		"docker.io/library/nginx@sha256:aaa":   "sha256:aaa",
+		"docker-pullable://nginx@sha256:aaa":   "sha256:aaa",
+		"10.0.0.5:5000/magnetiq/v2@sha256:aaa": "sha256:aaa",
+	} {
+		if got := ImageDigest(imageID); got != want {
+			t.Errorf("ImageDigest(%q) = %s, want %s", imageID, got, want)
+		}
+	}
+}
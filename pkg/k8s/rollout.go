@@ -0,0 +1,276 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/client-go/util/retry"
+)
+
+// revisionAnnotation holds the rollout revision of Deployments and their ReplicaSets
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// SetImage updates the image for a deployment
+func (c *Client) SetImage(deployment, container, image string) error {
+	c.Logger.Info("Updating image for %s/%s to %s", deployment, container, image)
+
+	if c.DryRun {
+		c.Logger.DryRun("Would update image for %s/%s to %s", deployment, container, image)
+		return nil
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	deployments := c.Clientset.AppsV1().Deployments(c.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		d, err := deployments.Get(context.Background(), deployment, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for i := range d.Spec.Template.Spec.Containers {
+			if d.Spec.Template.Spec.Containers[i].Name == container {
+				d.Spec.Template.Spec.Containers[i].Image = image
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("deployment %s has no container %s", deployment, container)
+		}
+
+		_, err = deployments.Update(context.Background(), d, metav1.UpdateOptions{FieldManager: FieldManager})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update image: %w", err)
+	}
+
+	c.Logger.Success("Image updated for %s/%s", deployment, container)
+	return nil
+}
+
+// WaitForRollout watches a deployment until its rollout completes
+func (c *Client) WaitForRollout(deployment string, timeout time.Duration) error {
+	c.Logger.Info("Waiting for rollout of %s (timeout: %v)", deployment, timeout)
+
+	if c.DryRun {
+		c.Logger.DryRun("Would wait for rollout of %s", deployment)
+		return nil
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	deployments := c.Clientset.AppsV1().Deployments(c.Namespace)
+	err := c.watchUntil(deployment, timeout, &appsv1.Deployment{},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return deployments.List(ctx, opts)
+		},
+		func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return deployments.Watch(ctx, opts)
+		},
+		func(obj runtime.Object) (bool, error) {
+			d, ok := obj.(*appsv1.Deployment)
+			if !ok {
+				return false, nil
+			}
+			return c.deploymentComplete(d)
+		})
+	if err != nil {
+		return fmt.Errorf("rollout failed or timed out: %w", err)
+	}
+
+	c.Logger.Success("Rollout completed for %s", deployment)
+	return nil
+}
+
+// deploymentComplete reports whether every replica runs the latest template,
+// the way 'kubectl rollout status' decides it
+func (c *Client) deploymentComplete(d *appsv1.Deployment) (bool, error) {
+	if d.Generation > d.Status.ObservedGeneration {
+		return false, nil
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return false, fmt.Errorf("deployment %s exceeded its progress deadline", d.Name)
+		}
+	}
+
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	switch {
+	case d.Status.UpdatedReplicas < replicas:
+		c.Logger.Debug("%s: %d of %d updated replicas available", d.Name, d.Status.UpdatedReplicas, replicas)
+		return false, nil
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		c.Logger.Debug("%s: %d old replicas pending termination", d.Name, d.Status.Replicas-d.Status.UpdatedReplicas)
+		return false, nil
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		c.Logger.Debug("%s: %d of %d updated replicas available", d.Name, d.Status.AvailableReplicas, d.Status.UpdatedReplicas)
+		return false, nil
+	}
+	return true, nil
+}
+
+// WaitForDaemonSet watches a DaemonSet until it has an up-to-date, available
+// pod on every scheduled node
+func (c *Client) WaitForDaemonSet(namespace, name string, timeout time.Duration) error {
+	if c.DryRun {
+		c.Logger.DryRun("Would wait for daemonset %s", name)
+		return nil
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	daemonSets := c.Clientset.AppsV1().DaemonSets(namespace)
+	err := c.watchUntil(name, timeout, &appsv1.DaemonSet{},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return daemonSets.List(ctx, opts)
+		},
+		func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return daemonSets.Watch(ctx, opts)
+		},
+		func(obj runtime.Object) (bool, error) {
+			ds, ok := obj.(*appsv1.DaemonSet)
+			if !ok {
+				return false, nil
+			}
+			return daemonSetComplete(ds), nil
+		})
+	if err != nil {
+		return fmt.Errorf("daemonset %s not ready: %w", name, err)
+	}
+	return nil
+}
+
+// daemonSetComplete reports whether every scheduled pod is updated and available
+func daemonSetComplete(ds *appsv1.DaemonSet) bool {
+	return ds.Generation <= ds.Status.ObservedGeneration &&
+		ds.Status.UpdatedNumberScheduled >= ds.Status.DesiredNumberScheduled &&
+		ds.Status.NumberAvailable >= ds.Status.DesiredNumberScheduled
+}
+
+// watchUntil watches the object called name until done reports true, done
+// fails, the object is deleted or timeout expires
+func (c *Client) watchUntil(name string, timeout time.Duration, objType runtime.Object,
+	list cache.ListWithContextFunc, watchFunc cache.WatchFuncWithContext, done func(runtime.Object) (bool, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	lw := &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = selector
+			return list(ctx, opts)
+		},
+		WatchFuncWithContext: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector
+			return watchFunc(ctx, opts)
+		},
+	}
+
+	_, err := watchtools.UntilWithSync(ctx, lw, objType, nil, func(event watch.Event) (bool, error) {
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("%s was deleted", name)
+		}
+		return done(event.Object)
+	})
+	return err
+}
+
+// Rollback rolls a deployment back to its previous revision, like
+// 'kubectl rollout undo': the pod template of the newest older ReplicaSet
+// becomes the deployment's template again
+func (c *Client) Rollback(deployment string) error {
+	c.Logger.Info("Rolling back deployment: %s", deployment)
+
+	if c.DryRun {
+		c.Logger.DryRun("Would rollback deployment %s", deployment)
+		return nil
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	deployments := c.Clientset.AppsV1().Deployments(c.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		d, err := deployments.Get(ctx, deployment, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		previous, err := c.previousReplicaSet(d)
+		if err != nil {
+			return err
+		}
+
+		template := previous.Spec.Template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		d.Spec.Template = *template
+
+		_, err = deployments.Update(ctx, d, metav1.UpdateOptions{FieldManager: FieldManager})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rollback deployment: %w", err)
+	}
+
+	c.Logger.Success("Rolled back deployment: %s", deployment)
+	return nil
+}
+
+// previousReplicaSet returns the ReplicaSet of d with the highest revision
+// below d's current revision
+func (c *Client) previousReplicaSet(d *appsv1.Deployment) (*appsv1.ReplicaSet, error) {
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector on deployment %s: %w", d.Name, err)
+	}
+
+	replicaSets, err := c.Clientset.AppsV1().ReplicaSets(d.Namespace).List(context.Background(), metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets: %w", err)
+	}
+
+	current, _ := strconv.ParseInt(d.Annotations[revisionAnnotation], 10, 64)
+	var previous *appsv1.ReplicaSet
+	var previousRevision int64
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		if !metav1.IsControlledBy(rs, d) {
+			continue
+		}
+		revision, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+		if err != nil || revision >= current {
+			continue
+		}
+		if previous == nil || revision > previousRevision {
+			previous, previousRevision = rs, revision
+		}
+	}
+
+	if previous == nil {
+		return nil, fmt.Errorf("no previous revision of deployment %s", d.Name)
+	}
+	c.Logger.Debug("Rolling %s back from revision %d to %d", d.Name, current, previousRevision)
+	return previous, nil
+}
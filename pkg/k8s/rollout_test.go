@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deployment returns a magnetiq-backend Deployment with one replica of image
+func deployment(image string) *appsv1.Deployment {
+	replicas := int32(1)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "magnetiq-backend",
+			Namespace:   "magnetiq-v2",
+			UID:         "deploy-uid",
+			Generation:  2,
+			Annotations: map[string]string{revisionAnnotation: "2"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "magnetiq-backend"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "magnetiq-backend"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "backend", Image: image}}},
+			},
+		},
+	}
+}
+
+func TestWaitForRollout(t *testing.T) {
+	d := deployment("magnetiq/v2/backend:new")
+	c := newFakeClient(d)
+
+	// Nothing rolled out yet: the wait times out
+	if err := c.WaitForRollout("magnetiq-backend", 200*time.Millisecond); err == nil {
+		t.Fatal("WaitForRollout() expected timeout error")
+	}
+
+	// The controller finishes the rollout while we watch
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		done := d.DeepCopy()
+		done.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+		c.Clientset.AppsV1().Deployments("magnetiq-v2").UpdateStatus(context.Background(), done, metav1.UpdateOptions{})
+	}()
+	if err := c.WaitForRollout("magnetiq-backend", 5*time.Second); err != nil {
+		t.Errorf("WaitForRollout() = %v, want nil", err)
+	}
+}
+
+func TestDeploymentComplete(t *testing.T) {
+	c := newFakeClient()
+	d := deployment("magnetiq/v2/backend:new")
+
+	d.Status = appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	if done, _ := c.deploymentComplete(d); done {
+		t.Error("complete before the controller observed the new generation")
+	}
+
+	d.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 1}
+	if done, _ := c.deploymentComplete(d); done {
+		t.Error("complete with an old replica still running")
+	}
+
+	d.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"}}
+	if _, err := c.deploymentComplete(d); err == nil {
+		t.Error("expected error once the progress deadline is exceeded")
+	}
+}
+
+func TestSetImageAndRollback(t *testing.T) {
+	d := deployment("magnetiq/v2/backend:new")
+	replicaSet := func(name, revision, image string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "magnetiq-v2",
+				Labels:          map[string]string{"app": "magnetiq-backend"},
+				Annotations:     map[string]string{revisionAnnotation: revision},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(d, appsv1.SchemeGroupVersion.WithKind("Deployment"))},
+			},
+			Spec: appsv1.ReplicaSetSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "magnetiq-backend", appsv1.DefaultDeploymentUniqueLabelKey: name}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "backend", Image: image}}},
+			}},
+		}
+	}
+	c := newFakeClient(d,
+		replicaSet("backend-1", "1", "magnetiq/v2/backend:old"),
+		replicaSet("backend-2", "2", "magnetiq/v2/backend:new"))
+
+	if err := c.SetImage("magnetiq-backend", "frontend", "x"); err == nil {
+		t.Error("SetImage() expected error for an unknown container")
+	}
+
+	if err := c.Rollback("magnetiq-backend"); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	got, _ := c.Clientset.AppsV1().Deployments("magnetiq-v2").Get(context.Background(), "magnetiq-backend", metav1.GetOptions{})
+	if image := got.Spec.Template.Spec.Containers[0].Image; image != "magnetiq/v2/backend:old" {
+		t.Errorf("image after Rollback() = %s, want magnetiq/v2/backend:old", image)
+	}
+	if _, ok := got.Spec.Template.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok {
+		t.Error("Rollback() copied the pod-template-hash label")
+	}
+
+	if err := c.SetImage("magnetiq-backend", "backend", "magnetiq/v2/backend:fix"); err != nil {
+		t.Fatalf("SetImage() error = %v", err)
+	}
+	got, _ = c.Clientset.AppsV1().Deployments("magnetiq-v2").Get(context.Background(), "magnetiq-backend", metav1.GetOptions{})
+	if image := got.Spec.Template.Spec.Containers[0].Image; image != "magnetiq/v2/backend:fix" {
+		t.Errorf("image after SetImage() = %s, want magnetiq/v2/backend:fix", image)
+	}
+}
@@ -0,0 +1,240 @@
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Taint effects that keep pods off a node
+const (
+	TaintNoSchedule = "NoSchedule"
+	TaintNoExecute  = "NoExecute"
+)
+
+// Taint is a node taint
+type Taint struct {
+	Key    string `json:"key" yaml:"key"`
+	Value  string `json:"value" yaml:"value"`
+	Effect string `json:"effect" yaml:"effect"`
+}
+
+// Toleration is a pod toleration
+type Toleration struct {
+	Key      string `yaml:"key"`
+	Operator string `yaml:"operator"` // Equal (default) or Exists
+	Value    string `yaml:"value"`
+	Effect   string `yaml:"effect"` // Empty matches all effects
+}
+
+// Tolerates reports whether the toleration matches the taint
+func (t Toleration) Tolerates(taint Taint) bool {
+	if t.Effect != "" && t.Effect != taint.Effect {
+		return false
+	}
+	if t.Operator == "Exists" {
+		return t.Key == "" || t.Key == taint.Key
+	}
+	return t.Key == taint.Key && t.Value == taint.Value
+}
+
+// Requirement is a label requirement, as in a nodeSelectorTerm's matchExpressions
+type Requirement struct {
+	Key      string   `yaml:"key"`
+	Operator string   `yaml:"operator"` // In, NotIn, Exists, DoesNotExist, Gt, Lt
+	Values   []string `yaml:"values"`
+}
+
+// Matches reports whether labels satisfy the requirement
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case "In":
+		return ok && containsValue(r.Values, value)
+	case "NotIn":
+		return !ok || !containsValue(r.Values, value)
+	case "Exists":
+		return ok
+	case "DoesNotExist":
+		return !ok
+	case "Gt", "Lt":
+		if !ok || len(r.Values) != 1 {
+			return false
+		}
+		have, err1 := strconv.ParseInt(value, 10, 64)
+		want, err2 := strconv.ParseInt(r.Values[0], 10, 64)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		if r.Operator == "Gt" {
+			return have > want
+		}
+		return have < want
+	}
+	return false
+}
+
+// Selector is a set of requirements that must all match
+type Selector []Requirement
+
+// Matches reports whether labels satisfy every requirement; an empty selector matches everything
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSelector parses a label selector in kubectl syntax, e.g.
+// "role=app,zone in (eu-1,eu-2),!gpu". Supported forms are key=value,
+// key==value, key!=value, key, !key, key in (...) and key notin (...).
+func ParseSelector(expr string) (Selector, error) {
+	var selector Selector
+	for _, part := range splitSelector(expr) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		r, err := parseRequirement(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node selector %q: %w", expr, err)
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+// parseRequirement parses one comma-separated element of a selector
+func parseRequirement(part string) (Requirement, error) {
+	if strings.HasPrefix(part, "!") {
+		return Requirement{Key: strings.TrimSpace(part[1:]), Operator: "DoesNotExist"}, nil
+	}
+
+	if key, value, ok := strings.Cut(part, "!="); ok {
+		return Requirement{Key: strings.TrimSpace(key), Operator: "NotIn", Values: []string{strings.TrimSpace(value)}}, nil
+	}
+	if key, value, ok := strings.Cut(part, "="); ok {
+		value = strings.TrimPrefix(value, "=")
+		return Requirement{Key: strings.TrimSpace(key), Operator: "In", Values: []string{strings.TrimSpace(value)}}, nil
+	}
+
+	fields := strings.Fields(part)
+	if len(fields) == 1 {
+		return Requirement{Key: fields[0], Operator: "Exists"}, nil
+	}
+	if len(fields) >= 3 && (fields[1] == "in" || fields[1] == "notin") {
+		list := strings.TrimSpace(strings.Join(fields[2:], " "))
+		if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+			return Requirement{}, fmt.Errorf("%q: values must be in parentheses", part)
+		}
+		var values []string
+		for _, v := range strings.Split(list[1:len(list)-1], ",") {
+			values = append(values, strings.TrimSpace(v))
+		}
+		operator := "In"
+		if fields[1] == "notin" {
+			operator = "NotIn"
+		}
+		return Requirement{Key: fields[0], Operator: operator, Values: values}, nil
+	}
+	return Requirement{}, fmt.Errorf("cannot parse %q", part)
+}
+
+// splitSelector splits a selector at commas outside parentheses
+func splitSelector(expr string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+// Placement describes where a workload's pods may be scheduled
+type Placement struct {
+	Workload     string // e.g. deployment/magnetiq-backend
+	Images       []string
+	NodeSelector map[string]string
+	Affinity     []Selector // Required node affinity terms; any one must match
+	Tolerations  []Toleration
+}
+
+// Allows reports whether the workload can be scheduled on node
+func (p Placement) Allows(node NodeInfo) bool {
+	for key, value := range p.NodeSelector {
+		if node.Labels[key] != value {
+			return false
+		}
+	}
+
+	if len(p.Affinity) > 0 {
+		matched := false
+		for _, term := range p.Affinity {
+			if term.Matches(node.Labels) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, taint := range node.Taints {
+		if !repelsPods(taint) {
+			continue
+		}
+		tolerated := false
+		for _, t := range p.Tolerations {
+			if t.Tolerates(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+// AcceptsWorkloads reports whether ordinary pods can run on the node. Control
+// plane nodes count only when untainted, e.g. a k0s controller+worker.
+func (n NodeInfo) AcceptsWorkloads() bool {
+	if !n.ControlPlane {
+		return true
+	}
+	for _, taint := range n.Taints {
+		if repelsPods(taint) {
+			return false
+		}
+	}
+	return true
+}
+
+// repelsPods reports whether the taint keeps pods without a toleration off the node
+func repelsPods(taint Taint) bool {
+	return taint.Effect == TaintNoSchedule || taint.Effect == TaintNoExecute
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
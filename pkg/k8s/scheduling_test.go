@@ -0,0 +1,149 @@
+package k8s
+
+import "testing"
+
+func TestParseSelector(t *testing.T) {
+	selector, err := ParseSelector("role=app, tier==web,zone in (eu-1, eu-2),env notin (dev),gpu,!spot,arch!=arm64")
+	if err != nil {
+		t.Fatalf("ParseSelector() error = %v", err)
+	}
+	if len(selector) != 7 {
+		t.Fatalf("ParseSelector() returned %d requirements, want 7: %+v", len(selector), selector)
+	}
+
+	labels := map[string]string{"role": "app", "tier": "web", "zone": "eu-2", "env": "prod", "gpu": "", "arch": "amd64"}
+	if !selector.Matches(labels) {
+		t.Errorf("selector should match %v", labels)
+	}
+	labels["spot"] = "true"
+	if selector.Matches(labels) {
+		t.Error("selector should not match a node labelled spot")
+	}
+
+	if _, err := ParseSelector("zone in eu-1"); err == nil {
+		t.Error("ParseSelector() accepted an in-list without parentheses")
+	}
+	if selector, err := ParseSelector(""); err != nil || len(selector) != 0 {
+		t.Errorf("ParseSelector(\"\") = %v, %v, want empty selector", selector, err)
+	}
+}
+
+func TestPlacementAllows(t *testing.T) {
+	placement := Placement{
+		NodeSelector: map[string]string{"pool": "app"},
+		Affinity: []Selector{
+			{{Key: "zone", Operator: "In", Values: []string{"eu-1"}}},
+			{{Key: "cores", Operator: "Gt", Values: []string{"8"}}},
+		},
+		Tolerations: []Toleration{{Key: "dedicated", Operator: "Equal", Value: "app", Effect: TaintNoSchedule}},
+	}
+
+	tests := []struct {
+		name string
+		node NodeInfo
+		want bool
+	}{
+		{"first affinity term", NodeInfo{Labels: map[string]string{"pool": "app", "zone": "eu-1"}}, true},
+		{"second affinity term", NodeInfo{Labels: map[string]string{"pool": "app", "cores": "16"}}, true},
+		{"no affinity term", NodeInfo{Labels: map[string]string{"pool": "app", "zone": "us-1"}}, false},
+		{"node selector", NodeInfo{Labels: map[string]string{"pool": "build", "zone": "eu-1"}}, false},
+		{"tolerated taint", NodeInfo{
+			Labels: map[string]string{"pool": "app", "zone": "eu-1"},
+			Taints: []Taint{{Key: "dedicated", Value: "app", Effect: TaintNoSchedule}},
+		}, true},
+		{"untolerated taint", NodeInfo{
+			Labels: map[string]string{"pool": "app", "zone": "eu-1"},
+			Taints: []Taint{{Key: "gpu", Effect: TaintNoSchedule}},
+		}, false},
+		{"soft taint", NodeInfo{
+			Labels: map[string]string{"pool": "app", "zone": "eu-1"},
+			Taints: []Taint{{Key: "gpu", Effect: "PreferNoSchedule"}},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		if got := placement.Allows(tt.node); got != tt.want {
+			t.Errorf("%s: Allows() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAcceptsWorkloads(t *testing.T) {
+	taint := Taint{Key: "node-role.kubernetes.io/master", Effect: TaintNoSchedule}
+
+	if !(NodeInfo{ControlPlane: true}).AcceptsWorkloads() {
+		t.Error("untainted controller+worker should accept workloads")
+	}
+	if (NodeInfo{ControlPlane: true, Taints: []Taint{taint}}).AcceptsWorkloads() {
+		t.Error("tainted control-plane node should not accept workloads")
+	}
+	if !(NodeInfo{Taints: []Taint{taint}}).AcceptsWorkloads() {
+		t.Error("tainted worker should still count as a worker")
+	}
+}
+
+func TestParseWorkloads(t *testing.T) {
+	data := []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: magnetiq-backend
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: magnetiq-backend
+spec:
+  template:
+    spec:
+      nodeSelector:
+        pool: app
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchExpressions:
+              - key: zone
+                operator: In
+                values: [eu-1]
+      tolerations:
+      - key: dedicated
+        operator: Exists
+      initContainers:
+      - name: migrate
+        image: magnetiq/v2/backend:latest
+      containers:
+      - name: backend
+        image: magnetiq/v2/backend:latest
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - image: alpine:3.20
+`)
+
+	placements, err := parseWorkloads(data)
+	if err != nil {
+		t.Fatalf("parseWorkloads() error = %v", err)
+	}
+	if len(placements) != 2 {
+		t.Fatalf("parseWorkloads() returned %d workloads, want 2", len(placements))
+	}
+
+	backend := placements[0]
+	if backend.Workload != "deployment/magnetiq-backend" || len(backend.Images) != 2 {
+		t.Errorf("backend = %+v", backend)
+	}
+	if backend.NodeSelector["pool"] != "app" || len(backend.Affinity) != 1 || len(backend.Tolerations) != 1 {
+		t.Errorf("backend scheduling = %+v", backend)
+	}
+	if placements[1].Workload != "cronjob/cleanup" || placements[1].Images[0] != "alpine:3.20" {
+		t.Errorf("cronjob = %+v", placements[1])
+	}
+}
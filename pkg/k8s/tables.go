@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// table renders rows as aligned columns, like kubectl's default output
+func table(header string, rows []string) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, header)
+	for _, row := range rows {
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// age formats the time since t, e.g. "5d3h"
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(t.Time))
+}
+
+// orNone returns s, or "<none>" when it is empty
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+// podTable lists pods like 'kubectl get pods -o wide'
+func podTable(pods []corev1.Pod) string {
+	rows := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		ready, restarts := 0, int32(0)
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Ready {
+				ready++
+			}
+			restarts += status.RestartCount
+		}
+		rows = append(rows, fmt.Sprintf("%s\t%d/%d\t%s\t%d\t%s\t%s\t%s",
+			pod.Name, ready, len(pod.Spec.Containers), podStatus(pod), restarts,
+			age(pod.CreationTimestamp), orNone(pod.Status.PodIP), orNone(pod.Spec.NodeName)))
+	}
+	return table("NAME\tREADY\tSTATUS\tRESTARTS\tAGE\tIP\tNODE", rows)
+}
+
+// podStatus returns the pod's phase, or the reason a container is not
+// running (e.g. CrashLoopBackOff) as kubectl shows it
+func podStatus(pod corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return status.State.Waiting.Reason
+		}
+		if status.State.Terminated != nil && status.State.Terminated.Reason != "" && pod.Status.Phase != corev1.PodSucceeded {
+			return status.State.Terminated.Reason
+		}
+	}
+	return string(pod.Status.Phase)
+}
+
+// serviceTable lists services like 'kubectl get services'
+func serviceTable(services []corev1.Service) string {
+	rows := make([]string, 0, len(services))
+	for _, svc := range services {
+		var external []string
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			external = append(external, ingress.IP+ingress.Hostname)
+		}
+		external = append(external, svc.Spec.ExternalIPs...)
+
+		var ports []string
+		for _, port := range svc.Spec.Ports {
+			if port.NodePort != 0 {
+				ports = append(ports, fmt.Sprintf("%d:%d/%s", port.Port, port.NodePort, port.Protocol))
+			} else {
+				ports = append(ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+			}
+		}
+
+		rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s",
+			svc.Name, svc.Spec.Type, orNone(svc.Spec.ClusterIP), orNone(strings.Join(external, ",")),
+			orNone(strings.Join(ports, ",")), age(svc.CreationTimestamp)))
+	}
+	return table("NAME\tTYPE\tCLUSTER-IP\tEXTERNAL-IP\tPORT(S)\tAGE", rows)
+}
+
+// ingressTable lists ingress resources like 'kubectl get ingress'
+func ingressTable(ingresses []networkingv1.Ingress) string {
+	rows := make([]string, 0, len(ingresses))
+	for _, ing := range ingresses {
+		class := ""
+		if ing.Spec.IngressClassName != nil {
+			class = *ing.Spec.IngressClassName
+		}
+
+		var hosts []string
+		for _, rule := range ing.Spec.Rules {
+			if rule.Host != "" {
+				hosts = append(hosts, rule.Host)
+			}
+		}
+		if len(hosts) == 0 {
+			hosts = []string{"*"}
+		}
+
+		var addresses []string
+		for _, lb := range ing.Status.LoadBalancer.Ingress {
+			addresses = append(addresses, lb.IP+lb.Hostname)
+		}
+
+		ports := "80"
+		if len(ing.Spec.TLS) > 0 {
+			ports = "80, 443"
+		}
+
+		rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s",
+			ing.Name, orNone(class), strings.Join(hosts, ","), strings.Join(addresses, ","), ports, age(ing.CreationTimestamp)))
+	}
+	return table("NAME\tCLASS\tHOSTS\tADDRESS\tPORTS\tAGE", rows)
+}
@@ -0,0 +1,128 @@
+package k8s
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// podSpec holds the scheduling fields of a pod template
+type podSpec struct {
+	NodeSelector map[string]string `yaml:"nodeSelector"`
+	Affinity     struct {
+		NodeAffinity struct {
+			Required struct {
+				Terms []struct {
+					MatchExpressions []Requirement `yaml:"matchExpressions"`
+				} `yaml:"nodeSelectorTerms"`
+			} `yaml:"requiredDuringSchedulingIgnoredDuringExecution"`
+		} `yaml:"nodeAffinity"`
+	} `yaml:"affinity"`
+	Tolerations    []Toleration `yaml:"tolerations"`
+	Containers     []container  `yaml:"containers"`
+	InitContainers []container  `yaml:"initContainers"`
+}
+
+type container struct {
+	Image string `yaml:"image"`
+}
+
+type podTemplate struct {
+	Spec podSpec `yaml:"spec"`
+}
+
+// workloadDocument is a manifest document that may carry a pod template
+type workloadDocument struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Template    podTemplate `yaml:"template"`
+		JobTemplate struct {
+			Spec struct {
+				Template podTemplate `yaml:"template"`
+			} `yaml:"spec"`
+		} `yaml:"jobTemplate"`
+	} `yaml:"spec"`
+}
+
+// ReadWorkloads returns the placement of every workload in the manifests under
+// k8sDir (Deployments, StatefulSets, DaemonSets, Jobs and CronJobs)
+func ReadWorkloads(k8sDir string) ([]Placement, error) {
+	var placements []Placement
+
+	err := filepath.WalkDir(k8sDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !(strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")) {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read manifest %s: %w", path, err)
+		}
+		found, err := parseWorkloads(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse manifest %s: %w", path, err)
+		}
+		placements = append(placements, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return placements, nil
+}
+
+// parseWorkloads extracts workload placements from a multi-document manifest
+func parseWorkloads(data []byte) ([]Placement, error) {
+	var placements []Placement
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc workloadDocument
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		var spec podSpec
+		switch doc.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+			spec = doc.Spec.Template.Spec
+		case "CronJob":
+			spec = doc.Spec.JobTemplate.Spec.Template.Spec
+		default:
+			continue
+		}
+
+		placement := Placement{
+			Workload:     strings.ToLower(doc.Kind) + "/" + doc.Metadata.Name,
+			NodeSelector: spec.NodeSelector,
+			Tolerations:  spec.Tolerations,
+		}
+		for _, term := range spec.Affinity.NodeAffinity.Required.Terms {
+			placement.Affinity = append(placement.Affinity, Selector(term.MatchExpressions))
+		}
+		for _, c := range append(spec.InitContainers, spec.Containers...) {
+			if c.Image != "" {
+				placement.Images = append(placement.Images, c.Image)
+			}
+		}
+		placements = append(placements, placement)
+	}
+
+	return placements, nil
+}
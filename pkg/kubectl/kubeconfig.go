@@ -0,0 +1,88 @@
+package kubectl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Admin kubeconfigs written by the distributions
+const (
+	K0sKubeconfig = "/var/lib/k0s/pki/admin.conf"
+	K3sKubeconfig = "/etc/rancher/k3s/k3s.yaml"
+)
+
+// KubeconfigPath returns the kubeconfig the API client reads: --kubeconfig,
+// else the distribution's admin kubeconfig ("" for plain kubectl, which
+// follows $KUBECONFIG and ~/.kube/config)
+func (e *Executor) KubeconfigPath() string {
+	if e.Kubeconfig != "" {
+		return e.Kubeconfig
+	}
+	switch e.Distribution {
+	case DistributionK0s:
+		return K0sKubeconfig
+	case DistributionK3s:
+		return K3sKubeconfig
+	default:
+		return ""
+	}
+}
+
+// RESTConfig loads the API server connection for the kubeconfig and context.
+// The distributions' admin kubeconfigs are only readable by root, so with
+// UseSudo a kubeconfig we may not read is read through sudo; nothing else
+// needs elevated privileges.
+func (e *Executor) RESTConfig() (*rest.Config, error) {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: e.Context}
+
+	path := e.KubeconfigPath()
+	if path == "" {
+		loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), overrides)
+		config, err := loader.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+		}
+		config.UserAgent = "m2deploy"
+		return config, nil
+	}
+
+	data, err := e.readKubeconfig(path)
+	if err != nil {
+		return nil, err
+	}
+	kubeconfig, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig %s: %w", path, err)
+	}
+	config, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, e.Context, overrides, nil).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig %s: %w", path, err)
+	}
+	config.UserAgent = "m2deploy"
+	return config, nil
+}
+
+// readKubeconfig reads path, falling back to 'sudo cat' when permission is denied
+func (e *Executor) readKubeconfig(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		return data, nil
+	case errors.Is(err, fs.ErrPermission) && e.UseSudo:
+		data, err = exec.Command("sudo", "cat", path).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kubeconfig %s with sudo: %w", path, err)
+		}
+		return data, nil
+	case errors.Is(err, fs.ErrPermission):
+		return nil, fmt.Errorf("failed to read kubeconfig %s: %w (run with --use-sudo)", path, err)
+	default:
+		return nil, fmt.Errorf("failed to read kubeconfig %s: %w", path, err)
+	}
+}
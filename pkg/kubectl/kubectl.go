@@ -0,0 +1,101 @@
+package kubectl
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Kubernetes distributions selectable with --kube-distribution
+const (
+	DistributionAuto    = "auto"
+	DistributionK0s     = "k0s"
+	DistributionK3s     = "k3s"
+	DistributionKubectl = "kubectl"
+)
+
+// Distributions lists the supported --kube-distribution values
+var Distributions = []string{DistributionAuto, DistributionK0s, DistributionK3s, DistributionKubectl}
+
+// Executor builds kubectl commands for a Kubernetes distribution: the
+// kubectl embedded in k0s or k3s, or a plain kubectl with a kubeconfig and
+// context. It is shared by every package that shells out to kubectl.
+type Executor struct {
+	Distribution string // DistributionK0s, DistributionK3s or DistributionKubectl
+	Kubeconfig   string // "" = the distribution's default
+	Context      string // "" = the kubeconfig's current context
+	UseSudo      bool
+}
+
+// New creates an executor, detecting the distribution when it is auto
+func New(distribution, kubeconfig, context string, useSudo bool) (*Executor, error) {
+	if err := ValidateDistribution(distribution); err != nil {
+		return nil, err
+	}
+	if distribution == DistributionAuto {
+		distribution = Detect(exec.LookPath)
+	}
+	return &Executor{
+		Distribution: distribution,
+		Kubeconfig:   kubeconfig,
+		Context:      context,
+		UseSudo:      useSudo,
+	}, nil
+}
+
+// ValidateDistribution checks that distribution is a supported --kube-distribution value
+func ValidateDistribution(distribution string) error {
+	for _, d := range Distributions {
+		if d == distribution {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported Kubernetes distribution %q (supported: %v)", distribution, Distributions)
+}
+
+// Detect picks the distribution from the tools installed on this host: k0s,
+// then k3s, falling back to plain kubectl. lookPath is exec.LookPath.
+func Detect(lookPath func(file string) (string, error)) string {
+	for _, distribution := range []string{DistributionK0s, DistributionK3s} {
+		if _, err := lookPath(distribution); err == nil {
+			return distribution
+		}
+	}
+	return DistributionKubectl
+}
+
+// Args returns the full kubectl command line for args, without sudo
+func (e *Executor) Args(args ...string) []string {
+	var cmd []string
+	switch e.Distribution {
+	case DistributionK0s, DistributionK3s:
+		cmd = []string{e.Distribution, "kubectl"}
+	default:
+		cmd = []string{"kubectl"}
+	}
+	if e.Kubeconfig != "" {
+		cmd = append(cmd, "--kubeconfig", e.Kubeconfig)
+	}
+	if e.Context != "" {
+		cmd = append(cmd, "--context", e.Context)
+	}
+	return append(cmd, args...)
+}
+
+// Command builds a kubectl command with optional sudo
+func (e *Executor) Command(args ...string) *exec.Cmd {
+	allArgs := e.Args(args...)
+	if e.UseSudo {
+		return exec.Command("sudo", allArgs...)
+	}
+	return exec.Command(allArgs[0], allArgs[1:]...)
+}
+
+// String returns the command prefix for messages, e.g. "sudo k0s kubectl"
+func (e *Executor) String() string {
+	prefix := strings.Join(e.Args(), " ")
+	if e.UseSudo {
+		return "sudo " + prefix
+	}
+	return prefix
+}
@@ -0,0 +1,87 @@
+package kubectl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		executor Executor
+		want     string
+	}{
+		{
+			name:     "k0s",
+			executor: Executor{Distribution: DistributionK0s},
+			want:     "k0s kubectl get pods",
+		},
+		{
+			name:     "k3s with kubeconfig",
+			executor: Executor{Distribution: DistributionK3s, Kubeconfig: "/etc/rancher/k3s/k3s.yaml"},
+			want:     "k3s kubectl --kubeconfig /etc/rancher/k3s/k3s.yaml get pods",
+		},
+		{
+			name:     "kubectl with kubeconfig and context",
+			executor: Executor{Distribution: DistributionKubectl, Kubeconfig: "/home/ops/.kube/config", Context: "eu-prod"},
+			want:     "kubectl --kubeconfig /home/ops/.kube/config --context eu-prod get pods",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tt.executor.Args("get", "pods"), " "); got != tt.want {
+				t.Errorf("Args = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandSudo(t *testing.T) {
+	e := &Executor{Distribution: DistributionK0s, UseSudo: true}
+	cmd := e.Command("get", "nodes")
+	if got := strings.Join(cmd.Args, " "); got != "sudo k0s kubectl get nodes" {
+		t.Errorf("Command = %q", got)
+	}
+	if got := e.String(); got != "sudo k0s kubectl" {
+		t.Errorf("String = %q", got)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	only := func(installed ...string) func(string) (string, error) {
+		return func(file string) (string, error) {
+			for _, name := range installed {
+				if name == file {
+					return "/usr/local/bin/" + file, nil
+				}
+			}
+			return "", errors.New("not found")
+		}
+	}
+
+	if got := Detect(only("k0s", "k3s", "kubectl")); got != DistributionK0s {
+		t.Errorf("k0s and k3s installed = %s, want k0s", got)
+	}
+	if got := Detect(only("k3s", "kubectl")); got != DistributionK3s {
+		t.Errorf("k3s installed = %s, want k3s", got)
+	}
+	if got := Detect(only()); got != DistributionKubectl {
+		t.Errorf("nothing installed = %s, want kubectl", got)
+	}
+}
+
+func TestValidateDistribution(t *testing.T) {
+	for _, d := range Distributions {
+		if err := ValidateDistribution(d); err != nil {
+			t.Errorf("ValidateDistribution(%q) = %v", d, err)
+		}
+	}
+	if err := ValidateDistribution("microk8s"); err == nil {
+		t.Error("expected unsupported distribution error")
+	}
+	if _, err := New("microk8s", "", "", false); err == nil {
+		t.Error("expected New to reject an unsupported distribution")
+	}
+}
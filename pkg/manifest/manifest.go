@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/registry"
 	"gopkg.in/yaml.v3"
 )
 
@@ -67,3 +70,33 @@ func (c *Client) UpdateNamespace(k8sDir, newNamespace string) error {
 	c.Logger.Success("Updated namespace in manifests")
 	return nil
 }
+
+// imageLinePattern matches a container image field, e.g. "  - image: repo/app:tag"
+var imageLinePattern = regexp.MustCompile(`^(\s*(?:-\s+)?image:\s*)(["']?)([^"'\s#]+)(["']?)(.*)$`)
+
+// RewriteImages replaces container images whose repository is a key of overrides
+// with the mapped reference, regardless of their tag. The rest of the manifest
+// is left untouched. Returns the new manifest and the number of images replaced.
+func RewriteImages(data []byte, overrides map[string]string) ([]byte, int) {
+	if len(overrides) == 0 {
+		return data, 0
+	}
+
+	lines := strings.Split(string(data), "\n")
+	count := 0
+	for i, line := range lines {
+		match := imageLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		repository, _, _ := registry.SplitReference(match[3])
+		replacement, ok := overrides[repository]
+		if !ok || replacement == match[3] {
+			continue
+		}
+		lines[i] = match[1] + match[2] + replacement + match[4] + match[5]
+		count++
+	}
+
+	return []byte(strings.Join(lines, "\n")), count
+}
@@ -0,0 +1,49 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteImages(t *testing.T) {
+	data := []byte(`apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+        - image: busybox:1.36
+      containers:
+        - name: backend
+          image: "crepo.re-cloud.io/magnetiq/v2/backend:latest"
+          imagePullPolicy: IfNotPresent
+        - name: sidecar
+          image: crepo.re-cloud.io/magnetiq/v2/backend:old # pinned by ops
+`)
+	overrides := map[string]string{
+		"crepo.re-cloud.io/magnetiq/v2/backend": "10.0.0.5:5000/magnetiq/v2/backend:abc@sha256:0123",
+	}
+
+	rewritten, count := RewriteImages(data, overrides)
+	if count != 2 {
+		t.Fatalf("RewriteImages() replaced %d images, want 2", count)
+	}
+
+	out := string(rewritten)
+	if !strings.Contains(out, `          image: "10.0.0.5:5000/magnetiq/v2/backend:abc@sha256:0123"`) {
+		t.Errorf("quoted image not rewritten:\n%s", out)
+	}
+	if !strings.Contains(out, `image: 10.0.0.5:5000/magnetiq/v2/backend:abc@sha256:0123 # pinned by ops`) {
+		t.Errorf("image with comment not rewritten:\n%s", out)
+	}
+	if !strings.Contains(out, "- image: busybox:1.36") {
+		t.Errorf("unrelated image changed:\n%s", out)
+	}
+}
+
+func TestRewriteImagesNoOverrides(t *testing.T) {
+	data := []byte("image: app:1\n")
+	if out, count := RewriteImages(data, nil); count != 0 || string(out) != string(data) {
+		t.Errorf("RewriteImages() without overrides = %q, %d", out, count)
+	}
+}
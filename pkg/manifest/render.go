@@ -0,0 +1,212 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// clusterScopedKinds are the cluster-scoped kinds application manifests
+// commonly hold besides Namespace. They are shared by every namespace of the
+// application and left out when rendering for another namespace.
+var clusterScopedKinds = map[string]bool{
+	"PersistentVolume":         true,
+	"StorageClass":             true,
+	"ClusterRole":              true,
+	"ClusterRoleBinding":       true,
+	"CustomResourceDefinition": true,
+	"IngressClass":             true,
+	"PriorityClass":            true,
+	"ClusterIssuer":            true,
+}
+
+// Rendering rewrites the manifests of an environment for another namespace
+type Rendering struct {
+	Namespace string              // Namespace of every object; Namespace objects are renamed to it
+	Hosts     func(string) string // Maps Ingress hosts (nil = unchanged)
+	Images    map[string]string   // Image overrides by repository, see RewriteImages
+	OmitKinds []string            // Kinds left out, e.g. Secrets copied from elsewhere
+
+	// KeepClusterScoped keeps cluster-scoped objects, without a namespace,
+	// for manifests that install a whole environment, e.g. bundles
+	KeepClusterScoped bool
+}
+
+// Object identifies a manifest object
+type Object struct {
+	Kind string
+	Name string
+}
+
+// Render rewrites a (multi-document) YAML manifest and returns it with the
+// objects left out: those of OmitKinds and, unless KeepClusterScoped,
+// cluster-scoped ones
+func (r *Rendering) Render(data []byte) ([]byte, []Object, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+
+	var omitted []Object
+	for {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		root := doc.Content[0]
+
+		object := Object{Kind: scalar(root, "kind"), Name: scalar(mapValue(root, "metadata"), "name")}
+		if r.omits(object.Kind) {
+			omitted = append(omitted, object)
+			continue
+		}
+		r.rewrite(root, object.Kind)
+
+		if err := encoder.Encode(&doc); err != nil {
+			return nil, nil, fmt.Errorf("failed to render %s/%s: %w", object.Kind, object.Name, err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	rendered, _ := RewriteImages(out.Bytes(), r.Images)
+	return rendered, omitted, nil
+}
+
+// RenderDir renders every YAML file under srcDir into the same path under
+// dstDir and copies the other files. It returns the objects left out.
+func (r *Rendering) RenderDir(srcDir, dstDir string) ([]Object, error) {
+	var omitted []Object
+	err := filepath.WalkDir(srcDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dstDir, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			var left []Object
+			if data, left, err = r.Render(data); err != nil {
+				return fmt.Errorf("%s: %w", rel, err)
+			}
+			omitted = append(omitted, left...)
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render manifests: %w", err)
+	}
+	return omitted, nil
+}
+
+// omits reports whether objects of kind are left out
+func (r *Rendering) omits(kind string) bool {
+	if clusterScopedKinds[kind] && !r.KeepClusterScoped {
+		return true
+	}
+	for _, omitted := range r.OmitKinds {
+		if omitted == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// rewrite moves an object into the namespace and maps its Ingress hosts
+func (r *Rendering) rewrite(root *yaml.Node, kind string) {
+	metadata := mapValue(root, "metadata")
+	if r.Namespace != "" && metadata != nil {
+		if kind == "Namespace" {
+			setScalar(metadata, "name", r.Namespace)
+		} else if !clusterScopedKinds[kind] {
+			setScalar(metadata, "namespace", r.Namespace)
+		}
+	}
+
+	if kind != "Ingress" || r.Hosts == nil {
+		return
+	}
+	spec := mapValue(root, "spec")
+	for _, rule := range items(mapValue(spec, "rules")) {
+		if host := mapValue(rule, "host"); host != nil && host.Value != "" {
+			host.Value = r.Hosts(host.Value)
+		}
+	}
+	for _, tls := range items(mapValue(spec, "tls")) {
+		for _, host := range items(mapValue(tls, "hosts")) {
+			host.Value = r.Hosts(host.Value)
+		}
+	}
+}
+
+// mapValue returns the value of key in a mapping node, or nil
+func mapValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// scalar returns the string value of key in a mapping node, or ""
+func scalar(node *yaml.Node, key string) string {
+	if value := mapValue(node, key); value != nil && value.Kind == yaml.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
+
+// setScalar sets key of a mapping node to a string value, adding it if missing
+func setScalar(node *yaml.Node, key, value string) {
+	if existing := mapValue(node, key); existing != nil {
+		existing.Kind, existing.Tag, existing.Value, existing.Style = yaml.ScalarNode, "!!str", value, 0
+		return
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+}
+
+// items returns the elements of a sequence node
+func items(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
+
+// HostPrefixer returns a host mapping that puts prefix in front of every
+// host as a subdomain, e.g. "feature-x" + "app.example.com"
+func HostPrefixer(prefix string) func(string) string {
+	return func(host string) string {
+		return prefix + "." + strings.TrimPrefix(host, "*.")
+	}
+}
@@ -0,0 +1,129 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	data := []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: magnetiq-v2
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: magnetiq-secrets
+  namespace: magnetiq-v2
+---
+apiVersion: v1
+kind: PersistentVolume
+metadata:
+  name: magnetiq-data
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: magnetiq
+  namespace: magnetiq-v2
+spec:
+  tls:
+    - hosts:
+        - magnetiq.example.com
+      secretName: magnetiq-tls
+  rules:
+    - host: magnetiq.example.com # public
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: magnetiq-backend
+spec:
+  template:
+    spec:
+      containers:
+        - name: backend
+          image: crepo.re-cloud.io/magnetiq/v2/backend:latest
+`)
+
+	r := &Rendering{
+		Namespace: "magnetiq-v2-feature-x",
+		Hosts:     HostPrefixer("feature-x"),
+		Images:    map[string]string{"crepo.re-cloud.io/magnetiq/v2/backend": "crepo.re-cloud.io/magnetiq/v2/backend:feature-x-abc1234"},
+		OmitKinds: []string{"Secret"},
+	}
+	rendered, omitted, err := r.Render(data)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	out := string(rendered)
+	for _, want := range []string{
+		"kind: Namespace\nmetadata:\n  name: magnetiq-v2-feature-x",
+		"- feature-x.magnetiq.example.com",
+		"- host: feature-x.magnetiq.example.com # public",
+		"name: magnetiq-backend\n  namespace: magnetiq-v2-feature-x",
+		"image: crepo.re-cloud.io/magnetiq/v2/backend:feature-x-abc1234",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered manifest lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "namespace: magnetiq-v2\n") || strings.Contains(out, "kind: Secret") || strings.Contains(out, "PersistentVolume") {
+		t.Errorf("rendered manifest keeps objects of the base environment:\n%s", out)
+	}
+
+	if len(omitted) != 2 || omitted[0] != (Object{Kind: "Secret", Name: "magnetiq-secrets"}) || omitted[1].Kind != "PersistentVolume" {
+		t.Errorf("omitted = %v, want the secret and the volume", omitted)
+	}
+}
+
+func TestRenderKeepClusterScoped(t *testing.T) {
+	data := []byte("apiVersion: v1\nkind: PersistentVolume\nmetadata:\n  name: magnetiq-data\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: magnetiq-backend\n")
+
+	r := &Rendering{Namespace: "magnetiq-prod", KeepClusterScoped: true}
+	rendered, omitted, err := r.Render(data)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if len(omitted) != 0 {
+		t.Errorf("omitted = %v, want none", omitted)
+	}
+	out := string(rendered)
+	if !strings.Contains(out, "name: magnetiq-data\n---") || !strings.Contains(out, "name: magnetiq-backend\n  namespace: magnetiq-prod") {
+		t.Errorf("rendered manifest:\n%s", out)
+	}
+}
+
+func TestRenderDir(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "backend"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"backend/service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: magnetiq-backend\n  namespace: magnetiq-v2\n",
+		"README.md":            "# manifests\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &Rendering{Namespace: "debug-123"}
+	if _, err := r.RenderDir(src, dst); err != nil {
+		t.Fatalf("RenderDir() error = %v", err)
+	}
+
+	service, _ := os.ReadFile(filepath.Join(dst, "backend/service.yaml"))
+	if !strings.Contains(string(service), "namespace: debug-123") {
+		t.Errorf("service not rendered:\n%s", service)
+	}
+	readme, _ := os.ReadFile(filepath.Join(dst, "README.md"))
+	if string(readme) != files["README.md"] {
+		t.Errorf("README.md = %q, want it copied", readme)
+	}
+}
@@ -0,0 +1,57 @@
+package prereq
+
+import (
+	"fmt"
+
+	"github.com/wapsol/m2deploy/pkg/kubectl"
+)
+
+// checkAPIAccess verifies the API server answers through the API client and
+// whether namespace exists
+func (c *Checker) checkAPIAccess(executor *kubectl.Executor, namespace string) {
+	if _, err := c.K8s.Nodes(); err != nil {
+		message := fmt.Sprintf("Cannot access Kubernetes API: %v\n   %s", err, controlPlaneHint(executor))
+		if path := executor.KubeconfigPath(); path != "" {
+			message += fmt.Sprintf("\n   Kubeconfig: %s", path)
+		}
+
+		c.AddResult(CheckResult{
+			Name:     "Kubernetes API",
+			Status:   "fail",
+			Message:  message,
+			Required: true,
+		})
+		return
+	}
+
+	message := "Kubernetes API access verified"
+	if c.K8s.Config != nil {
+		message += fmt.Sprintf(" (%s)", c.K8s.Config.Host)
+	}
+	c.AddResult(CheckResult{
+		Name:     "Kubernetes API",
+		Status:   "pass",
+		Message:  message,
+		Required: true,
+	})
+
+	if namespace == "" {
+		return
+	}
+	if exists, err := c.K8s.NamespaceExists(namespace); err != nil || !exists {
+		c.AddResult(CheckResult{
+			Name:     "Namespace",
+			Status:   "warning",
+			Message:  fmt.Sprintf("Namespace '%s' does not exist (will be created during deployment)", namespace),
+			Required: false,
+		})
+		return
+	}
+
+	c.AddResult(CheckResult{
+		Name:     "Namespace",
+		Status:   "pass",
+		Message:  fmt.Sprintf("Namespace '%s' exists", namespace),
+		Required: false,
+	})
+}
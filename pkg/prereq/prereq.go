@@ -7,6 +7,8 @@ import (
 	"syscall"
 
 	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/k8s"
+	"github.com/wapsol/m2deploy/pkg/kubectl"
 )
 
 // CheckResult represents the result of a prerequisite check
@@ -21,6 +23,8 @@ type CheckResult struct {
 type Checker struct {
 	Logger  *config.Logger
 	Results []CheckResult
+	Kubectl *kubectl.Executor // Distribution to check (nil = k0s)
+	K8s     *k8s.Client       // API client to check (nil = check through kubectl)
 }
 
 // NewChecker creates a new prerequisite checker
@@ -128,8 +132,29 @@ func stringContains(s, substr string) bool {
 	return false
 }
 
-// CheckK0s verifies k0s is installed and running
+// kubectl returns the executor for the checks, with the check's sudo setting.
+// Without a configured executor the checks go through k0s as before.
+func (c *Checker) kubectl(useSudo bool) *kubectl.Executor {
+	executor := kubectl.Executor{Distribution: kubectl.DistributionK0s}
+	if c.Kubectl != nil {
+		executor = *c.Kubectl
+	}
+	executor.UseSudo = useSudo
+	return &executor
+}
+
+// CheckK0s verifies the Kubernetes distribution is installed: k0s must be
+// running, k3s and plain kubectl must be installed
 func (c *Checker) CheckK0s(useSudo bool) {
+	executor := c.kubectl(useSudo)
+	if executor.Distribution != kubectl.DistributionK0s {
+		// Without the CLI the API check covers k3s and plain kubectl
+		if c.K8s == nil {
+			c.checkKubectlBinary(executor)
+		}
+		return
+	}
+
 	var cmd *exec.Cmd
 	if useSudo {
 		cmd = exec.Command("sudo", "k0s", "status")
@@ -149,7 +174,8 @@ func (c *Checker) CheckK0s(useSudo bool) {
 		} else if contains(errMsg, "command not found") || contains(errMsg, "No such file") {
 			message = "k0s is not installed. k0s is a lightweight Kubernetes distribution required for deployment.\n" +
 				"   Install k0s: https://docs.k0sproject.io/stable/install/\n" +
-				"   Quick install: curl -sSLf https://get.k0s.sh | sudo sh"
+				"   Quick install: curl -sSLf https://get.k0s.sh | sudo sh\n" +
+				"   Or select another distribution: --kube-distribution k3s|kubectl"
 		} else {
 			message = fmt.Sprintf("k0s is not running or not properly configured: %v\n"+
 				"   Check k0s status: sudo k0s status\n"+
@@ -173,15 +199,50 @@ func (c *Checker) CheckK0s(useSudo bool) {
 	})
 }
 
-// CheckK0sKubectl verifies kubectl access through k0s
+// checkKubectlBinary verifies the k3s or kubectl binary is installed. Whether
+// the cluster is reachable is left to CheckK0sKubectl.
+func (c *Checker) checkKubectlBinary(executor *kubectl.Executor) {
+	binary := executor.Args()[0]
+	if _, err := exec.LookPath(binary); err != nil {
+		var message string
+		if executor.Distribution == kubectl.DistributionK3s {
+			message = "k3s is not installed.\n" +
+				"   Install k3s: curl -sfL https://get.k3s.io | sh -\n" +
+				"   Or select another distribution: --kube-distribution k0s|kubectl"
+		} else {
+			message = "kubectl is not installed.\n" +
+				"   Install kubectl: https://kubernetes.io/docs/tasks/tools/\n" +
+				"   Or select another distribution: --kube-distribution k0s|k3s"
+		}
+
+		c.AddResult(CheckResult{
+			Name:     binary,
+			Status:   "fail",
+			Message:  message,
+			Required: true,
+		})
+		return
+	}
+
+	c.AddResult(CheckResult{
+		Name:     binary,
+		Status:   "pass",
+		Message:  fmt.Sprintf("%s is installed", binary),
+		Required: true,
+	})
+}
+
+// CheckK0sKubectl verifies access to the cluster: through the API client when
+// one is set, else through the configured distribution's kubectl
 func (c *Checker) CheckK0sKubectl(useSudo bool, namespace string) {
-	var cmd *exec.Cmd
-	if useSudo {
-		cmd = exec.Command("sudo", "k0s", "kubectl", "get", "nodes")
-	} else {
-		cmd = exec.Command("k0s", "kubectl", "get", "nodes")
+	executor := c.kubectl(useSudo)
+	if c.K8s != nil {
+		c.checkAPIAccess(executor, namespace)
+		return
 	}
 
+	cmd := executor.Command("get", "nodes")
+
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		// Parse error for specific guidance
@@ -192,14 +253,11 @@ func (c *Checker) CheckK0sKubectl(useSudo bool, namespace string) {
 			message = "kubectl permission denied or timeout. Access to the Kubernetes API requires elevated privileges.\n" +
 				"   Run with --use-sudo flag: m2deploy deploy --use-sudo ..."
 		} else if contains(errMsg, "connection refused") || contains(errMsg, "dial") {
-			message = "Cannot connect to Kubernetes API server. The k0s control plane may not be running.\n" +
-				"   Check k0s status: sudo k0s status\n" +
-				"   Ensure k0s controller is started: sudo systemctl status k0s\n" +
-				"   View API server logs: sudo k0s kubectl logs -n kube-system kube-apiserver-*"
+			message = "Cannot connect to Kubernetes API server. " + controlPlaneHint(executor)
 		} else {
 			message = fmt.Sprintf("Cannot access Kubernetes cluster: %v\n"+
-				"   Verify k0s is running and accessible.\n"+
-				"   Test manually: sudo k0s kubectl get nodes", err)
+				"   Verify the cluster is running and accessible.\n"+
+				"   Test manually: %s get nodes", err, executor)
 		}
 
 		c.AddResult(CheckResult{
@@ -214,18 +272,13 @@ func (c *Checker) CheckK0sKubectl(useSudo bool, namespace string) {
 	c.AddResult(CheckResult{
 		Name:     "kubectl",
 		Status:   "pass",
-		Message:  "kubectl access verified",
+		Message:  fmt.Sprintf("kubectl access verified (%s)", executor),
 		Required: true,
 	})
 
 	// Check namespace exists
 	if namespace != "" {
-		var nsCmd *exec.Cmd
-		if useSudo {
-			nsCmd = exec.Command("sudo", "k0s", "kubectl", "get", "namespace", namespace)
-		} else {
-			nsCmd = exec.Command("k0s", "kubectl", "get", "namespace", namespace)
-		}
+		nsCmd := executor.Command("get", "namespace", namespace)
 
 		if err := nsCmd.Run(); err != nil {
 			c.AddResult(CheckResult{
@@ -245,6 +298,25 @@ func (c *Checker) CheckK0sKubectl(useSudo bool, namespace string) {
 	}
 }
 
+// controlPlaneHint returns the troubleshooting steps for an unreachable API server
+func controlPlaneHint(executor *kubectl.Executor) string {
+	switch executor.Distribution {
+	case kubectl.DistributionK0s:
+		return "The k0s control plane may not be running.\n" +
+			"   Check k0s status: sudo k0s status\n" +
+			"   Ensure k0s controller is started: sudo systemctl status k0s\n" +
+			"   View API server logs: sudo k0s kubectl logs -n kube-system kube-apiserver-*"
+	case kubectl.DistributionK3s:
+		return "The k3s server may not be running.\n" +
+			"   Ensure k3s is started: sudo systemctl status k3s\n" +
+			"   View k3s logs: sudo journalctl -u k3s"
+	default:
+		return "Check the kubeconfig and context.\n" +
+			"   Show the current context: kubectl config current-context\n" +
+			"   Select them with --kubeconfig and --kube-context"
+	}
+}
+
 // CheckGit verifies Git is installed
 func (c *Checker) CheckGit() {
 	cmd := exec.Command("git", "--version")
@@ -0,0 +1,46 @@
+package prereq
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wapsol/m2deploy/pkg/ssh"
+)
+
+// CheckWorkers runs the SSH preflight on every worker in parallel and adds one
+// result per worker. requiredBytes is the size of the images to be sent.
+func (c *Checker) CheckWorkers(distributor *ssh.Distributor, workers []*ssh.WorkerNode, requiredBytes int64) {
+	for _, result := range distributor.Preflight(workers) {
+		c.AddResult(workerResult(result, requiredBytes))
+	}
+}
+
+// workerResult converts a worker's preflight into a check result
+func workerResult(result *ssh.PreflightResult, requiredBytes int64) CheckResult {
+	name := fmt.Sprintf("Worker %s (%s)", result.Worker.Name, result.Worker.IP)
+	failures, warnings := result.Problems(requiredBytes)
+
+	switch {
+	case len(failures) > 0:
+		return CheckResult{
+			Name:     name,
+			Status:   "fail",
+			Message:  strings.Join(append(failures, warnings...), "; "),
+			Required: true,
+		}
+	case len(warnings) > 0:
+		return CheckResult{
+			Name:     name,
+			Status:   "warning",
+			Message:  strings.Join(warnings, "; "),
+			Required: false,
+		}
+	}
+
+	return CheckResult{
+		Name:     name,
+		Status:   "pass",
+		Message:  result.Summary(),
+		Required: true,
+	}
+}
@@ -0,0 +1,73 @@
+package preview
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	"github.com/wapsol/m2deploy/pkg/k8s"
+)
+
+// Kind is the k8s.EphemeralLabel value of preview namespaces
+const Kind = "preview"
+
+// Annotations recording what a preview namespace runs
+const (
+	BranchAnnotation = k8s.ProvenancePrefix + "preview-branch"
+	CommitAnnotation = k8s.ProvenancePrefix + "preview-commit"
+	BaseAnnotation   = k8s.ProvenancePrefix + "preview-base" // Namespace the preview was derived from
+)
+
+// Limits of Kubernetes namespace names and of the slug in image tags
+const (
+	maxNamespace = 63
+	maxTagSlug   = 40
+)
+
+// Slug turns a branch name into lowercase letters, digits and dashes,
+// e.g. "feature/Login_Form" into "feature-login-form"
+func Slug(branch string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(branch) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// Namespace returns the namespace of branch's preview, the base namespace
+// with the branch slug appended. Names too long for a namespace are cut and
+// end in a hash of the branch, so they stay distinct.
+func Namespace(base, branch string) string {
+	name := base + "-" + Slug(branch)
+	if len(name) <= maxNamespace {
+		return name
+	}
+	sum := sha1.Sum([]byte(branch))
+	hash := hex.EncodeToString(sum[:])[:6]
+	return strings.TrimSuffix(name[:maxNamespace-len(hash)-1], "-") + "-" + hash
+}
+
+// Tag returns the image tag of branch's preview built from commit
+func Tag(branch, commit string) string {
+	slug := Slug(branch)
+	if len(slug) > maxTagSlug {
+		slug = strings.TrimSuffix(slug[:maxTagSlug], "-")
+	}
+	if commit == "" {
+		return "preview-" + slug
+	}
+	return "preview-" + slug + "-" + commit
+}
+
+// Subdomain returns the label put in front of ingress hosts for the preview
+// in namespace, the part of it after base
+func Subdomain(base, namespace string) string {
+	return strings.TrimPrefix(namespace, base+"-")
+}
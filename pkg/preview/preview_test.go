@@ -0,0 +1,46 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlug(t *testing.T) {
+	for branch, want := range map[string]string{
+		"feature-x":              "feature-x",
+		"feature/Login_Form":     "feature-login-form",
+		"--fix//double--dash--/": "fix-double-dash",
+		"release/1.2":            "release-1-2",
+	} {
+		if got := Slug(branch); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", branch, got, want)
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	if got := Namespace("magnetiq-v2", "feature/x"); got != "magnetiq-v2-feature-x" {
+		t.Errorf("Namespace() = %s", got)
+	}
+
+	long := "feature/" + strings.Repeat("very-long-branch-name-", 4)
+	a, b := Namespace("magnetiq-v2", long+"a"), Namespace("magnetiq-v2", long+"b")
+	if len(a) > 63 || len(b) > 63 {
+		t.Errorf("Namespace() = %s (%d), longer than 63", a, len(a))
+	}
+	if a == b {
+		t.Errorf("Namespace() = %s for two branches", a)
+	}
+	if Subdomain("magnetiq-v2", a) != strings.TrimPrefix(a, "magnetiq-v2-") {
+		t.Errorf("Subdomain() = %s", Subdomain("magnetiq-v2", a))
+	}
+}
+
+func TestTag(t *testing.T) {
+	if got := Tag("feature/X", "abc1234"); got != "preview-feature-x-abc1234" {
+		t.Errorf("Tag() = %s", got)
+	}
+	if got := Tag(strings.Repeat("a", 200), "abc1234"); len(got) > 128 {
+		t.Errorf("Tag() = %s, too long for an image tag", got)
+	}
+}
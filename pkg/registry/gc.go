@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// TagInfo describes a tag stored in the registry
+type TagInfo struct {
+	Repository string // Repository path without the registry host
+	Tag        string
+	Digest     string // Manifest digest the tag points to
+	Created    time.Time
+}
+
+// PlanGC selects the manifests to delete from a registry. Per repository, the
+// keep newest images and any image whose digest is protected (referenced by a
+// release) survive; every other digest is deleted once. Deleting a digest
+// removes all tags pointing to it, so digests shared with a kept tag are kept.
+func PlanGC(tags []TagInfo, protected map[string]bool, keep int) []TagInfo {
+	byRepo := make(map[string][]TagInfo)
+	var repos []string
+	for _, tag := range tags {
+		if _, ok := byRepo[tag.Repository]; !ok {
+			repos = append(repos, tag.Repository)
+		}
+		byRepo[tag.Repository] = append(byRepo[tag.Repository], tag)
+	}
+	sort.Strings(repos)
+
+	var deletions []TagInfo
+	for _, repo := range repos {
+		repoTags := byRepo[repo]
+		sort.SliceStable(repoTags, func(i, j int) bool {
+			return repoTags[i].Created.After(repoTags[j].Created)
+		})
+
+		// Keep counts images, so several tags of one digest use one slot
+		kept := make(map[string]bool)
+		newest := 0
+		for _, tag := range repoTags {
+			if kept[tag.Digest] {
+				continue
+			}
+			if newest < keep {
+				kept[tag.Digest] = true
+				newest++
+			} else if protected[tag.Digest] {
+				kept[tag.Digest] = true
+			}
+		}
+
+		deleted := make(map[string]bool)
+		for _, tag := range repoTags {
+			if kept[tag.Digest] || deleted[tag.Digest] {
+				continue
+			}
+			deleted[tag.Digest] = true
+			deletions = append(deletions, tag)
+		}
+	}
+
+	return deletions
+}
+
+// ListTags returns the tags of the given repositories with their digests and creation times
+func (c *Client) ListTags(repositories []string) ([]TagInfo, error) {
+	var infos []TagInfo
+	for _, repo := range repositories {
+		tags, err := c.Tags(repo)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range tags {
+			digest, err := c.ManifestDigest(repo, tag)
+			if err != nil {
+				return nil, err
+			}
+			created, err := c.Created(repo, tag)
+			if err != nil {
+				c.Logger.Debug("Cannot read creation time of %s:%s: %v", repo, tag, err)
+			}
+			infos = append(infos, TagInfo{Repository: repo, Tag: tag, Digest: digest, Created: created})
+		}
+	}
+	return infos, nil
+}
+
+// ProtectedDigests resolves the references that point at this registry to
+// manifest digests; references to other registries are ignored
+func (c *Client) ProtectedDigests(refs []string) map[string]bool {
+	protected := make(map[string]bool)
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref, c.Address+"/") {
+			continue
+		}
+
+		repository, tag, digest := SplitReference(ref)
+		if digest != "" {
+			protected[digest] = true
+			continue
+		}
+		if tag == "" {
+			tag = "latest"
+		}
+		resolved, err := c.ManifestDigest(RepositoryPath(repository), tag)
+		if err != nil {
+			c.Logger.Debug("Cannot resolve %s: %v", ref, err)
+			continue
+		}
+		protected[resolved] = true
+	}
+	return protected
+}
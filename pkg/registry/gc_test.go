@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanGC(t *testing.T) {
+	day := func(n int) time.Time { return time.Date(2026, 1, n, 0, 0, 0, 0, time.UTC) }
+	tags := []TagInfo{
+		{Repository: "app/backend", Tag: "v1", Digest: "sha256:1", Created: day(1)},
+		{Repository: "app/backend", Tag: "v2", Digest: "sha256:2", Created: day(2)},
+		{Repository: "app/backend", Tag: "v3", Digest: "sha256:3", Created: day(3)},
+		{Repository: "app/backend", Tag: "v4", Digest: "sha256:4", Created: day(4)},
+		{Repository: "app/backend", Tag: "latest", Digest: "sha256:4", Created: day(4)},
+		{Repository: "app/frontend", Tag: "v1", Digest: "sha256:f1", Created: day(1)},
+	}
+	protected := map[string]bool{"sha256:1": true}
+
+	deletions := PlanGC(tags, protected, 2)
+
+	// v4/latest and v3 are newest, v1 is in use; only v2 goes. Frontend keeps its only tag.
+	if len(deletions) != 1 || deletions[0].Digest != "sha256:2" {
+		t.Fatalf("PlanGC() = %+v, want only sha256:2", deletions)
+	}
+}
+
+func TestPlanGCSharedDigest(t *testing.T) {
+	tags := []TagInfo{
+		{Repository: "app/backend", Tag: "new", Digest: "sha256:a", Created: time.Unix(200, 0)},
+		{Repository: "app/backend", Tag: "old-alias", Digest: "sha256:a", Created: time.Unix(100, 0)},
+		{Repository: "app/backend", Tag: "old", Digest: "sha256:b", Created: time.Unix(50, 0)},
+	}
+
+	deletions := PlanGC(tags, nil, 1)
+
+	// The alias shares the kept digest, so deleting it would also delete "new"
+	if len(deletions) != 1 || deletions[0].Tag != "old" {
+		t.Fatalf("PlanGC() = %+v, want only old", deletions)
+	}
+}
@@ -0,0 +1,36 @@
+package registry
+
+import "strings"
+
+// SplitReference splits an image reference into repository, tag and digest.
+// Example: localhost:5000/magnetiq/v2/backend:abc123@sha256:... ->
+// "localhost:5000/magnetiq/v2/backend", "abc123", "sha256:..."
+func SplitReference(ref string) (repository, tag, digest string) {
+	repository = ref
+	if at := strings.Index(repository, "@"); at >= 0 {
+		digest = repository[at+1:]
+		repository = repository[:at]
+	}
+	// A colon after the last slash separates the tag (earlier colons are ports)
+	if colon := strings.LastIndex(repository, ":"); colon > strings.LastIndex(repository, "/") {
+		tag = repository[colon+1:]
+		repository = repository[:colon]
+	}
+	return repository, tag, digest
+}
+
+// Rehost moves an image reference to another registry, keeping its path and tag.
+// Example: crepo.re-cloud.io/magnetiq/v2/backend:latest on 10.0.0.5:5000 ->
+// 10.0.0.5:5000/magnetiq/v2/backend:latest
+func Rehost(address, imageName string) string {
+	return address + "/" + RepositoryPath(imageName)
+}
+
+// RepositoryPath strips the registry host from an image reference
+func RepositoryPath(imageName string) string {
+	parts := strings.SplitN(imageName, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[1]
+	}
+	return imageName
+}
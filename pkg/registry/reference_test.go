@@ -0,0 +1,43 @@
+package registry
+
+import "testing"
+
+func TestSplitReference(t *testing.T) {
+	tests := []struct {
+		ref                     string
+		repository, tag, digest string
+	}{
+		{"crepo.re-cloud.io/magnetiq/v2/backend:latest", "crepo.re-cloud.io/magnetiq/v2/backend", "latest", ""},
+		{"localhost:5000/magnetiq/v2/backend", "localhost:5000/magnetiq/v2/backend", "", ""},
+		{"10.0.0.5:5000/app/backend:abc@sha256:0123", "10.0.0.5:5000/app/backend", "abc", "sha256:0123"},
+		{"10.0.0.5:5000/app/backend@sha256:0123", "10.0.0.5:5000/app/backend", "", "sha256:0123"},
+		{"alpine:3.20", "alpine", "3.20", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			repository, tag, digest := SplitReference(tt.ref)
+			if repository != tt.repository || tag != tt.tag || digest != tt.digest {
+				t.Errorf("SplitReference(%q) = %q, %q, %q, want %q, %q, %q",
+					tt.ref, repository, tag, digest, tt.repository, tt.tag, tt.digest)
+			}
+		})
+	}
+}
+
+func TestRehost(t *testing.T) {
+	tests := []struct {
+		imageName string
+		want      string
+	}{
+		{"crepo.re-cloud.io/magnetiq/v2/backend:latest", "10.0.0.5:5000/magnetiq/v2/backend:latest"},
+		{"localhost/app:1.0", "10.0.0.5:5000/app:1.0"},
+		{"magnetiq/backend:latest", "10.0.0.5:5000/magnetiq/backend:latest"},
+	}
+
+	for _, tt := range tests {
+		if got := Rehost("10.0.0.5:5000", tt.imageName); got != tt.want {
+			t.Errorf("Rehost(%q) = %q, want %q", tt.imageName, got, tt.want)
+		}
+	}
+}
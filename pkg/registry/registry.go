@@ -0,0 +1,253 @@
+package registry
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+)
+
+// Manifest media types accepted when resolving tags
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}
+
+// Client talks to a plain OCI distribution registry over its HTTP API
+type Client struct {
+	Logger   *config.Logger
+	Address  string // host:port of the registry
+	Username string // Optional basic auth credentials
+	Password string
+	Insecure bool // Allow plain HTTP and unverified TLS
+
+	http   *http.Client
+	scheme string
+}
+
+// NewClient creates a new registry client
+func NewClient(logger *config.Logger, address, username, password string, insecure bool) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &Client{
+		Logger:   logger,
+		Address:  address,
+		Username: username,
+		Password: password,
+		Insecure: insecure,
+		http:     &http.Client{Transport: transport, Timeout: 60 * time.Second},
+	}
+}
+
+// Ping checks that the registry API is reachable and the credentials are accepted.
+// Insecure registries are tried over HTTPS first, then plain HTTP.
+func (c *Client) Ping() error {
+	schemes := []string{"https"}
+	if c.Insecure {
+		schemes = append(schemes, "http")
+	}
+
+	var lastErr error
+	for _, scheme := range schemes {
+		resp, err := c.request(http.MethodGet, fmt.Sprintf("%s://%s/v2/", scheme, c.Address), nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			c.scheme = scheme
+			return nil
+		case http.StatusUnauthorized:
+			return fmt.Errorf("registry %s rejected credentials (use --registry-username/--registry-password)", c.Address)
+		default:
+			lastErr = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+	}
+
+	return fmt.Errorf("registry %s not reachable: %w", c.Address, lastErr)
+}
+
+// Tags lists the tags of a repository (empty if the repository does not exist)
+func (c *Client) Tags(repository string) ([]string, error) {
+	resp, err := c.get(fmt.Sprintf("/v2/%s/tags/list", repository), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list tags of %s: %s", repository, resp.Status)
+	}
+
+	var list struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to parse tags of %s: %w", repository, err)
+	}
+	return list.Tags, nil
+}
+
+// ManifestDigest resolves a tag or digest to the manifest digest stored in the registry
+func (c *Client) ManifestDigest(repository, reference string) (string, error) {
+	resp, err := c.manifestRequest(http.MethodHead, repository, reference)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("manifest %s:%s not found: %s", repository, reference, resp.Status)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not report a digest for %s:%s", repository, reference)
+	}
+	return digest, nil
+}
+
+// Created returns the creation time recorded in an image's config
+func (c *Client) Created(repository, reference string) (time.Time, error) {
+	var m struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+	}
+	if err := c.getManifest(repository, reference, &m); err != nil {
+		return time.Time{}, err
+	}
+
+	// Indexes are followed to their first platform manifest
+	if m.Config.Digest == "" && len(m.Manifests) > 0 {
+		if err := c.getManifest(repository, m.Manifests[0].Digest, &m); err != nil {
+			return time.Time{}, err
+		}
+	}
+	if m.Config.Digest == "" {
+		return time.Time{}, fmt.Errorf("manifest %s:%s has no config", repository, reference)
+	}
+
+	resp, err := c.get(fmt.Sprintf("/v2/%s/blobs/%s", repository, m.Config.Digest), nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("failed to read config of %s:%s: %s", repository, reference, resp.Status)
+	}
+
+	var cfg struct {
+		Created time.Time `json:"created"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse config of %s:%s: %w", repository, reference, err)
+	}
+	return cfg.Created, nil
+}
+
+// DeleteManifest deletes a manifest by digest, removing every tag that points to it
+func (c *Client) DeleteManifest(repository, digest string) error {
+	resp, err := c.manifestRequest(http.MethodDelete, repository, digest)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+		return nil
+	case http.StatusMethodNotAllowed:
+		return fmt.Errorf("registry %s does not allow deletes (set REGISTRY_STORAGE_DELETE_ENABLED=true)", c.Address)
+	default:
+		return fmt.Errorf("failed to delete %s@%s: %s", repository, digest, resp.Status)
+	}
+}
+
+// getManifest fetches a manifest and decodes it into v
+func (c *Client) getManifest(repository, reference string, v interface{}) error {
+	resp, err := c.manifestRequest(http.MethodGet, repository, reference)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("manifest %s:%s not found: %s", repository, reference, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse manifest %s:%s: %w", repository, reference, err)
+	}
+	return nil
+}
+
+// manifestRequest sends a request for a manifest, accepting all manifest media types
+func (c *Client) manifestRequest(method, repository, reference string) (*http.Response, error) {
+	if err := c.ensureScheme(); err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", c.scheme, c.Address, repository, reference)
+	return c.request(method, url, map[string]string{"Accept": strings.Join(manifestMediaTypes, ", ")})
+}
+
+// get sends a GET request for an API path
+func (c *Client) get(path string, headers map[string]string) (*http.Response, error) {
+	if err := c.ensureScheme(); err != nil {
+		return nil, err
+	}
+	return c.request(http.MethodGet, fmt.Sprintf("%s://%s%s", c.scheme, c.Address, path), headers)
+}
+
+// ensureScheme pings the registry once to pick HTTPS or HTTP
+func (c *Client) ensureScheme() error {
+	if c.scheme != "" {
+		return nil
+	}
+	return c.Ping()
+}
+
+// request sends an HTTP request with basic auth when credentials are set
+func (c *Client) request(method, url string, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	c.Logger.Debug("Registry request: %s %s", method, url)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drain bodies of HEAD/DELETE so connections can be reused
+	if method != http.MethodGet {
+		io.Copy(io.Discard, resp.Body)
+	}
+	return resp, nil
+}
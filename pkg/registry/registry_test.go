@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+)
+
+func TestClientAgainstRegistry(t *testing.T) {
+	var deleted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "deploy" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/app/backend/tags/list":
+			w.Write([]byte(`{"name":"app/backend","tags":["v1","v2"]}`))
+		case r.URL.Path == "/v2/app/backend/manifests/v2" && r.Method == http.MethodHead:
+			if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.manifest.v1+json") {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:beef")
+			w.WriteHeader(http.StatusOK)
+		case strings.HasPrefix(r.URL.Path, "/v2/app/backend/manifests/sha256:") && r.Method == http.MethodDelete:
+			deleted = strings.TrimPrefix(r.URL.Path, "/v2/app/backend/manifests/")
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "http://")
+	client := NewClient(config.NewLogger(false), address, "deploy", "secret", true)
+
+	if err := client.Ping(); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+
+	tags, err := client.Tags("app/backend")
+	if err != nil || len(tags) != 2 {
+		t.Fatalf("Tags() = %v, %v", tags, err)
+	}
+
+	missing, err := client.Tags("app/missing")
+	if err != nil || len(missing) != 0 {
+		t.Errorf("Tags() for missing repository = %v, %v; want empty", missing, err)
+	}
+
+	digest, err := client.ManifestDigest("app/backend", "v2")
+	if err != nil || digest != "sha256:beef" {
+		t.Fatalf("ManifestDigest() = %q, %v", digest, err)
+	}
+
+	if err := client.DeleteManifest("app/backend", digest); err != nil {
+		t.Fatalf("DeleteManifest() error = %v", err)
+	}
+	if deleted != "sha256:beef" {
+		t.Errorf("deleted %q, want sha256:beef", deleted)
+	}
+}
+
+func TestPingRejectsCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewClient(config.NewLogger(false), strings.TrimPrefix(server.URL, "http://"), "", "", true)
+	if err := client.Ping(); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Errorf("Ping() error = %v, want credentials error", err)
+	}
+}
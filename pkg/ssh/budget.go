@@ -0,0 +1,50 @@
+package ssh
+
+// acquire takes a distribution slot for worker and returns the function that
+// gives it back. The budget is shared by every distribution running on the
+// Distributor, so components distributed concurrently together send at most
+// Parallel tarballs at a time and at most WorkerParallel to any one worker.
+// The worker slot is taken first, so a goroutine never holds a global slot
+// while waiting for a busy worker.
+func (d *Distributor) acquire(worker *WorkerNode) func() {
+	d.slotsMu.Lock()
+	if d.slots == nil {
+		d.slots = make(chan struct{}, max(d.Parallel, 1))
+	}
+	if d.workerSlots == nil {
+		d.workerSlots = make(map[string]chan struct{})
+	}
+	workerSlots, ok := d.workerSlots[worker.Name]
+	if !ok {
+		workerSlots = make(chan struct{}, max(d.WorkerParallel, 1))
+		d.workerSlots[worker.Name] = workerSlots
+	}
+	slots := d.slots
+	d.slotsMu.Unlock()
+
+	workerSlots <- struct{}{}
+	slots <- struct{}{}
+	return func() {
+		<-slots
+		<-workerSlots
+	}
+}
+
+// SetImageDigest records the digest workers must hold for imageName ("" = name check only)
+func (d *Distributor) SetImageDigest(imageName, digest string) {
+	d.digestsMu.Lock()
+	defer d.digestsMu.Unlock()
+
+	if d.ImageDigests == nil {
+		d.ImageDigests = make(map[string]string)
+	}
+	d.ImageDigests[imageName] = digest
+}
+
+// imageDigest returns the digest recorded for imageName
+func (d *Distributor) imageDigest(imageName string) string {
+	d.digestsMu.Lock()
+	defer d.digestsMu.Unlock()
+
+	return d.ImageDigests[imageName]
+}
@@ -0,0 +1,52 @@
+package ssh
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireBudget(t *testing.T) {
+	d := &Distributor{Parallel: 3, WorkerParallel: 1}
+	workers := []*WorkerNode{{Name: "worker-1"}, {Name: "worker-2"}, {Name: "worker-3"}, {Name: "worker-4"}}
+
+	var total atomic.Int32
+	var peak atomic.Int32
+	perWorker := make(map[string]*atomic.Int32)
+	for _, w := range workers {
+		perWorker[w.Name] = &atomic.Int32{}
+	}
+
+	// Two components distributed to every worker at the same time
+	var wg sync.WaitGroup
+	for range 2 {
+		for _, w := range workers {
+			wg.Add(1)
+			go func(w *WorkerNode) {
+				defer wg.Done()
+				release := d.acquire(w)
+				defer release()
+
+				n := total.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				if perWorker[w.Name].Add(1) > 1 {
+					t.Errorf("%s has more than one distribution at a time", w.Name)
+				}
+				time.Sleep(5 * time.Millisecond)
+				perWorker[w.Name].Add(-1)
+				total.Add(-1)
+			}(w)
+		}
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p > 3 {
+		t.Errorf("peak concurrency = %d, want at most 3", p)
+	}
+}
@@ -0,0 +1,268 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Compression algorithms supported for tarball transfer
+const (
+	CompressionZstd = "zstd"
+	CompressionGzip = "gzip"
+	CompressionNone = "none"
+)
+
+// compressionFallbackOrder lists algorithms from most to least preferred
+var compressionFallbackOrder = []string{CompressionZstd, CompressionGzip, CompressionNone}
+
+// compressionExtensions maps algorithms to the file suffix used for compressed tarballs
+var compressionExtensions = map[string]string{
+	CompressionZstd: ".zst",
+	CompressionGzip: ".gz",
+	CompressionNone: "",
+}
+
+// ValidateCompression checks if a compression algorithm name is supported
+func ValidateCompression(algorithm string) error {
+	if _, ok := compressionExtensions[algorithm]; !ok {
+		return fmt.Errorf("invalid transfer compression: %s (must be %s, %s, or %s)",
+			algorithm, CompressionZstd, CompressionGzip, CompressionNone)
+	}
+	return nil
+}
+
+// compressionCandidates returns the requested algorithm followed by its fallbacks
+// Example: zstd -> [zstd gzip none], gzip -> [gzip none]
+func compressionCandidates(requested string) []string {
+	for i, algorithm := range compressionFallbackOrder {
+		if algorithm == requested {
+			return compressionFallbackOrder[i:]
+		}
+	}
+	return []string{CompressionNone}
+}
+
+// transferArtifact is a (possibly compressed) tarball ready to be copied to workers
+type transferArtifact struct {
+	Path         string
+	Compression  string
+	Size         int64
+	OriginalSize int64
+	Temporary    bool // Created by the distributor and removed after distribution
+}
+
+// Ratio returns the compression ratio (original size / transferred size)
+func (a *transferArtifact) Ratio() float64 {
+	if a.Size == 0 {
+		return 1
+	}
+	return float64(a.OriginalSize) / float64(a.Size)
+}
+
+// negotiateCompression picks the best algorithm available both locally and on the worker
+func (d *Distributor) negotiateCompression(worker *WorkerNode) string {
+	for _, algorithm := range compressionCandidates(d.Compression) {
+		if algorithm == CompressionNone {
+			return CompressionNone
+		}
+
+		if _, err := exec.LookPath(algorithm); err != nil {
+			d.Logger.Debug("  [%s] %s not available locally, trying next algorithm", worker.Name, algorithm)
+			continue
+		}
+
+		if _, err := d.sshExec(worker, fmt.Sprintf("command -v %s", algorithm)); err != nil {
+			d.Logger.Debug("  [%s] %s not installed on worker, trying next algorithm", worker.Name, algorithm)
+			continue
+		}
+
+		return algorithm
+	}
+
+	return CompressionNone
+}
+
+// artifactCall is an artifact being prepared; others needing it wait on done
+type artifactCall struct {
+	done     chan struct{}
+	artifact *transferArtifact
+	err      error
+}
+
+// prepareArtifact returns the tarball compressed with the given algorithm
+// Compressed artifacts are cached so each tarball is compressed at most once per algorithm
+func (d *Distributor) prepareArtifact(tarballPath, algorithm string) (*transferArtifact, error) {
+	return d.sharedArtifact(tarballPath+"|"+algorithm, func() (*transferArtifact, error) {
+		return d.buildArtifact(tarballPath, algorithm)
+	})
+}
+
+// sharedArtifact returns the cached artifact for key or builds it. build runs
+// without artifactsMu held, so different artifacts are built concurrently
+// while callers wanting the same one wait for the first.
+func (d *Distributor) sharedArtifact(key string, build func() (*transferArtifact, error)) (*transferArtifact, error) {
+	d.artifactsMu.Lock()
+	if artifact, ok := d.artifacts[key]; ok {
+		d.artifactsMu.Unlock()
+		return artifact, nil
+	}
+	if call, ok := d.preparing[key]; ok {
+		d.artifactsMu.Unlock()
+		<-call.done
+		return call.artifact, call.err
+	}
+	call := &artifactCall{done: make(chan struct{})}
+	if d.preparing == nil {
+		d.preparing = make(map[string]*artifactCall)
+	}
+	d.preparing[key] = call
+	d.artifactsMu.Unlock()
+
+	call.artifact, call.err = build()
+
+	d.artifactsMu.Lock()
+	delete(d.preparing, key)
+	if call.err == nil {
+		if d.artifacts == nil {
+			d.artifacts = make(map[string]*transferArtifact)
+		}
+		d.artifacts[key] = call.artifact
+	}
+	d.artifactsMu.Unlock()
+	close(call.done)
+
+	return call.artifact, call.err
+}
+
+// buildArtifact compresses a tarball with algorithm, or describes it as is for none
+func (d *Distributor) buildArtifact(tarballPath, algorithm string) (*transferArtifact, error) {
+	info, err := os.Stat(tarballPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat tarball: %w", err)
+	}
+
+	artifact := &transferArtifact{
+		Path:         tarballPath,
+		Compression:  algorithm,
+		Size:         info.Size(),
+		OriginalSize: info.Size(),
+	}
+	if algorithm == CompressionNone {
+		return artifact, nil
+	}
+
+	compressedPath := tarballPath + compressionExtensions[algorithm]
+	d.Logger.Info("Compressing %s with %s...", tarballPath, algorithm)
+
+	if err := compressFile(algorithm, tarballPath, compressedPath); err != nil {
+		os.Remove(compressedPath)
+		return nil, fmt.Errorf("%s compression failed: %w", algorithm, err)
+	}
+
+	compressedInfo, err := os.Stat(compressedPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat compressed tarball: %w", err)
+	}
+
+	artifact.Path = compressedPath
+	artifact.Size = compressedInfo.Size()
+	artifact.Temporary = true
+	d.Logger.Debug("Compressed %.1f MB -> %.1f MB (ratio %.2fx)",
+		float64(artifact.OriginalSize)/1024/1024, float64(artifact.Size)/1024/1024, artifact.Ratio())
+
+	return artifact, nil
+}
+
+// removeArtifacts deletes compressed copies and delta archives derived from a tarball
+func (d *Distributor) removeArtifacts(tarballPath string) {
+	d.artifactsMu.Lock()
+	defer d.artifactsMu.Unlock()
+
+	for key, artifact := range d.artifacts {
+		if !derivedFrom(key[:strings.LastIndex(key, "|")], tarballPath) {
+			continue
+		}
+		if artifact.Temporary {
+			if err := os.Remove(artifact.Path); err != nil && !os.IsNotExist(err) {
+				d.Logger.Warning("Failed to remove temporary tarball %s: %v", artifact.Path, err)
+			} else {
+				d.Logger.Debug("Removed temporary tarball: %s", artifact.Path)
+			}
+		}
+		delete(d.artifacts, key)
+	}
+	for path := range d.checksums {
+		if derivedFrom(path, tarballPath) {
+			delete(d.checksums, path)
+		}
+	}
+	delete(d.layouts, tarballPath)
+}
+
+// derivedFrom reports whether path is tarballPath, one of its delta archives
+// or a compressed copy of either. Other tarballs whose names merely start
+// like tarballPath's do not match.
+func derivedFrom(path, tarballPath string) bool {
+	for _, ext := range compressionExtensions {
+		if ext != "" && strings.HasSuffix(path, ext) {
+			path = strings.TrimSuffix(path, ext)
+			break
+		}
+	}
+	if path == tarballPath {
+		return true
+	}
+
+	rest, ok := strings.CutPrefix(path, strings.TrimSuffix(tarballPath, ".tar")+".delta-")
+	if !ok {
+		return false
+	}
+	key, ok := strings.CutSuffix(rest, ".tar")
+	if !ok || len(key) != deltaKeyLength {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// compressFile compresses src into dst using the local compression tool
+func compressFile(algorithm, src, dst string) error {
+	var cmd *exec.Cmd
+	switch algorithm {
+	case CompressionZstd:
+		cmd = exec.Command("zstd", "-q", "-f", "-T0", "-3", src, "-o", dst)
+	case CompressionGzip:
+		out, err := os.Create(dst)
+		if err != nil {
+			return fmt.Errorf("cannot create %s: %w", dst, err)
+		}
+		defer out.Close()
+		cmd = exec.Command("gzip", "-c", "-6", src)
+		cmd.Stdout = out
+	default:
+		return fmt.Errorf("unsupported compression: %s", algorithm)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// decompressCommand returns the shell command that restores the tarball on a worker
+func decompressCommand(algorithm, compressedPath, tarballPath string) string {
+	switch algorithm {
+	case CompressionZstd:
+		return fmt.Sprintf("zstd -d -q -f --rm %s -o %s", compressedPath, tarballPath)
+	case CompressionGzip:
+		return fmt.Sprintf("gzip -d -c %s > %s && rm -f %s", compressedPath, tarballPath, compressedPath)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,167 @@
+package ssh
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/constants"
+)
+
+func TestCompressionCandidates(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		want      []string
+	}{
+		{
+			name:      "zstd falls back to gzip then none",
+			requested: CompressionZstd,
+			want:      []string{CompressionZstd, CompressionGzip, CompressionNone},
+		},
+		{
+			name:      "gzip falls back to none",
+			requested: CompressionGzip,
+			want:      []string{CompressionGzip, CompressionNone},
+		},
+		{
+			name:      "none has no fallback",
+			requested: CompressionNone,
+			want:      []string{CompressionNone},
+		},
+		{
+			name:      "unknown algorithm sends uncompressed",
+			requested: "lz4",
+			want:      []string{CompressionNone},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compressionCandidates(tt.requested); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compressionCandidates(%q) = %v, want %v", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	for _, algorithm := range []string{CompressionZstd, CompressionGzip, CompressionNone} {
+		if err := ValidateCompression(algorithm); err != nil {
+			t.Errorf("ValidateCompression(%q) unexpected error: %v", algorithm, err)
+		}
+	}
+
+	if err := ValidateCompression("bzip2"); err == nil {
+		t.Error("ValidateCompression(\"bzip2\") expected error, got nil")
+	}
+}
+
+func TestTransferArtifactRatio(t *testing.T) {
+	artifact := &transferArtifact{Size: 250, OriginalSize: 1000}
+	if got := artifact.Ratio(); got != 4 {
+		t.Errorf("Ratio() = %v, want 4", got)
+	}
+
+	empty := &transferArtifact{}
+	if got := empty.Ratio(); got != 1 {
+		t.Errorf("Ratio() on empty artifact = %v, want 1", got)
+	}
+}
+
+func TestDerivedFrom(t *testing.T) {
+	tarball := "/tmp/magnetiq-backend.tar"
+	for path, want := range map[string]bool{
+		"/tmp/magnetiq-backend.tar":                        true,
+		"/tmp/magnetiq-backend.tar.zst":                    true,
+		"/tmp/magnetiq-backend.delta-0123456789ab.tar":     true,
+		"/tmp/magnetiq-backend.delta-0123456789ab.tar.gz":  true,
+		"/tmp/magnetiq-backend-worker.tar":                 false,
+		"/tmp/magnetiq-backend-worker.tar.zst":             false,
+		"/tmp/magnetiq-backend.delta-0123456789ab-x.tar":   false,
+		"/tmp/magnetiq-backend-old.delta-0123456789ab.tar": false,
+	} {
+		if got := derivedFrom(path, tarball); got != want {
+			t.Errorf("derivedFrom(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestRemoveArtifactsExact(t *testing.T) {
+	dir := t.TempDir()
+	backend := filepath.Join(dir, "magnetiq-backend.tar")
+	worker := filepath.Join(dir, "magnetiq-backend-worker.tar")
+	for _, path := range []string{backend + ".zst", worker + ".zst"} {
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := &Distributor{Logger: config.NewLogger(false), artifacts: map[string]*transferArtifact{
+		backend + "|" + CompressionZstd: {Path: backend + ".zst", Temporary: true},
+		worker + "|" + CompressionZstd:  {Path: worker + ".zst", Temporary: true},
+	}}
+	d.removeArtifacts(backend)
+
+	if _, ok := d.artifacts[worker+"|"+CompressionZstd]; !ok {
+		t.Error("removeArtifacts() dropped the artifact of another tarball")
+	}
+	if _, err := os.Stat(worker + ".zst"); err != nil {
+		t.Errorf("removeArtifacts() removed another tarball's copy: %v", err)
+	}
+	if _, err := os.Stat(backend + ".zst"); !os.IsNotExist(err) {
+		t.Errorf("compressed copy still exists: %v", err)
+	}
+}
+
+func TestPrepareArtifactShared(t *testing.T) {
+	if _, err := exec.LookPath("gzip"); err != nil {
+		t.Skip("gzip not installed")
+	}
+	tarball := filepath.Join(t.TempDir(), "magnetiq-backend.tar")
+	if err := os.WriteFile(tarball, bytes.Repeat([]byte("layer"), 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := config.NewLogger(false)
+	logger.Stdout = io.Discard
+	d := &Distributor{Logger: logger}
+
+	artifacts := make([]*transferArtifact, 8)
+	var wg sync.WaitGroup
+	for i := range artifacts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			artifact, err := d.prepareArtifact(tarball, CompressionGzip)
+			if err != nil {
+				t.Errorf("prepareArtifact() error = %v", err)
+			}
+			artifacts[i] = artifact
+		}(i)
+	}
+	wg.Wait()
+
+	for _, artifact := range artifacts {
+		if artifact != artifacts[0] {
+			t.Fatal("prepareArtifact() compressed the same tarball more than once")
+		}
+	}
+	if len(d.preparing) != 0 {
+		t.Errorf("preparing = %v, want empty after all calls", d.preparing)
+	}
+	d.removeArtifacts(tarball)
+}
+
+func TestNewDistributorCompression(t *testing.T) {
+	d := NewDistributor(config.NewLogger(false), &Config{})
+	if d.Compression != constants.DefaultTransferCompression {
+		t.Errorf("NewDistributor().Compression = %s, want the CLI default %s", d.Compression, constants.DefaultTransferCompression)
+	}
+}
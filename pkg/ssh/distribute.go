@@ -1,12 +1,13 @@
 package ssh
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"io"
+	"net"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +16,9 @@ import (
 
 	"github.com/wapsol/m2deploy/pkg/config"
 	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/containerd"
+	"github.com/wapsol/m2deploy/pkg/inventory"
+	"github.com/wapsol/m2deploy/pkg/k8s"
 )
 
 // Config holds SSH connection parameters
@@ -28,13 +32,57 @@ type Config struct {
 
 // Distributor handles distributing images to worker nodes
 type Distributor struct {
-	Logger        *config.Logger
-	SSHConfig     *Config
-	Parallel      int  // Max parallel distributions
-	RetryCount    int  // Number of retries per worker
-	MinWorkers    int  // Minimum successful workers required
-	KeepTarballs  bool // Keep tarballs on workers for debugging
-	WorkerIPs     []string // Manual worker IPs (overrides auto-discovery)
+	Logger       *config.Logger
+	SSHConfig    *Config
+	Parallel     int                  // Max parallel distributions across all components
+	RetryCount   int                  // Number of retries per worker
+	MinWorkers   int                  // Minimum successful workers required
+	KeepTarballs bool                 // Keep tarballs on workers for debugging
+	WorkerIPs    []string             // Manual worker IPs (overrides auto-discovery)
+	Inventory    *inventory.Inventory // Per-host settings reconciled with discovered nodes
+	Compression  string               // Preferred transfer compression (zstd, gzip, none)
+	DeltaLayers  bool                 // Send only layers missing from the worker's content store
+	FanOut       bool                 // Let workers that hold the image forward it to the rest
+	FanOutSeeds  int                  // Workers seeded by the controller in fan-out mode (0 = Parallel)
+	ImageDigests map[string]string    // Expected image digests keyed by image name (empty = name check only)
+	SkipPresent  bool                 // Skip workers that already hold the image with the expected digest
+	NodeSelector k8s.Selector         // Only discovered workers whose labels match
+	Runtime      string               // Container runtime on workers (containerd.RuntimeAuto = detect per worker)
+	Socket       string               // Containerd socket on workers ("" = runtime default or detected)
+
+	ResumeTransfers bool  // Continue partial transfers left by earlier attempts
+	ChunkSize       int64 // Split transfers into chunks of this many bytes (0 = single stream)
+	ChunkParallel   int   // Chunks sent concurrently over one SSH connection
+	WorkerParallel  int   // Max distributions to one worker at a time across all components
+	RateLimit       int64 // Bytes per second across all transfers (0 = unlimited)
+	WorkerRateLimit int64 // Bytes per second to each worker (0 = unlimited)
+
+	artifacts   map[string]*transferArtifact // Compressed tarballs and delta archives keyed by path and algorithm
+	preparing   map[string]*artifactCall     // Artifacts being compressed, keyed like artifacts
+	layouts     map[string]*imageLayout      // Parsed layer digests keyed by tarball path
+	reading     map[string]*layoutCall       // Tarballs whose layouts are being read, keyed like layouts
+	checksums   map[string]string            // Local SHA-256 sums keyed by path
+	hashing     map[string]*checksumCall     // Local files being hashed, keyed like checksums
+	artifactsMu sync.Mutex
+
+	presence   map[string]map[string]bool // Workers holding an image, from CheckPresence
+	presenceMu sync.Mutex
+	digestsMu  sync.Mutex
+
+	hostKeys   map[string]ssh.PublicKey // Host keys seen this run keyed by "host:port"
+	hostKeysMu sync.Mutex
+
+	runtimes   map[string]*containerd.Runtime // Resolved runtimes keyed by worker name
+	runtimesMu sync.Mutex
+
+	slots       chan struct{}            // Distribution budget shared by all components
+	workerSlots map[string]chan struct{} // Per-worker budget keyed by worker name
+	slotsMu     sync.Mutex
+
+	totalLimiter   *rateLimiter
+	workerLimiters map[string]*rateLimiter
+	limitMu        sync.Mutex
+	progress       *progressTracker
 }
 
 // WorkerNode represents a k8s worker node
@@ -43,15 +91,46 @@ type WorkerNode struct {
 	IP        string
 	Reachable bool
 	LastError error
+
+	// Per-host settings from the inventory; empty values use the Distributor's defaults
+	User      string
+	Port      int
+	KeyPath   string
+	TempDir   string
+	Namespace string // Containerd namespace
+	Runtime   string // Container runtime kind (containerd.RuntimeK0s, ...)
+	Socket    string // Containerd socket
+	NoSudo    bool   // Run ctr without sudo
+
+	Labels map[string]string // Node labels overlaid with inventory labels (nil for --workers)
+	Taints []k8s.Taint
 }
 
 // DistributionResult tracks per-worker results
 type DistributionResult struct {
-	Worker    *WorkerNode
-	Component string
-	Success   bool
-	Duration  time.Duration
-	Error     error
+	Worker           *WorkerNode
+	Component        string
+	Success          bool
+	Duration         time.Duration
+	Error            error
+	Compression      string        // Algorithm used for the transfer
+	BytesTransferred int64         // Bytes sent over the wire (compressed size)
+	OriginalBytes    int64         // Uncompressed tarball size
+	TransferDuration time.Duration // Time spent copying and decompressing
+	LayersSent       int           // Layers shipped to the worker
+	LayersTotal      int           // Layers in the image
+	Source           string        // Worker that forwarded the image ("" = controller)
+	Hop              int           // Transfers between the controller and this worker
+	AlreadyPresent   bool          // Worker already held the exact image; nothing was sent
+	Throughput       float64       // Bytes per second on the wire while copying
+}
+
+// EffectiveThroughput returns uncompressed bytes delivered per second of transfer time
+func (r *DistributionResult) EffectiveThroughput() float64 {
+	if r.TransferDuration <= 0 {
+		return 0
+	}
+	return float64(r.OriginalBytes) / r.TransferDuration.Seconds()
 }
 
 // NewDistributor creates a new distributor instance
@@ -64,6 +143,22 @@ func NewDistributor(logger *config.Logger, sshConfig *Config) *Distributor {
 		MinWorkers:   0, // 0 means all required
 		KeepTarballs: false,
 		WorkerIPs:    nil,
+		Compression:  constants.DefaultTransferCompression,
+		DeltaLayers:  false,
+		FanOut:       false,
+		FanOutSeeds:  0,
+		ImageDigests: map[string]string{},
+		SkipPresent:  true,
+		Runtime:      containerd.RuntimeAuto,
+
+		ResumeTransfers: true,
+		ChunkSize:       0,
+		ChunkParallel:   4,
+		WorkerParallel:  1,
+		RateLimit:       0,
+		WorkerRateLimit: 0,
+
+		progress: newProgressTracker(logger),
 	}
 }
 
@@ -86,35 +181,99 @@ func (d *Distributor) GetWorkerNodes(k8sClient interface{}) ([]*WorkerNode, erro
 	// Otherwise discover from k8s API
 	d.Logger.Debug("Discovering workers from k8s API")
 
-	// Cast k8sClient to the actual type and call GetWorkerIPs
-	// For now, we'll implement a simple interface check
-	type WorkerIPGetter interface {
-		GetWorkerIPs() ([]string, error)
+	type workerLister interface {
+		WorkerNodes() ([]k8s.NodeInfo, error)
 	}
 
-	getter, ok := k8sClient.(WorkerIPGetter)
+	lister, ok := k8sClient.(workerLister)
 	if !ok {
-		return nil, fmt.Errorf("k8s client does not implement GetWorkerIPs method")
+		return nil, fmt.Errorf("k8s client does not implement WorkerNodes method")
 	}
 
-	ips, err := getter.GetWorkerIPs()
+	nodes, err := lister.WorkerNodes()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get worker IPs from k8s: %w", err)
+		return nil, fmt.Errorf("failed to get worker nodes from k8s: %w", err)
 	}
 
-	if len(ips) == 0 {
+	if len(nodes) == 0 {
 		return nil, fmt.Errorf("no worker nodes found in cluster")
 	}
 
-	workers := make([]*WorkerNode, len(ips))
-	for i, ip := range ips {
-		workers[i] = &WorkerNode{
-			Name: fmt.Sprintf("worker-%s", ip),
-			IP:   ip,
+	var workers []*WorkerNode
+	if d.Inventory == nil {
+		for _, node := range nodes {
+			workers = append(workers, &WorkerNode{
+				Name:   node.Name,
+				IP:     node.IP,
+				Labels: node.Labels,
+				Taints: node.Taints,
+			})
+		}
+	} else {
+		// Per-host settings come from the inventory; differences are flagged
+		hosts, mismatches := inventory.Reconcile(d.Inventory, nodes)
+		for _, mismatch := range mismatches {
+			d.Logger.Warning("Inventory mismatch: %s", mismatch)
+		}
+
+		// Hosts are returned in node order
+		for i, host := range hosts {
+			worker := workerFromHost(host)
+			worker.Labels = mergeLabels(nodes[i].Labels, host.Labels)
+			worker.Taints = nodes[i].Taints
+			workers = append(workers, worker)
 		}
 	}
 
-	return workers, nil
+	if len(d.NodeSelector) == 0 {
+		return workers, nil
+	}
+
+	var selected []*WorkerNode
+	for _, worker := range workers {
+		if d.NodeSelector.Matches(worker.Labels) {
+			selected = append(selected, worker)
+		} else {
+			d.Logger.Debug("Skipping %s: labels do not match node selector", worker.Name)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no worker nodes match the node selector")
+	}
+	return selected, nil
+}
+
+// mergeLabels returns the node's labels overlaid with the inventory's
+func mergeLabels(nodeLabels, inventoryLabels map[string]string) map[string]string {
+	labels := make(map[string]string, len(nodeLabels)+len(inventoryLabels))
+	for k, v := range nodeLabels {
+		labels[k] = v
+	}
+	for k, v := range inventoryLabels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// NodeInfo describes the worker for scheduling checks
+func (w *WorkerNode) NodeInfo() k8s.NodeInfo {
+	return k8s.NodeInfo{Name: w.Name, IP: w.IP, Labels: w.Labels, Taints: w.Taints}
+}
+
+// workerFromHost converts a resolved inventory host to a worker
+func workerFromHost(host inventory.Host) *WorkerNode {
+	return &WorkerNode{
+		Name:      host.Name,
+		IP:        host.Address,
+		User:      host.User,
+		Port:      host.Port,
+		KeyPath:   host.Key,
+		TempDir:   host.TempDir,
+		Namespace: host.Namespace,
+		Runtime:   host.Runtime,
+		Socket:    host.Socket,
+		NoSudo:    host.Sudo != nil && !*host.Sudo,
+	}
 }
 
 // TestConnectivity tests SSH connectivity to all workers
@@ -145,133 +304,173 @@ func (d *Distributor) TestConnectivity(workers []*WorkerNode) error {
 }
 
 // DistributeToWorker distributes a single tarball to a single worker
+// With DeltaLayers enabled, only layers missing on the worker are sent; if the
+// delta import fails the full tarball is sent instead.
 func (d *Distributor) DistributeToWorker(worker *WorkerNode, tarballPath, component, imageName string) (*DistributionResult, error) {
+	if d.DeltaLayers {
+		result, err := d.distributeToWorker(worker, tarballPath, component, imageName, true, false)
+		if err == nil {
+			return result, nil
+		}
+		d.Logger.Warning("  [%s] Delta transfer failed (%v), sending full tarball", worker.Name, err)
+	}
+
+	return d.distributeToWorker(worker, tarballPath, component, imageName, false, false)
+}
+
+// distributeToWorker copies, imports and verifies an image on a single worker
+// keepTarball leaves the imported tarball on the worker so it can forward it to peers.
+func (d *Distributor) distributeToWorker(worker *WorkerNode, tarballPath, component, imageName string, useDelta, keepTarball bool) (*DistributionResult, error) {
 	startTime := time.Now()
+	result := &DistributionResult{
+		Worker:    worker,
+		Component: component,
+		Hop:       1,
+	}
+
+	fail := func(err error) (*DistributionResult, error) {
+		result.Success = false
+		result.Duration = time.Since(startTime)
+		result.Error = err
+		return result, err
+	}
+
+	// Build a delta archive holding only the layers this worker is missing
+	sourcePath := tarballPath
+	if useDelta {
+		deltaPath, plan, err := d.deltaForWorker(worker, tarballPath, imageName)
+		if err != nil {
+			return fail(err)
+		}
+		defer d.unpinLayers(worker, plan)
+		result.LayersTotal = len(plan.Layout.Layers)
+		result.LayersSent = len(plan.Missing)
+		if deltaPath == "" {
+			d.Logger.Debug("  [%s] No layers present on worker, sending full tarball", worker.Name)
+			useDelta = false
+		} else {
+			d.Logger.Info("  [%s] Worker has %d/%d layers, sending %d (%.1f MB of %.1f MB)",
+				worker.Name, plan.Reused, len(plan.Layout.Layers), len(plan.Missing),
+				float64(plan.MissingSize())/1024/1024, float64(plan.Layout.TotalLayerSize())/1024/1024)
+			sourcePath = deltaPath
+		}
+	}
 
 	// Generate remote paths
-	tarballName := filepath.Base(tarballPath)
-	remoteTarball := filepath.Join(d.SSHConfig.WorkerTempDir, tarballName)
+	remoteTarball := filepath.Join(d.tempDir(worker), filepath.Base(sourcePath))
 
-	// Get tarball size for logging
-	tarballInfo, err := os.Stat(tarballPath)
+	// Pick compression supported on both ends and prepare the artifact to send
+	algorithm := d.negotiateCompression(worker)
+	artifact, err := d.prepareArtifact(sourcePath, algorithm)
+	if err != nil && algorithm != CompressionNone {
+		d.Logger.Warning("  [%s] %v, sending uncompressed", worker.Name, err)
+		algorithm = CompressionNone
+		artifact, err = d.prepareArtifact(sourcePath, algorithm)
+	}
 	if err != nil {
-		return &DistributionResult{
-			Worker:    worker,
-			Component: component,
-			Success:   false,
-			Duration:  time.Since(startTime),
-			Error:     fmt.Errorf("cannot stat tarball: %w", err),
-		}, err
+		return fail(err)
 	}
-	tarballSize := tarballInfo.Size()
 
-	d.Logger.Info("  [%s] Copying tarball (%.1f MB)...", worker.Name, float64(tarballSize)/1024/1024)
+	result.Compression = artifact.Compression
+	result.OriginalBytes = artifact.OriginalSize
+	remoteArtifact := filepath.Join(d.tempDir(worker), filepath.Base(artifact.Path))
+
+	if artifact.Compression == CompressionNone {
+		d.Logger.Info("  [%s] Copying tarball (%.1f MB)...", worker.Name, float64(artifact.Size)/1024/1024)
+	} else {
+		d.Logger.Info("  [%s] Copying %s tarball (%.1f MB, %.1f MB uncompressed)...",
+			worker.Name, artifact.Compression, float64(artifact.Size)/1024/1024, float64(artifact.OriginalSize)/1024/1024)
+	}
 
-	// SCP tarball to worker
-	if err := d.scpToWorker(worker, tarballPath, remoteTarball); err != nil {
-		return &DistributionResult{
-			Worker:    worker,
-			Component: component,
-			Success:   false,
-			Duration:  time.Since(startTime),
-			Error:     fmt.Errorf("SCP failed: %w", err),
-		}, err
+	// Copy tarball to worker, resuming any partial copy from an earlier attempt
+	transferStart := time.Now()
+	throughput, err := d.transferToWorker(worker, component, artifact.Path, remoteArtifact)
+	if err != nil {
+		return fail(fmt.Errorf("transfer failed: %w", err))
 	}
+	result.BytesTransferred = artifact.Size
+	result.Throughput = throughput
+
+	// Decompress on worker
+	if artifact.Compression != CompressionNone {
+		d.Logger.Debug("  [%s] Decompressing tarball...", worker.Name)
+		if _, err := d.sshExec(worker, decompressCommand(artifact.Compression, remoteArtifact, remoteTarball)); err != nil {
+			d.CleanupOnWorker(worker, remoteArtifact)
+			return fail(fmt.Errorf("decompression failed: %w", err))
+		}
+	}
+	result.TransferDuration = time.Since(transferStart)
 
 	d.Logger.Info("  [%s] Importing into containerd...", worker.Name)
 
-	// Import to containerd with base-name
-	if err := d.importOnWorker(worker, remoteTarball, imageName); err != nil {
-		return &DistributionResult{
-			Worker:    worker,
-			Component: component,
-			Success:   false,
-			Duration:  time.Since(startTime),
-			Error:     fmt.Errorf("import failed: %w", err),
-		}, err
+	// Import to containerd (base-name for docker archives, index annotations for deltas)
+	if err := d.importOnWorker(worker, remoteTarball, imageName, useDelta); err != nil {
+		if useDelta && !d.KeepTarballs {
+			d.CleanupOnWorker(worker, remoteTarball)
+		}
+		return fail(fmt.Errorf("import failed: %w", err))
 	}
 
 	d.Logger.Info("  [%s] Verifying import...", worker.Name)
 
 	// Verify import
 	if err := d.VerifyImportOnWorker(worker, imageName); err != nil {
-		return &DistributionResult{
-			Worker:    worker,
-			Component: component,
-			Success:   false,
-			Duration:  time.Since(startTime),
-			Error:     fmt.Errorf("verification failed: %w", err),
-		}, err
+		return fail(fmt.Errorf("verification failed: %w", err))
 	}
 
 	// Cleanup (optional)
-	if !d.KeepTarballs {
+	if !d.KeepTarballs && !keepTarball {
 		d.Logger.Debug("  [%s] Cleaning up tarball...", worker.Name)
 		d.CleanupOnWorker(worker, remoteTarball)
 	}
 
-	duration := time.Since(startTime)
-	d.Logger.Success("  [%s] Completed in %s", worker.Name, duration)
+	result.Success = true
+	result.Duration = time.Since(startTime)
+	d.Logger.Success("  [%s] Completed in %s", worker.Name, result.Duration)
 
-	return &DistributionResult{
-		Worker:    worker,
-		Component: component,
-		Success:   true,
-		Duration:  duration,
-		Error:     nil,
-	}, nil
+	return result, nil
 }
 
 // DistributeToAllWorkers distributes tarball to all workers (with parallelism)
 func (d *Distributor) DistributeToAllWorkers(workers []*WorkerNode, tarballPath, component, imageName string) ([]*DistributionResult, error) {
-	d.Logger.Info("Distributing %s to %d workers (parallel: %d)", component, len(workers), d.Parallel)
-
-	results := make([]*DistributionResult, len(workers))
-
-	// Use semaphore to limit parallelism
-	sem := make(chan struct{}, d.Parallel)
-	var wg sync.WaitGroup
-
-	for i, worker := range workers {
-		wg.Add(1)
+	var results []*DistributionResult
+	targets := workers
+
+	// Workers that already hold the exact image are not sent anything
+	if d.SkipPresent {
+		present := d.takePresence(workers, imageName)
+		targets = nil
+		for _, worker := range workers {
+			if !present[worker.Name] {
+				targets = append(targets, worker)
+				continue
+			}
+			d.Logger.Info("  [%s] %s already present", worker.Name, component)
+			results = append(results, &DistributionResult{
+				Worker:         worker,
+				Component:      component,
+				Success:        true,
+				AlreadyPresent: true,
+			})
+		}
+	}
 
-		go func(idx int, w *WorkerNode) {
-			defer wg.Done()
+	if len(targets) > 0 {
+		d.Logger.Info("Distributing %s to %d workers (parallel: %d)", component, len(targets), d.Parallel)
 
-			// Acquire semaphore
-			sem <- struct{}{}
-			defer func() { <-sem }()
-
-			// Attempt distribution with retries
-			var lastErr error
-			for attempt := 1; attempt <= d.RetryCount; attempt++ {
-				if attempt > 1 {
-					d.Logger.Info("  [%s] Retry %d/%d", w.Name, attempt, d.RetryCount)
-					time.Sleep(time.Second * 2) // Brief delay between retries
-				}
-
-				result, err := d.DistributeToWorker(w, tarballPath, component, imageName)
-				if err == nil {
-					results[idx] = result
-					return
-				}
-
-				lastErr = err
-			}
+		// Compressed copies are shared between workers and removed once all are done
+		defer d.removeArtifacts(tarballPath)
+		defer d.progress.run()()
 
-			// All retries failed
-			results[idx] = &DistributionResult{
-				Worker:    w,
-				Component: component,
-				Success:   false,
-				Error:     lastErr,
-			}
-			d.Logger.Warning("  [%s] Failed after %d attempts: %v", w.Name, d.RetryCount, lastErr)
-		}(i, worker)
+		if d.FanOut && len(targets) > d.fanOutSeeds() {
+			results = append(results, d.distributeFanOut(targets, tarballPath, component, imageName)...)
+		} else {
+			results = append(results, d.distributeDirect(targets, component, func(w *WorkerNode) (*DistributionResult, error) {
+				return d.DistributeToWorker(w, tarballPath, component, imageName)
+			})...)
+		}
 	}
 
-	wg.Wait()
-
 	// Count successes
 	successCount := 0
 	for _, result := range results {
@@ -286,13 +485,17 @@ func (d *Distributor) DistributeToAllWorkers(workers []*WorkerNode, tarballPath,
 	}
 
 	d.Logger.Info("")
+	d.logTransferSummary(results)
 	if successCount < minRequired {
 		return results, fmt.Errorf("only %d/%d workers received image (minimum: %d)",
 			successCount, len(workers), minRequired)
 	}
 
+	presentCount := len(workers) - len(targets)
 	if successCount < len(workers) {
 		d.Logger.Warning("Image distributed to %d/%d workers (some failures)", successCount, len(workers))
+	} else if presentCount > 0 {
+		d.Logger.Success("Image available on all %d workers (%d already present)", successCount, presentCount)
 	} else {
 		d.Logger.Success("Image distributed to all %d workers", successCount)
 	}
@@ -300,106 +503,142 @@ func (d *Distributor) DistributeToAllWorkers(workers []*WorkerNode, tarballPath,
 	return results, nil
 }
 
-// VerifyImportOnWorker verifies image exists in worker's containerd
-func (d *Distributor) VerifyImportOnWorker(worker *WorkerNode, imageName string) error {
-	listCmd := fmt.Sprintf("sudo ctr -n %s images list", constants.ContainerdNamespace)
-	output, err := d.sshExec(worker, listCmd)
-	if err != nil {
-		return fmt.Errorf("failed to list images: %w", err)
-	}
+// distributeDirect runs attempt for every worker within the distribution
+// budget shared with other components (see acquire)
+func (d *Distributor) distributeDirect(workers []*WorkerNode, component string, attempt func(w *WorkerNode) (*DistributionResult, error)) []*DistributionResult {
+	results := make([]*DistributionResult, len(workers))
+	var wg sync.WaitGroup
 
-	if !strings.Contains(output, imageName) {
-		return fmt.Errorf("image %s not found in containerd", imageName)
-	}
+	for i, worker := range workers {
+		wg.Add(1)
 
-	return nil
-}
+		go func(idx int, w *WorkerNode) {
+			defer wg.Done()
 
-// CleanupOnWorker removes tarball from worker's temp directory
-func (d *Distributor) CleanupOnWorker(worker *WorkerNode, tarballPath string) error {
-	cleanupCmd := fmt.Sprintf("rm -f %s", tarballPath)
-	_, err := d.sshExec(worker, cleanupCmd)
-	if err != nil {
-		d.Logger.Warning("Failed to cleanup %s on %s: %v", tarballPath, worker.Name, err)
+			release := d.acquire(w)
+			defer release()
+
+			results[idx] = d.withRetries(w, component, func() (*DistributionResult, error) {
+				return attempt(w)
+			})
+		}(i, worker)
 	}
-	return err
+
+	wg.Wait()
+	return results
 }
 
-// scpToWorker copies file to worker using SCP
-func (d *Distributor) scpToWorker(worker *WorkerNode, localPath, remotePath string) error {
-	// Get local file info
-	localInfo, err := os.Stat(localPath)
-	if err != nil {
-		return fmt.Errorf("cannot stat local file: %w", err)
-	}
-	localSize := localInfo.Size()
+// withRetries runs a distribution attempt up to RetryCount times
+func (d *Distributor) withRetries(worker *WorkerNode, component string, attempt func() (*DistributionResult, error)) *DistributionResult {
+	var lastErr error
+	for i := 1; i <= d.RetryCount; i++ {
+		if i > 1 {
+			d.Logger.Info("  [%s] Retry %d/%d", worker.Name, i, d.RetryCount)
+			time.Sleep(time.Second * 2) // Brief delay between retries
+		}
 
-	// Open local file
-	localFile, err := os.Open(localPath)
-	if err != nil {
-		return fmt.Errorf("cannot open local file: %w", err)
+		result, err := attempt()
+		if err == nil {
+			return result
+		}
+
+		lastErr = err
 	}
-	defer localFile.Close()
 
-	// Establish SSH connection
-	client, err := d.getSSHClient(worker)
-	if err != nil {
-		return fmt.Errorf("SSH connection failed: %w", err)
+	// All retries failed
+	d.Logger.Warning("  [%s] Failed after %d attempts: %v", worker.Name, d.RetryCount, lastErr)
+	return &DistributionResult{
+		Worker:    worker,
+		Component: component,
+		Success:   false,
+		Error:     lastErr,
 	}
-	defer client.Close()
+}
 
-	// Open SCP session
-	session, err := client.NewSession()
-	if err != nil {
-		return fmt.Errorf("cannot create SSH session: %w", err)
+// logTransferSummary logs compression ratio and effective throughput of the
+// completed copies, also when the run fails
+func (d *Distributor) logTransferSummary(results []*DistributionResult) {
+	var sent, original int64
+	var transferTime time.Duration
+	var layersSent, layersTotal int
+	var wireRate float64
+	var copies int
+	algorithms := map[string]int{}
+
+	// Copies that completed count even when the import failed afterwards
+	for _, result := range results {
+		if result.BytesTransferred == 0 || result.TransferDuration <= 0 {
+			continue
+		}
+		sent += result.BytesTransferred
+		original += result.OriginalBytes
+		transferTime += result.TransferDuration
+		layersSent += result.LayersSent
+		layersTotal += result.LayersTotal
+		algorithms[result.Compression]++
+		if result.Throughput > 0 {
+			wireRate += result.Throughput
+			copies++
+		}
 	}
-	defer session.Close()
 
-	// Set up pipes
-	stdin, err := session.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("cannot create stdin pipe: %w", err)
+	if sent == 0 || transferTime <= 0 {
+		return
 	}
 
-	// Start SCP command
-	scpCmd := fmt.Sprintf("scp -t %s", remotePath)
-	if err := session.Start(scpCmd); err != nil {
-		return fmt.Errorf("cannot start SCP: %w", err)
+	var used []string
+	for algorithm, count := range algorithms {
+		used = append(used, fmt.Sprintf("%s x%d", algorithm, count))
 	}
+	sort.Strings(used)
 
-	// Send file via SCP protocol
-	// Format: C0644 <size> <filename>\n
-	filename := filepath.Base(localPath)
-	fmt.Fprintf(stdin, "C0644 %d %s\n", localSize, filename)
+	d.Logger.Info("  Compression: %s, %.1f MB sent for %.1f MB of image data (ratio %.2fx)",
+		strings.Join(used, ", "), float64(sent)/1024/1024, float64(original)/1024/1024, float64(original)/float64(sent))
+	d.Logger.Info("  Effective throughput: %.1f MB/s per worker",
+		float64(original)/1024/1024/transferTime.Seconds())
+	if copies > 0 {
+		d.Logger.Info("  Wire throughput: %.1f MB/s per worker (average of %d copies)",
+			wireRate/float64(copies)/1024/1024, copies)
+	}
+	if layersTotal > 0 {
+		d.Logger.Info("  Layers: %d/%d sent, %d already present on workers",
+			layersSent, layersTotal, layersTotal-layersSent)
+	}
+}
 
-	// Copy file content
-	_, err = io.Copy(stdin, localFile)
+// VerifyImportOnWorker verifies image exists in worker's containerd
+// The reference must match exactly and, if an expected digest is recorded in
+// ImageDigests, resolve to that digest. A *containerd.VerifyError reports
+// whether the image is missing or stale.
+func (d *Distributor) VerifyImportOnWorker(worker *WorkerNode, imageName string) error {
+	image, err := containerd.VerifyImage(d.ctrRunner(worker), imageName, d.imageDigest(imageName))
 	if err != nil {
-		return fmt.Errorf("file copy failed: %w", err)
+		return err
 	}
 
-	// Send termination byte
-	fmt.Fprint(stdin, "\x00")
-	stdin.Close()
+	d.Logger.Debug("  [%s] %s verified (%s)", worker.Name, image.Ref, image.Digest)
+	return nil
+}
 
-	// Wait for completion
-	if err := session.Wait(); err != nil {
-		return fmt.Errorf("SCP session failed: %w", err)
+// ctrRunner returns a containerd.Runner that executes ctr on the worker over SSH
+func (d *Distributor) ctrRunner(worker *WorkerNode) containerd.Runner {
+	return func(args ...string) (string, error) {
+		command, err := d.ctrCommand(worker, strings.Join(args, " "))
+		if err != nil {
+			return "", err
+		}
+		return d.sshExec(worker, command)
 	}
+}
 
-	// Verify remote file size
-	checkCmd := fmt.Sprintf("stat -c%%s %s", remotePath)
-	output, err := d.sshExec(worker, checkCmd)
+// CleanupOnWorker removes tarball from worker's temp directory
+func (d *Distributor) CleanupOnWorker(worker *WorkerNode, tarballPath string) error {
+	cleanupCmd := fmt.Sprintf("rm -f %s", tarballPath)
+	_, err := d.sshExec(worker, cleanupCmd)
 	if err != nil {
-		return fmt.Errorf("cannot verify remote file: %w", err)
-	}
-
-	remoteSize, _ := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
-	if remoteSize != localSize {
-		return fmt.Errorf("size mismatch: local=%d remote=%d", localSize, remoteSize)
+		d.Logger.Warning("Failed to cleanup %s on %s: %v", tarballPath, worker.Name, err)
 	}
-
-	return nil
+	return err
 }
 
 // sshExec executes command on worker via SSH with timeout
@@ -425,9 +664,14 @@ func (d *Distributor) sshExecWithContext(ctx context.Context, worker *WorkerNode
 	}
 	defer session.Close()
 
-	// Run command with context timeout
+	return runSession(ctx, session, command, time.Duration(d.SSHConfig.Timeout)*time.Second)
+}
+
+// runSession runs command in session, killing it when ctx expires
+func runSession(ctx context.Context, session *ssh.Session, command string, timeout time.Duration) (string, error) {
 	done := make(chan error, 1)
 	var output []byte
+	var err error
 
 	go func() {
 		output, err = session.CombinedOutput(command)
@@ -437,7 +681,7 @@ func (d *Distributor) sshExecWithContext(ctx context.Context, worker *WorkerNode
 	select {
 	case <-ctx.Done():
 		session.Signal(ssh.SIGKILL)
-		return "", fmt.Errorf("command timeout after %ds", d.SSHConfig.Timeout)
+		return "", fmt.Errorf("command timeout after %s", timeout)
 	case err := <-done:
 		if err != nil {
 			return string(output), fmt.Errorf("command failed: %w: %s", err, string(output))
@@ -447,18 +691,21 @@ func (d *Distributor) sshExecWithContext(ctx context.Context, worker *WorkerNode
 }
 
 // importOnWorker imports tarball into containerd on worker
-func (d *Distributor) importOnWorker(worker *WorkerNode, tarballPath, imageName string) error {
+// Delta archives are OCI layouts that carry the image name in index.json annotations
+func (d *Distributor) importOnWorker(worker *WorkerNode, tarballPath, imageName string, ociLayout bool) error {
 	// Extract base name for --base-name flag
 	// Example: crepo.re-cloud.io/magnetiq/v2/backend:latest -> crepo.re-cloud.io/magnetiq/v2
 	parts := strings.Split(imageName, "/")
 	baseName := strings.Join(parts[:len(parts)-1], "/")
 
-	importCmd := fmt.Sprintf(
-		"sudo ctr -n %s images import --base-name %s %s",
-		constants.ContainerdNamespace,
-		baseName,
-		tarballPath,
-	)
+	if ociLayout {
+		baseName = ""
+	}
+	runtime, err := d.runtime(worker)
+	if err != nil {
+		return err
+	}
+	importCmd := d.sudo(worker) + strings.Join(runtime.ImportArgs(tarballPath, baseName), " ")
 
 	output, err := d.sshExec(worker, importCmd)
 	if err != nil {
@@ -483,9 +730,10 @@ func (d *Distributor) importOnWorker(worker *WorkerNode, tarballPath, imageName
 // getSSHClient creates SSH client connection to worker
 func (d *Distributor) getSSHClient(worker *WorkerNode) (*ssh.Client, error) {
 	// Read private key
-	key, err := os.ReadFile(d.SSHConfig.KeyPath)
+	keyPath := d.keyPath(worker)
+	key, err := os.ReadFile(keyPath)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read SSH key %s: %w", d.SSHConfig.KeyPath, err)
+		return nil, fmt.Errorf("cannot read SSH key %s: %w", keyPath, err)
 	}
 
 	// Parse private key
@@ -496,16 +744,16 @@ func (d *Distributor) getSSHClient(worker *WorkerNode) (*ssh.Client, error) {
 
 	// Configure SSH client
 	sshConfig := &ssh.ClientConfig{
-		User: d.SSHConfig.User,
+		User: d.user(worker),
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // TODO: Improve with proper host key verification
+		HostKeyCallback: d.pinHostKey, // TODO: Verify first contact against known_hosts
 		Timeout:         time.Duration(d.SSHConfig.Timeout) * time.Second,
 	}
 
 	// Connect to worker
-	addr := fmt.Sprintf("%s:%d", worker.IP, d.SSHConfig.Port)
+	addr := fmt.Sprintf("%s:%d", worker.IP, d.port(worker))
 	client, err := ssh.Dial("tcp", addr, sshConfig)
 	if err != nil {
 		return nil, fmt.Errorf("SSH dial failed: %w", err)
@@ -513,3 +761,27 @@ func (d *Distributor) getSSHClient(worker *WorkerNode) (*ssh.Client, error) {
 
 	return client, nil
 }
+
+// pinHostKey accepts a worker's host key on first contact and rejects another
+// key for the same address for the rest of the run. Fan-out peers check each
+// other against the pinned keys.
+func (d *Distributor) pinHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	d.hostKeysMu.Lock()
+	defer d.hostKeysMu.Unlock()
+
+	if d.hostKeys == nil {
+		d.hostKeys = make(map[string]ssh.PublicKey)
+	}
+	if pinned, ok := d.hostKeys[hostname]; ok && !bytes.Equal(pinned.Marshal(), key.Marshal()) {
+		return fmt.Errorf("host key of %s changed during the run", hostname)
+	}
+	d.hostKeys[hostname] = key
+	return nil
+}
+
+// pinnedHostKey returns the host key seen for addr ("host:port"), or nil
+func (d *Distributor) pinnedHostKey(addr string) ssh.PublicKey {
+	d.hostKeysMu.Lock()
+	defer d.hostKeysMu.Unlock()
+	return d.hostKeys[addr]
+}
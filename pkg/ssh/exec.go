@@ -0,0 +1,95 @@
+package ssh
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ExecResult is the outcome of an ad-hoc command or copy on one worker
+type ExecResult struct {
+	Worker   string `json:"worker"`
+	IP       string `json:"ip"`
+	ExitCode int    `json:"exitCode"` // -1 if the command did not run to completion
+	Output   string `json:"output"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ExecGroup is a set of workers that produced the same result
+type ExecGroup struct {
+	Workers  []string `json:"workers"`
+	ExitCode int      `json:"exitCode"`
+	Output   string   `json:"output"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Exec runs command on worker with the distributor's SSH settings
+func (d *Distributor) Exec(worker *WorkerNode, command string) *ExecResult {
+	result := &ExecResult{Worker: worker.Name, IP: worker.IP}
+
+	output, err := d.sshExec(worker, command)
+	result.Output = output
+	result.ExitCode = exitCode(err)
+	if err != nil && result.ExitCode < 0 {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Copy sends localPath to worker. A remotePath ending in "/" is a directory
+// the file is copied into under its local name.
+func (d *Distributor) Copy(worker *WorkerNode, localPath, remotePath string) *ExecResult {
+	result := &ExecResult{Worker: worker.Name, IP: worker.IP}
+
+	if strings.HasSuffix(remotePath, "/") {
+		remotePath = path.Join(remotePath, filepath.Base(localPath))
+	}
+	if _, err := d.transferToWorker(worker, filepath.Base(localPath), localPath, remotePath); err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+		return result
+	}
+	result.Output = remotePath
+	return result
+}
+
+// exitCode returns the remote exit status of a command error: 0 on success,
+// -1 if the command did not exit (connection failure, timeout, signal)
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && exitErr.Signal() == "" {
+		return exitErr.ExitStatus()
+	}
+	return -1
+}
+
+// GroupResults collapses workers with identical output, exit code and error,
+// largest group first
+func GroupResults(results []*ExecResult) []*ExecGroup {
+	var groups []*ExecGroup
+	byKey := make(map[string]*ExecGroup)
+
+	for _, result := range results {
+		key := strings.Join([]string{strconv.Itoa(result.ExitCode), result.Error, result.Output}, "\x00")
+		group, ok := byKey[key]
+		if !ok {
+			group = &ExecGroup{ExitCode: result.ExitCode, Output: result.Output, Error: result.Error}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.Workers = append(group.Workers, result.Worker)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Workers) > len(groups[j].Workers)
+	})
+	return groups
+}
@@ -0,0 +1,49 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	if code := exitCode(nil); code != 0 {
+		t.Errorf("exitCode(nil) = %d, want 0", code)
+	}
+	if code := exitCode(errors.New("dial tcp: connection refused")); code != -1 {
+		t.Errorf("exitCode(connection error) = %d, want -1", code)
+	}
+	if code := exitCode(fmt.Errorf("command timeout after %s", "30s")); code != -1 {
+		t.Errorf("exitCode(timeout) = %d, want -1", code)
+	}
+}
+
+func TestGroupResults(t *testing.T) {
+	results := []*ExecResult{
+		{Worker: "worker-1", Output: "ok\n"},
+		{Worker: "worker-2", ExitCode: 1, Output: "disk full\n"},
+		{Worker: "worker-3", Output: "ok\n"},
+		{Worker: "worker-4", ExitCode: -1, Error: "unreachable"},
+	}
+
+	groups := GroupResults(results)
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups, want 3", len(groups))
+	}
+	if !reflect.DeepEqual(groups[0].Workers, []string{"worker-1", "worker-3"}) || groups[0].Output != "ok\n" {
+		t.Errorf("first group = %+v", groups[0])
+	}
+	if !reflect.DeepEqual(groups[1].Workers, []string{"worker-2"}) || groups[1].ExitCode != 1 {
+		t.Errorf("second group = %+v", groups[1])
+	}
+	if groups[2].Error != "unreachable" {
+		t.Errorf("third group = %+v", groups[2])
+	}
+
+	// Same output with another exit code is a separate group
+	groups = GroupResults([]*ExecResult{{Worker: "a", Output: "x"}, {Worker: "b", ExitCode: 2, Output: "x"}})
+	if len(groups) != 2 {
+		t.Errorf("got %d groups, want 2", len(groups))
+	}
+}
@@ -0,0 +1,447 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/wapsol/m2deploy/pkg/constants"
+)
+
+// peerSource is a worker holding a verified tarball that it can forward
+type peerSource struct {
+	Worker *WorkerNode
+	Hop    int
+}
+
+// fanOutSteps are the transfers a fan-out schedules
+type fanOutSteps struct {
+	seed       func(workers []*WorkerNode) []*DistributionResult                     // From the controller, keeping the tarball to forward
+	direct     func(workers []*WorkerNode) []*DistributionResult                     // From the controller when no worker can forward
+	forward    func(src peerSource, target *WorkerNode) (*DistributionResult, error) // From a holding worker
+	fallback   func(target *WorkerNode) *DistributionResult                          // From the controller after a failed forward
+	canForward func(worker *WorkerNode) bool                                         // Whether a holder may act as a source
+}
+
+// fanOutAccess lets workers copy to each other during one fan-out without the
+// controller's key: an ephemeral key authorized on the receiving workers only
+// while the fan-out runs, and the host keys the controller saw, which the
+// sending workers check their peers against
+type fanOutAccess struct {
+	id         string // Comment tagging the authorized key
+	key        ed25519.PrivateKey
+	authorized string // authorized_keys line of the key
+
+	mu        sync.Mutex
+	receivers map[string]bool // Workers the key is authorized on
+	senders   map[string]bool // Workers holding the peers' known_hosts
+}
+
+// fanOutSeeds returns how many workers the controller seeds in fan-out mode
+func (d *Distributor) fanOutSeeds() int {
+	if d.FanOutSeeds > 0 {
+		return d.FanOutSeeds
+	}
+	if d.Parallel > 0 {
+		return d.Parallel
+	}
+	return 1
+}
+
+// distributeFanOut seeds a few workers from the controller and lets every
+// worker that holds the image forward it to one remaining worker at a time,
+// so the set of sources grows as the distribution proceeds. Workers a peer
+// cannot reach are served by the controller instead.
+func (d *Distributor) distributeFanOut(workers []*WorkerNode, tarballPath, component, imageName string) []*DistributionResult {
+	seeds := d.fanOutSeeds()
+	d.Logger.Info("Fan-out: seeding %d workers from controller, %d via peers", seeds, len(workers)-seeds)
+
+	access, err := newFanOutAccess(workers)
+	if err != nil {
+		d.Logger.Warning("Cannot set up peer access (%v), distributing directly from controller", err)
+		return d.distributeDirect(workers, component, func(w *WorkerNode) (*DistributionResult, error) {
+			return d.DistributeToWorker(w, tarballPath, component, imageName)
+		})
+	}
+	d.grantFanOutAccess(access, workers, workers[seeds:])
+	defer d.revokeFanOutAccess(access, workers, workers[seeds:])
+
+	results, holders := d.runFanOut(workers, seeds, fanOutSteps{
+		seed: func(ws []*WorkerNode) []*DistributionResult {
+			return d.distributeDirect(ws, component, func(w *WorkerNode) (*DistributionResult, error) {
+				return d.distributeToWorker(w, tarballPath, component, imageName, false, true)
+			})
+		},
+		direct: func(ws []*WorkerNode) []*DistributionResult {
+			return d.distributeDirect(ws, component, func(w *WorkerNode) (*DistributionResult, error) {
+				return d.DistributeToWorker(w, tarballPath, component, imageName)
+			})
+		},
+		forward: func(src peerSource, target *WorkerNode) (*DistributionResult, error) {
+			if !access.canReceive(target) {
+				return nil, fmt.Errorf("peer access to %s not set up", target.Name)
+			}
+			return d.forwardFromPeer(access, src, target, tarballPath, component, imageName)
+		},
+		fallback: func(target *WorkerNode) *DistributionResult {
+			return d.withRetries(target, component, func() (*DistributionResult, error) {
+				return d.distributeToWorker(target, tarballPath, component, imageName, false, true)
+			})
+		},
+		canForward: access.canSend,
+	})
+
+	// Forwarded tarballs are no longer needed once every worker is served
+	if !d.KeepTarballs {
+		for _, holder := range holders {
+			d.CleanupOnWorker(holder, filepath.Join(d.tempDir(holder), filepath.Base(tarballPath)))
+		}
+	}
+
+	d.logFanOutSummary(results)
+	return results
+}
+
+// runFanOut serves workers[:seeds] with steps.seed and every other worker
+// from a holder that can forward, one target per source at a time. It returns
+// the results in the order of workers and the workers left holding a tarball.
+func (d *Distributor) runFanOut(workers []*WorkerNode, seeds int, steps fanOutSteps) ([]*DistributionResult, []*WorkerNode) {
+	results := make([]*DistributionResult, len(workers))
+	seeded := steps.seed(workers[:seeds])
+	copy(results, seeded)
+
+	var holders []*WorkerNode
+	var holdersMu sync.Mutex
+	sources := make(chan peerSource, len(workers))
+	for _, result := range seeded {
+		if result.Success {
+			holders = append(holders, result.Worker)
+			if steps.canForward(result.Worker) {
+				sources <- peerSource{Worker: result.Worker, Hop: result.Hop}
+			}
+		}
+	}
+
+	if len(sources) == 0 {
+		d.Logger.Warning("No seed worker can forward the image, distributing directly from controller")
+		copy(results[seeds:], steps.direct(workers[seeds:]))
+		return results, holders
+	}
+
+	var wg sync.WaitGroup
+	for i := seeds; i < len(workers); i++ {
+		// Wait for a free source; each forwards to one worker at a time
+		src := <-sources
+
+		wg.Add(1)
+		go func(idx int, target *WorkerNode, src peerSource) {
+			defer wg.Done()
+
+			result, err := steps.forward(src, target)
+			sources <- src
+
+			if err != nil {
+				d.Logger.Warning("  [%s] Peer transfer from %s failed (%v), sending from controller", target.Name, src.Worker.Name, err)
+				result = steps.fallback(target)
+			}
+
+			if result.Success {
+				holdersMu.Lock()
+				holders = append(holders, target)
+				holdersMu.Unlock()
+				if steps.canForward(target) {
+					sources <- peerSource{Worker: target, Hop: result.Hop}
+				}
+			}
+			results[idx] = result
+		}(i, workers[i], src)
+	}
+	wg.Wait()
+
+	return results, holders
+}
+
+// newFanOutAccess creates an ephemeral key that workers may use to reach each other
+func newFanOutAccess(workers []*WorkerNode) (*fanOutAccess, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate key: %w", err)
+	}
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("cannot generate key id: %w", err)
+	}
+
+	access := &fanOutAccess{
+		id:        "m2deploy-fanout-" + hex.EncodeToString(id),
+		key:       private,
+		receivers: make(map[string]bool),
+		senders:   make(map[string]bool),
+	}
+	access.authorized = authorizedKeyLine(sshPublic, workers, access.id)
+	return access, nil
+}
+
+// authorizedKeyLine returns the authorized_keys line of key, usable only from
+// the workers' addresses and without forwarding or a terminal
+func authorizedKeyLine(key ssh.PublicKey, workers []*WorkerNode, comment string) string {
+	ips := make([]string, 0, len(workers))
+	for _, w := range workers {
+		ips = append(ips, w.IP)
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	return fmt.Sprintf(`restrict,from="%s" %s %s`, strings.Join(ips, ","), line, comment)
+}
+
+// knownHostsFile returns known_hosts content for the given host keys, keyed
+// by the "host:port" address the controller dialed
+func knownHostsFile(keys map[string]ssh.PublicKey) string {
+	addrs := make([]string, 0, len(keys))
+	for addr := range keys {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	var b strings.Builder
+	for _, addr := range addrs {
+		b.WriteString(knownhosts.Line([]string{knownhosts.Normalize(addr)}, keys[addr]))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// canReceive reports whether the fan-out key is authorized on worker
+func (a *fanOutAccess) canReceive(worker *WorkerNode) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.receivers[worker.Name]
+}
+
+// canSend reports whether worker can check the host keys of its peers
+func (a *fanOutAccess) canSend(worker *WorkerNode) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.senders[worker.Name]
+}
+
+// knownHostsPath returns where the peers' host keys are kept on worker
+func (d *Distributor) knownHostsPath(access *fanOutAccess, worker *WorkerNode) string {
+	return filepath.Join(d.tempDir(worker), access.id+".known_hosts")
+}
+
+// grantFanOutAccess authorizes the fan-out key on receivers and gives every
+// worker the host keys of the receivers. Workers where this fails are served
+// by the controller or do not forward.
+func (d *Distributor) grantFanOutAccess(access *fanOutAccess, workers, receivers []*WorkerNode) {
+	// Connecting to the receivers also pins their host keys
+	authorize := fmt.Sprintf("umask 077 && mkdir -p ~/.ssh && printf '%%s\\n' '%s' >> ~/.ssh/authorized_keys", access.authorized)
+	d.onWorkers(receivers, func(w *WorkerNode) {
+		if _, err := d.sshExec(w, authorize); err != nil {
+			d.Logger.Warning("  [%s] Cannot authorize peer key (%v), the controller serves it", w.Name, err)
+			return
+		}
+		access.mu.Lock()
+		access.receivers[w.Name] = true
+		access.mu.Unlock()
+	})
+
+	keys := make(map[string]ssh.PublicKey)
+	for _, w := range receivers {
+		addr := fmt.Sprintf("%s:%d", w.IP, d.port(w))
+		if key := d.pinnedHostKey(addr); key != nil && access.canReceive(w) {
+			keys[addr] = key
+		}
+	}
+	knownHosts := knownHostsFile(keys)
+
+	d.onWorkers(workers, func(w *WorkerNode) {
+		path := d.knownHostsPath(access, w)
+		write := fmt.Sprintf("mkdir -p %s && cat > %s <<'EOF'\n%sEOF", d.tempDir(w), path, knownHosts)
+		if _, err := d.sshExec(w, write); err != nil {
+			d.Logger.Warning("  [%s] Cannot install peer host keys (%v), it will not forward", w.Name, err)
+			return
+		}
+		access.mu.Lock()
+		access.senders[w.Name] = true
+		access.mu.Unlock()
+	})
+}
+
+// revokeFanOutAccess removes the fan-out key and the peers' host keys again
+func (d *Distributor) revokeFanOutAccess(access *fanOutAccess, workers, receivers []*WorkerNode) {
+	revoke := fmt.Sprintf("sed -i '/ %s$/d' ~/.ssh/authorized_keys", access.id)
+	d.onWorkers(receivers, func(w *WorkerNode) {
+		if !access.canReceive(w) {
+			return
+		}
+		if _, err := d.sshExec(w, revoke); err != nil {
+			d.Logger.Warning("  [%s] Failed to remove peer key %s: %v", w.Name, access.id, err)
+		}
+	})
+	d.onWorkers(workers, func(w *WorkerNode) {
+		if access.canSend(w) {
+			d.CleanupOnWorker(w, d.knownHostsPath(access, w))
+		}
+	})
+}
+
+// onWorkers runs fn for every worker concurrently, within the distribution budget
+func (d *Distributor) onWorkers(workers []*WorkerNode, fn func(w *WorkerNode)) {
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(w *WorkerNode) {
+			defer wg.Done()
+			release := d.acquire(w)
+			defer release()
+			fn(w)
+		}(worker)
+	}
+	wg.Wait()
+}
+
+// forwardFromPeer has src copy its tarball to target, then imports and verifies it there
+func (d *Distributor) forwardFromPeer(access *fanOutAccess, src peerSource, target *WorkerNode, tarballPath, component, imageName string) (*DistributionResult, error) {
+	startTime := time.Now()
+	result := &DistributionResult{
+		Worker:      target,
+		Component:   component,
+		Compression: CompressionNone,
+		Source:      src.Worker.Name,
+		Hop:         src.Hop + 1,
+	}
+
+	fail := func(err error) (*DistributionResult, error) {
+		result.Success = false
+		result.Duration = time.Since(startTime)
+		result.Error = err
+		return result, err
+	}
+
+	info, err := os.Stat(tarballPath)
+	if err != nil {
+		return fail(fmt.Errorf("cannot stat tarball: %w", err))
+	}
+	result.OriginalBytes = info.Size()
+
+	sourceTarball := filepath.Join(d.tempDir(src.Worker), filepath.Base(tarballPath))
+	remoteTarball := filepath.Join(d.tempDir(target), filepath.Base(tarballPath))
+
+	d.Logger.Info("  [%s] Receiving tarball from %s (hop %d, %.1f MB)...",
+		target.Name, src.Worker.Name, result.Hop, float64(info.Size())/1024/1024)
+
+	// The source authenticates with the fan-out key through a forwarded agent
+	// and checks target's host key against the one the controller pinned
+	transferStart := time.Now()
+	scpCmd := fmt.Sprintf(
+		"scp -q -o BatchMode=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=%s -o ConnectTimeout=%d -P %d %s %s@%s:%s",
+		d.knownHostsPath(access, src.Worker), d.SSHConfig.Timeout, d.port(target), sourceTarball, d.user(target), target.IP, remoteTarball,
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), constants.PeerTransferTimeout)
+	defer cancel()
+	if _, err := d.sshExecForwardingAgent(ctx, src.Worker, access.key, scpCmd, constants.PeerTransferTimeout); err != nil {
+		return fail(fmt.Errorf("peer copy failed: %w", err))
+	}
+	result.BytesTransferred = info.Size()
+
+	// Compare against the controller's tarball, not the source's copy
+	if err := d.verifyRemoteChecksum(target, tarballPath, remoteTarball); err != nil {
+		d.CleanupOnWorker(target, remoteTarball)
+		return fail(err)
+	}
+	result.TransferDuration = time.Since(transferStart)
+
+	d.Logger.Info("  [%s] Importing into containerd...", target.Name)
+	if err := d.importOnWorker(target, remoteTarball, imageName, false); err != nil {
+		d.dropForwarded(target, remoteTarball)
+		return fail(fmt.Errorf("import failed: %w", err))
+	}
+
+	if err := d.VerifyImportOnWorker(target, imageName); err != nil {
+		d.dropForwarded(target, remoteTarball)
+		return fail(fmt.Errorf("verification failed: %w", err))
+	}
+
+	result.Success = true
+	result.Duration = time.Since(startTime)
+	d.Logger.Success("  [%s] Completed in %s (from %s)", target.Name, result.Duration, src.Worker.Name)
+
+	return result, nil
+}
+
+// dropForwarded removes a forwarded tarball from a target that failed; only
+// targets that succeed become holders whose tarballs are removed at the end
+func (d *Distributor) dropForwarded(target *WorkerNode, remoteTarball string) {
+	if !d.KeepTarballs {
+		d.CleanupOnWorker(target, remoteTarball)
+	}
+}
+
+// sshExecForwardingAgent executes command on worker with key available
+// through a forwarded SSH agent
+func (d *Distributor) sshExecForwardingAgent(ctx context.Context, worker *WorkerNode, key ed25519.PrivateKey, command string, timeout time.Duration) (string, error) {
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		return "", fmt.Errorf("cannot load SSH key into agent: %w", err)
+	}
+
+	client, err := d.getSSHClient(worker)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	if err := agent.ForwardToAgent(client, keyring); err != nil {
+		return "", fmt.Errorf("cannot forward SSH agent: %w", err)
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("cannot create session: %w", err)
+	}
+	defer session.Close()
+
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		return "", fmt.Errorf("agent forwarding refused by %s: %w", worker.Name, err)
+	}
+
+	return runSession(ctx, session, command, timeout)
+}
+
+// logFanOutSummary logs how many workers were served by the controller and by peers
+func (d *Distributor) logFanOutSummary(results []*DistributionResult) {
+	fromController, fromPeers, maxHop := 0, 0, 0
+	for _, result := range results {
+		if result == nil || !result.Success {
+			continue
+		}
+		if result.Source == "" {
+			fromController++
+		} else {
+			fromPeers++
+		}
+		if result.Hop > maxHop {
+			maxHop = result.Hop
+		}
+	}
+
+	d.Logger.Info("  Fan-out: %d workers served by controller, %d by peers (max hops: %d)",
+		fromController, fromPeers, maxHop)
+}
@@ -0,0 +1,195 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+)
+
+func TestFanOutSeeds(t *testing.T) {
+	tests := []struct {
+		name        string
+		parallel    int
+		fanOutSeeds int
+		want        int
+	}{
+		{name: "defaults to parallel", parallel: 3, want: 3},
+		{name: "explicit seeds", parallel: 3, fanOutSeeds: 2, want: 2},
+		{name: "at least one seed", parallel: 0, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Distributor{Parallel: tt.parallel, FanOutSeeds: tt.fanOutSeeds}
+			if got := d.fanOutSeeds(); got != tt.want {
+				t.Errorf("fanOutSeeds() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeFanOut records which transfers a fan-out schedules
+type fakeFanOut struct {
+	mu          sync.Mutex
+	failSeed    bool
+	failForward map[string]bool // Targets peers cannot reach
+	noSender    map[string]bool // Holders without the peers' host keys
+	forwarded   map[string]string
+	fellBack    []string
+	direct      []string
+}
+
+func (f *fakeFanOut) steps() fanOutSteps {
+	served := func(w *WorkerNode, source string, hop int) *DistributionResult {
+		return &DistributionResult{Worker: w, Success: true, Source: source, Hop: hop}
+	}
+	return fanOutSteps{
+		seed: func(workers []*WorkerNode) []*DistributionResult {
+			var results []*DistributionResult
+			for _, w := range workers {
+				results = append(results, &DistributionResult{Worker: w, Success: !f.failSeed, Hop: 1})
+			}
+			return results
+		},
+		direct: func(workers []*WorkerNode) []*DistributionResult {
+			var results []*DistributionResult
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			for _, w := range workers {
+				f.direct = append(f.direct, w.Name)
+				results = append(results, served(w, "", 1))
+			}
+			return results
+		},
+		forward: func(src peerSource, target *WorkerNode) (*DistributionResult, error) {
+			if f.failForward[target.Name] {
+				return nil, fmt.Errorf("host key mismatch")
+			}
+			f.mu.Lock()
+			f.forwarded[target.Name] = src.Worker.Name
+			f.mu.Unlock()
+			return served(target, src.Worker.Name, src.Hop+1), nil
+		},
+		fallback: func(target *WorkerNode) *DistributionResult {
+			f.mu.Lock()
+			f.fellBack = append(f.fellBack, target.Name)
+			f.mu.Unlock()
+			return served(target, "", 1)
+		},
+		canForward: func(w *WorkerNode) bool { return !f.noSender[w.Name] },
+	}
+}
+
+func fanOutWorkers(n int) []*WorkerNode {
+	workers := make([]*WorkerNode, n)
+	for i := range workers {
+		workers[i] = &WorkerNode{Name: fmt.Sprintf("worker-%d", i+1), IP: fmt.Sprintf("10.0.0.%d", i+1)}
+	}
+	return workers
+}
+
+func quietDistributor() *Distributor {
+	logger := config.NewLogger(false)
+	logger.Stdout, logger.Stderr = io.Discard, io.Discard
+	return &Distributor{Logger: logger}
+}
+
+func TestRunFanOut(t *testing.T) {
+	f := &fakeFanOut{forwarded: map[string]string{}}
+	workers := fanOutWorkers(6)
+
+	results, holders := quietDistributor().runFanOut(workers, 1, f.steps())
+	for i, result := range results {
+		if result == nil || !result.Success || result.Worker != workers[i] {
+			t.Fatalf("results[%d] = %+v, want success for %s", i, result, workers[i].Name)
+		}
+	}
+	if len(f.forwarded) != 5 || len(f.fellBack) != 0 || len(f.direct) != 0 {
+		t.Errorf("forwarded %v, fell back %v, direct %v; want all 5 via peers", f.forwarded, f.fellBack, f.direct)
+	}
+	if len(holders) != 6 {
+		t.Errorf("holders = %d, want 6", len(holders))
+	}
+}
+
+func TestRunFanOutPeerFailure(t *testing.T) {
+	f := &fakeFanOut{
+		forwarded:   map[string]string{},
+		failForward: map[string]bool{"worker-3": true},
+		noSender:    map[string]bool{"worker-2": true},
+	}
+	workers := fanOutWorkers(4)
+
+	results, _ := quietDistributor().runFanOut(workers, 1, f.steps())
+	if len(f.fellBack) != 1 || f.fellBack[0] != "worker-3" {
+		t.Errorf("fell back for %v, want worker-3", f.fellBack)
+	}
+	if results[2].Source != "" || !results[2].Success {
+		t.Errorf("worker-3 result = %+v, want served by the controller", results[2])
+	}
+	for target, source := range f.forwarded {
+		if source == "worker-2" {
+			t.Errorf("%s received from worker-2, which cannot check host keys", target)
+		}
+	}
+}
+
+func TestRunFanOutNoSeed(t *testing.T) {
+	f := &fakeFanOut{forwarded: map[string]string{}, failSeed: true}
+
+	results, holders := quietDistributor().runFanOut(fanOutWorkers(3), 1, f.steps())
+	if len(f.direct) != 2 || len(f.forwarded) != 0 {
+		t.Errorf("direct %v, forwarded %v; want the rest from the controller", f.direct, f.forwarded)
+	}
+	if results[0].Success || !results[1].Success || !results[2].Success || len(holders) != 0 {
+		t.Errorf("results = %+v, holders = %v", results, holders)
+	}
+}
+
+func TestFanOutAccess(t *testing.T) {
+	workers := fanOutWorkers(2)
+	access, err := newFanOutAccess(workers)
+	if err != nil {
+		t.Fatalf("newFanOutAccess() error = %v", err)
+	}
+
+	if !strings.HasPrefix(access.authorized, `restrict,from="10.0.0.1,10.0.0.2" ssh-ed25519 `) ||
+		!strings.HasSuffix(access.authorized, " "+access.id) {
+		t.Errorf("authorized line = %s", access.authorized)
+	}
+
+	public, _ := ssh.NewPublicKey(access.key.Public().(ed25519.PublicKey))
+	known := knownHostsFile(map[string]ssh.PublicKey{"10.0.0.1:22": public, "10.0.0.2:2222": public})
+	lines := strings.Split(strings.TrimSpace(known), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "10.0.0.1 ssh-ed25519 ") || !strings.HasPrefix(lines[1], "[10.0.0.2]:2222 ssh-ed25519 ") {
+		t.Errorf("known_hosts =\n%s", known)
+	}
+}
+
+func TestPinHostKey(t *testing.T) {
+	d := &Distributor{}
+	_, first, _ := ed25519.GenerateKey(nil)
+	_, second, _ := ed25519.GenerateKey(nil)
+	firstKey, _ := ssh.NewPublicKey(first.Public())
+	secondKey, _ := ssh.NewPublicKey(second.Public())
+
+	if err := d.pinHostKey("10.0.0.1:22", nil, firstKey); err != nil {
+		t.Fatalf("pinHostKey() first contact = %v", err)
+	}
+	if err := d.pinHostKey("10.0.0.1:22", nil, firstKey); err != nil {
+		t.Errorf("pinHostKey() same key = %v", err)
+	}
+	if err := d.pinHostKey("10.0.0.1:22", nil, secondKey); err == nil {
+		t.Error("pinHostKey() accepted a changed host key")
+	}
+	if d.pinnedHostKey("10.0.0.1:22") == nil {
+		t.Error("pinnedHostKey() = nil after first contact")
+	}
+}
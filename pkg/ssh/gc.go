@@ -0,0 +1,31 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wapsol/m2deploy/pkg/containerd"
+)
+
+// ListReleaseImages lists the worker's images from the given repositories
+func (d *Distributor) ListReleaseImages(worker *WorkerNode, repositories []string) ([]containerd.ReleaseImage, error) {
+	return containerd.ListReleaseImages(d.ctrRunner(worker), repositories)
+}
+
+// RemoveImages removes image references from the worker's containerd and
+// waits for the freed content to be garbage-collected
+func (d *Distributor) RemoveImages(worker *WorkerNode, refs []string) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	command, err := d.ctrCommand(worker, "images rm --sync "+strings.Join(refs, " "))
+	if err != nil {
+		return fmt.Errorf("failed to remove images on %s: %w", worker.Name, err)
+	}
+	output, err := d.sshExec(worker, command)
+	if err != nil {
+		return fmt.Errorf("failed to remove images on %s: %w: %s", worker.Name, err, strings.TrimSpace(output))
+	}
+	return nil
+}
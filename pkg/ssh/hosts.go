@@ -0,0 +1,112 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/containerd"
+)
+
+// user returns the SSH user for worker
+func (d *Distributor) user(worker *WorkerNode) string {
+	if worker.User != "" {
+		return worker.User
+	}
+	return d.SSHConfig.User
+}
+
+// port returns the SSH port for worker
+func (d *Distributor) port(worker *WorkerNode) int {
+	if worker.Port != 0 {
+		return worker.Port
+	}
+	return d.SSHConfig.Port
+}
+
+// keyPath returns the SSH private key used for worker
+func (d *Distributor) keyPath(worker *WorkerNode) string {
+	if worker.KeyPath != "" {
+		return worker.KeyPath
+	}
+	return d.SSHConfig.KeyPath
+}
+
+// tempDir returns the directory tarballs are copied to on worker
+func (d *Distributor) tempDir(worker *WorkerNode) string {
+	if worker.TempDir != "" {
+		return worker.TempDir
+	}
+	return d.SSHConfig.WorkerTempDir
+}
+
+// ctrCommand builds a ctr command line for worker's containerd namespace
+func (d *Distributor) ctrCommand(worker *WorkerNode, args string) (string, error) {
+	runtime, err := d.runtime(worker)
+	if err != nil {
+		return "", err
+	}
+	return d.sudo(worker) + strings.Join(runtime.CtrArgs(args), " "), nil
+}
+
+// sudo returns the prefix running runtime commands as root on worker
+func (d *Distributor) sudo(worker *WorkerNode) string {
+	if worker.NoSudo {
+		return ""
+	}
+	return "sudo "
+}
+
+// runtime returns the container runtime of worker from the inventory or
+// --runtime, detected over SSH on first use when set to auto. Detection
+// failures are errors: guessing could import into another containerd than
+// the kubelet's, such as Docker's. Only with an explicit socket is plain ctr
+// used on it instead.
+func (d *Distributor) runtime(worker *WorkerNode) (*containerd.Runtime, error) {
+	d.runtimesMu.Lock()
+	runtime, ok := d.runtimes[worker.Name]
+	d.runtimesMu.Unlock()
+	if ok {
+		return runtime, nil
+	}
+
+	kind := worker.Runtime
+	if kind == "" {
+		kind = d.Runtime
+	}
+	if kind == "" {
+		kind = containerd.RuntimeAuto
+	}
+	socket := worker.Socket
+	if socket == "" {
+		socket = d.Socket
+	}
+
+	runtime, err := containerd.Resolve(kind, socket, namespace(worker), func() (string, error) {
+		return d.sshExec(worker, containerd.DetectScript)
+	})
+	if err != nil && socket == "" {
+		return nil, fmt.Errorf("%w; pass --runtime or --containerd-socket", err)
+	}
+	if err != nil {
+		d.Logger.Warning("  [%s] %v, using ctr on %s", worker.Name, err, socket)
+		runtime = &containerd.Runtime{Kind: containerd.RuntimeCtr, Socket: socket, Namespace: namespace(worker)}
+	}
+
+	d.runtimesMu.Lock()
+	if d.runtimes == nil {
+		d.runtimes = make(map[string]*containerd.Runtime)
+	}
+	d.runtimes[worker.Name] = runtime
+	d.runtimesMu.Unlock()
+	d.Logger.Debug("  [%s] container runtime: %s", worker.Name, runtime)
+	return runtime, nil
+}
+
+// namespace returns the containerd namespace images are imported into on worker
+func namespace(worker *WorkerNode) string {
+	if worker.Namespace != "" {
+		return worker.Namespace
+	}
+	return constants.ContainerdNamespace
+}
@@ -0,0 +1,498 @@
+package ssh
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/constants"
+)
+
+// OCI media types used when assembling delta archives
+const (
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeOCILayer    = "application/vnd.oci.image.layer.v1.tar"
+)
+
+// blobRef describes a blob stored inside a docker-save tarball
+type blobRef struct {
+	Path   string // Path of the member inside the tarball
+	Digest string // sha256:<hex>
+	Size   int64
+}
+
+// imageLayout is the parsed content of a docker-save tarball
+type imageLayout struct {
+	Config blobRef
+	Layers []blobRef
+}
+
+// TotalLayerSize returns the combined size of all layers
+func (l *imageLayout) TotalLayerSize() int64 {
+	var total int64
+	for _, layer := range l.Layers {
+		total += layer.Size
+	}
+	return total
+}
+
+// deltaPlan describes which blobs a worker is missing for an image
+type deltaPlan struct {
+	Layout  *imageLayout
+	Missing []blobRef // Layers not present in the worker's content store
+	Reused  int       // Layers already present on the worker
+	Pinned  []string  // Digests of the present layers, pinned until the import
+}
+
+// MissingSize returns the combined size of the layers that must be sent
+func (p *deltaPlan) MissingSize() int64 {
+	var total int64
+	for _, layer := range p.Missing {
+		total += layer.Size
+	}
+	return total
+}
+
+// deltaKeyLength is the length of a delta archive's key in its file name
+const deltaKeyLength = 12
+
+// key returns a stable identifier for the set of missing layers
+func (p *deltaPlan) key() string {
+	digests := make([]string, len(p.Missing))
+	for i, layer := range p.Missing {
+		digests[i] = layer.Digest
+	}
+	sort.Strings(digests)
+	sum := sha256.Sum256([]byte(strings.Join(digests, ",")))
+	return hex.EncodeToString(sum[:])[:deltaKeyLength]
+}
+
+// dockerSaveManifest is an entry of manifest.json in a docker-save tarball
+type dockerSaveManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// readImageLayout hashes every member of a docker-save tarball and resolves
+// the config and layer digests referenced by manifest.json.
+// Works with both the legacy (<id>/layer.tar) and OCI (blobs/sha256/...) save formats.
+func readImageLayout(tarballPath string) (*imageLayout, error) {
+	file, err := os.Open(tarballPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open tarball: %w", err)
+	}
+	defer file.Close()
+
+	members := map[string]blobRef{}
+	symlinks := map[string]string{}
+	var manifestData []byte
+
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read tarball: %w", err)
+		}
+
+		name := path.Clean(header.Name)
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			// Legacy format deduplicates identical layers with relative symlinks
+			symlinks[name] = path.Join(path.Dir(name), header.Linkname)
+		case tar.TypeReg:
+			if name == "manifest.json" {
+				manifestData, err = io.ReadAll(reader)
+				if err != nil {
+					return nil, fmt.Errorf("cannot read manifest.json: %w", err)
+				}
+				continue
+			}
+
+			hasher := sha256.New()
+			size, err := io.Copy(hasher, reader)
+			if err != nil {
+				return nil, fmt.Errorf("cannot hash %s: %w", name, err)
+			}
+			members[name] = blobRef{
+				Path:   name,
+				Digest: "sha256:" + hex.EncodeToString(hasher.Sum(nil)),
+				Size:   size,
+			}
+		}
+	}
+
+	if manifestData == nil {
+		return nil, fmt.Errorf("manifest.json not found in tarball")
+	}
+
+	var manifests []dockerSaveManifest
+	if err := json.Unmarshal(manifestData, &manifests); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest.json: %w", err)
+	}
+	if len(manifests) != 1 {
+		return nil, fmt.Errorf("expected exactly one image in tarball, found %d", len(manifests))
+	}
+
+	resolve := func(name string) (blobRef, error) {
+		name = path.Clean(name)
+		for i := 0; i < 10; i++ {
+			if ref, ok := members[name]; ok {
+				return ref, nil
+			}
+			target, ok := symlinks[name]
+			if !ok {
+				break
+			}
+			name = target
+		}
+		return blobRef{}, fmt.Errorf("%s referenced by manifest.json not found in tarball", name)
+	}
+
+	layout := &imageLayout{}
+	if layout.Config, err = resolve(manifests[0].Config); err != nil {
+		return nil, err
+	}
+	for _, layerPath := range manifests[0].Layers {
+		layer, err := resolve(layerPath)
+		if err != nil {
+			return nil, err
+		}
+		layout.Layers = append(layout.Layers, layer)
+	}
+
+	return layout, nil
+}
+
+// planDelta compares an image's layers with the blobs in a set of present digests
+func planDelta(layout *imageLayout, present map[string]bool) *deltaPlan {
+	plan := &deltaPlan{Layout: layout}
+	seen := map[string]bool{}
+	for _, layer := range layout.Layers {
+		if present[layer.Digest] {
+			plan.Reused++
+			if !seen[layer.Digest] {
+				plan.Pinned = append(plan.Pinned, layer.Digest)
+			}
+			seen[layer.Digest] = true
+			continue
+		}
+		if seen[layer.Digest] {
+			continue
+		}
+		seen[layer.Digest] = true
+		plan.Missing = append(plan.Missing, layer)
+	}
+	return plan
+}
+
+// gcRootLabel marks content as a root of containerd's garbage collection
+const gcRootLabel = "containerd.io/gc.root"
+
+// parseContentList parses one digest per line into a digest set
+func parseContentList(output string) map[string]bool {
+	present := map[string]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		digest := strings.TrimSpace(line)
+		if strings.HasPrefix(digest, "sha256:") {
+			present[digest] = true
+		}
+	}
+	return present
+}
+
+// pinLayers labels the layers of layout held in worker's content store as
+// garbage collection roots, so containerd cannot remove them before the delta
+// import references them. Labeling fails for blobs the store lacks, so the
+// pinned digests are also the layers the worker has.
+func (d *Distributor) pinLayers(worker *WorkerNode, layout *imageLayout) (map[string]bool, error) {
+	root := gcRootLabel + "=" + time.Now().UTC().Format(time.RFC3339)
+	var commands []string
+	seen := map[string]bool{}
+	for _, layer := range layout.Layers {
+		if seen[layer.Digest] {
+			continue
+		}
+		seen[layer.Digest] = true
+		label, err := d.ctrCommand(worker, "content label "+layer.Digest+" "+root)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, fmt.Sprintf("%s >/dev/null 2>&1 && echo %s", label, layer.Digest))
+	}
+	commands = append(commands, "true")
+
+	output, err := d.sshExec(worker, strings.Join(commands, "; "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pin layers in content store: %w", err)
+	}
+	return parseContentList(output), nil
+}
+
+// unpinLayers removes the garbage collection root label set by pinLayers
+func (d *Distributor) unpinLayers(worker *WorkerNode, plan *deltaPlan) {
+	if len(plan.Pinned) == 0 {
+		return
+	}
+	var commands []string
+	for _, digest := range plan.Pinned {
+		unlabel, err := d.ctrCommand(worker, "content label "+digest+" "+gcRootLabel+"=")
+		if err != nil {
+			d.Logger.Warning("  [%s] Failed to unpin %d layers: %v", worker.Name, len(plan.Pinned), err)
+			return
+		}
+		commands = append(commands, unlabel)
+	}
+	if _, err := d.sshExec(worker, strings.Join(commands, "; ")); err != nil {
+		d.Logger.Warning("  [%s] Failed to unpin %d layers: %v", worker.Name, len(plan.Pinned), err)
+	}
+}
+
+// deltaForWorker plans a delta transfer for a worker and writes the archive to send.
+// The layers the worker holds stay pinned until unpinLayers. Returns an empty
+// path when the worker holds none of the layers.
+func (d *Distributor) deltaForWorker(worker *WorkerNode, tarballPath, imageName string) (string, *deltaPlan, error) {
+	layout, err := d.imageLayoutFor(tarballPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot read image layers: %w", err)
+	}
+
+	present, err := d.pinLayers(worker, layout)
+	if err != nil {
+		return "", nil, err
+	}
+
+	plan := planDelta(layout, present)
+	if plan.Reused == 0 {
+		return "", plan, nil
+	}
+
+	deltaPath, err := d.prepareDeltaArchive(tarballPath, imageName, plan)
+	if err != nil {
+		d.unpinLayers(worker, plan)
+		return "", nil, fmt.Errorf("cannot build delta archive: %w", err)
+	}
+	return deltaPath, plan, nil
+}
+
+// layoutCall is a tarball being read; others needing its layout wait on done
+type layoutCall struct {
+	done   chan struct{}
+	layout *imageLayout
+	err    error
+}
+
+// imageLayoutFor returns the parsed layout of a tarball, hashing it only once.
+// Reading runs without artifactsMu held; callers wanting the same layout wait for the first.
+func (d *Distributor) imageLayoutFor(tarballPath string) (*imageLayout, error) {
+	d.artifactsMu.Lock()
+	if layout, ok := d.layouts[tarballPath]; ok {
+		d.artifactsMu.Unlock()
+		return layout, nil
+	}
+	if call, ok := d.reading[tarballPath]; ok {
+		d.artifactsMu.Unlock()
+		<-call.done
+		return call.layout, call.err
+	}
+	call := &layoutCall{done: make(chan struct{})}
+	if d.reading == nil {
+		d.reading = make(map[string]*layoutCall)
+	}
+	d.reading[tarballPath] = call
+	d.artifactsMu.Unlock()
+
+	d.Logger.Debug("Reading layer digests from %s", tarballPath)
+	call.layout, call.err = readImageLayout(tarballPath)
+
+	d.artifactsMu.Lock()
+	delete(d.reading, tarballPath)
+	if call.err == nil {
+		if d.layouts == nil {
+			d.layouts = make(map[string]*imageLayout)
+		}
+		d.layouts[tarballPath] = call.layout
+	}
+	d.artifactsMu.Unlock()
+	close(call.done)
+
+	return call.layout, call.err
+}
+
+// prepareDeltaArchive writes an OCI-layout archive holding the manifest, config and
+// the layers from the plan. Archives are cached per set of missing layers.
+func (d *Distributor) prepareDeltaArchive(tarballPath, imageName string, plan *deltaPlan) (string, error) {
+	deltaPath := fmt.Sprintf("%s.delta-%s.tar", strings.TrimSuffix(tarballPath, ".tar"), plan.key())
+	_, err := d.sharedArtifact(deltaPath+"|"+CompressionNone, func() (*transferArtifact, error) {
+		if err := writeDeltaArchive(tarballPath, deltaPath, imageName, plan); err != nil {
+			os.Remove(deltaPath)
+			return nil, err
+		}
+
+		info, err := os.Stat(deltaPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot stat delta archive: %w", err)
+		}
+		return &transferArtifact{
+			Path:         deltaPath,
+			Compression:  CompressionNone,
+			Size:         info.Size(),
+			OriginalSize: info.Size(),
+			Temporary:    true,
+		}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return deltaPath, nil
+}
+
+// writeDeltaArchive copies the needed blobs out of a docker-save tarball into an OCI layout
+func writeDeltaArchive(tarballPath, deltaPath, imageName string, plan *deltaPlan) error {
+	// Blobs to copy from the source tarball, keyed by member path
+	needed := map[string]blobRef{plan.Layout.Config.Path: plan.Layout.Config}
+	for _, layer := range plan.Missing {
+		needed[layer.Path] = layer
+	}
+
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeOCIManifest,
+		"config": map[string]interface{}{
+			"mediaType": mediaTypeOCIConfig,
+			"digest":    plan.Layout.Config.Digest,
+			"size":      plan.Layout.Config.Size,
+		},
+		"layers": ociLayerDescriptors(plan.Layout.Layers),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot encode manifest: %w", err)
+	}
+	manifestSum := sha256.Sum256(manifest)
+	manifestDigest := "sha256:" + hex.EncodeToString(manifestSum[:])
+
+	index, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeOCIIndex,
+		"manifests": []map[string]interface{}{{
+			"mediaType": mediaTypeOCIManifest,
+			"digest":    manifestDigest,
+			"size":      len(manifest),
+			"annotations": map[string]string{
+				"io.containerd.image.name":          imageName,
+				"org.opencontainers.image.ref.name": imageTag(imageName),
+			},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot encode index: %w", err)
+	}
+
+	source, err := os.Open(tarballPath)
+	if err != nil {
+		return fmt.Errorf("cannot open tarball: %w", err)
+	}
+	defer source.Close()
+
+	out, err := os.Create(deltaPath)
+	if err != nil {
+		return fmt.Errorf("cannot create delta archive: %w", err)
+	}
+	defer out.Close()
+
+	writer := tar.NewWriter(out)
+
+	writeFile := func(name string, data []byte) error {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err := writer.Write(data)
+		return err
+	}
+
+	if err := writeFile("oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)); err != nil {
+		return fmt.Errorf("cannot write oci-layout: %w", err)
+	}
+	if err := writeFile("index.json", index); err != nil {
+		return fmt.Errorf("cannot write index.json: %w", err)
+	}
+	if err := writeFile(blobPath(manifestDigest), manifest); err != nil {
+		return fmt.Errorf("cannot write manifest blob: %w", err)
+	}
+
+	written := map[string]bool{}
+	reader := tar.NewReader(source)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read tarball: %w", err)
+		}
+
+		ref, ok := needed[path.Clean(header.Name)]
+		if !ok || header.Typeflag != tar.TypeReg || written[ref.Digest] {
+			continue
+		}
+
+		if err := writer.WriteHeader(&tar.Header{Name: blobPath(ref.Digest), Mode: 0644, Size: ref.Size, Typeflag: tar.TypeReg}); err != nil {
+			return fmt.Errorf("cannot write blob header: %w", err)
+		}
+		if _, err := io.Copy(writer, reader); err != nil {
+			return fmt.Errorf("cannot copy blob %s: %w", ref.Digest, err)
+		}
+		written[ref.Digest] = true
+	}
+
+	for _, ref := range needed {
+		if !written[ref.Digest] {
+			return fmt.Errorf("blob %s (%s) not found while writing delta archive", ref.Digest, ref.Path)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("cannot finalize delta archive: %w", err)
+	}
+	return nil
+}
+
+// ociLayerDescriptors converts layers to OCI manifest descriptors
+func ociLayerDescriptors(layers []blobRef) []map[string]interface{} {
+	descriptors := make([]map[string]interface{}, len(layers))
+	for i, layer := range layers {
+		descriptors[i] = map[string]interface{}{
+			"mediaType": mediaTypeOCILayer,
+			"digest":    layer.Digest,
+			"size":      layer.Size,
+		}
+	}
+	return descriptors
+}
+
+// blobPath returns the OCI layout path for a digest
+func blobPath(digest string) string {
+	return path.Join("blobs", strings.Replace(digest, ":", "/", 1))
+}
+
+// imageTag returns the tag portion of an image reference (defaults to latest)
+func imageTag(imageName string) string {
+	lastSlash := strings.LastIndex(imageName, "/")
+	if idx := strings.LastIndex(imageName, ":"); idx > lastSlash {
+		return imageName[idx+1:]
+	}
+	return constants.DefaultTag
+}
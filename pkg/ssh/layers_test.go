@@ -0,0 +1,188 @@
+package ssh
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// writeTestTarball writes a legacy-format docker-save tarball with two layers,
+// the second one stored as a symlink to a third directory
+func writeTestTarball(t *testing.T, dir string) (string, map[string]string) {
+	t.Helper()
+
+	files := map[string]string{
+		"cfg123.json":   `{"architecture":"amd64","os":"linux"}`,
+		"aaa/layer.tar": "base layer content",
+		"bbb/layer.tar": "app layer content",
+	}
+	manifest := `[{"Config":"cfg123.json","RepoTags":["example/backend:abc"],"Layers":["aaa/layer.tar","ccc/layer.tar"]}]`
+
+	tarballPath := filepath.Join(dir, "image.tar")
+	out, err := os.Create(tarballPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	writer := tar.NewWriter(out)
+	for name, content := range files {
+		writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		writer.Write([]byte(content))
+	}
+	writer.WriteHeader(&tar.Header{Name: "ccc/layer.tar", Linkname: "../bbb/layer.tar", Typeflag: tar.TypeSymlink})
+	writer.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(manifest)), Typeflag: tar.TypeReg})
+	writer.Write([]byte(manifest))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	digests := map[string]string{}
+	for name, content := range files {
+		sum := sha256.Sum256([]byte(content))
+		digests[name] = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return tarballPath, digests
+}
+
+func TestReadImageLayout(t *testing.T) {
+	tarballPath, digests := writeTestTarball(t, t.TempDir())
+
+	layout, err := readImageLayout(tarballPath)
+	if err != nil {
+		t.Fatalf("readImageLayout() unexpected error: %v", err)
+	}
+
+	if layout.Config.Digest != digests["cfg123.json"] {
+		t.Errorf("Config.Digest = %s, want %s", layout.Config.Digest, digests["cfg123.json"])
+	}
+	if len(layout.Layers) != 2 {
+		t.Fatalf("len(Layers) = %d, want 2", len(layout.Layers))
+	}
+	if layout.Layers[0].Digest != digests["aaa/layer.tar"] {
+		t.Errorf("Layers[0].Digest = %s, want %s", layout.Layers[0].Digest, digests["aaa/layer.tar"])
+	}
+	if layout.Layers[1].Digest != digests["bbb/layer.tar"] {
+		t.Errorf("symlinked Layers[1].Digest = %s, want %s", layout.Layers[1].Digest, digests["bbb/layer.tar"])
+	}
+}
+
+func TestImageLayoutForShared(t *testing.T) {
+	tarballPath, _ := writeTestTarball(t, t.TempDir())
+	d := quietDistributor()
+
+	layouts := make([]*imageLayout, 8)
+	var wg sync.WaitGroup
+	for i := range layouts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			layout, err := d.imageLayoutFor(tarballPath)
+			if err != nil {
+				t.Errorf("imageLayoutFor() error = %v", err)
+			}
+			layouts[i] = layout
+		}(i)
+	}
+	wg.Wait()
+
+	for _, layout := range layouts {
+		if layout != layouts[0] {
+			t.Fatal("imageLayoutFor() read the same tarball more than once")
+		}
+	}
+	if len(d.reading) != 0 {
+		t.Errorf("reading = %v, want empty after all calls", d.reading)
+	}
+}
+
+func TestWriteDeltaArchive(t *testing.T) {
+	dir := t.TempDir()
+	tarballPath, digests := writeTestTarball(t, dir)
+
+	layout, err := readImageLayout(tarballPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := planDelta(layout, map[string]bool{digests["aaa/layer.tar"]: true})
+	if plan.Reused != 1 || len(plan.Missing) != 1 {
+		t.Fatalf("planDelta() reused=%d missing=%d, want 1 and 1", plan.Reused, len(plan.Missing))
+	}
+	if len(plan.Pinned) != 1 || plan.Pinned[0] != digests["aaa/layer.tar"] {
+		t.Errorf("planDelta() pinned = %v, want the present layer", plan.Pinned)
+	}
+
+	deltaPath := filepath.Join(dir, "delta.tar")
+	if err := writeDeltaArchive(tarballPath, deltaPath, "example/backend:abc", plan); err != nil {
+		t.Fatalf("writeDeltaArchive() unexpected error: %v", err)
+	}
+
+	file, err := os.Open(deltaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	members := map[string][]byte{}
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(reader)
+		members[header.Name] = data
+	}
+
+	if _, ok := members[blobPath(digests["aaa/layer.tar"])]; ok {
+		t.Error("delta archive contains a layer already present on the worker")
+	}
+	if _, ok := members[blobPath(digests["bbb/layer.tar"])]; !ok {
+		t.Error("delta archive is missing the app layer")
+	}
+	if _, ok := members[blobPath(digests["cfg123.json"])]; !ok {
+		t.Error("delta archive is missing the image config")
+	}
+
+	var index struct {
+		Manifests []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(members["index.json"], &index); err != nil {
+		t.Fatalf("cannot parse index.json: %v", err)
+	}
+	if len(index.Manifests) != 1 {
+		t.Fatalf("index.json has %d manifests, want 1", len(index.Manifests))
+	}
+	if got := index.Manifests[0].Annotations["io.containerd.image.name"]; got != "example/backend:abc" {
+		t.Errorf("image name annotation = %s, want example/backend:abc", got)
+	}
+	if _, ok := members[blobPath(index.Manifests[0].Digest)]; !ok {
+		t.Error("delta archive is missing the manifest blob")
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	tests := map[string]string{
+		"crepo.re-cloud.io/magnetiq/v2/backend:abc123": "abc123",
+		"localhost:5000/backend":                       "latest",
+		"backend":                                      "latest",
+	}
+	for imageName, want := range tests {
+		if got := imageTag(imageName); got != want {
+			t.Errorf("imageTag(%q) = %s, want %s", imageName, got, want)
+		}
+	}
+}
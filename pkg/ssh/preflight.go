@@ -0,0 +1,200 @@
+package ssh
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/constants"
+	"github.com/wapsol/m2deploy/pkg/containerd"
+)
+
+// containerdRoots lists where containerd keeps its content, k0s first
+var containerdRoots = []string{"/var/lib/k0s/containerd", "/var/lib/rancher/k3s/agent/containerd", "/var/lib/containerd"}
+
+// PreflightResult holds what a worker reported before any transfer
+type PreflightResult struct {
+	Worker     *WorkerNode
+	TempDir    string
+	TempFree   int64 // Bytes free in TempDir (-1 = unknown)
+	RootDir    string
+	RootFree   int64  // Bytes free in the containerd root (-1 = unknown)
+	Runtime    string // Container runtime used for the worker
+	CtrError   string
+	Namespace  string
+	Namespaces []string // Containerd namespaces on the worker
+	ClockSkew  time.Duration
+	Err        error // Worker could not be checked at all
+}
+
+// Problems returns the failures and warnings for a transfer of requiredBytes
+func (r *PreflightResult) Problems(requiredBytes int64) (failures, warnings []string) {
+	if r.Err != nil {
+		return []string{fmt.Sprintf("unreachable: %v", r.Err)}, nil
+	}
+
+	if r.CtrError != "" {
+		failures = append(failures, fmt.Sprintf("ctr not usable without a password prompt: %s", r.CtrError))
+	}
+
+	switch {
+	case r.TempFree < 0:
+		warnings = append(warnings, fmt.Sprintf("cannot read free space in %s", r.TempDir))
+	case r.TempFree < requiredBytes:
+		failures = append(failures, fmt.Sprintf("%s has %s free, %s needed", r.TempDir, formatBytes(r.TempFree), formatBytes(requiredBytes)))
+	}
+
+	switch {
+	case r.RootDir == "":
+		warnings = append(warnings, "containerd root not found")
+	case r.RootFree < 0:
+		warnings = append(warnings, fmt.Sprintf("cannot read free space in %s", r.RootDir))
+	case r.RootFree < requiredBytes:
+		failures = append(failures, fmt.Sprintf("%s has %s free, %s needed", r.RootDir, formatBytes(r.RootFree), formatBytes(requiredBytes)))
+	}
+
+	if r.CtrError == "" && !containsString(r.Namespaces, r.Namespace) {
+		warnings = append(warnings, fmt.Sprintf("containerd namespace %s does not exist yet (kubelet may use another namespace)", r.Namespace))
+	}
+
+	if skew := r.ClockSkew.Abs(); skew > constants.MaxWorkerClockSkew {
+		warnings = append(warnings, fmt.Sprintf("clock differs from the controller by %s", skew.Round(time.Second)))
+	}
+
+	return failures, warnings
+}
+
+// Summary describes the worker's state in one line
+func (r *PreflightResult) Summary() string {
+	return fmt.Sprintf("%s, %s free in %s, %s free in %s, clock skew %s",
+		r.Runtime, formatBytes(r.TempFree), r.TempDir, formatBytes(r.RootFree), r.RootDir, r.ClockSkew.Round(time.Second))
+}
+
+// Preflight checks every worker in parallel before any transfer: the
+// container runtime (detected unless configured), free space in the temp dir
+// and the containerd root, non-interactive ctr access, the containerd
+// namespace, and clock skew against this host
+func (d *Distributor) Preflight(workers []*WorkerNode) []*PreflightResult {
+	results := make([]*PreflightResult, len(workers))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(d.Parallel, 1))
+
+	for i, worker := range workers {
+		wg.Add(1)
+		go func(idx int, w *WorkerNode) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[idx] = d.preflightWorker(w)
+		}(i, worker)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// preflightWorker runs the preflight script on one worker
+func (d *Distributor) preflightWorker(worker *WorkerNode) *PreflightResult {
+	runtime, err := d.runtime(worker)
+	if err != nil {
+		return &PreflightResult{Worker: worker, Err: err}
+	}
+	start := time.Now()
+	output, err := d.sshExec(worker, d.preflightScript(worker, runtime))
+	end := time.Now()
+
+	if err != nil {
+		return &PreflightResult{Worker: worker, Err: err}
+	}
+
+	result := parsePreflight(output, start.Add(end.Sub(start)/2))
+	result.Worker = worker
+	result.Runtime = runtime.String()
+	result.TempDir = d.tempDir(worker)
+	result.Namespace = namespace(worker)
+	d.Logger.Debug("  [%s] preflight: %s", worker.Name, result.Summary())
+	return result
+}
+
+// preflightScript prints key=value lines parsed by parsePreflight
+func (d *Distributor) preflightScript(worker *WorkerNode, runtime *containerd.Runtime) string {
+	sudo := "sudo -n "
+	if worker.NoSudo {
+		sudo = ""
+	}
+
+	return fmt.Sprintf(`echo "tmp_free=$(df -Pk %[1]s 2>/dev/null | awk 'NR==2{print $4}')"
+for dir in %[2]s; do
+  if [ -d "$dir" ]; then echo "root=$dir"; echo "root_free=$(df -Pk "$dir" 2>/dev/null | awk 'NR==2{print $4}')"; break; fi
+done
+out=$(%[3]s%[4]s 2>&1) || echo "ctr_error=$(echo "$out" | tail -n 1)"
+echo "namespaces=$(%[3]s%[5]s 2>/dev/null | tr '\n' ' ')"
+echo "time=$(date +%%s)"`,
+		d.tempDir(worker), strings.Join(containerdRoots, " "), sudo, strings.Join(runtime.CtrArgs("version"), " "), strings.Join(runtime.CtrArgs("namespaces list -q"), " "))
+}
+
+// parsePreflight parses the preflight script output; localTime is when the
+// worker's clock was read, as seen from this host
+func parsePreflight(output string, localTime time.Time) *PreflightResult {
+	result := &PreflightResult{TempFree: -1, RootFree: -1}
+
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "tmp_free":
+			result.TempFree = parseKilobytes(value)
+		case "root":
+			result.RootDir = value
+		case "root_free":
+			result.RootFree = parseKilobytes(value)
+		case "ctr_error":
+			result.CtrError = value
+			if result.CtrError == "" {
+				result.CtrError = "ctr version failed"
+			}
+		case "namespaces":
+			result.Namespaces = strings.Fields(value)
+		case "time":
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+				result.ClockSkew = time.Unix(seconds, 0).Sub(localTime.Truncate(time.Second))
+			}
+		}
+	}
+
+	return result
+}
+
+// parseKilobytes converts a df kilobyte count to bytes (-1 if unparsable)
+func parseKilobytes(value string) int64 {
+	kb, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return kb * 1024
+}
+
+// formatBytes renders a byte count for messages
+func formatBytes(n int64) string {
+	if n < 0 {
+		return "unknown"
+	}
+	if n >= 1024*1024*1024 {
+		return fmt.Sprintf("%.1f GB", float64(n)/1024/1024/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/1024/1024)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package ssh
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/containerd"
+)
+
+func TestParsePreflight(t *testing.T) {
+	local := time.Unix(1700000000, 0)
+	output := `tmp_free=2097152
+root=/var/lib/k0s/containerd
+root_free=10485760
+namespaces=default k8s.io 
+time=1700000045`
+
+	result := parsePreflight(output, local)
+	if result.TempFree != 2*1024*1024*1024 || result.RootFree != 10*1024*1024*1024 {
+		t.Errorf("free space = %d, %d", result.TempFree, result.RootFree)
+	}
+	if result.RootDir != "/var/lib/k0s/containerd" || result.CtrError != "" {
+		t.Errorf("result = %+v", result)
+	}
+	if len(result.Namespaces) != 2 || result.Namespaces[1] != "k8s.io" {
+		t.Errorf("namespaces = %v", result.Namespaces)
+	}
+	if result.ClockSkew != 45*time.Second {
+		t.Errorf("clock skew = %s, want 45s", result.ClockSkew)
+	}
+
+	result = parsePreflight("tmp_free=\nctr_error=sudo: a password is required\n", local)
+	if result.TempFree != -1 || result.RootFree != -1 || result.CtrError != "sudo: a password is required" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestPreflightProblems(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	healthy := PreflightResult{
+		Worker:     &WorkerNode{Name: "worker-1"},
+		TempDir:    "/tmp",
+		TempFree:   5 * gb,
+		RootDir:    "/var/lib/containerd",
+		RootFree:   20 * gb,
+		Namespace:  "k8s.io",
+		Namespaces: []string{"k8s.io"},
+		ClockSkew:  2 * time.Second,
+	}
+
+	if failures, warnings := healthy.Problems(1 * gb); len(failures) != 0 || len(warnings) != 0 {
+		t.Errorf("healthy worker: failures %v, warnings %v", failures, warnings)
+	}
+
+	full := healthy
+	full.TempFree = gb / 2
+	full.CtrError = "sudo: a password is required"
+	failures, _ := full.Problems(1 * gb)
+	if len(failures) != 2 || !strings.Contains(failures[1], "/tmp has 512.0 MB free") {
+		t.Errorf("full worker failures = %v", failures)
+	}
+
+	skewed := healthy
+	skewed.ClockSkew = -2 * time.Minute
+	skewed.Namespaces = []string{"default"}
+	failures, warnings := skewed.Problems(1 * gb)
+	if len(failures) != 0 || len(warnings) != 2 {
+		t.Errorf("skewed worker: failures %v, warnings %v", failures, warnings)
+	}
+}
+
+func TestRuntimeDetectionFailure(t *testing.T) {
+	d := quietDistributor()
+	d.SSHConfig = &Config{KeyPath: filepath.Join(t.TempDir(), "missing"), Timeout: 1}
+	worker := &WorkerNode{Name: "worker-1", IP: "127.0.0.1"}
+
+	// Without a socket the import must not guess another containerd
+	if _, err := d.runtime(worker); err == nil || !strings.Contains(err.Error(), "--containerd-socket") {
+		t.Errorf("runtime() error = %v, want a detection failure naming --containerd-socket", err)
+	}
+	if _, err := d.ctrCommand(worker, "images list"); err == nil {
+		t.Error("ctrCommand() built a command without a runtime")
+	}
+
+	d.Socket = "/run/k3s/containerd/containerd.sock"
+	runtime, err := d.runtime(worker)
+	if err != nil || runtime.Kind != containerd.RuntimeCtr || runtime.Socket != d.Socket {
+		t.Errorf("runtime() with explicit socket = %v, %v, want ctr on it", runtime, err)
+	}
+}
@@ -0,0 +1,71 @@
+package ssh
+
+import (
+	"sync"
+
+	"github.com/wapsol/m2deploy/pkg/containerd"
+)
+
+// CheckPresence reports which workers already hold imageName with the digest
+// recorded in ImageDigests, keyed by worker name. Without a recorded digest no
+// worker counts as holding the image, since a name match may be stale. The
+// result is reused by the next DistributeToAllWorkers call for the image.
+func (d *Distributor) CheckPresence(workers []*WorkerNode, imageName string) map[string]bool {
+	present := d.checkPresence(workers, imageName)
+
+	d.presenceMu.Lock()
+	if d.presence == nil {
+		d.presence = make(map[string]map[string]bool)
+	}
+	d.presence[imageName] = present
+	d.presenceMu.Unlock()
+
+	return present
+}
+
+// takePresence returns the presence recorded by CheckPresence and forgets it,
+// checking the workers if nothing was recorded
+func (d *Distributor) takePresence(workers []*WorkerNode, imageName string) map[string]bool {
+	d.presenceMu.Lock()
+	present, ok := d.presence[imageName]
+	delete(d.presence, imageName)
+	d.presenceMu.Unlock()
+
+	if ok {
+		return present
+	}
+	return d.checkPresence(workers, imageName)
+}
+
+// checkPresence verifies the image on all workers, at most Parallel at a time
+func (d *Distributor) checkPresence(workers []*WorkerNode, imageName string) map[string]bool {
+	present := make(map[string]bool, len(workers))
+	digest := d.imageDigest(imageName)
+	if digest == "" {
+		return present
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(d.Parallel, 1))
+
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(w *WorkerNode) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if _, err := containerd.VerifyImage(d.ctrRunner(w), imageName, digest); err != nil {
+				d.Logger.Debug("  [%s] needs %s: %v", w.Name, imageName, err)
+				return
+			}
+			mu.Lock()
+			present[w.Name] = true
+			mu.Unlock()
+		}(worker)
+	}
+
+	wg.Wait()
+	return present
+}
@@ -0,0 +1,183 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/wapsol/m2deploy/pkg/config"
+	"github.com/wapsol/m2deploy/pkg/constants"
+)
+
+// progressEntry tracks one transfer to a worker
+type progressEntry struct {
+	label    string
+	total    int64
+	start    time.Time
+	done     atomic.Int64
+	skipped  atomic.Int64 // Bytes already on the worker, not sent
+	finished atomic.Int64 // Unix nanoseconds when the last byte was sent
+}
+
+// add records n more bytes sent; safe on a nil entry
+func (e *progressEntry) add(n int) {
+	if e == nil || n <= 0 {
+		return
+	}
+	if e.done.Add(int64(n)) >= e.total {
+		e.finished.CompareAndSwap(0, time.Now().UnixNano())
+	}
+}
+
+// skip records n bytes found on the worker from an earlier attempt
+func (e *progressEntry) skip(n int64) {
+	e.skipped.Add(n)
+	e.add(int(n))
+}
+
+// throughput returns bytes sent per second, up to now or until the last byte was sent
+func (e *progressEntry) throughput(now time.Time) float64 {
+	if finished := e.finished.Load(); finished != 0 {
+		now = time.Unix(0, finished)
+	}
+	elapsed := now.Sub(e.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(e.done.Load()-e.skipped.Load()) / elapsed
+}
+
+// line renders the entry, e.g. "[worker-1] backend  120.0/512.0 MB  23%  45.2 MB/s  ETA 9s"
+func (e *progressEntry) line(now time.Time) string {
+	done := e.done.Load()
+	percent := int64(100)
+	if e.total > 0 {
+		percent = done * 100 / e.total
+	}
+
+	rate := e.throughput(now)
+	eta := "--"
+	if rate > 0 {
+		eta = time.Duration(float64(e.total-done) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("%s  %.1f/%.1f MB  %d%%  %.1f MB/s  ETA %s",
+		e.label, float64(done)/1024/1024, float64(e.total)/1024/1024, percent, rate/1024/1024, eta)
+}
+
+// progressTracker shows the progress of running transfers, as a live block
+// on terminals and as periodic log lines otherwise
+type progressTracker struct {
+	logger   *config.Logger
+	tty      bool
+	interval time.Duration
+
+	mu      sync.Mutex
+	entries []*progressEntry
+	users   int
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newProgressTracker creates a tracker rendering for the current stdout
+func newProgressTracker(logger *config.Logger) *progressTracker {
+	tty := term.IsTerminal(int(os.Stdout.Fd()))
+	interval := constants.TransferProgressLogInterval
+	if tty {
+		interval = constants.TransferProgressRefresh
+	}
+	return &progressTracker{logger: logger, tty: tty, interval: interval}
+}
+
+// run starts rendering until the returned function is called. Nested calls
+// share one renderer, which stops when the last caller is done.
+func (t *progressTracker) run() func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.users++
+	if t.users == 1 {
+		t.stop = make(chan struct{})
+		t.stopped = make(chan struct{})
+		go t.loop(t.stop, t.stopped)
+	}
+
+	return func() {
+		t.mu.Lock()
+		t.users--
+		last := t.users == 0
+		stop, stopped := t.stop, t.stopped
+		t.mu.Unlock()
+
+		if last {
+			close(stop)
+			<-stopped
+		}
+	}
+}
+
+// begin registers a transfer of total bytes
+func (t *progressTracker) begin(label string, total int64) *progressEntry {
+	entry := &progressEntry{label: label, total: total, start: time.Now()}
+
+	t.mu.Lock()
+	t.entries = append(t.entries, entry)
+	t.mu.Unlock()
+	return entry
+}
+
+// end removes a finished transfer
+func (t *progressTracker) end(entry *progressEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, e := range t.entries {
+		if e == entry {
+			t.entries = append(t.entries[:i], t.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// loop renders at the tracker's interval until stop is closed
+func (t *progressTracker) loop(stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			if t.tty {
+				t.logger.SetStatus(nil)
+			}
+			return
+		case <-ticker.C:
+			t.render()
+		}
+	}
+}
+
+// render draws the running transfers
+func (t *progressTracker) render() {
+	now := time.Now()
+	t.mu.Lock()
+	lines := make([]string, 0, len(t.entries))
+	for _, entry := range t.entries {
+		lines = append(lines, entry.line(now))
+	}
+	t.mu.Unlock()
+
+	if t.tty {
+		t.logger.SetStatus(lines)
+		return
+	}
+	for _, line := range lines {
+		t.logger.Info("  %s", line)
+	}
+}
@@ -0,0 +1,126 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// meterBlockSize caps reads through a meteredReader so limits and progress stay smooth
+const meterBlockSize = 32 * 1024
+
+// ParseRate parses a transfer rate such as "50M", "500KB/s" or "1G" into bytes
+// per second. Units are powers of 1024; a plain number means MB/s. "" and "0"
+// mean unlimited.
+func ParseRate(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(s, "/S")
+	s = strings.TrimSuffix(s, "B")
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := float64(1024 * 1024)
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1024
+		s = s[:len(s)-1]
+	case 'M':
+		s = s[:len(s)-1]
+	case 'G':
+		multiplier = 1024 * 1024 * 1024
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid transfer rate %q (examples: 50M, 500K, 1G)", value)
+	}
+	return int64(n * multiplier), nil
+}
+
+// rateLimiter is a token bucket shared by all transfers it applies to.
+// A nil limiter does not limit.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter for bytesPerSec, or nil if it is not positive
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSec)
+	return &rateLimiter{
+		rate:  rate,
+		burst: max(rate/4, meterBlockSize),
+		last:  time.Now(),
+	}
+}
+
+// wait blocks until n more bytes may be sent. Concurrent callers each reserve
+// their bytes, so the combined rate stays within the limit.
+func (l *rateLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// meteredReader applies rate limits to a transfer and reports its progress
+type meteredReader struct {
+	r        io.Reader
+	limiters []*rateLimiter
+	progress *progressEntry
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	if len(p) > meterBlockSize {
+		p = p[:meterBlockSize]
+	}
+	n, err := m.r.Read(p)
+	for _, limiter := range m.limiters {
+		limiter.wait(n)
+	}
+	m.progress.add(n)
+	return n, err
+}
+
+// meter wraps r with the total and per-worker rate limits and progress reporting
+func (d *Distributor) meter(worker *WorkerNode, r io.Reader, progress *progressEntry) io.Reader {
+	d.limitMu.Lock()
+	defer d.limitMu.Unlock()
+
+	if d.totalLimiter == nil && d.RateLimit > 0 {
+		d.totalLimiter = newRateLimiter(d.RateLimit)
+	}
+	if d.workerLimiters == nil {
+		d.workerLimiters = make(map[string]*rateLimiter)
+	}
+	limiter, ok := d.workerLimiters[worker.Name]
+	if !ok {
+		limiter = newRateLimiter(d.WorkerRateLimit)
+		d.workerLimiters[worker.Name] = limiter
+	}
+
+	return &meteredReader{r: r, limiters: []*rateLimiter{d.totalLimiter, limiter}, progress: progress}
+}
@@ -0,0 +1,82 @@
+package ssh
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"50", 50 * 1024 * 1024},
+		{"50M", 50 * 1024 * 1024},
+		{"50MB/s", 50 * 1024 * 1024},
+		{"500k", 500 * 1024},
+		{"1.5G", 1536 * 1024 * 1024},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRate(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"fast", "-5M", "10X"} {
+		if _, err := ParseRate(value); err == nil {
+			t.Errorf("ParseRate(%q) accepted invalid rate", value)
+		}
+	}
+}
+
+func TestRateLimiterLimits(t *testing.T) {
+	// 1 MB at 4 MB/s takes about 250ms once the initial burst is used up
+	limiter := newRateLimiter(4 * 1024 * 1024)
+	reader := &meteredReader{r: bytes.NewReader(make([]byte, 1024*1024)), limiters: []*rateLimiter{limiter}}
+
+	start := time.Now()
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("limited copy took %s, want about 250ms", elapsed)
+	}
+}
+
+func TestRateLimiterNil(t *testing.T) {
+	var limiter *rateLimiter
+	limiter.wait(1 << 30) // Must not block
+	if newRateLimiter(0) != nil {
+		t.Error("newRateLimiter(0) should not limit")
+	}
+}
+
+func TestProgressEntry(t *testing.T) {
+	entry := &progressEntry{label: "[w1] backend", total: 100 * 1024 * 1024, start: time.Now().Add(-10 * time.Second)}
+	entry.skip(20 * 1024 * 1024)
+	entry.add(30 * 1024 * 1024)
+
+	// Only the 30 MB actually sent count towards throughput
+	if got := entry.throughput(time.Now()) / 1024 / 1024; got < 2.9 || got > 3.1 {
+		t.Errorf("throughput() = %.2f MB/s, want 3", got)
+	}
+
+	line := entry.line(time.Now())
+	for _, want := range []string{"[w1] backend", "50.0/100.0 MB", "50%", "ETA 17s"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("line() = %q, missing %q", line, want)
+		}
+	}
+
+	entry.add(50 * 1024 * 1024)
+	if entry.finished.Load() == 0 {
+		t.Error("entry not marked finished after the last byte")
+	}
+}
@@ -0,0 +1,176 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/constants"
+)
+
+// SCP protocol response codes sent by the remote 'scp -t' process
+const (
+	scpOK      = 0
+	scpWarning = 1
+	scpError   = 2
+)
+
+// scpToWorker copies file to worker using SCP
+// The SHA-256 of the local file is computed while sending and compared with
+// sha256sum on the worker, so corrupted or truncated transfers never reach import.
+// The copy is rate limited and reported to progress.
+func (d *Distributor) scpToWorker(worker *WorkerNode, localPath, remotePath string, progress *progressEntry) error {
+	// Get local file info
+	localInfo, err := os.Stat(localPath)
+	if err != nil {
+		return fmt.Errorf("cannot stat local file: %w", err)
+	}
+	localSize := localInfo.Size()
+
+	// Open local file
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("cannot open local file: %w", err)
+	}
+	defer localFile.Close()
+
+	// Establish SSH connection
+	client, err := d.getSSHClient(worker)
+	if err != nil {
+		return fmt.Errorf("SSH connection failed: %w", err)
+	}
+	defer client.Close()
+
+	// Open SCP session
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("cannot create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	// Set up pipes
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("cannot create stdin pipe: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("cannot create stdout pipe: %w", err)
+	}
+	acks := bufio.NewReader(stdout)
+
+	// Start SCP command
+	scpCmd := fmt.Sprintf("scp -t %s", remotePath)
+	if err := session.Start(scpCmd); err != nil {
+		return fmt.Errorf("cannot start SCP: %w", err)
+	}
+
+	// Remote scp acknowledges once it is ready to receive
+	if err := readSCPAck(acks); err != nil {
+		return fmt.Errorf("SCP not ready: %w", err)
+	}
+
+	// Send file via SCP protocol
+	// Format: C0644 <size> <filename>\n
+	filename := filepath.Base(remotePath)
+	if _, err := fmt.Fprintf(stdin, "C0644 %d %s\n", localSize, filename); err != nil {
+		return fmt.Errorf("cannot send SCP header: %w", err)
+	}
+	if err := readSCPAck(acks); err != nil {
+		return fmt.Errorf("SCP rejected file: %w", err)
+	}
+
+	// Copy file content, hashing as we go
+	hasher := sha256.New()
+	if _, err := io.Copy(stdin, io.TeeReader(d.meter(worker, localFile, progress), hasher)); err != nil {
+		// The remote side may have reported why it stopped reading
+		if ackErr := readSCPAck(acks); ackErr != nil {
+			return fmt.Errorf("file copy failed: %w", ackErr)
+		}
+		return fmt.Errorf("file copy failed: %w", err)
+	}
+	localSum := hex.EncodeToString(hasher.Sum(nil))
+
+	// Send termination byte and wait for the final acknowledgement
+	if _, err := fmt.Fprint(stdin, "\x00"); err != nil {
+		return fmt.Errorf("cannot finish SCP transfer: %w", err)
+	}
+	if err := readSCPAck(acks); err != nil {
+		return fmt.Errorf("SCP transfer failed: %w", err)
+	}
+	stdin.Close()
+
+	// Wait for completion
+	if err := session.Wait(); err != nil {
+		return fmt.Errorf("SCP session failed: %w", err)
+	}
+
+	// Verify remote checksum
+	remoteSum, err := d.remoteSHA256(worker, remotePath, localSize)
+	if err != nil {
+		return fmt.Errorf("cannot verify remote file: %w", err)
+	}
+	if remoteSum != localSum {
+		return fmt.Errorf("checksum mismatch: local=%s remote=%s", localSum[:12], remoteSum[:12])
+	}
+	d.Logger.Debug("  [%s] Checksum verified: sha256:%s", worker.Name, localSum[:12])
+
+	return nil
+}
+
+// remoteSHA256 returns the hex SHA-256 of a file of size bytes on the worker
+func (d *Distributor) remoteSHA256(worker *WorkerNode, remotePath string, size int64) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hashTimeout(size))
+	defer cancel()
+
+	output, err := d.sshExecWithContext(ctx, worker, fmt.Sprintf("sha256sum %s", remotePath))
+	if err != nil {
+		return "", err
+	}
+	return parseSHA256Sum(output)
+}
+
+// hashTimeout returns how long hashing size bytes on a worker may take; the
+// SSH timeout is meant for connecting and too short for large images
+func hashTimeout(size int64) time.Duration {
+	return constants.RemoteHashTimeout + time.Duration(size/constants.RemoteHashMinRate)*time.Second
+}
+
+// parseSHA256Sum extracts the hash from 'sha256sum' output ("<hex>  <path>")
+func parseSHA256Sum(output string) (string, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return "", fmt.Errorf("unexpected sha256sum output: %q", strings.TrimSpace(output))
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+// readSCPAck reads one SCP response: 0 means OK, 1 and 2 carry an error message
+// terminated by a newline (e.g. "scp: /tmp/x.tar: No space left on device")
+func readSCPAck(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("no response from remote scp: %w", err)
+	}
+
+	switch code {
+	case scpOK:
+		return nil
+	case scpWarning, scpError:
+		message, _ := r.ReadString('\n')
+		message = strings.TrimSpace(message)
+		if message == "" {
+			message = "unknown error"
+		}
+		return fmt.Errorf("remote scp: %s", message)
+	default:
+		return fmt.Errorf("unexpected SCP response byte 0x%02x", code)
+	}
+}
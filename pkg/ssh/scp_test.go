@@ -0,0 +1,81 @@
+package ssh
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wapsol/m2deploy/pkg/constants"
+)
+
+func TestReadSCPAck(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:  "ok",
+			input: "\x00",
+		},
+		{
+			name:    "fatal error with message",
+			input:   "\x02scp: /tmp/magnetiq-backend.tar: No space left on device\n",
+			wantErr: "No space left on device",
+		},
+		{
+			name:    "warning with message",
+			input:   "\x01scp: /tmp: Permission denied\n",
+			wantErr: "Permission denied",
+		},
+		{
+			name:    "closed stream",
+			input:   "",
+			wantErr: "no response",
+		},
+		{
+			name:    "unexpected byte",
+			input:   "C",
+			wantErr: "unexpected SCP response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := readSCPAck(bufio.NewReader(strings.NewReader(tt.input)))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("readSCPAck() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readSCPAck() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSHA256Sum(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+
+	got, err := parseSHA256Sum(sum + "  /tmp/magnetiq-backend.tar\n")
+	if err != nil || got != sum {
+		t.Errorf("parseSHA256Sum() = %q, %v, want %q", got, err, sum)
+	}
+
+	if _, err := parseSHA256Sum("sha256sum: /tmp/x: No such file or directory"); err == nil {
+		t.Error("parseSHA256Sum() expected error for invalid output, got nil")
+	}
+}
+
+func TestHashTimeout(t *testing.T) {
+	if got := hashTimeout(0); got != constants.RemoteHashTimeout {
+		t.Errorf("hashTimeout(0) = %s, want %s", got, constants.RemoteHashTimeout)
+	}
+	// A 2 GB image on a slow disk needs more than the base
+	if got := hashTimeout(2 << 30); got < constants.RemoteHashTimeout+3*time.Minute {
+		t.Errorf("hashTimeout(2 GB) = %s, too short", got)
+	}
+}
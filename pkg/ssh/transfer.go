@@ -0,0 +1,346 @@
+package ssh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// transferChunk is a byte range of a file sent in a single SSH session
+type transferChunk struct {
+	Offset int64
+	Length int64
+}
+
+// splitChunks divides a file of the given size into chunks of chunkSize bytes
+func splitChunks(size, chunkSize int64) []transferChunk {
+	if chunkSize <= 0 || chunkSize >= size {
+		return []transferChunk{{Offset: 0, Length: size}}
+	}
+
+	var chunks []transferChunk
+	for offset := int64(0); offset < size; offset += chunkSize {
+		length := chunkSize
+		if offset+length > size {
+			length = size - offset
+		}
+		chunks = append(chunks, transferChunk{Offset: offset, Length: length})
+	}
+	return chunks
+}
+
+// transferToWorker copies a file to the worker, resuming partial transfers
+// left behind by earlier attempts and optionally sending chunks in parallel.
+// Fresh single-stream transfers use SCP; resumed and chunked transfers write
+// byte ranges with dd. Every path ends with a SHA-256 comparison.
+// Returns the throughput of the copy in bytes per second.
+func (d *Distributor) transferToWorker(worker *WorkerNode, component, localPath, remotePath string) (float64, error) {
+	localInfo, err := os.Stat(localPath)
+	if err != nil {
+		return 0, fmt.Errorf("cannot stat local file: %w", err)
+	}
+	size := localInfo.Size()
+
+	progress := d.progress.begin(fmt.Sprintf("[%s] %s", worker.Name, component), size)
+	defer d.progress.end(progress)
+
+	if err := d.transferFile(worker, localPath, remotePath, size, progress); err != nil {
+		return 0, err
+	}
+	return progress.throughput(time.Now()), nil
+}
+
+// transferFile picks chunked, resumed or fresh transfer for a file of size bytes
+func (d *Distributor) transferFile(worker *WorkerNode, localPath, remotePath string, size int64, progress *progressEntry) error {
+	remoteSize := int64(-1)
+	if d.ResumeTransfers {
+		remoteSize = d.remoteFileSize(worker, remotePath)
+	}
+
+	if d.ChunkSize > 0 && size > d.ChunkSize {
+		return d.transferChunked(worker, localPath, remotePath, size, remoteSize, progress)
+	}
+
+	// Resume a single-stream transfer if the partial remote file is a valid prefix
+	if remoteSize > 0 && remoteSize <= size {
+		localPrefix, err := hashFileRange(localPath, 0, remoteSize)
+		if err != nil {
+			return err
+		}
+		remotePrefix, err := d.remoteRangeSHA256(worker, remotePath, 0, remoteSize)
+		if err == nil && remotePrefix == localPrefix {
+			progress.skip(remoteSize)
+			if remoteSize == size {
+				d.Logger.Info("  [%s] Complete file already on worker, skipping copy", worker.Name)
+			} else {
+				d.Logger.Info("  [%s] Resuming transfer at %.1f MB (%d%%)",
+					worker.Name, float64(remoteSize)/1024/1024, remoteSize*100/size)
+				if err := d.sendChunks(worker, localPath, remotePath, []transferChunk{{Offset: remoteSize, Length: size - remoteSize}}, progress); err != nil {
+					return err
+				}
+			}
+			return d.verifyRemoteChecksum(worker, localPath, remotePath)
+		}
+		d.Logger.Debug("  [%s] Partial remote file does not match, restarting transfer", worker.Name)
+	}
+
+	return d.scpToWorker(worker, localPath, remotePath, progress)
+}
+
+// transferChunked sends the chunks the worker does not already hold
+func (d *Distributor) transferChunked(worker *WorkerNode, localPath, remotePath string, size, remoteSize int64, progress *progressEntry) error {
+	chunks := splitChunks(size, d.ChunkSize)
+	pending := chunks
+
+	// Keep chunks that already arrived intact in an earlier attempt
+	if remoteSize > 0 {
+		pending = nil
+		for _, chunk := range chunks {
+			if chunk.Offset+chunk.Length <= remoteSize {
+				localSum, err := hashFileRange(localPath, chunk.Offset, chunk.Length)
+				if err != nil {
+					return err
+				}
+				remoteSum, err := d.remoteRangeSHA256(worker, remotePath, chunk.Offset, chunk.Length)
+				if err == nil && remoteSum == localSum {
+					progress.skip(chunk.Length)
+					continue
+				}
+			}
+			pending = append(pending, chunk)
+		}
+		if done := len(chunks) - len(pending); done > 0 {
+			d.Logger.Info("  [%s] Resuming transfer: %d/%d chunks already on worker", worker.Name, done, len(chunks))
+		}
+	} else {
+		// Start from an empty file so stale data never survives
+		if _, err := d.sshExec(worker, fmt.Sprintf(": > %s", remotePath)); err != nil {
+			return fmt.Errorf("cannot create remote file: %w", err)
+		}
+	}
+
+	if len(pending) > 0 {
+		d.Logger.Debug("  [%s] Sending %d chunks of %.1f MB (parallel: %d)",
+			worker.Name, len(pending), float64(d.ChunkSize)/1024/1024, d.chunkParallelism())
+		if err := d.sendChunks(worker, localPath, remotePath, pending, progress); err != nil {
+			return err
+		}
+	}
+
+	// Drop any bytes beyond the expected size left from a larger stale file
+	if remoteSize > size {
+		if _, err := d.sshExec(worker, fmt.Sprintf("truncate -s %d %s", size, remotePath)); err != nil {
+			return fmt.Errorf("cannot truncate remote file: %w", err)
+		}
+	}
+
+	return d.verifyRemoteChecksum(worker, localPath, remotePath)
+}
+
+// sendChunks writes byte ranges of the local file into the remote file.
+// All chunks share one SSH connection, each using its own session.
+func (d *Distributor) sendChunks(worker *WorkerNode, localPath, remotePath string, chunks []transferChunk, progress *progressEntry) error {
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("cannot open local file: %w", err)
+	}
+	defer localFile.Close()
+
+	client, err := d.getSSHClient(worker)
+	if err != nil {
+		return fmt.Errorf("SSH connection failed: %w", err)
+	}
+	defer client.Close()
+
+	sem := make(chan struct{}, d.chunkParallelism())
+	errs := make(chan error, len(chunks))
+	var wg sync.WaitGroup
+
+	for _, chunk := range chunks {
+		wg.Add(1)
+		go func(c transferChunk) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			data := d.meter(worker, io.NewSectionReader(localFile, c.Offset, c.Length), progress)
+			if err := sendRange(client, data, remotePath, c.Offset); err != nil {
+				errs <- fmt.Errorf("chunk at offset %d failed: %w", c.Offset, err)
+			}
+		}(chunk)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return err
+	}
+	return nil
+}
+
+// sendRange streams data into the remote file starting at offset
+func sendRange(client *ssh.Client, data io.Reader, remotePath string, offset int64) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("cannot create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("cannot create stdin pipe: %w", err)
+	}
+
+	var stderr strings.Builder
+	session.Stderr = &stderr
+
+	ddCmd := fmt.Sprintf("dd of=%s bs=1M seek=%d oflag=seek_bytes conv=notrunc status=none", remotePath, offset)
+	if err := session.Start(ddCmd); err != nil {
+		return fmt.Errorf("cannot start dd: %w", err)
+	}
+
+	if _, err := io.Copy(stdin, data); err != nil {
+		return fmt.Errorf("copy failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	stdin.Close()
+
+	if err := session.Wait(); err != nil {
+		return fmt.Errorf("remote write failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// verifyRemoteChecksum compares the SHA-256 of the whole local and remote files
+func (d *Distributor) verifyRemoteChecksum(worker *WorkerNode, localPath, remotePath string) error {
+	localSum, err := d.localSHA256(localPath)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return fmt.Errorf("cannot stat local file: %w", err)
+	}
+
+	remoteSum, err := d.remoteSHA256(worker, remotePath, info.Size())
+	if err != nil {
+		return fmt.Errorf("cannot verify remote file: %w", err)
+	}
+	if remoteSum != localSum {
+		return fmt.Errorf("checksum mismatch: local=%s remote=%s", localSum[:12], remoteSum[:12])
+	}
+
+	d.Logger.Debug("  [%s] Checksum verified: sha256:%s", worker.Name, localSum[:12])
+	return nil
+}
+
+// checksumCall is a local file being hashed; others needing its sum wait on done
+type checksumCall struct {
+	done chan struct{}
+	sum  string
+	err  error
+}
+
+// localSHA256 returns the hex SHA-256 of a local file, hashing each file only once.
+// Hashing runs without artifactsMu held; callers wanting the same sum wait for the first.
+func (d *Distributor) localSHA256(localPath string) (string, error) {
+	d.artifactsMu.Lock()
+	if sum, ok := d.checksums[localPath]; ok {
+		d.artifactsMu.Unlock()
+		return sum, nil
+	}
+	if call, ok := d.hashing[localPath]; ok {
+		d.artifactsMu.Unlock()
+		<-call.done
+		return call.sum, call.err
+	}
+	call := &checksumCall{done: make(chan struct{})}
+	if d.hashing == nil {
+		d.hashing = make(map[string]*checksumCall)
+	}
+	d.hashing[localPath] = call
+	d.artifactsMu.Unlock()
+
+	call.sum, call.err = hashLocalFile(localPath)
+
+	d.artifactsMu.Lock()
+	delete(d.hashing, localPath)
+	if call.err == nil {
+		if d.checksums == nil {
+			d.checksums = make(map[string]string)
+		}
+		d.checksums[localPath] = call.sum
+	}
+	d.artifactsMu.Unlock()
+	close(call.done)
+
+	return call.sum, call.err
+}
+
+// hashLocalFile returns the hex SHA-256 of a whole local file
+func hashLocalFile(localPath string) (string, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot stat local file: %w", err)
+	}
+	return hashFileRange(localPath, 0, info.Size())
+}
+
+// remoteFileSize returns the size of a file on the worker, or -1 if it does not exist
+func (d *Distributor) remoteFileSize(worker *WorkerNode, remotePath string) int64 {
+	output, err := d.sshExec(worker, fmt.Sprintf("stat -c%%s %s 2>/dev/null || echo -1", remotePath))
+	if err != nil {
+		return -1
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// remoteRangeSHA256 returns the hex SHA-256 of a byte range of a file on the worker
+func (d *Distributor) remoteRangeSHA256(worker *WorkerNode, remotePath string, offset, length int64) (string, error) {
+	hashCmd := fmt.Sprintf("dd if=%s bs=1M skip=%d count=%d iflag=skip_bytes,count_bytes status=none | sha256sum",
+		remotePath, offset, length)
+	ctx, cancel := context.WithTimeout(context.Background(), hashTimeout(length))
+	defer cancel()
+
+	output, err := d.sshExecWithContext(ctx, worker, hashCmd)
+	if err != nil {
+		return "", err
+	}
+	return parseSHA256Sum(output)
+}
+
+// chunkParallelism returns how many chunks may be sent at once
+func (d *Distributor) chunkParallelism() int {
+	if d.ChunkParallel < 1 {
+		return 1
+	}
+	return d.ChunkParallel
+}
+
+// hashFileRange returns the hex SHA-256 of a byte range of a local file
+func hashFileRange(path string, offset, length int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot open local file: %w", err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, io.NewSectionReader(file, offset, length)); err != nil {
+		return "", fmt.Errorf("cannot hash local file: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
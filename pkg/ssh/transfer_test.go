@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int64
+		chunkSize int64
+		want      []transferChunk
+	}{
+		{
+			name:      "single stream",
+			size:      100,
+			chunkSize: 0,
+			want:      []transferChunk{{Offset: 0, Length: 100}},
+		},
+		{
+			name:      "chunk larger than file",
+			size:      100,
+			chunkSize: 200,
+			want:      []transferChunk{{Offset: 0, Length: 100}},
+		},
+		{
+			name:      "even split",
+			size:      100,
+			chunkSize: 50,
+			want:      []transferChunk{{Offset: 0, Length: 50}, {Offset: 50, Length: 50}},
+		},
+		{
+			name:      "short last chunk",
+			size:      100,
+			chunkSize: 40,
+			want:      []transferChunk{{Offset: 0, Length: 40}, {Offset: 40, Length: 40}, {Offset: 80, Length: 20}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitChunks(tt.size, tt.chunkSize)
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitChunks() returned %d chunks, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("chunk %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHashFileRange(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	path := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := hashFileRange(path, 5, 10)
+	if err != nil {
+		t.Fatalf("hashFileRange() error = %v", err)
+	}
+
+	sum := sha256.Sum256(data[5:15])
+	if want := hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("hashFileRange() = %s, want %s", got, want)
+	}
+}
+
+func TestLocalSHA256Shared(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	path := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := quietDistributor()
+	sum := sha256.Sum256(data)
+	want := hex.EncodeToString(sum[:])
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := d.localSHA256(path); err != nil || got != want {
+				t.Errorf("localSHA256() = %s, %v, want %s", got, err, want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(d.hashing) != 0 {
+		t.Errorf("hashing = %v, want empty after all calls", d.hashing)
+	}
+	if d.checksums[path] != want {
+		t.Errorf("checksums[%s] = %s, want %s", path, d.checksums[path], want)
+	}
+}
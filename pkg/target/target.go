@@ -0,0 +1,189 @@
+package target
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Strategies for deploying to several targets
+const (
+	StrategySequential = "sequential" // One after another, stopping at the first failure
+	StrategyParallel   = "parallel"   // All at once, each to completion
+)
+
+// Strategies lists the supported --target-strategy values
+var Strategies = []string{StrategySequential, StrategyParallel}
+
+// Result statuses
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped" // Not touched: an earlier target failed
+)
+
+// Target is one cluster the application is deployed to. Empty fields fall
+// back to the command-line flags, except Workers: without them the workers
+// are discovered in the target's cluster.
+type Target struct {
+	Name         string `yaml:"-"`
+	Kubeconfig   string `yaml:"kubeconfig"`
+	Context      string `yaml:"context"`
+	Distribution string `yaml:"distribution"` // Kubernetes distribution (k0s, k3s, kubectl)
+	Namespace    string `yaml:"namespace"`
+	Workers      string `yaml:"workers"` // Comma-separated worker IPs
+	Inventory    string `yaml:"inventory"`
+	NodeSelector string `yaml:"nodeSelector"`
+}
+
+// File is the targets file: the clusters of an application by name
+type File struct {
+	Targets map[string]Target `yaml:"targets"`
+}
+
+// Result is the outcome of one target
+type Result struct {
+	Target   string
+	Status   string
+	Error    error
+	Duration time.Duration
+}
+
+// Load reads a targets file
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read targets file: %w", err)
+	}
+
+	var file File
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid targets file %s: %w", path, err)
+	}
+	for name, t := range file.Targets {
+		t.Name = name
+		file.Targets[name] = t
+	}
+	return &file, nil
+}
+
+// Select returns the named targets in the given order
+func (f *File) Select(names []string) ([]Target, error) {
+	seen := make(map[string]bool)
+	var targets []Target
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		t, ok := f.Targets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown target %q (defined: %s)", name, strings.Join(f.names(), ", "))
+		}
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets selected")
+	}
+	return targets, nil
+}
+
+// names returns the defined target names, sorted
+func (f *File) names() []string {
+	names := make([]string, 0, len(f.Targets))
+	for name := range f.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateStrategy checks that strategy is a supported --target-strategy value
+func ValidateStrategy(strategy string) error {
+	for _, s := range Strategies {
+		if s == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported target strategy %q (supported: %v)", strategy, Strategies)
+}
+
+// Run runs fn for every target and returns one result per target, in order.
+// In parallel every target runs to completion whatever the others do.
+// Sequentially, the targets after a failure are skipped, so each cluster is
+// either done, failed or untouched.
+func Run(targets []Target, strategy string, fn func(Target) error) []Result {
+	results := make([]Result, len(targets))
+	run := func(i int) {
+		start := time.Now()
+		err := safeCall(fn, targets[i])
+		results[i] = Result{Target: targets[i].Name, Status: StatusSucceeded, Error: err, Duration: time.Since(start)}
+		if err != nil {
+			results[i].Status = StatusFailed
+		}
+	}
+
+	if strategy == StrategyParallel {
+		var wg sync.WaitGroup
+		for i := range targets {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+		return results
+	}
+
+	failed := false
+	for i := range targets {
+		if failed {
+			results[i] = Result{Target: targets[i].Name, Status: StatusSkipped}
+			continue
+		}
+		run(i)
+		failed = results[i].Status == StatusFailed
+	}
+	return results
+}
+
+// safeCall runs fn, turning a panic into an error so one target cannot take
+// the others down
+func safeCall(fn func(Target) error, t Target) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(t)
+}
+
+// Failed returns the number of failed results
+func Failed(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if r.Status == StatusFailed {
+			n++
+		}
+	}
+	return n
+}
+
+// Suffixed returns path with "-name" inserted before its extension, giving
+// each target its own copy of a state file
+func Suffixed(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
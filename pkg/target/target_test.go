@@ -0,0 +1,102 @@
+package target
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLoadAndSelect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	data := `targets:
+  eu:
+    kubeconfig: ~/.kube/eu.yaml
+    workers: 10.0.1.11,10.0.1.12
+  us:
+    context: us-prod
+    distribution: kubectl
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	targets, err := file.Select([]string{"us", "eu", "us"})
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if len(targets) != 2 || targets[0].Name != "us" || targets[1].Name != "eu" {
+		t.Fatalf("Select() = %+v, want us then eu", targets)
+	}
+	if targets[0].Context != "us-prod" || targets[1].Workers != "10.0.1.11,10.0.1.12" {
+		t.Errorf("targets = %+v", targets)
+	}
+
+	if _, err := file.Select([]string{"ap"}); err == nil {
+		t.Error("Select() expected error for an unknown target")
+	}
+}
+
+func TestLoadUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	if err := os.WriteFile(path, []byte("targets:\n  eu:\n    kubconfig: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load() expected error for a misspelled field")
+	}
+}
+
+func TestRunSequentialGate(t *testing.T) {
+	targets := []Target{{Name: "eu"}, {Name: "us"}, {Name: "ap"}}
+	var calls atomic.Int32
+	results := Run(targets, StrategySequential, func(tgt Target) error {
+		calls.Add(1)
+		if tgt.Name == "eu" {
+			return errors.New("rollout failed")
+		}
+		return nil
+	})
+
+	if calls.Load() != 1 {
+		t.Errorf("ran %d targets, want 1", calls.Load())
+	}
+	want := []string{StatusFailed, StatusSkipped, StatusSkipped}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("%s = %s, want %s", r.Target, r.Status, want[i])
+		}
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	targets := []Target{{Name: "eu"}, {Name: "us"}}
+	results := Run(targets, StrategyParallel, func(tgt Target) error {
+		if tgt.Name == "eu" {
+			panic("boom")
+		}
+		return nil
+	})
+
+	if results[0].Status != StatusFailed || results[0].Error == nil {
+		t.Errorf("eu = %+v, want failed", results[0])
+	}
+	if results[1].Status != StatusSucceeded {
+		t.Errorf("us = %+v, want succeeded despite eu failing", results[1])
+	}
+	if Failed(results) != 1 {
+		t.Errorf("Failed() = %d, want 1", Failed(results))
+	}
+}
+
+func TestSuffixed(t *testing.T) {
+	if got := Suffixed("/home/ops/.m2deploy/worker-health.json", "eu"); got != "/home/ops/.m2deploy/worker-health-eu.json" {
+		t.Errorf("Suffixed() = %s", got)
+	}
+}